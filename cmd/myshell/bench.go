@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"shell/pkg/parser"
+)
+
+// benchParse times parsing FILE, as for the hidden myshell --bench-parse
+// FILE, parsing it whole and line by line, and returns the exit status.
+// A file the parser rejects is reported instead.
+func benchParse(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: myshell --bench-parse FILE\n")
+		return 2
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "myshell: %v\n", err)
+		return 1
+	}
+	text := string(data)
+	if _, err := parser.Parse(text); err != nil {
+		fmt.Fprintf(os.Stderr, "myshell: %s: %v\n", args[0], err)
+		return 1
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	whole := testing.Benchmark(func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parser.Parse(text)
+		}
+	})
+	perLine := testing.Benchmark(func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, line := range lines {
+				parser.Parse(line)
+			}
+		}
+	})
+	fmt.Printf("%s: %d bytes, %d lines\n", args[0], len(text), len(lines))
+	fmt.Printf("whole   %s\t%s\n", whole, whole.MemString())
+	fmt.Printf("by line %s\t%s\n", perLine, perLine.MemString())
+	return 0
+}
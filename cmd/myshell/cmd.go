@@ -1,25 +1,206 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
 
 	"shell/internal/config"
+	"shell/internal/executor"
+	"shell/internal/plugin"
+	"shell/internal/script"
 	"shell/internal/shell"
+	"shell/internal/startup"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = ""
+
 func main() {
-	cfg, err := config.Load("config.yml")
+	executor.InitSandbox()
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--bench-parse" {
+		os.Exit(benchParse(os.Args[2:]))
+	}
+
+	var (
+		command    = flag.String("c", "", "run `command` and exit")
+		configFile = flag.String("config", "", "read the config from `file` instead of searching for one")
+		noRC       = flag.Bool("norc", false, "do not read a config file")
+		login      bool
+		xtrace     = flag.Bool("x", false, "print each command before running it")
+		errexit    = flag.Bool("e", false, "exit as soon as a command fails")
+		showVer    = flag.Bool("version", false, "print the version and exit")
+		profile    = flag.Bool("profile-startup", false, "print how long each step of the startup takes")
+	)
+	flag.BoolVar(&login, "l", false, "run as a login shell")
+	flag.BoolVar(&login, "login", false, "run as a login shell")
+	flag.Parse()
+
+	if *showVer {
+		fmt.Printf("myshell %s\n", buildVersion())
+		return
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding home directory: %v\n", err)
+		os.Exit(1)
+	}
+	tracker := startup.Begin(filepath.Join(config.DataDir(home), "startup.json"))
+	if *profile {
+		tracker.Profile(os.Stderr)
+	}
+
+	var cfg *config.Config
+	safeMode := tracker.SafeMode()
+	if safeMode {
+		culprit := tracker.Culprit()
+		fmt.Fprintf(os.Stderr, "The last %d startups failed", culprit.Failures)
+		if culprit.File != "" {
+			fmt.Fprintf(os.Stderr, " while loading %s %s", culprit.Phase, culprit.File)
+		}
+		fmt.Fprintln(os.Stderr, "; starting in safe mode with default settings and no plugins.")
+		cfg, err = config.Default()
+	} else if *noRC {
+		cfg, err = config.FromEnv()
+	} else {
+		cfg, err = loadConfig(*configFile, home, tracker)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
+	tracker.Step("shell", "")
 	s, err := shell.New(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing shell: %v\n", err)
 		os.Exit(1)
 	}
 
-	s.Run()
+	if *errexit {
+		s.SetOption(shell.OptionErrexit, true)
+	}
+	if *xtrace {
+		s.SetOption(shell.OptionXtrace, true)
+	}
+
+	if !safeMode {
+		// Plugins are loaded before the first command runs rather than
+		// now, as they can take a while.
+		s.LoadLater(func() {
+			loadPlugins(s, cfg, tracker)
+			tracker.Done()
+		})
+		loadScripts(s, cfg.ScriptsDir, tracker)
+	}
+	// A login shell is started with -l, or by login(1) with a name
+	// starting with '-'.
+	if login || strings.HasPrefix(filepath.Base(os.Args[0]), "-") {
+		s.Login()
+		if !safeMode {
+			profile := filepath.Join(cfg.HomeDir, shell.ProfileFile)
+			tracker.Step("profile", profile)
+			s.SourceIfExists(profile)
+		}
+	}
+	tracker.Done()
+
+	switch {
+	case *command != "":
+		// As in sh -c, the arguments after the command are $0 and on.
+		if flag.NArg() > 0 {
+			s.SetArgs(flag.Arg(0), flag.Args()[1:])
+		}
+		os.Exit(s.RunCommand(*command))
+	case flag.NArg() > 0:
+		s.SetArgs(flag.Arg(0), flag.Args()[1:])
+		os.Exit(s.RunScript(flag.Arg(0)))
+	}
+	os.Exit(s.Run())
+}
+
+// buildVersion returns the version set at build time, or else the module
+// version go install recorded.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// loadPlugins loads every plugin in the plugins directory and those the
+// config lists. A plugin that fails to load is reported and skipped so it
+// cannot keep the shell from starting.
+func loadPlugins(s *shell.Shell, cfg *config.Config, tracker *startup.Tracker) {
+	paths, err := plugin.Discover(cfg.PluginsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plugins: %v\n", err)
+	}
+	for _, name := range cfg.Plugins {
+		path := name
+		if !strings.ContainsRune(name, filepath.Separator) && !strings.ContainsRune(name, '/') {
+			path = filepath.Join(cfg.PluginsDir, name)
+		}
+		if !contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range paths {
+		tracker.Step("plugin", path)
+		if _, err := s.LoadPlugin(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading plugin %s: %v\n", path, err)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadScripts runs every Lua script in dir, reporting and skipping the
+// ones that fail.
+func loadScripts(s *shell.Shell, dir string, tracker *startup.Tracker) {
+	paths, err := script.Discover(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading scripts: %v\n", err)
+		return
+	}
+	for _, path := range paths {
+		tracker.Step("script", path)
+		if err := s.LoadScript(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading script %s: %v\n", path, err)
+		}
+	}
+}
+
+// loadConfig reads the config from file, or else from $MYSHELL_CONFIG or
+// the first config file found. Without a config file the defaults are
+// used. MYSHELL_* variables override settings either way.
+func loadConfig(file, home string, tracker *startup.Tracker) (*config.Config, error) {
+	if file == "" {
+		file = os.Getenv(config.EnvName("config"))
+	}
+	if file == "" {
+		var ok bool
+		if file, ok = config.Find(home); !ok {
+			return config.FromEnv()
+		}
+	}
+	tracker.Step("config", file)
+	return config.Load(file)
 }
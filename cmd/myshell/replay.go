@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"shell/internal/record"
+)
+
+// replay plays back a session recorded with the record builtin, as for
+// myshell replay [-speed N] [-idle DURATION] FILE, and returns the exit
+// status.
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := flags.Float64("speed", 1, "play back `n` times faster")
+	idle := flags.Duration("idle", 0, "cut pauses longer than `duration` short")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: myshell replay [-speed N] [-idle DURATION] FILE\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *speed <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "myshell: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	if err := record.Replay(f, os.Stdout, *speed, *idle); err != nil {
+		fmt.Fprintf(os.Stderr, "myshell: %s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	return 0
+}
@@ -3,8 +3,14 @@ module shell
 go 1.22.2
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/chzyer/readline v1.5.1
-	gopkg.in/yaml.v2 v2.4.0
+	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51
+	github.com/mattn/go-runewidth v0.0.16
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
+require github.com/rivo/uniseg v0.2.0 // indirect
@@ -0,0 +1,28 @@
+// Package cdpath looks cd targets up in CDPATH, for both shells.
+package cdpath
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolve looks a relative cd target up in the colon-separated cdpath.
+// It reports whether a CDPATH entry was used, in which case the new
+// directory is printed like other shells do.
+func Resolve(target, cdpath string) (string, bool) {
+	if cdpath == "" || filepath.IsAbs(target) || target == "." || target == ".." ||
+		strings.HasPrefix(target, "./") || strings.HasPrefix(target, "../") {
+		return target, false
+	}
+	for _, entry := range filepath.SplitList(cdpath) {
+		if entry == "" {
+			entry = "."
+		}
+		candidate := filepath.Join(entry, target)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, entry != "."
+		}
+	}
+	return target, false
+}
@@ -1,38 +1,472 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
-
-	"gopkg.in/yaml.v2"
+	"strconv"
+	"time"
 )
 
 type Config struct {
+	// Path is the file the config was read from, if any.
+	Path string `yaml:"-"`
+
 	HistoryFile string `yaml:"history_file"`
 	HomeDir     string `yaml:"home_dir"`
+
+	// BookmarksFile keeps the directories saved with bookmark add, for
+	// cd ~name and cd @name.
+	BookmarksFile string `yaml:"bookmarks_file"`
+
+	// NoHistoryExpansion turns off bash-style !! and !n references.
+	NoHistoryExpansion bool `yaml:"no_history_expansion"`
+
+	History HistoryConfig `yaml:"history"`
+
+	// ScreenReader avoids line redraws and decorative characters so the
+	// shell reads well through a terminal screen reader.
+	ScreenReader bool `yaml:"screen_reader"`
+
+	// HupOnExit sends SIGHUP to running background jobs when the shell
+	// exits, as bash's huponexit does. They always get it when the shell
+	// itself is hung up.
+	HupOnExit bool `yaml:"huponexit"`
+
+	// Hooks are commands run at zsh's hook points.
+	Hooks HooksConfig `yaml:"hooks"`
+
+	// CommandTimeout kills external commands that run for longer, as
+	// "30s" or "5m"; empty or "0" means no limit. The timeout builtin
+	// sets one for a single command.
+	CommandTimeout string `yaml:"command_timeout"`
+
+	// ReportTime reports the duration and exit status of commands that
+	// run for longer, as zsh's REPORTTIME does. The report goes in the
+	// prompt's {duration} field if it has one, or on a line of its own.
+	ReportTime string `yaml:"report_time"`
+
+	Aliases map[string]string `yaml:"aliases"`
+
+	// SuffixAliases open files by extension, like zsh's alias -s: with
+	// "py: python3", typing script.py runs python3 script.py.
+	SuffixAliases map[string]string `yaml:"suffix_aliases"`
+
+	// AutoCD makes a directory name typed as a command cd into it.
+	AutoCD bool `yaml:"autocd"`
+
+	// Correct offers to correct misspelt commands and cd targets at the
+	// prompt, as zsh's correct option does.
+	Correct bool `yaml:"correct"`
+
+	// Env is exported at startup. Values may refer to other variables,
+	// as in "PATH: $HOME/bin:$PATH".
+	Env map[string]string `yaml:"env"`
+
+	// Prompt is the prompt format, with PromptFields in braces, e.g.
+	// "{user}@{host} {dir} > ".
+	Prompt string `yaml:"prompt"`
+
+	// Theme draws the prompt from segments instead, in one of Themes'
+	// styles; "" or "none" uses Prompt. ThemeSegments chooses the
+	// segments, in order, in place of the theme's own: PromptFields and
+	// those plugins add.
+	Theme         string   `yaml:"theme"`
+	ThemeSegments []string `yaml:"theme_segments"`
+
+	// PromptWait is how long the prompt waits for its slow fields, such
+	// as {git} and the segments plugins provide, which are computed in
+	// the background, before it is shown without them; it is drawn again
+	// once they are ready. The default is 50ms.
+	PromptWait string `yaml:"prompt_wait"`
+
+	// EditingMode is "emacs" (the default) or "vi" for the line editor's
+	// keys, as set -o emacs and set -o vi choose.
+	EditingMode string `yaml:"editing_mode"`
+
+	// LineEditor is "native" (the default) for the shell's own line
+	// editor, or "readline" for the older chzyer/readline one.
+	LineEditor string `yaml:"line_editor"`
+
+	// Keybindings binds keys such as "ctrl-o" to actions, line editor
+	// functions or macros (see CheckBinding), on top of
+	// DefaultKeybindings.
+	Keybindings map[string]string `yaml:"keybindings"`
+
+	// PluginsDir is scanned for .so plugins at startup.
+	PluginsDir string `yaml:"plugins_dir"`
+
+	// Plugins lists more plugins to load at startup, as paths or as
+	// names of files in PluginsDir.
+	Plugins []string `yaml:"plugins"`
+
+	// ScriptsDir is scanned for Lua scripts at startup.
+	ScriptsDir string `yaml:"scripts_dir"`
+
+	Glob GlobConfig `yaml:"glob"`
+
+	Sandbox SandboxConfig `yaml:"sandbox"`
+
+	CaptureOutput CaptureConfig `yaml:"capture_output"`
+
+	Jobs JobsConfig `yaml:"jobs"`
+
+	Notify NotifyConfig `yaml:"notify"`
+
+	DirEnv DirEnvConfig `yaml:"dir_env"`
+
+	Terminal TerminalConfig `yaml:"terminal"`
+
+	Clipboard ClipboardConfig `yaml:"clipboard"`
+
+	// Pager shows the output of history, jobs, env and help when it is
+	// longer than the terminal: a command such as "less -R", "internal"
+	// for the shell's own pager, or "none" for no pager. Empty, the
+	// default, uses $PAGER, or else the shell's own.
+	Pager string `yaml:"pager"`
+
+	// FuzzyFinder is a fuzzy finder, such as "fzf" or "fzf --height
+	// 40%", for Ctrl+R to search the history with and Ctrl+T to pick
+	// files with. Where it is not installed, or by default, the shell's
+	// own search and completion menu do instead.
+	FuzzyFinder string `yaml:"fuzzy_finder"`
+
+	Completion CompletionConfig `yaml:"completion"`
+
+	// fromEnv maps the settings set by MYSHELL_* variables to the
+	// variable, so problems with them are reported against it.
+	fromEnv map[string]string
+}
+
+// HistoryConfig chooses where the history is kept and which commands go
+// into it.
+type HistoryConfig struct {
+	// Backend is "file" (the default) for a bash-style history_file, or
+	// "sqlite" for a database that also records each command's directory,
+	// exit code and duration.
+	Backend  string `yaml:"backend"`
+	Database string `yaml:"database"`
+
+	// Size is how many commands the history keeps, 1000 by default. The
+	// line editor's arrow keys recall the newest 1000 of them, and Ctrl+R
+	// searches them all.
+	Size int `yaml:"size"`
+	// Sync is when the file backend writes commands to the history
+	// file: "write" (the default) as each is run, "fsync" also waiting
+	// for the disk, or "exit" only when the shell exits, or 100 have
+	// piled up.
+	Sync string `yaml:"sync"`
+
+	IgnoreDups  bool     `yaml:"ignore_dups"`
+	IgnoreSpace bool     `yaml:"ignore_space"`
+	Ignore      []string `yaml:"ignore"`
+
+	// Secrets is "redact" (the default), "skip" or "keep": what to do
+	// with commands matching one of SecretPatterns, which default to
+	// common tokens, keys and password flags.
+	Secrets        string   `yaml:"secrets"`
+	SecretPatterns []string `yaml:"secret_patterns"`
+
+	// Project also keeps a history per project, keyed by the root of
+	// the git repository a command runs in, under ProjectDir. Ctrl+R
+	// then searches the project's history first.
+	Project    bool   `yaml:"project"`
+	ProjectDir string `yaml:"project_dir"`
+}
+
+// GlobConfig limits how much of the file system a pattern such as
+// **/*.go may search, and orders what it matches.
+type GlobConfig struct {
+	// MaxDepth is how many directories deep ** descends; 0, the
+	// default, means no limit.
+	MaxDepth int `yaml:"max_depth"`
+	// MaxEntries is how many directory entries a pattern may read
+	// before it fails, so that ** at / does not run for minutes; it
+	// defaults to 100000, and -1 means no limit.
+	MaxEntries int `yaml:"max_entries"`
+	// Sort is "name" (the default) to sort matches by name, or "mtime"
+	// for the most recently modified first.
+	Sort string `yaml:"sort"`
+}
+
+// SandboxConfig sets up the sandbox the sandbox builtin runs commands
+// in, and names commands that always run in one.
+type SandboxConfig struct {
+	// Network leaves the network reachable from the sandbox.
+	Network bool `yaml:"network"`
+	// Writable are paths left writable, which may refer to variables
+	// as in "$HOME/scratch".
+	Writable []string `yaml:"writable"`
+	// Commands always run sandboxed, e.g. "curl" or "npx".
+	Commands []string `yaml:"commands"`
+}
+
+// CaptureConfig keeps what external commands write to the terminal, for
+// $OUTPUT, $STDERR and the output builtin.
+type CaptureConfig struct {
+	// Keep is how many command lines' output to keep; 0, the default,
+	// keeps none.
+	Keep int `yaml:"keep"`
+	// Exclude are commands whose output is not kept, as it is not
+	// worth keeping or they need the terminal itself. It defaults to
+	// editors, pagers and other full-screen programs.
+	Exclude []string `yaml:"exclude"`
+}
+
+// JobsConfig decides what becomes of the output of background jobs that
+// was not redirected, which the joblog builtin shows.
+type JobsConfig struct {
+	// Output is "log" (the default) to write each job's output to a
+	// file of its own in LogDir, "memory" to keep the last 64 KiB of it
+	// in memory, or "discard" to drop it.
+	Output string `yaml:"output"`
+	// LogDir defaults to jobs in the data directory.
+	LogDir string `yaml:"log_dir"`
+}
+
+// NotifyConfig asks for a notification when a command or background job
+// that ran a long time finishes while the terminal window may not have
+// the focus.
+type NotifyConfig struct {
+	// After is how long a command must run to be notified of, as for
+	// command_timeout; empty, the default, means never.
+	After string `yaml:"after"`
+	// Method is "osc9" (the default) or "osc777" for a desktop
+	// notification sent through the terminal with that escape sequence,
+	// "bell" to ring the terminal bell, or "none" to leave it to
+	// notifier plugins.
+	Method string `yaml:"method"`
+}
+
+// TerminalConfig chooses what the shell tells the terminal emulator about
+// itself, with escape sequences that terminals not understanding them
+// ignore.
+type TerminalConfig struct {
+	// NoReportDir stops the shell reporting the working directory with
+	// OSC 7 before each prompt, which lets the terminal open new tabs
+	// and windows in it.
+	NoReportDir bool `yaml:"no_report_dir"`
+	// NoMarkPrompts stops the shell marking where prompts, command lines
+	// and their output start and end with OSC 133, which lets terminals
+	// jump between prompts and show each command's exit status.
+	NoMarkPrompts bool `yaml:"no_mark_prompts"`
+	// Title is the window title while a command line runs, with
+	// {command} and PromptFields in braces, by default "{command}";
+	// PromptTitle is the title at the prompt, by default "{cwd}". "none"
+	// leaves the title alone.
+	Title       string `yaml:"title"`
+	PromptTitle string `yaml:"prompt_title"`
+}
+
+// ClipboardConfig chooses the commands the copy and paste builtins use
+// for the system clipboard, as program and arguments. Left out, they are
+// found from the platform and what is installed: pbcopy, wl-copy, xclip,
+// xsel and the like. Copy may be just "osc52" to send what is copied
+// to the terminal with that escape sequence, as is done when no command
+// is found.
+type ClipboardConfig struct {
+	Copy  []string `yaml:"copy"`
+	Paste []string `yaml:"paste"`
+}
+
+// CompletionConfig tunes Tab completion.
+type CompletionConfig struct {
+	// Flags completes the options of external commands from their
+	// --help output, or else their man page. It is off by default since
+	// it runs the commands, once for each version of each, to read them.
+	Flags bool `yaml:"flags"`
+	// FlagCache is where the options read are kept, by default
+	// flags.json in the data directory.
+	FlagCache string `yaml:"flag_cache"`
+	// NoMenu lists the completions Tab cannot choose between, rather
+	// than offering them in a menu to pick one from with Tab and the
+	// arrow keys.
+	NoMenu bool `yaml:"no_menu"`
+	// Matching is how a word is matched to what it may complete to:
+	// "prefix" (the default) by its start, "substring" anywhere in it,
+	// or "fuzzy" by its letters in order, with the best matches first.
+	Matching string `yaml:"matching"`
+	// Specs say what the arguments of commands complete to, by command:
+	// "directories", "files", "variables", "commands" or "none". They
+	// add to and override the shell's own, by which cd completes
+	// directories and unset variables, for instance.
+	Specs map[string]string `yaml:"specs"`
+}
+
+// DirEnvConfig sets up the env files loaded in the directories that have
+// them, as direnv does.
+type DirEnvConfig struct {
+	// Files are the names of env files, in order of preference. They
+	// default to .myshell-env and .env; an empty list turns env files
+	// off.
+	Files []string `yaml:"files"`
+	// AllowFile lists the env files, and the project files, that may be
+	// loaded, with a hash of their contents. It defaults to env-allowed in
+	// the data directory.
+	AllowFile string `yaml:"allow_file"`
+}
+
+// HooksConfig lists commands to run before each command line the user
+// enters (preexec) and before each prompt (precmd), as in zsh.
+type HooksConfig struct {
+	Preexec []string `yaml:"preexec"`
+	Precmd  []string `yaml:"precmd"`
 }
 
 func Load(file string) (*Config, error) {
-	cfg := &Config{}
-	data, err := os.ReadFile(file)
+	// Keep an absolute path so the file can be read again after a cd.
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{Path: path}
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	// Every format is parsed into a node tree that knows the line of each
+	// setting, then checked and decoded from there.
+	root, err := loaderFor(filepath.Ext(path)).Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if root.Kind != 0 { // not an empty file
+		if err := cfg.checkFields(root); err != nil {
+			return nil, err
+		}
+		if err := root.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(root); err != nil {
 		return nil, err
 	}
 
+	return cfg, cfg.setDefaults()
+}
+
+// Timeout returns CommandTimeout as a duration, or 0 for none.
+func (cfg *Config) Timeout() time.Duration {
+	d, _ := ParseDuration(cfg.CommandTimeout)
+	return d
+}
+
+// NotifyAfter returns Notify.After as a duration, or 0 for none.
+func (cfg *Config) NotifyAfter() time.Duration {
+	d, _ := ParseDuration(cfg.Notify.After)
+	return d
+}
+
+// ReportDuration returns ReportTime as a duration, or 0 for none.
+func (cfg *Config) ReportDuration() time.Duration {
+	d, _ := ParseDuration(cfg.ReportTime)
+	return d
+}
+
+// PromptWaitDuration returns PromptWait as a duration.
+func (cfg *Config) PromptWaitDuration() time.Duration {
+	d, _ := ParseDuration(cfg.PromptWait)
+	return d
+}
+
+// ParseDuration parses a duration such as "1m30s". A plain number is a
+// number of seconds, as for coreutils' timeout.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q, expected a number of seconds or a duration such as 30s or 5m", s)
+	}
+	return d, nil
+}
+
+// Default returns the default configuration, ignoring MYSHELL_*
+// variables.
+func Default() (*Config, error) {
+	cfg := &Config{}
+	return cfg, cfg.setDefaults()
+}
+
+func (cfg *Config) setDefaults() error {
+	var err error
 	if cfg.HomeDir == "" {
 		cfg.HomeDir, err = os.UserHomeDir()
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
+	configDir, dataDir := ConfigDir(cfg.HomeDir), DataDir(cfg.HomeDir)
+	legacyDir := filepath.Join(cfg.HomeDir, ".myshell")
+
 	if cfg.HistoryFile == "" {
-		cfg.HistoryFile = filepath.Join(cfg.HomeDir, ".myshell_history")
+		cfg.HistoryFile = legacyPath(filepath.Join(dataDir, "history"), filepath.Join(cfg.HomeDir, ".myshell_history"))
+	}
+
+	if cfg.BookmarksFile == "" {
+		cfg.BookmarksFile = filepath.Join(dataDir, "bookmarks.json")
+	}
+
+	if cfg.Glob.MaxEntries == 0 {
+		cfg.Glob.MaxEntries = 100000
+	}
+
+	if cfg.CaptureOutput.Exclude == nil {
+		cfg.CaptureOutput.Exclude = []string{"vi", "vim", "nvim", "nano", "emacs", "less", "more", "man", "top", "htop", "ssh", "tmux", "screen"}
+	}
+
+	if cfg.DirEnv.Files == nil {
+		cfg.DirEnv.Files = []string{".myshell-env", ".env"}
+	}
+
+	if cfg.DirEnv.AllowFile == "" {
+		cfg.DirEnv.AllowFile = filepath.Join(dataDir, "env-allowed")
+	}
+
+	if cfg.PromptWait == "" {
+		cfg.PromptWait = "50ms"
+	}
+
+	if cfg.Terminal.Title == "" {
+		cfg.Terminal.Title = "{command}"
+	}
+
+	if cfg.Terminal.PromptTitle == "" {
+		cfg.Terminal.PromptTitle = "{cwd}"
+	}
+
+	if cfg.Completion.FlagCache == "" {
+		cfg.Completion.FlagCache = filepath.Join(dataDir, "flags.json")
+	}
+
+	if cfg.Jobs.LogDir == "" {
+		cfg.Jobs.LogDir = filepath.Join(dataDir, "jobs")
+	}
+
+	if cfg.History.Database == "" {
+		cfg.History.Database = legacyPath(filepath.Join(dataDir, "history.db"), filepath.Join(legacyDir, "history.db"))
+	}
+
+	if cfg.History.ProjectDir == "" {
+		cfg.History.ProjectDir = legacyPath(filepath.Join(dataDir, "projects"), filepath.Join(legacyDir, "projects"))
+	}
+
+	if cfg.PluginsDir == "" {
+		cfg.PluginsDir = legacyPath(filepath.Join(configDir, "plugins"), filepath.Join(legacyDir, "plugins"))
+	}
+
+	if cfg.ScriptsDir == "" {
+		cfg.ScriptsDir = legacyPath(filepath.Join(configDir, "scripts"), filepath.Join(legacyDir, "scripts"))
 	}
 
-	return cfg, nil
+	return nil
 }
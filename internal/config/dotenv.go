@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvVar is a variable an env file sets.
+type EnvVar struct {
+	Name, Value string
+}
+
+// FindEnvFile returns the env file that applies to dir: the nearest one
+// in it or a directory above it, named one of names, the first winning
+// within a directory.
+func FindEnvFile(dir string, names []string) (string, bool) {
+	if len(names) == 0 {
+		return "", false
+	}
+	for {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// ParseEnvFile parses a .env file: NAME=value lines, optionally starting
+// with export, and # comments. A value may be in single quotes, taken
+// as it is, or in double quotes, where \n, \t, \", \\ and $ escapes
+// work. Outside single quotes $NAME and ${NAME} are replaced by the
+// variables set before them in the file or by lookup.
+func ParseEnvFile(data []byte, lookup func(string) (string, bool)) ([]EnvVar, error) {
+	var vars []EnvVar
+	set := make(map[string]string)
+	expand := func(name string) string {
+		if value, ok := set[name]; ok {
+			return value
+		}
+		value, _ := lookup(name)
+		return value
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", n)
+		}
+		value, err := envValue(strings.TrimSpace(value), expand)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, name, err)
+		}
+		set[name] = value
+		vars = append(vars, EnvVar{name, value})
+	}
+	return vars, scanner.Err()
+}
+
+// envValue unquotes and expands the value of a line of an env file.
+func envValue(value string, expand func(string) string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("missing closing '")
+		}
+		return value[1 : end+1], checkTrailing(value[end+2:])
+	case strings.HasPrefix(value, `"`):
+		// Escaped characters are kept out of the expansion.
+		var b, raw strings.Builder
+		flush := func() {
+			b.WriteString(os.Expand(raw.String(), expand))
+			raw.Reset()
+		}
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				flush()
+				return b.String(), checkTrailing(value[i+1:])
+			case c == '\\' && i+1 < len(value):
+				flush()
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(value[i])
+				}
+			default:
+				raw.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf(`missing closing "`)
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return os.Expand(value, expand), nil
+}
+
+// checkTrailing allows only a comment after a quoted value.
+func checkTrailing(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the names of the environment variables that override
+// settings. Each setting has one, named after its path in the file:
+// history_file is MYSHELL_HISTORY_FILE and history.backend is
+// MYSHELL_HISTORY_BACKEND.
+//
+// Settings are resolved in this order, each overriding the ones after it:
+// command-line flags, MYSHELL_* variables, the config file, defaults.
+const EnvPrefix = "MYSHELL_"
+
+// EnvName returns the variable that overrides the setting at path.
+func EnvName(path ...string) string {
+	return EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// FromEnv returns the configuration used when no file is read: the
+// defaults with any MYSHELL_* overrides applied.
+func FromEnv() (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(&yaml.Node{}); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.setDefaults()
+}
+
+// applyEnv sets every setting whose variable lookup finds. Strings are
+// taken as they are; other settings are parsed as YAML, so a list is
+// written "[a, b]" and a map "{ll: ls -l}".
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	var walk func(v reflect.Value, path []string)
+	walk = func(v reflect.Value, path []string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			field, fieldPath := v.Field(i), append(append([]string{}, path...), tag)
+			if field.Kind() == reflect.Struct {
+				walk(field, fieldPath)
+				continue
+			}
+			name := EnvName(fieldPath...)
+			value, ok := lookup(name)
+			if !ok {
+				continue
+			}
+			field.Set(reflect.Zero(field.Type()))
+			if field.Kind() == reflect.String {
+				field.SetString(value)
+			} else if err := yaml.Unmarshal([]byte(value), field.Addr().Interface()); err != nil {
+				errs = append(errs, &ValidationError{
+					File:  "$" + name,
+					Field: strings.Join(fieldPath, "."),
+					Msg:   fmt.Sprintf("cannot parse %q", value),
+				})
+				continue
+			}
+			if cfg.fromEnv == nil {
+				cfg.fromEnv = make(map[string]string)
+			}
+			cfg.fromEnv[strings.Join(fieldPath, ".")] = name
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), nil)
+	return joinByLine(errs)
+}
+
+// envSource returns the variable that set the setting at path, or of the
+// map or list it is in.
+func (cfg *Config) envSource(path []string) (string, bool) {
+	for n := len(path); n > 0; n-- {
+		if name, ok := cfg.fromEnv[strings.Join(path[:n], ".")]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"shell/internal/lineedit"
+)
+
+// Actions that keys can be bound to in the keybindings section, besides
+// the line editor's functions (lineedit.Functions) and macros.
+const (
+	ActionTogglePreview     = "toggle-preview"
+	ActionSelectCompletions = "select-completions"
+	ActionSearchHistory     = "search-history"
+	// ActionSearchScope switches a history search between the project
+	// and the global history. Outside a search it picks files to insert
+	// instead, as fzf's Ctrl+T does.
+	ActionSearchScope = "search-scope"
+	// ActionCopyLine copies the line being edited to the clipboard, and
+	// ActionPasteClipboard inserts what the clipboard holds.
+	ActionCopyLine       = "copy-line"
+	ActionPasteClipboard = "paste-clipboard"
+	// ActionNone unbinds a key.
+	ActionNone = "none"
+)
+
+var keyActions = []string{
+	ActionTogglePreview, ActionSelectCompletions, ActionSearchHistory, ActionSearchScope,
+	ActionCopyLine, ActionPasteClipboard, ActionNone,
+}
+
+// DefaultKeybindings are bound before the config's keybindings apply.
+var DefaultKeybindings = map[string]string{
+	"ctrl-o": ActionTogglePreview,
+	"ctrl-x": ActionSelectCompletions,
+	"ctrl-r": ActionSearchHistory,
+	"ctrl-t": ActionSearchScope,
+}
+
+// ParseKey turns a key name such as "ctrl-o", "C-o", `\C-o` or "^O" into the
+// character the terminal sends for it. Only control keys can be bound,
+// since other keys insert text.
+func ParseKey(spec string) (rune, error) {
+	lower := strings.ToLower(spec)
+	var letter string
+	switch {
+	case strings.HasPrefix(lower, "ctrl-"), strings.HasPrefix(lower, "ctrl+"):
+		letter = lower[5:]
+	case strings.HasPrefix(lower, "c-"):
+		letter = lower[2:]
+	case strings.HasPrefix(lower, `\c-`):
+		letter = lower[3:]
+	case strings.HasPrefix(lower, "^"):
+		letter = lower[1:]
+	}
+	if len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+		return 0, fmt.Errorf("unknown key %q, expected one like ctrl-o", spec)
+	}
+	return rune(letter[0]-'a') + 1, nil
+}
+
+// KeyName is the name ParseKey reads for a control key.
+func KeyName(r rune) string {
+	return "ctrl-" + string('a'+r-1)
+}
+
+// Actions returns the names a key can be bound to: the actions and the
+// line editor's functions, in order.
+func Actions() []string {
+	names := append([]string{}, keyActions...)
+	for name := range lineedit.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var bindingName = regexp.MustCompile(`^[a-z]+(-[a-z]+)*$`)
+
+// IsMacro reports whether a key binding is text to type rather than an
+// action or function name, which are lower-case words joined by dashes.
+// A macro ending in a newline runs the line it leaves.
+func IsMacro(binding string) bool {
+	return !bindingName.MatchString(binding)
+}
+
+// CheckBinding reports whether a key can be bound to binding.
+func CheckBinding(binding string) error {
+	switch {
+	case binding == "":
+		return fmt.Errorf("empty binding")
+	case IsMacro(binding) || validAction(binding):
+		return nil
+	}
+	if _, ok := lineedit.Functions[binding]; ok {
+		return nil
+	}
+	return fmt.Errorf("unknown action or function %q, bind -l lists them", binding)
+}
+
+func validAction(action string) bool {
+	for _, a := range keyActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader parses one config file format. Every format is turned into a
+// YAML node tree, which is what settings are decoded and validated from,
+// so the setting names are the same in each. Nodes should carry the line
+// they came from so errors can point at it.
+type Loader interface {
+	Parse(data []byte) (*yaml.Node, error)
+}
+
+// loaders maps file extensions to the loader for that format. Files with
+// an unknown extension are read as YAML.
+var loaders = map[string]Loader{
+	".yml":  yamlLoader{},
+	".yaml": yamlLoader{},
+	".json": jsonLoader{},
+	".toml": tomlLoader{},
+}
+
+// RegisterLoader adds support for config files ending in ext, such as
+// ".ini".
+func RegisterLoader(ext string, loader Loader) {
+	loaders[strings.ToLower(ext)] = loader
+}
+
+func loaderFor(ext string) Loader {
+	if loader, ok := loaders[strings.ToLower(ext)]; ok {
+		return loader
+	}
+	return yamlLoader{}
+}
+
+type yamlLoader struct{}
+
+func (yamlLoader) Parse(data []byte) (*yaml.Node, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// jsonLoader relies on JSON being a subset of YAML, but checks the syntax
+// with a JSON parser first so that YAML-only syntax is rejected.
+type jsonLoader struct{}
+
+func (jsonLoader) Parse(data []byte) (*yaml.Node, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		if syntax, ok := err.(*json.SyntaxError); ok {
+			return nil, fmt.Errorf("line %d: %v", lineAt(data, syntax.Offset), err)
+		}
+		return nil, err
+	}
+	return yamlLoader{}.Parse(data)
+}
+
+func lineAt(data []byte, offset int64) int {
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+type tomlLoader struct{}
+
+func (tomlLoader) Parse(data []byte) (*yaml.Node, error) {
+	var v map[string]interface{}
+	if _, err := toml.Decode(string(data), &v); err != nil {
+		return nil, err
+	}
+	return toNode(v, nil, tomlLines(data)), nil
+}
+
+// toNode builds a node tree from decoded TOML, taking the line of each
+// key from lines, which is indexed by dotted path. Keys inside inline
+// tables get the line of the table.
+func toNode(v interface{}, path []string, lines map[string]int) *yaml.Node {
+	lineOf := func(path []string) int {
+		for n := len(path); n > 0; n-- {
+			if line, ok := lines[strings.Join(path[:n], ".")]; ok {
+				return line
+			}
+		}
+		return 0
+	}
+	line := lineOf(path)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := append(append([]string{}, path...), key)
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, Line: lineOf(keyPath)}
+			node.Content = append(node.Content, keyNode, toNode(v[key], keyPath, lines))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line}
+		for _, item := range v {
+			node.Content = append(node.Content, toNode(item, path, lines))
+		}
+		return node
+	case []map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line}
+		for _, item := range v {
+			node.Content = append(node.Content, toNode(item, path, lines))
+		}
+		return node
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v, Line: line}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v), Line: line}
+	case int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v, 10), Line: line}
+	case float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(v, 'g', -1, 64), Line: line}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(v), Line: line}
+}
+
+// tomlLines finds the line each key is set on, by dotted path. It handles
+// [table] headers and key = value lines, which is all a config needs.
+func tomlLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	var table []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "["):
+			header := strings.Trim(line, "[] \t")
+			table = splitTOMLKey(header)
+			if _, seen := lines[strings.Join(table, ".")]; !seen {
+				lines[strings.Join(table, ".")] = n
+			}
+		default:
+			key, _, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			path := append(append([]string{}, table...), splitTOMLKey(key)...)
+			lines[strings.Join(path, ".")] = n
+		}
+	}
+	return lines
+}
+
+// splitTOMLKey splits a dotted TOML key, unquoting its parts.
+func splitTOMLKey(key string) []string {
+	var parts []string
+	for _, part := range strings.Split(key, ".") {
+		part = strings.TrimSpace(part)
+		if unquoted, err := strconv.Unquote(part); err == nil {
+			part = unquoted
+		} else {
+			part = strings.Trim(part, "'")
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
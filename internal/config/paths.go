@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigDir is where the shell's configuration lives:
+// $XDG_CONFIG_HOME/myshell, or ~/.config/myshell.
+func ConfigDir(home string) string {
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", home, ".config"), "myshell")
+}
+
+// DataDir is where the shell keeps history and other state:
+// $XDG_DATA_HOME/myshell, or ~/.local/share/myshell.
+func DataDir(home string) string {
+	return filepath.Join(xdgDir("XDG_DATA_HOME", home, ".local", "share"), "myshell")
+}
+
+// xdgDir returns the directory named by the environment variable env,
+// which the XDG spec says to ignore unless it is absolute, or its default
+// under home.
+func xdgDir(env, home string, fallback ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{home}, fallback...)...)
+}
+
+// configNames are the file names Find looks for in ConfigDir, in order.
+var configNames = []string{"config.yml", "config.yaml", "config.toml", "config.json"}
+
+// Find returns the first config file that exists, looking at
+// ConfigDir/config.{yml,yaml,toml,json} and then ~/.myshellrc.yml.
+func Find(home string) (string, bool) {
+	var paths []string
+	for _, name := range configNames {
+		paths = append(paths, filepath.Join(ConfigDir(home), name))
+	}
+	for _, path := range append(paths, filepath.Join(home, ".myshellrc.yml")) {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// legacyPath returns old when it exists and path does not, so files from
+// before the XDG layout keep being used.
+func legacyPath(path, old string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	if _, err := os.Stat(old); err == nil {
+		return old
+	}
+	return path
+}
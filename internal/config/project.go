@@ -0,0 +1,24 @@
+package config
+
+import "gopkg.in/yaml.v3"
+
+// ProjectFile is the name of the per-directory configuration file. Its
+// settings apply in the directory containing it and everything below.
+const ProjectFile = ".myshell.yml"
+
+type Project struct {
+	Dir     string            `yaml:"-"`
+	Aliases map[string]string `yaml:"aliases"`
+	// Container is an image that external commands run in, in the
+	// directory and below, with the directory mounted.
+	Container string `yaml:"container"`
+}
+
+// ParseProject parses data, the project file found in dir.
+func ParseProject(dir string, data []byte) (*Project, error) {
+	p := &Project{Dir: dir}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
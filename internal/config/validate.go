@@ -0,0 +1,272 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PromptFields are the {name} placeholders a prompt format may use.
+var PromptFields = []string{"user", "host", "cwd", "dir", "status", "time", "duration", "mode", "git", "kube"}
+
+// CompletionKinds are what completion specs can have arguments complete
+// to.
+var CompletionKinds = []string{"directories", "files", "variables", "commands", "none"}
+
+// Themes are the prompt themes there are, besides "none".
+var Themes = []string{"powerline", "minimal", "plain"}
+
+// ValidationError reports a setting that parses but makes no sense, with
+// the line it is on.
+type ValidationError struct {
+	File  string
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", e.File, e.Field, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Field, e.Msg)
+}
+
+var (
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	promptField    = regexp.MustCompile(`\{([^{}]*)\}`)
+)
+
+// validate checks the settings decoded from root, the parsed file, and
+// returns every problem found.
+func (cfg *Config) validate(root *yaml.Node) error {
+	var errs []error
+	problem := func(path []string, format string, args ...interface{}) {
+		err := &ValidationError{
+			File:  cfg.Path,
+			Line:  lineOf(root, path...),
+			Field: strings.Join(path, "."),
+			Msg:   fmt.Sprintf(format, args...),
+		}
+		if name, ok := cfg.envSource(path); ok {
+			err.File, err.Line = "$"+name, 0
+		}
+		errs = append(errs, err)
+	}
+
+	for name := range cfg.Aliases {
+		if name == "" || strings.ContainsAny(name, " \t=/'\"") {
+			problem([]string{"aliases", name}, "invalid alias name")
+		}
+	}
+	for ext := range cfg.SuffixAliases {
+		if ext == "" || strings.ContainsAny(ext, " \t=/.'\"") {
+			problem([]string{"suffix_aliases", ext}, "invalid extension, expected one such as py")
+		}
+	}
+	for name := range cfg.Env {
+		if !envNamePattern.MatchString(name) {
+			problem([]string{"env", name}, "invalid variable name")
+		}
+	}
+	for key, action := range cfg.Keybindings {
+		if _, err := ParseKey(key); err != nil {
+			problem([]string{"keybindings", key}, "%v", err)
+		} else if err := CheckBinding(action); err != nil {
+			problem([]string{"keybindings", key}, "%v", err)
+		}
+	}
+	for _, m := range promptField.FindAllStringSubmatch(cfg.Prompt, -1) {
+		if !contains(PromptFields, m[1]) {
+			problem([]string{"prompt"}, "unknown field {%s}, expected one of {%s}", m[1], strings.Join(PromptFields, "}, {"))
+		}
+	}
+	if cfg.Theme != "" && cfg.Theme != "none" && !contains(Themes, cfg.Theme) {
+		problem([]string{"theme"}, "unknown theme %q, expected none, %s", cfg.Theme, strings.Join(Themes, ", "))
+	}
+	for _, m := range promptField.FindAllStringSubmatch(cfg.Terminal.Title, -1) {
+		if m[1] != "command" && !contains(PromptFields, m[1]) {
+			problem([]string{"terminal", "title"}, "unknown field {%s}, expected {command} or one of {%s}", m[1], strings.Join(PromptFields, "}, {"))
+		}
+	}
+	for _, m := range promptField.FindAllStringSubmatch(cfg.Terminal.PromptTitle, -1) {
+		if !contains(PromptFields, m[1]) {
+			problem([]string{"terminal", "prompt_title"}, "unknown field {%s}, expected one of {%s}", m[1], strings.Join(PromptFields, "}, {"))
+		}
+	}
+
+	if _, err := ParseDuration(cfg.CommandTimeout); err != nil {
+		problem([]string{"command_timeout"}, "%v", err)
+	}
+	if _, err := ParseDuration(cfg.ReportTime); err != nil {
+		problem([]string{"report_time"}, "%v", err)
+	}
+	if _, err := ParseDuration(cfg.PromptWait); err != nil {
+		problem([]string{"prompt_wait"}, "%v", err)
+	}
+	if _, err := ParseDuration(cfg.Notify.After); err != nil {
+		problem([]string{"notify", "after"}, "%v", err)
+	}
+
+	switch cfg.EditingMode {
+	case "", "emacs", "vi":
+	default:
+		problem([]string{"editing_mode"}, "unknown editing mode %q, expected emacs or vi", cfg.EditingMode)
+	}
+	switch cfg.LineEditor {
+	case "", "native", "readline":
+	default:
+		problem([]string{"line_editor"}, "unknown line editor %q, expected native or readline", cfg.LineEditor)
+	}
+	if cfg.Glob.MaxDepth < 0 {
+		problem([]string{"glob", "max_depth"}, "must not be negative, 0 means no limit")
+	}
+	if cfg.Glob.MaxEntries < -1 {
+		problem([]string{"glob", "max_entries"}, "must be -1 for no limit, or a positive number")
+	}
+	switch cfg.Glob.Sort {
+	case "", "name", "mtime":
+	default:
+		problem([]string{"glob", "sort"}, "unknown order %q, expected name or mtime", cfg.Glob.Sort)
+	}
+	switch cfg.Completion.Matching {
+	case "", "prefix", "substring", "fuzzy":
+	default:
+		problem([]string{"completion", "matching"}, "unknown matching %q, expected prefix, substring or fuzzy", cfg.Completion.Matching)
+	}
+	for command, kind := range cfg.Completion.Specs {
+		if !contains(CompletionKinds, kind) {
+			problem([]string{"completion", "specs", command}, "unknown kind %q, expected %s", kind, strings.Join(CompletionKinds, ", "))
+		}
+	}
+	if cfg.CaptureOutput.Keep < 0 {
+		problem([]string{"capture_output", "keep"}, "must not be negative, 0 keeps none")
+	}
+	switch cfg.Notify.Method {
+	case "", "osc9", "osc777", "bell", "none":
+	default:
+		problem([]string{"notify", "method"}, "unknown method %q, expected osc9, osc777, bell or none", cfg.Notify.Method)
+	}
+	switch cfg.Jobs.Output {
+	case "", "log", "memory", "discard":
+	default:
+		problem([]string{"jobs", "output"}, "unknown output %q, expected log, memory or discard", cfg.Jobs.Output)
+	}
+	switch cfg.History.Backend {
+	case "", "file", "sqlite":
+	default:
+		problem([]string{"history", "backend"}, "unknown backend %q, expected file or sqlite", cfg.History.Backend)
+	}
+	if cfg.History.Size < 0 {
+		problem([]string{"history", "size"}, "must not be negative, 0 keeps the default of 1000")
+	}
+	switch cfg.History.Sync {
+	case "", "write", "fsync", "exit":
+	default:
+		problem([]string{"history", "sync"}, "unknown policy %q, expected write, fsync or exit", cfg.History.Sync)
+	}
+	switch cfg.History.Secrets {
+	case "", "redact", "skip", "keep":
+	default:
+		problem([]string{"history", "secrets"}, "unknown action %q, expected redact, skip or keep", cfg.History.Secrets)
+	}
+	for _, pattern := range cfg.History.SecretPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problem([]string{"history", "secret_patterns"}, "%v", err)
+		}
+	}
+	return joinByLine(errs)
+}
+
+// checkFields reports settings in root that Config does not have, which
+// are most likely misspelt.
+func (cfg *Config) checkFields(root *yaml.Node) error {
+	var errs []error
+	var check func(node *yaml.Node, t reflect.Type, path []string)
+	check = func(node *yaml.Node, t reflect.Type, path []string) {
+		if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+			node = node.Content[0]
+		}
+		if node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			keyPath := append(append([]string{}, path...), key.Value)
+			field, ok := fieldByTag(t, key.Value)
+			if !ok {
+				errs = append(errs, &ValidationError{
+					File:  cfg.Path,
+					Line:  key.Line,
+					Field: strings.Join(keyPath, "."),
+					Msg:   "unknown setting",
+				})
+				continue
+			}
+			check(node.Content[i+1], field.Type, keyPath)
+		}
+	}
+	check(root, reflect.TypeOf(*cfg), nil)
+	return joinByLine(errs)
+}
+
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == name && tag != "-" {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// joinByLine joins validation errors in the order they appear in the
+// file.
+func joinByLine(errs []error) error {
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*ValidationError).Line < errs[j].(*ValidationError).Line
+	})
+	return errors.Join(errs...)
+}
+
+// lineOf returns the line of the key at path in a parsed document,
+// or of the deepest part of the path that exists.
+func lineOf(node *yaml.Node, path ...string) int {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return line
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Docker runs commands in containers of an image, through the Docker
+// Engine API. Each command gets a container of its own, which is removed
+// once it finishes, with Mount bound at the same path and the working
+// directory set to the shell's.
+//
+// Of a command's Limits, only the memory limit applies. Only the
+// variables set for a command, and not the whole environment,
+// are passed in, since the image has its own PATH and HOME. A command run
+// from the terminal does not read it, as the terminal cannot be handed
+// back once the container has taken it.
+type Docker struct {
+	Image string
+	// Mount is the directory bound into the container, normally the
+	// working directory or the project it is in.
+	Mount string
+	// Host is the daemon's address as in DOCKER_HOST; empty means
+	// DOCKER_HOST or else the default socket.
+	Host string
+}
+
+func (d Docker) Run(ctx context.Context, c Command) (Result, error) {
+	api, err := newDockerAPI(d.Host)
+	if err != nil {
+		return Result{}, err
+	}
+	dir := c.Dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return Result{}, err
+		}
+	}
+	stdin := c.Stdin
+	if isTerminal(stdin) {
+		stdin = nil
+	}
+
+	config := map[string]any{
+		"Image":        d.Image,
+		"Cmd":          c.Args,
+		"Env":          changedEnv(c.Env),
+		"WorkingDir":   dir,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"AttachStdin":  stdin != nil,
+		"OpenStdin":    stdin != nil,
+		"StdinOnce":    stdin != nil,
+		"HostConfig": map[string]any{
+			// Mounts, unlike Binds, takes paths that contain a colon.
+			"Mounts": []map[string]any{{"Type": "bind", "Source": d.Mount, "Target": d.Mount}},
+			"Memory": c.Limits.Memory,
+		},
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid > 0 {
+		// Files the command creates in the mount belong to the user.
+		config["User"] = fmt.Sprintf("%d:%d", uid, gid)
+	}
+	var created struct{ Id string }
+	err = api.call(ctx, "POST", "/containers/create", config, &created)
+	var apiErr *dockerError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		if err = api.pull(ctx, d.Image); err == nil {
+			err = api.call(ctx, "POST", "/containers/create", config, &created)
+		}
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	id := created.Id
+	// The container is removed even when ctx is done.
+	defer api.call(context.Background(), "DELETE", "/containers/"+id+"?force=1", nil, nil)
+
+	conn, output, err := api.attach(id, stdin != nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if err := api.call(ctx, "POST", "/containers/"+id+"/start", nil, nil); err != nil {
+		return Result{}, err
+	}
+	if c.Started != nil {
+		// A container has no process of the shell's to signal.
+		c.Started(0)
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(conn, stdin)
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			}
+		}()
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		demux(output, c.Stdout, c.Stderr)
+		close(copied)
+	}()
+	select {
+	case <-copied:
+	case <-ctx.Done():
+		api.call(context.Background(), "POST", "/containers/"+id+"/kill", nil, nil)
+		<-copied
+	}
+
+	var waited struct{ StatusCode int }
+	if err := api.call(context.Background(), "POST", "/containers/"+id+"/wait", nil, &waited); err != nil {
+		return Result{}, err
+	}
+	return Result{ExitCode: waited.StatusCode}, nil
+}
+
+// changedEnv returns the variables in env that the shell's own
+// environment does not have, or has with another value.
+func changedEnv(env []string) []string {
+	own := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		own[kv] = true
+	}
+	var changed []string
+	for _, kv := range env {
+		if !own[kv] {
+			changed = append(changed, kv)
+		}
+	}
+	return changed
+}
+
+// demux copies a container's output, which comes with stdout and stderr
+// interleaved as frames with an 8 byte header saying which each is and
+// how long.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if w == nil {
+			w = io.Discard
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// dockerAPI makes Engine API requests over the daemon's socket.
+type dockerAPI struct {
+	dial   func(ctx context.Context) (net.Conn, error)
+	client *http.Client
+}
+
+// dockerError is an error response from the daemon.
+type dockerError struct {
+	status  int
+	message string
+}
+
+func (e *dockerError) Error() string {
+	return "docker: " + e.message
+}
+
+func newDockerAPI(host string) (*dockerAPI, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	network, addr, ok := strings.Cut(host, "://")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, fmt.Errorf("docker: %s: only unix:// and tcp:// hosts are supported", host)
+	}
+	api := &dockerAPI{dial: func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}}
+	api.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return api.dial(ctx)
+		},
+	}}
+	return api, nil
+}
+
+// call makes a request with body, if any, as JSON, and decodes the
+// response into out, if set.
+func (api *dockerAPI) call(ctx context.Context, method, path string, body, out any) error {
+	resp, err := api.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (api *dockerAPI) request(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker"+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var msg struct{ Message string }
+		if json.NewDecoder(resp.Body).Decode(&msg) != nil || msg.Message == "" {
+			msg.Message = resp.Status
+		}
+		return nil, &dockerError{status: resp.StatusCode, message: msg.Message}
+	}
+	return resp, nil
+}
+
+// pull fetches an image that is not there yet, which can take a while,
+// so it says so.
+func (api *dockerAPI) pull(ctx context.Context, image string) error {
+	fmt.Fprintf(os.Stderr, "Pulling %s...\n", image)
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") && !strings.Contains(image, "@") {
+		name, tag = image[:i], image[i+1:]
+	}
+	resp, err := api.request(ctx, "POST", "/images/create?fromImage="+url.QueryEscape(name)+"&tag="+url.QueryEscape(tag), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The progress comes as a stream of JSON messages, any of which may
+	// be an error.
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct{ Error string }
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return &dockerError{message: msg.Error}
+		}
+	}
+}
+
+// attach connects to a container's standard files before it starts,
+// taking over the HTTP connection for them. It returns the connection,
+// for writing to stdin, and a reader of the output on it.
+func (api *dockerAPI) attach(id string, stdin bool) (net.Conn, io.Reader, error) {
+	conn, err := api.dial(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("docker: %w", err)
+	}
+	query := "stream=1&stdout=1&stderr=1&stdin=" + strconv.FormatBool(stdin)
+	req, err := http.NewRequest("POST", "http://docker/containers/"+id+"/attach?"+query, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("docker: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("docker: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, nil, &dockerError{status: resp.StatusCode, message: "attach: " + resp.Status}
+	}
+	return conn, br, nil
+}
@@ -0,0 +1,70 @@
+// Package executor runs external commands for the shell. The shell only
+// goes through an Executor, so tests can substitute a fake one and other
+// backends, such as a remote host or a container, can be added.
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Command is an external command to run.
+type Command struct {
+	Args []string
+	// Dir is the working directory; empty means the shell's.
+	Dir string
+	// Env is the environment; nil means the shell's.
+	Env []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// ExtraFiles are open in the command as descriptors 3 on, as in
+	// os/exec; a nil one is closed. Only local commands get them.
+	ExtraFiles []*os.File
+	// Limits restrict the resources the command may use. Only local
+	// commands get them.
+	Limits Limits
+	// Sandbox, if set, runs the command in a sandbox. Only local
+	// commands can be.
+	Sandbox *Sandbox
+
+	// Detach runs the command apart from the terminal's signals, as
+	// background jobs are, so Ctrl+C only reaches the foreground.
+	Detach bool
+	// Started, if set, is called with the process ID once the command
+	// is running.
+	Started func(pid int)
+}
+
+// Limits are the resources a command may use; the zero value sets none.
+type Limits struct {
+	// Memory is the most address space the command may map, in bytes.
+	Memory uint64
+	// CPU is the most CPU time it may use before it is killed.
+	CPU time.Duration
+	// Nice is the niceness it runs at, as set by nice(1).
+	Nice int
+}
+
+// Result is how a command finished.
+type Result struct {
+	// ExitCode is the command's exit status, or 128 plus the signal
+	// number if it was killed by a signal.
+	ExitCode int
+	Signaled bool
+
+	// UserTime and SystemTime are the CPU time the command used, where
+	// the executor can tell.
+	UserTime   time.Duration
+	SystemTime time.Duration
+}
+
+type Executor interface {
+	// Run runs cmd until it finishes or ctx is done, when it is killed.
+	// The error is only set when the command could not be run at all; a
+	// command that fails is reported in the Result.
+	Run(ctx context.Context, cmd Command) (Result, error)
+}
@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// limit makes cmd run through the shell, which sets the limits on itself
+// and then execs the command, as Go has no hook to run between fork and
+// exec. The limits are thus in place before the command runs at all,
+// and every process it starts inherits them.
+func limit(cmd *exec.Cmd, l Limits) error {
+	if l == (Limits{}) {
+		return nil
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	cmd.Args = append([]string{limitsInit, formatLimits(l), "--", cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
+
+// initLimits is the process limit starts. args are the limits, --, the
+// command's path and its arguments. It sets the limits and execs the
+// command in its place.
+func initLimits(args []string) {
+	// The niceness is set per thread, and the command must be run from
+	// the thread it was set on.
+	runtime.LockOSThread()
+	if len(args) < 4 || args[1] != "--" {
+		limitsFailed(fmt.Errorf("usage: %s LIMITS -- PATH ARG0 [ARG...]", limitsInit))
+	}
+	l, err := parseLimits(args[0])
+	if err != nil {
+		limitsFailed(err)
+	}
+	if err := setLimits(l); err != nil {
+		limitsFailed(err)
+	}
+	err = unix.Exec(args[2], args[3:], os.Environ())
+	limitsFailed(fmt.Errorf("%s: %w", args[2], err))
+}
+
+func limitsFailed(err error) {
+	fmt.Fprintf(os.Stderr, "limit: %v\n", err)
+	os.Exit(126)
+}
+
+// setLimits sets the limits on the calling process.
+func setLimits(l Limits) error {
+	if l.Memory > 0 {
+		if err := unix.Setrlimit(unix.RLIMIT_AS, &unix.Rlimit{Cur: l.Memory, Max: l.Memory}); err != nil {
+			return err
+		}
+	}
+	if l.CPU > 0 {
+		// The limit is in whole seconds; a part of one counts as one.
+		secs := uint64((l.CPU + time.Second - 1) / time.Second)
+		if err := unix.Setrlimit(unix.RLIMIT_CPU, &unix.Rlimit{Cur: secs, Max: secs}); err != nil {
+			return err
+		}
+	}
+	if l.Nice != 0 {
+		return unix.Setpriority(unix.PRIO_PROCESS, 0, l.Nice)
+	}
+	return nil
+}
+
+// formatLimits writes limits as parseLimits reads them.
+func formatLimits(l Limits) string {
+	return fmt.Sprintf("%d:%d:%d", l.Memory, l.CPU, l.Nice)
+}
+
+// parseLimits reads limits as formatLimits writes them.
+func parseLimits(s string) (Limits, error) {
+	var l Limits
+	var cpu int64
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &l.Memory, &cpu, &l.Nice); err != nil {
+		return Limits{}, fmt.Errorf("limits %q: %w", s, err)
+	}
+	l.CPU = time.Duration(cpu)
+	return l, nil
+}
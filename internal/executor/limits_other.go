@@ -0,0 +1,33 @@
+//go:build !linux && !windows
+
+package executor
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+)
+
+// limit refuses memory and CPU limits, which are only supported on
+// Linux, and runs cmd through nice(1) for a niceness, so that it is set
+// before the command runs.
+func limit(cmd *exec.Cmd, l Limits) error {
+	if l.Memory > 0 || l.CPU > 0 {
+		return errors.New("memory and CPU limits are only supported on Linux")
+	}
+	if l.Nice == 0 {
+		return nil
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	nice, err := exec.LookPath("nice")
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{"nice", "-n", strconv.Itoa(l.Nice), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = nice
+	return nil
+}
+
+func initLimits(args []string) {}
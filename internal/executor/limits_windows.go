@@ -0,0 +1,15 @@
+package executor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func limit(cmd *exec.Cmd, l Limits) error {
+	if l != (Limits{}) {
+		return errors.New("resource limits are not supported on Windows")
+	}
+	return nil
+}
+
+func initLimits(args []string) {}
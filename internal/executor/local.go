@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// Local runs commands as child processes of the shell.
+type Local struct{}
+
+func (Local) Run(ctx context.Context, c Command) (Result, error) {
+	cmd := command(ctx, c.Args)
+	cmd.Dir = c.Dir
+	cmd.Env = c.Env
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	cmd.ExtraFiles = c.ExtraFiles
+	if c.Detach {
+		detach(cmd)
+	}
+
+	// A sandboxed command's limits are set from inside the sandbox.
+	if c.Sandbox != nil {
+		if err := sandbox(cmd, c.Sandbox, c.Limits); err != nil {
+			return Result{}, err
+		}
+	} else if err := limit(cmd, c.Limits); err != nil {
+		return Result{}, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return Result{}, err
+	}
+	if c.Started != nil {
+		c.Started(cmd.Process.Pid)
+	}
+	err := cmd.Wait()
+	var res Result
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res = result(exitErr)
+	} else if err != nil {
+		return Result{}, err
+	}
+	res.UserTime, res.SystemTime = usage(cmd.ProcessState)
+	return res, nil
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+func command(ctx context.Context, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, args[0], args[1:]...)
+}
+
+// detach starts cmd in a process group of its own, so that signals from
+// the terminal, such as Ctrl+C, do not reach it.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// usage reads the CPU time a finished process used from its rusage.
+func usage(state *os.ProcessState) (user, sys time.Duration) {
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano())
+	}
+	return 0, 0
+}
+
+func result(err *exec.ExitError) Result {
+	if ws, ok := err.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return Result{ExitCode: 128 + int(ws.Signal()), Signaled: true}
+	}
+	return Result{ExitCode: err.ExitCode()}
+}
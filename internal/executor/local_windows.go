@@ -0,0 +1,63 @@
+//go:build windows
+
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func command(ctx context.Context, args []string) *exec.Cmd {
+	switch strings.ToLower(filepath.Ext(args[0])) {
+	case ".ps1":
+		psArgs := []string{"-NoProfile", "-ExecutionPolicy", "Bypass", "-File", args[0]}
+		return exec.CommandContext(ctx, "powershell.exe", append(psArgs, args[1:]...)...)
+	case ".bat", ".cmd":
+		comspec := os.Getenv("COMSPEC")
+		if comspec == "" {
+			comspec = "cmd.exe"
+		}
+		// cmd.exe does its own parsing, so hand it a pre-quoted command
+		// line instead of letting os/exec apply C runtime escaping.
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = quoteCmdArg(arg)
+		}
+		cmd := exec.CommandContext(ctx, comspec)
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			CmdLine: quoteCmdArg(comspec) + ` /d /s /c "` + strings.Join(quoted, " ") + `"`,
+		}
+		return cmd
+	}
+	return exec.CommandContext(ctx, args[0], args[1:]...)
+}
+
+func quoteCmdArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"&|<>^()%!,;=") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `"`, `""`)
+	return `"` + arg + `"`
+}
+
+// detach starts cmd in a process group of its own, so that Ctrl+C does
+// not reach it.
+func detach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+func usage(state *os.ProcessState) (user, sys time.Duration) {
+	return state.UserTime(), state.SystemTime()
+}
+
+func result(err *exec.ExitError) Result {
+	return Result{ExitCode: err.ExitCode()}
+}
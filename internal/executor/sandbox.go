@@ -0,0 +1,42 @@
+package executor
+
+import "os"
+
+// Sandbox restricts what a command can reach: it sees the file system
+// read-only, with an empty /tmp of its own, sees only its own processes,
+// and has no network.
+type Sandbox struct {
+	// Network leaves the network reachable.
+	Network bool
+	// Writable are paths left writable.
+	Writable []string
+}
+
+// sandboxInit is the name the shell runs itself by to set up a sandbox
+// from inside it, before running the command there.
+const sandboxInit = "myshell-sandbox"
+
+// sandboxReaper is the name it runs itself by as the init of the
+// sandbox's PID namespace.
+const sandboxReaper = "myshell-sandbox-init"
+
+// limitsInit is the name it runs itself by to set a command's limits
+// before running it.
+const limitsInit = "myshell-limits"
+
+// InitSandbox must be called first thing in main. In a process Local
+// started to set up a sandbox, or a command's limits, it does so and runs
+// the command, and does not return.
+func InitSandbox() {
+	if len(os.Args) == 0 {
+		return
+	}
+	switch os.Args[0] {
+	case sandboxInit:
+		initSandbox(os.Args[1:])
+	case sandboxReaper:
+		initReaper(os.Args[1:])
+	case limitsInit:
+		initLimits(os.Args[1:])
+	}
+}
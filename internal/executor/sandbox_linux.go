@@ -0,0 +1,492 @@
+package executor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// A sandbox is a set of new namespaces: a user namespace, which lets an
+// unprivileged user create the others, a mount namespace whose mounts are
+// all made read-only, a PID namespace with a /proc of its own, so that
+// the command can neither see nor signal processes outside, and unless
+// the network is allowed, a network namespace with nothing in it. Unix
+// sockets that lead out of the sandbox whatever the network, such as the
+// Docker daemon's and the D-Bus buses, are hidden.
+//
+// Go cannot run code between fork and exec, so the shell runs itself to
+// set the namespaces up, twice. The first process, in every namespace
+// but the PID namespace, starts the second as the PID namespace's init
+// and waits for it. It stays in the shell's PID namespace, where it
+// stops and continues along with the command, as the job the shell sees.
+// The second sets up the mounts, runs the command, and reaps what the
+// command leaves behind; when the command exits, it does too, and the
+// kernel kills whatever is left in the namespace.
+
+// Mount flags as statfs reports them, which differ from those of mount.
+const (
+	stNosuid     = 0x2
+	stNodev      = 0x4
+	stNoexec     = 0x8
+	stNoatime    = 0x400
+	stNodiratime = 0x800
+	stRelatime   = 0x1000
+)
+
+// Securebits that keep root, inside the sandbox, from getting
+// capabilities when it execs.
+const (
+	secbitNoroot       = 0x1
+	secbitNorootLocked = 0x2
+)
+
+// hiddenSockets are the sockets, outside the runtime directory, that
+// lead to services able to act outside the sandbox.
+var hiddenSockets = []string{"/run/docker.sock", "/var/run/docker.sock", "/run/dbus/system_bus_socket"}
+
+// sandbox makes cmd run through the shell's sandbox setup, with limits.
+func sandbox(cmd *exec.Cmd, sb *Sandbox, limits Limits) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	args := []string{sandboxInit}
+	if limits != (Limits{}) {
+		// The limits are set only on the command, as they would keep
+		// the processes before it from starting.
+		args = append(args, "-l", formatLimits(limits))
+	}
+	for _, path := range sb.Writable {
+		// Paths are compared with mount points, which are absolute.
+		path, err := filepath.Abs(path)
+		if err == nil {
+			path, err = filepath.EvalSymlinks(path)
+		}
+		if err != nil {
+			return err
+		}
+		args = append(args, "-w", path)
+	}
+	args = append(args, "--", cmd.Path)
+	cmd.Args = append(args, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !sb.Network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	// The user keeps their own IDs inside, with just the capabilities
+	// the setup needs, which the command does not get.
+	uid, gid := os.Getuid(), os.Getgid()
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	attr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_SETPCAP}
+	return nil
+}
+
+// initSandbox is the first process of the sandbox. args are -l LIMITS if
+// there are any, -w PATH for each writable path, then --, the command's
+// path and its arguments. It starts the PID namespace's init with the
+// same arguments and exits as the command did.
+func initSandbox(args []string) {
+	// The init reports how the command ended on status, as it cannot
+	// die of the signal that killed it.
+	status, report, err := os.Pipe()
+	if err != nil {
+		sandboxFailed(err)
+	}
+	if _, err := unix.FcntlInt(report.Fd(), unix.F_SETFD, 0); err != nil {
+		sandboxFailed(err)
+	}
+	reaper := exec.Command("/proc/self/exe")
+	reaper.Args = append([]string{sandboxReaper, "-s", strconv.Itoa(int(report.Fd()))}, args...)
+	reaper.Stdin, reaper.Stdout, reaper.Stderr = os.Stdin, os.Stdout, os.Stderr
+	reaper.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWPID, Pdeathsig: syscall.SIGKILL}
+	// Ctrl+C and Ctrl+\ reach the command from the terminal, and are
+	// caught here only to be dropped: ignoring them would have the
+	// command ignore them too. Other signals are passed on.
+	terminal := make(chan os.Signal, 1)
+	signal.Notify(terminal, syscall.SIGINT, syscall.SIGQUIT)
+	forward := []os.Signal{syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forward...)
+	if err := reaper.Start(); err != nil {
+		sandboxFailed(err)
+	}
+	report.Close()
+	go func() {
+		for {
+			select {
+			case <-terminal:
+			case sig := <-signals:
+				reaper.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err = reaper.Wait()
+	ended, _ := io.ReadAll(status)
+	if sig, ok := strings.CutPrefix(string(ended), "signal "); ok {
+		if n, err := strconv.Atoi(sig); err == nil {
+			signal.Reset()
+			syscall.Kill(os.Getpid(), syscall.Signal(n))
+			// Signals whose default is to be ignored do not end the
+			// process.
+			time.Sleep(100 * time.Millisecond)
+			os.Exit(128 + n)
+		}
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.ExitCode())
+	}
+	if err != nil {
+		sandboxFailed(err)
+	}
+	os.Exit(0)
+}
+
+// initReaper is the init of the sandbox's PID namespace. args are -s FD,
+// where it reports how the command ended, then the arguments of
+// initSandbox.
+func initReaper(args []string) {
+	// Capabilities and the securebits are set per thread, and the
+	// command must be started from the thread that dropped them.
+	runtime.LockOSThread()
+	if len(args) < 2 || args[0] != "-s" {
+		sandboxFailed(fmt.Errorf("usage: %s -s FD [-l LIMITS] [-w PATH]... -- PATH ARG0 [ARG...]", sandboxReaper))
+	}
+	fd, err := strconv.Atoi(args[1])
+	if err != nil {
+		sandboxFailed(err)
+	}
+	syscall.CloseOnExec(fd)
+	status := os.NewFile(uintptr(fd), "status")
+	args = args[2:]
+
+	var limits Limits
+	if len(args) > 1 && args[0] == "-l" {
+		if limits, err = parseLimits(args[1]); err != nil {
+			sandboxFailed(err)
+		}
+		args = args[2:]
+	}
+	var writable []string
+	for len(args) > 1 && args[0] == "-w" {
+		writable = append(writable, args[1])
+		args = args[2:]
+	}
+	if len(args) < 3 || args[0] != "--" {
+		sandboxFailed(fmt.Errorf("usage: %s -s FD [-l LIMITS] [-w PATH]... -- PATH ARG0 [ARG...]", sandboxReaper))
+	}
+	if err := setupSandbox(writable); err != nil {
+		sandboxFailed(err)
+	}
+
+	// Orphans are reparented to this process, which reaps them below.
+	// The terminal's signals are for the command; the Go runtime would
+	// otherwise exit on them.
+	children := make(chan os.Signal, 1)
+	signal.Notify(children, syscall.SIGCHLD)
+	forward := make(chan os.Signal, 1)
+	signal.Notify(forward, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGINT, syscall.SIGQUIT)
+	cmd := &exec.Cmd{Path: args[1], Args: args[2:], Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	if err := limit(cmd, limits); err != nil {
+		sandboxFailed(err)
+	}
+	if err := cmd.Start(); err != nil {
+		sandboxFailed(err)
+	}
+	pid := cmd.Process.Pid
+	for {
+		select {
+		case sig := <-forward:
+			syscall.Kill(pid, sig.(syscall.Signal))
+			continue
+		case <-children:
+		}
+		for {
+			var ws syscall.WaitStatus
+			reaped, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+			if err != nil || reaped <= 0 {
+				break
+			}
+			if reaped != pid {
+				continue
+			}
+			if ws.Signaled() {
+				fmt.Fprintf(status, "signal %d", ws.Signal())
+				os.Exit(128 + int(ws.Signal()))
+			}
+			os.Exit(ws.ExitStatus())
+		}
+	}
+}
+
+func sandboxFailed(err error) {
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+func setupSandbox(writable []string) error {
+	// Nothing mounted here may leak out to the rest of the system.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+	// The writable paths are opened before /tmp's tmpfs can hide them.
+	files := make([]*os.File, len(writable))
+	for i, path := range writable {
+		f, err := os.OpenFile(path, unix.O_PATH, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files[i] = f
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mounting /tmp: %w", err)
+	}
+	// The writable paths become mounts of their own, which are left
+	// alone when the rest are made read-only.
+	for i, path := range writable {
+		if err := mountPoint(path, files[i]); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		source := fmt.Sprintf("/proc/self/fd/%d", files[i].Fd())
+		if err := unix.Mount(source, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	writable = append(writable, "/tmp")
+
+	if err := hideSockets(writable); err != nil {
+		return err
+	}
+	// This process's /proc, of the new PID namespace, hides the
+	// processes outside it.
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mounting /proc: %w", err)
+	}
+
+	// Every mount the command can reach must end up read-only; if one
+	// cannot be made so, the command does not run.
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if underAny(m.point, writable) {
+			continue
+		}
+		reachable, err := m.reachable()
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", m.point, err)
+		}
+		if !reachable {
+			continue
+		}
+		if err := remountReadOnly(m.point); err != nil {
+			return fmt.Errorf("making %s read-only: %w", m.point, err)
+		}
+	}
+	if mounts, err = readMounts(); err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if m.readOnly || underAny(m.point, writable) {
+			continue
+		}
+		if reachable, err := m.reachable(); err != nil || reachable {
+			return fmt.Errorf("%s is still writable", m.point)
+		}
+	}
+
+	// The command must not get the capabilities back, even as root.
+	if err := unix.Prctl(unix.PR_SET_SECUREBITS, secbitNoroot|secbitNorootLocked, 0, 0, 0); err != nil {
+		return fmt.Errorf("dropping capabilities: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("dropping capabilities: %w", err)
+	}
+	return unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+}
+
+// hideSockets covers the user's runtime directory, which holds the
+// D-Bus session bus and other services' sockets, with an empty tmpfs,
+// and the hiddenSockets with /dev/null. Unix sockets are reached through
+// the file system, so no network namespace keeps a command from
+// connecting to them, and a read-only mount does not either. Paths the
+// command is allowed to write to are left alone.
+func hideSockets(writable []string) error {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	paths := append([]string{runtimeDir}, hiddenSockets...)
+	if host, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"), "unix://"); ok {
+		paths = append(paths, host)
+	}
+	for _, path := range paths {
+		path, err := filepath.EvalSymlinks(path)
+		if errors.Is(err, os.ErrNotExist) || err == nil && underAny(path, writable) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("hiding %s: %w", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("hiding %s: %w", path, err)
+		}
+		if info.IsDir() {
+			err = unix.Mount("tmpfs", path, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=0700")
+		} else {
+			err = unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("hiding %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// mountPoint makes sure there is something at path to mount f on, as a
+// path under /tmp is gone once the tmpfs is mounted there.
+func mountPoint(path string, f *os.File) error {
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return os.MkdirAll(path, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, nil, 0o644)
+}
+
+// remountReadOnly makes a mount read-only, keeping the flags it was
+// mounted with, which a user namespace may not change.
+func remountReadOnly(mount string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(mount, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+	for _, f := range []struct{ st, ms uintptr }{
+		{stNosuid, unix.MS_NOSUID},
+		{stNodev, unix.MS_NODEV},
+		{stNoexec, unix.MS_NOEXEC},
+		{stNoatime, unix.MS_NOATIME},
+		{stNodiratime, unix.MS_NODIRATIME},
+		{stRelatime, unix.MS_RELATIME},
+	} {
+		if uintptr(st.Flags)&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+	return unix.Mount("", mount, "", flags, "")
+}
+
+// mount is a mount of the mount namespace.
+type mount struct {
+	id       uint64
+	point    string
+	readOnly bool
+}
+
+// reachable reports whether the mount can be reached by its path: it
+// cannot when another has been mounted on top of it or of a directory
+// above it, or when a directory on the way may not be searched. Without
+// a kernel that tells which mount a path is on, every mount counts as
+// reachable.
+func (m mount) reachable() (bool, error) {
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, m.point, unix.AT_SYMLINK_NOFOLLOW|unix.AT_NO_AUTOMOUNT, unix.STATX_MNT_ID, &stx)
+	switch {
+	case errors.Is(err, unix.ENOENT) || errors.Is(err, unix.EACCES):
+		return false, nil
+	case err != nil:
+		return false, err
+	case stx.Mask&unix.STATX_MNT_ID == 0:
+		return true, nil
+	}
+	return stx.Mnt_id == m.id, nil
+}
+
+// readMounts lists the mount namespace's mounts, from
+// /proc/self/mountinfo.
+func readMounts() ([]mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		options := strings.Split(fields[5], ",")
+		mounts = append(mounts, mount{
+			id:       id,
+			point:    unescapeMount(fields[4]),
+			readOnly: len(options) > 0 && options[0] == "ro",
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMount undoes the octal escapes, such as \040 for a space, in a
+// mount point.
+func unescapeMount(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if n, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// underAny reports whether path is one of dirs or below one.
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package executor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func sandbox(cmd *exec.Cmd, sb *Sandbox, limits Limits) error {
+	return errors.New("sandboxing is only supported on Linux")
+}
+
+func initSandbox(args []string) {}
+
+func initReaper(args []string) {}
@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"shell/internal/lineedit"
+)
+
+// SSH runs commands on a remote host with the ssh client, so that
+// ~/.ssh/config, keys and the agent work as they do for ssh itself.
+// Commands share one connection, which ssh keeps open for ten minutes
+// after the last, so they do not each log in again; Windows' ssh cannot
+// share connections.
+//
+// A command gets a terminal on the remote host when it is run from one,
+// so interactive programs work, and the variables set for it are passed
+// on.
+type SSH struct {
+	Host string
+	// Dir is the remote working directory; empty means the login
+	// directory.
+	Dir string
+}
+
+func (e *SSH) Run(ctx context.Context, c Command) (Result, error) {
+	flag := "-T"
+	if isTerminal(c.Stdin) && isTerminal(c.Stdout) {
+		flag = "-t"
+	}
+	args, err := e.args(flag)
+	if err != nil {
+		return Result{}, err
+	}
+	c.Args = append(append([]string{"ssh"}, args...), "--", e.remoteCommand(c.Args, changedEnv(c.Env)))
+	c.Dir, c.Env, c.ExtraFiles = "", nil, nil
+	return Local{}.Run(ctx, c)
+}
+
+// Pwd changes to dir, relative to Dir, on the remote host and returns the
+// full path it ends up in. It is how a connection is checked too.
+func (e *SSH) Pwd(ctx context.Context, dir string) (string, error) {
+	script := "cd"
+	if dir != "" {
+		script += " " + shellquote.Join(dir)
+	}
+	if e.Dir != "" {
+		script = "cd " + shellquote.Join(e.Dir) + " && " + script
+	}
+	args, err := e.args("-T")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "ssh", append(args, "--", script+" && pwd")...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s", msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Close closes the shared connection.
+func (e *SSH) Close() error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	args, err := e.args("-O")
+	if err != nil {
+		return err
+	}
+	return exec.Command("ssh", append(args, "exit")...).Run()
+}
+
+// ValidHost reports whether host can be passed to ssh as a host: ssh
+// would take one starting with - for an option.
+func ValidHost(host string) bool {
+	return host != "" && !strings.HasPrefix(host, "-")
+}
+
+// args returns ssh's arguments up to the remote command, starting with
+// flag.
+func (e *SSH) args(flag string) ([]string, error) {
+	if !ValidHost(e.Host) {
+		return nil, errors.New("invalid host name")
+	}
+	args := []string{flag}
+	if runtime.GOOS != "windows" {
+		dir, err := controlDir()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args,
+			"-o", "ControlMaster=auto",
+			"-o", "ControlPersist=10m",
+			"-o", "ControlPath="+filepath.Join(dir, "%C"))
+	}
+	return append(args, e.Host), nil
+}
+
+// controlDir returns the directory the shared connections' sockets are
+// in, creating it. Anyone who could create a socket there could take
+// over the user's sessions, so it is private to the user, in
+// $XDG_RUNTIME_DIR or else in ~/.ssh, and never in the shared temporary
+// directory.
+func controlDir() (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".ssh")
+	}
+	dir := filepath.Join(base, "myshell-ssh")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s: not a directory", dir)
+	}
+	if info.Mode().Perm() != 0o700 {
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// remoteCommand returns the command line the remote shell runs for
+// args, in Dir and with env set.
+func (e *SSH) remoteCommand(args, env []string) string {
+	line := "exec "
+	if len(env) > 0 {
+		line += "env " + shellquote.Join(env...) + " "
+	}
+	line += shellquote.Join(args...)
+	if e.Dir != "" {
+		line = "cd " + shellquote.Join(e.Dir) + " && " + line
+	}
+	return line
+}
+
+// isTerminal reports whether one of a command's files is a terminal.
+func isTerminal(f any) bool {
+	file, ok := f.(*os.File)
+	return ok && lineedit.IsTerminal(int(file.Fd()))
+}
@@ -0,0 +1,500 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File keeps the commands of this session, on top of those read at
+// startup, and appends the new ones to a bash-style history file, as
+// Options.Sync says, through a descriptor kept open between them.
+// Several shells can share one file: writes are serialised with a lock
+// file, and the file is only rewritten to compact it back to maxItems,
+// once it grows well past it and at exit if it is past it at all. The
+// directory, host, exit code and duration of a command are only known
+// for this session's entries; the file does not keep them. The file is
+// only read once its entries are first needed, so that a large one does
+// not hold up startup.
+type File struct {
+	items    []Entry
+	file     string
+	maxItems int
+	session  string
+	filter   filter
+	// added is set while the last command Add saw is the last entry, so
+	// Finish knows whether it has an entry to complete.
+	added bool
+	mu    sync.Mutex
+
+	// fileItems counts the entries in the file, as far as this shell
+	// knows; other shells may have appended more.
+	fileItems int
+	// loaded is set once the file has been read.
+	loaded bool
+
+	sync string
+	// out is the file appended to, and pending the entries not written
+	// to it yet.
+	out     *os.File
+	pending []Entry
+}
+
+// maxPending is how many entries SyncExit keeps before writing them.
+const maxPending = 100
+
+func NewFile(file string, options Options) (*File, error) {
+	filter, err := newFilter(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, err
+	}
+	// A file that cannot be read is reported now, rather than when it
+	// is first needed.
+	if f, err := os.Open(file); err == nil {
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &File{
+		file:     file,
+		maxItems: options.size(),
+		session:  newSessionID(),
+		filter:   filter,
+		sync:     options.Sync,
+	}, nil
+}
+
+func (h *File) SessionID() string {
+	return h.session
+}
+
+func (h *File) Add(item string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	last := ""
+	if len(h.items) > 0 {
+		last = h.items[len(h.items)-1].Command
+	}
+	item, h.added = h.filter.apply(item, last)
+	if !h.added {
+		return
+	}
+
+	entry := newEntry(item, h.session)
+	h.items = append(h.items, entry)
+	if len(h.items) > h.maxItems {
+		h.items = h.items[len(h.items)-h.maxItems:]
+	}
+	h.append(entry)
+}
+
+func (h *File) Finish(exitCode int, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.added && len(h.items) > 0 {
+		h.items[len(h.items)-1].finish(exitCode, duration)
+	}
+	h.added = false
+}
+
+// Close writes the commands not written yet at exit, and trims the file
+// to maxItems if this shell knows it holds more.
+func (h *File) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err := h.flush()
+	if h.out != nil {
+		h.out.Close()
+		h.out = nil
+	}
+	if err != nil || h.fileItems <= h.maxItems {
+		return err
+	}
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return h.compact()
+}
+
+// Clear forgets every entry, in memory and in the file.
+func (h *File) Clear() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.items, h.loaded = nil, true
+	h.pending = nil
+	h.added = false
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	h.fileItems = 0
+	return writeFile(h.file, nil)
+}
+
+// Delete removes entry n, counting from 1 as GetAll is numbered, from
+// memory and from the file.
+func (h *File) Delete(n int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	if n < 1 || n > len(h.items) {
+		return fmt.Errorf("%d: history position out of range", n)
+	}
+	if err := h.flush(); err != nil {
+		return err
+	}
+	item := h.items[n-1]
+	h.items = append(h.items[:n-1], h.items[n:]...)
+	h.added = false
+
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	items, err := readEntries(h.file)
+	if err != nil {
+		return err
+	}
+	// Other shells may have added entries since, so find the entry
+	// itself rather than trusting its position.
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].same(item) {
+			items = append(items[:i], items[i+1:]...)
+			break
+		}
+	}
+	h.fileItems = len(items)
+	return writeFile(h.file, items)
+}
+
+// Write saves the entries in memory to path, or to the history file if
+// path is empty, replacing what it held.
+func (h *File) Write(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	if path == "" || path == h.file {
+		unlock, err := h.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		h.fileItems = len(h.items)
+		h.pending = nil
+		path = h.file
+	}
+	return writeFile(path, h.items)
+}
+
+// Read appends the entries of path, or of the history file if path is
+// empty, to those in memory.
+func (h *File) Read(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	if path == "" {
+		path = h.file
+	}
+	items, err := readEntries(path)
+	if err != nil {
+		return err
+	}
+	h.items = append(h.items, items...)
+	if len(h.items) > h.maxItems {
+		h.items = h.items[len(h.items)-h.maxItems:]
+	}
+	return nil
+}
+
+func (h *File) GetAll() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	commands := make([]string, len(h.items))
+	for i, item := range h.items {
+		commands[i] = item.Command
+	}
+	return commands
+}
+
+func (h *File) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	return append([]Entry{}, h.items...)
+}
+
+func (h *File) Sessions() []Session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	return groupSessions(h.items)
+}
+
+// Query filters the entries in memory.
+func (h *File) Query(q Query) ([]Entry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	return q.filter(h.items), nil
+}
+
+// load reads the file the first time its entries are needed. The lock
+// must be held.
+//
+// The file uses bash's timestamp comments, extended with the session ID:
+// a "#<unix time> <session>" line precedes each command. A command that
+// looks like one of those lines is written escaped, as escapeCommand
+// says.
+func (h *File) load() {
+	if h.loaded {
+		return
+	}
+	h.loaded = true
+	items, _ := readEntries(h.file)
+	h.fileItems = len(items)
+	if len(items) > h.maxItems {
+		items = items[len(items)-h.maxItems:]
+	}
+	h.items = items
+}
+
+// readEntries reads a history file. A missing file holds no entries.
+// The file is read in one go and the commands sliced out of it, rather
+// than copied a line at a time, so that one of 100000 entries or more
+// is read quickly.
+func readEntries(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	text := string(data)
+	items := make([]Entry, 0, strings.Count(text, "\n")/2+1)
+	var meta Entry
+	for text != "" {
+		var line string
+		line, text, _ = strings.Cut(text, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if m, ok := parseMeta(line); ok {
+			meta = m
+			continue
+		}
+		meta.Command = unescapeCommand(line)
+		items = append(items, meta)
+		meta = Entry{}
+	}
+	return items, nil
+}
+
+func parseMeta(line string) (Entry, bool) {
+	if !strings.HasPrefix(line, "#") {
+		return Entry{}, false
+	}
+	stamp, session, _ := strings.Cut(line[1:], " ")
+	sec, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Time: time.Unix(sec, 0), Session: session}, true
+}
+
+func writeEntry(w io.Writer, item Entry) error {
+	if !item.Time.IsZero() {
+		if _, err := fmt.Fprintf(w, "#%d %s\n", item.Time.Unix(), item.Session); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, escapeCommand(item.Command)+"\n")
+	return err
+}
+
+// escapeCommand adds a backslash to a command that would read back as a
+// metadata line, such as the comment "#1700000000 note", and to one that
+// is such a line after backslashes, so that it reads back as itself.
+// unescapeCommand takes the backslash off again.
+func escapeCommand(command string) string {
+	if _, ok := parseMeta(strings.TrimLeft(command, `\`)); ok {
+		return `\` + command
+	}
+	return command
+}
+
+func unescapeCommand(line string) string {
+	if !strings.HasPrefix(line, `\`) {
+		return line
+	}
+	if _, ok := parseMeta(strings.TrimLeft(line, `\`)); ok {
+		return line[1:]
+	}
+	return line
+}
+
+// lock takes the lock that every shell sharing the history file holds
+// while writing it. The lock lives in a separate file so compaction can
+// replace the history file itself.
+func (h *File) lock() (unlock func(), err error) {
+	file, err := os.OpenFile(h.file+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// append adds one entry to the end of the file, or keeps it for later
+// under SyncExit.
+func (h *File) append(item Entry) error {
+	h.pending = append(h.pending, item)
+	if h.sync == SyncExit && len(h.pending) < maxPending {
+		return nil
+	}
+	return h.flush()
+}
+
+// flush writes the entries pending to the end of the file, compacting it
+// once it holds twice as many entries as are kept.
+func (h *File) flush() error {
+	if len(h.pending) == 0 {
+		return nil
+	}
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := h.open(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, item := range h.pending {
+		writeEntry(&buf, item)
+	}
+	// Write the entries in one call so they cannot interleave with
+	// others.
+	if _, err := h.out.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if h.sync == SyncFsync {
+		if err := h.out.Sync(); err != nil {
+			return err
+		}
+	}
+	if !keepOpen {
+		h.out.Close()
+		h.out = nil
+	}
+
+	h.fileItems += len(h.pending)
+	h.pending = nil
+	if h.fileItems >= 2*h.maxItems {
+		return h.compact()
+	}
+	return nil
+}
+
+// open opens the file to append to, unless it is open already. It opens
+// it again if it was replaced since, as compacting it in any shell does.
+// The lock must be held.
+func (h *File) open() error {
+	if h.out != nil {
+		open, err := h.out.Stat()
+		current, cerr := os.Stat(h.file)
+		if err == nil && cerr == nil && os.SameFile(open, current) {
+			return nil
+		}
+		h.out.Close()
+		h.out = nil
+	}
+	out, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	h.out = out
+	return nil
+}
+
+// compact rewrites the file with only its newest maxItems entries,
+// closing the file appended to, which it replaces. The lock must be
+// held.
+func (h *File) compact() error {
+	if h.out != nil {
+		h.out.Close()
+		h.out = nil
+	}
+	items, err := readEntries(h.file)
+	if err != nil {
+		return err
+	}
+	h.fileItems = len(items)
+	if len(items) <= h.maxItems {
+		return nil
+	}
+	items = items[len(items)-h.maxItems:]
+	if err := writeFile(h.file, items); err != nil {
+		return err
+	}
+	h.fileItems = len(items)
+	return nil
+}
+
+// writeFile replaces path with items. It writes a temporary file and
+// renames it over path so readers never see a partial file.
+func writeFile(path string, items []Entry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, item := range items {
+		if err := writeEntry(writer, item); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
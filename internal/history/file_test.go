@@ -0,0 +1,208 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestFile(t *testing.T, path string, options Options) *File {
+	t.Helper()
+	h, err := NewFile(path, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// commandsIn returns the commands a history file holds.
+func commandsIn(t *testing.T, path string) []string {
+	t.Helper()
+	items, err := readEntries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, item := range items {
+		commands = append(commands, item.Command)
+	}
+	return commands
+}
+
+func TestFileSync(t *testing.T) {
+	for _, sync := range []string{"", SyncWrite, SyncFsync} {
+		path := filepath.Join(t.TempDir(), "history")
+		h := newTestFile(t, path, Options{Sync: sync})
+		h.Add("one")
+		h.Add("two")
+		if got, want := commandsIn(t, path), []string{"one", "two"}; !slices.Equal(got, want) {
+			t.Errorf("sync %q: the file holds %q before Close, want %q", sync, got, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "history")
+	h := newTestFile(t, path, Options{Sync: SyncExit})
+	h.Add("one")
+	h.Add("two")
+	if got := commandsIn(t, path); len(got) != 0 {
+		t.Errorf("sync exit: the file holds %q before Close, want nothing", got)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := commandsIn(t, path), []string{"one", "two"}; !slices.Equal(got, want) {
+		t.Errorf("sync exit: the file holds %q after Close, want %q", got, want)
+	}
+}
+
+func TestFileShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	a := newTestFile(t, path, Options{})
+	b := newTestFile(t, path, Options{})
+	a.Add("a1")
+	b.Add("b1")
+	a.Add("a2")
+	b.Add("b2")
+	if got, want := commandsIn(t, path), []string{"a1", "b1", "a2", "b2"}; !slices.Equal(got, want) {
+		t.Errorf("the file holds %q, want %q", got, want)
+	}
+
+	// Each shell lists its own commands, on top of those it read.
+	if got, want := a.GetAll(), []string{"a1", "a2"}; !slices.Equal(got, want) {
+		t.Errorf("a lists %q, want %q", got, want)
+	}
+	c := newTestFile(t, path, Options{})
+	if got, want := c.GetAll(), []string{"a1", "b1", "a2", "b2"}; !slices.Equal(got, want) {
+		t.Errorf("a new shell lists %q, want %q", got, want)
+	}
+
+	// Deleting finds the entry in the file, wherever the other shells'
+	// commands put it.
+	if err := a.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := commandsIn(t, path), []string{"b1", "a2", "b2"}; !slices.Equal(got, want) {
+		t.Errorf("after a deletes a1, the file holds %q, want %q", got, want)
+	}
+	b.Add("b3")
+	if got, want := commandsIn(t, path), []string{"b1", "a2", "b2", "b3"}; !slices.Equal(got, want) {
+		t.Errorf("after b adds b3, the file holds %q, want %q", got, want)
+	}
+}
+
+func TestFileCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := newTestFile(t, path, Options{Size: 3})
+	for _, command := range []string{"1", "2", "3", "4", "5"} {
+		h.Add(command)
+	}
+	// The file is only rewritten once it holds twice as many entries
+	// as are kept.
+	if got := commandsIn(t, path); len(got) != 5 {
+		t.Errorf("the file holds %q, want all 5 commands", got)
+	}
+	h.Add("6")
+	if got, want := commandsIn(t, path), []string{"4", "5", "6"}; !slices.Equal(got, want) {
+		t.Errorf("after compacting, the file holds %q, want %q", got, want)
+	}
+	h.Add("7")
+	if got, want := commandsIn(t, path), []string{"4", "5", "6", "7"}; !slices.Equal(got, want) {
+		t.Errorf("after appending again, the file holds %q, want %q", got, want)
+	}
+	// Closing trims it to the size kept.
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := commandsIn(t, path), []string{"5", "6", "7"}; !slices.Equal(got, want) {
+		t.Errorf("after Close, the file holds %q, want %q", got, want)
+	}
+}
+
+func TestFileClearWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history")
+	h := newTestFile(t, path, Options{})
+	h.Add("one")
+	h.Add("two")
+
+	export := filepath.Join(dir, "export")
+	if err := h.Write(export); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got := commandsIn(t, path); len(got) != 0 {
+		t.Errorf("after Clear, the file holds %q", got)
+	}
+	h.Add("three")
+	if err := h.Read(export); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.GetAll(), []string{"three", "one", "two"}; !slices.Equal(got, want) {
+		t.Errorf("after Read, the history is %q, want %q", got, want)
+	}
+	if err := h.Write(""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := commandsIn(t, path), []string{"three", "one", "two"}; !slices.Equal(got, want) {
+		t.Errorf("after Write, the file holds %q, want %q", got, want)
+	}
+}
+
+func TestFileDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("#1700000000 old\nmake\n#1700000001 old\nls\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestFile(t, path, Options{})
+	h.Add("make")
+	h.Add("pwd")
+
+	// The entry added in this session has a monotonic clock reading and
+	// nanoseconds that the file does not keep. Delete must still find
+	// it there, and not the same command from another session.
+	if err := h.Delete(3); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.GetAll(), []string{"make", "ls", "pwd"}; !slices.Equal(got, want) {
+		t.Errorf("after Delete(3), the history is %q, want %q", got, want)
+	}
+	if got, want := commandsIn(t, path), []string{"make", "ls", "pwd"}; !slices.Equal(got, want) {
+		t.Errorf("after Delete(3), the file holds %q, want %q", got, want)
+	}
+	if err := h.Delete(4); err == nil {
+		t.Error("Delete(4) of 3 entries did not fail")
+	}
+}
+
+func TestFileCommandsLikeMetadata(t *testing.T) {
+	commands := []string{
+		"#1700000000 note to self",
+		"#42",
+		`\#1700000000`,
+		`\\#1 x`,
+		`\ls`,
+		"# not a time",
+		"echo #1700000000",
+	}
+	path := filepath.Join(t.TempDir(), "history")
+	h := newTestFile(t, path, Options{})
+	for _, command := range commands {
+		h.Add(command)
+	}
+	if got := commandsIn(t, path); !slices.Equal(got, commands) {
+		t.Errorf("the file reads back as %q, want %q", got, commands)
+	}
+	items, err := readEntries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if item.Session != h.SessionID() {
+			t.Errorf("%q: session %q, want %q", item.Command, item.Session, h.SessionID())
+		}
+	}
+}
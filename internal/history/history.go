@@ -1,73 +1,237 @@
 package history
 
 import (
-	"bufio"
+	"fmt"
 	"os"
-	"sync"
+	"regexp"
+	"strings"
+	"time"
 )
 
-type History struct {
-	items    []string
-	file     string
-	maxItems int
-	mu       sync.Mutex
+// History records the commands run in the shell. File keeps them in a
+// bash-style text file, SQLite in a database with richer metadata.
+type History interface {
+	// Add records a command as typed, unless the options say to skip
+	// it. Leading blanks are dropped from what is stored.
+	Add(item string)
+	// Finish completes the entry of the command Add last recorded once
+	// it has run.
+	Finish(exitCode int, duration time.Duration)
+
+	GetAll() []string
+	Entries() []Entry
+	// Sessions returns the history grouped by session, in the order
+	// each session first appears.
+	Sessions() []Session
+	// SessionID identifies the running shell in the history.
+	SessionID() string
+	// Query returns the entries matching q, oldest first.
+	Query(q Query) ([]Entry, error)
+
+	Clear() error
+	Delete(n int) error
+	Write(path string) error
+	Read(path string) error
+	Close() error
 }
 
-func New(file string) (*History, error) {
-	h := &History{
-		file:     file,
-		maxItems: 1000,
-	}
-	if err := h.load(); err != nil {
-		return nil, err
+// DefaultSize is how many entries a history keeps when Options.Size does
+// not say.
+const DefaultSize = 1000
+
+// Entry is a single history item. Time and Session are zero for entries
+// read from files written before metadata was recorded. Dir and Host are
+// where the command ran; ExitCode and Duration are set once it finished.
+type Entry struct {
+	Command string
+	Time    time.Time
+	Session string
+
+	Dir      string
+	Host     string
+	Finished bool
+	ExitCode int
+	Duration time.Duration
+}
+
+func newEntry(command, session string) Entry {
+	dir, _ := os.Getwd()
+	host, _ := os.Hostname()
+	return Entry{Command: command, Time: time.Now(), Session: session, Dir: dir, Host: host}
+}
+
+func (e *Entry) finish(exitCode int, duration time.Duration) {
+	e.Finished = true
+	e.ExitCode = exitCode
+	e.Duration = duration
+}
+
+// same reports whether e and other record the same command, comparing
+// only what every backend stores. Times are compared in whole seconds,
+// as history files keep them: == would also compare the nanoseconds and
+// monotonic clock reading of an entry made in this session.
+func (e Entry) same(other Entry) bool {
+	return e.Command == other.Command && e.Session == other.Session && e.Time.Unix() == other.Time.Unix()
+}
+
+func newSessionID() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().Unix())
+}
+
+// Session groups the entries run from one shell instance.
+type Session struct {
+	ID      string
+	Start   time.Time
+	End     time.Time
+	Entries []Entry
+	// Indexes holds each entry's position in the full history, so entries
+	// can be numbered the same way as in a plain listing.
+	Indexes []int
+}
+
+// Query selects history entries. Zero fields match everything.
+type Query struct {
+	// Dir keeps commands run in this directory.
+	Dir string
+	// Failed keeps commands that finished with a non-zero status.
+	Failed bool
+}
+
+func (q Query) match(e Entry) bool {
+	if q.Dir != "" && e.Dir != q.Dir {
+		return false
 	}
-	return h, nil
+	return !q.Failed || (e.Finished && e.ExitCode != 0)
 }
 
-func (h *History) Add(item string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+func (q Query) filter(items []Entry) []Entry {
+	var matched []Entry
+	for _, item := range items {
+		if q.match(item) {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
 
-	h.items = append(h.items, item)
-	if len(h.items) > h.maxItems {
-		h.items = h.items[len(h.items)-h.maxItems:]
+func groupSessions(items []Entry) []Session {
+	var sessions []Session
+	byID := make(map[string]int)
+	for i, item := range items {
+		n, ok := byID[item.Session]
+		if !ok {
+			n = len(sessions)
+			byID[item.Session] = n
+			sessions = append(sessions, Session{ID: item.Session, Start: item.Time})
+		}
+		s := &sessions[n]
+		s.Entries = append(s.Entries, item)
+		s.Indexes = append(s.Indexes, i)
+		if s.Start.IsZero() || (!item.Time.IsZero() && item.Time.Before(s.Start)) {
+			s.Start = item.Time
+		}
+		if item.Time.After(s.End) {
+			s.End = item.Time
+		}
 	}
-	h.save()
+	return sessions
 }
 
-func (h *History) GetAll() []string {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// Options control which commands Add records.
+type Options struct {
+	// IgnoreDups skips a command identical to the one before it.
+	IgnoreDups bool
+	// IgnoreSpace skips commands typed with a leading space.
+	IgnoreSpace bool
+	// Ignore lists patterns of commands not to record. '*' matches any
+	// text and '?' any single character, as in bash's HISTIGNORE.
+	Ignore []string
 
-	return append([]string{}, h.items...)
+	// Secrets lists regular expressions matching secrets such as tokens
+	// and passwords; DefaultSecrets is used when it is empty. When a
+	// pattern has groups, only the groups are secret.
+	Secrets []string
+	// SecretAction is SecretRedact (the default) to store commands with
+	// their secrets masked, SecretSkip to not store them, or SecretKeep.
+	SecretAction string
+
+	// Size is how many entries are kept, DefaultSize if it is 0.
+	Size int
+	// Sync is when File writes the commands added to the file:
+	// SyncWrite (the default), SyncFsync or SyncExit.
+	Sync string
 }
 
-func (h *History) load() error {
-	file, err := os.Open(h.file)
-	if err != nil {
-		return nil
+// When File writes the commands added to its file.
+const (
+	// SyncWrite appends each command as it is added, where other shells
+	// see it at once.
+	SyncWrite = "write"
+	// SyncFsync also waits for it to reach the disk, so that it
+	// survives the machine crashing.
+	SyncFsync = "fsync"
+	// SyncExit keeps the commands in memory until the history is
+	// closed, or maxPending of them pile up, for slow file systems.
+	SyncExit = "exit"
+)
+
+// size returns how many entries are kept.
+func (o Options) size() int {
+	if o.Size > 0 {
+		return o.Size
 	}
-	defer file.Close()
+	return DefaultSize
+}
+
+// filter applies Options to the commands passed to Add.
+type filter struct {
+	options Options
+	ignore  []*regexp.Regexp
+	secrets secrets
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		h.items = append(h.items, scanner.Text())
+func newFilter(options Options) (filter, error) {
+	f := filter{options: options}
+	for _, pattern := range options.Ignore {
+		f.ignore = append(f.ignore, compilePattern(pattern))
 	}
-	return scanner.Err()
+	var err error
+	f.secrets, err = newSecrets(options.SecretAction, options.Secrets)
+	return f, err
 }
 
-func (h *History) save() error {
-	file, err := os.Create(h.file)
-	if err != nil {
-		return err
+// apply returns item as it should be stored and whether to store it at
+// all, given the last command stored.
+func (f filter) apply(item, last string) (string, bool) {
+	if f.options.IgnoreSpace && (strings.HasPrefix(item, " ") || strings.HasPrefix(item, "\t")) {
+		return "", false
 	}
-	defer file.Close()
+	item = strings.TrimLeft(item, " \t")
+	for _, re := range f.ignore {
+		if re.MatchString(item) {
+			return "", false
+		}
+	}
+	item, ok := f.secrets.apply(item)
+	if !ok || (f.options.IgnoreDups && item == last) {
+		return "", false
+	}
+	return item, true
+}
 
-	writer := bufio.NewWriter(file)
-	for _, item := range h.items {
-		if _, err := writer.WriteString(item + "\n"); err != nil {
-			return err
+func compilePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
 		}
 	}
-	return writer.Flush()
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
 }
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package history
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepOpen says the file appended to can stay open between writes, as
+// it can still be replaced while it is.
+const keepOpen = true
+
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
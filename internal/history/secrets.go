@@ -0,0 +1,106 @@
+package history
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// What Add does with a command that contains a secret.
+const (
+	SecretRedact = "redact"
+	SecretSkip   = "skip"
+	SecretKeep   = "keep"
+)
+
+const redacted = "[REDACTED]"
+
+// secretValue matches the value a secret is given: a word, or a quoted
+// string up to its closing quote. Its groups are the value without the
+// quotes.
+const secretValue = `(?:'([^']*)'|"([^"]*)"|([^\s'"]+))`
+
+// DefaultSecrets are the patterns used when Options.Secrets is empty.
+var DefaultSecrets = []string{
+	// AWS access key IDs and secret keys.
+	`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`,
+	`(?i)aws_secret_access_key\s*[=:]\s*` + secretValue,
+	// GitHub, GitLab and Slack tokens.
+	`\b(gh[pousr]_[A-Za-z0-9]{36,})\b`,
+	`\b(glpat-[A-Za-z0-9_-]{20,})\b`,
+	`\b(xox[abprs]-[A-Za-z0-9-]{10,})\b`,
+	// Bearer tokens in headers.
+	`(?i)authorization:\s*(?:bearer|token)\s+([^\s'"]+)`,
+	// --password=... and similar flags, and NAME=value assignments.
+	`(?i)--?(?:password|passwd|pass|token|secret|api-?key)[= ]` + secretValue,
+	`(?i)\b[A-Z_]*(?:PASSWORD|PASSWD|TOKEN|SECRET|API_?KEY)=` + secretValue,
+	// Credentials in URLs.
+	`://[^/\s:@]+:([^/\s@]+)@`,
+}
+
+type secrets struct {
+	action   string
+	patterns []*regexp.Regexp
+}
+
+func newSecrets(action string, patterns []string) (secrets, error) {
+	switch action {
+	case "":
+		action = SecretRedact
+	case SecretRedact, SecretSkip, SecretKeep:
+	default:
+		return secrets{}, fmt.Errorf("unknown secret action %q", action)
+	}
+	if len(patterns) == 0 {
+		patterns = DefaultSecrets
+	}
+
+	s := secrets{action: action}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return secrets{}, fmt.Errorf("secret pattern %q: %w", pattern, err)
+		}
+		s.patterns = append(s.patterns, re)
+	}
+	return s, nil
+}
+
+// apply masks the secrets in item, or reports that item must not be
+// stored at all.
+func (s secrets) apply(item string) (string, bool) {
+	if s.action == SecretKeep {
+		return item, true
+	}
+	for _, re := range s.patterns {
+		matches := re.FindAllStringSubmatchIndex(item, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if s.action == SecretSkip {
+			return "", false
+		}
+		item = redact(item, matches)
+	}
+	return item, true
+}
+
+// redact replaces each match with a placeholder. When the pattern has
+// groups only the groups are replaced, keeping e.g. the flag name.
+func redact(item string, matches [][]int) string {
+	var spans [][2]int
+	for _, m := range matches {
+		if len(m) == 2 {
+			spans = append(spans, [2]int{m[0], m[1]})
+			continue
+		}
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				spans = append(spans, [2]int{m[i], m[i+1]})
+			}
+		}
+	}
+	for i := len(spans) - 1; i >= 0; i-- {
+		item = item[:spans[i][0]] + redacted + item[spans[i][1]:]
+	}
+	return item
+}
@@ -0,0 +1,247 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS history (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	command     TEXT    NOT NULL,
+	time        INTEGER NOT NULL,
+	session     TEXT    NOT NULL,
+	dir         TEXT    NOT NULL DEFAULT '',
+	host        TEXT    NOT NULL DEFAULT '',
+	exit_code   INTEGER,
+	duration_ms INTEGER
+);
+CREATE INDEX IF NOT EXISTS history_dir ON history (dir);
+`
+
+// SQLite keeps the history in a database shared by every shell, along
+// with where each command ran, its exit code and how long it took.
+// Listings show the newest Options.Size entries of all shells.
+type SQLite struct {
+	db      *sql.DB
+	session string
+	filter  filter
+	size    int
+	// lastID is the row of the command Add last recorded, or 0 if it
+	// skipped the command.
+	lastID int64
+	mu     sync.Mutex
+}
+
+func NewSQLite(path string, options Options) (*SQLite, error) {
+	filter, err := newFilter(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &SQLite{db: db, session: newSessionID(), filter: filter, size: options.size()}, nil
+}
+
+func (h *SQLite) SessionID() string {
+	return h.session
+}
+
+func (h *SQLite) Add(item string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID = 0
+	var last string
+	h.db.QueryRow(`SELECT command FROM history ORDER BY id DESC LIMIT 1`).Scan(&last)
+	item, ok := h.filter.apply(item, last)
+	if !ok {
+		return
+	}
+	entry := newEntry(item, h.session)
+	res, err := h.db.Exec(`INSERT INTO history (command, time, session, dir, host) VALUES (?, ?, ?, ?, ?)`,
+		entry.Command, entry.Time.Unix(), entry.Session, entry.Dir, entry.Host)
+	if err != nil {
+		return
+	}
+	h.lastID, _ = res.LastInsertId()
+}
+
+func (h *SQLite) Finish(exitCode int, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lastID != 0 {
+		h.db.Exec(`UPDATE history SET exit_code = ?, duration_ms = ? WHERE id = ?`,
+			exitCode, duration.Milliseconds(), h.lastID)
+	}
+	h.lastID = 0
+}
+
+func (h *SQLite) GetAll() []string {
+	entries := h.Entries()
+	commands := make([]string, len(entries))
+	for i, entry := range entries {
+		commands[i] = entry.Command
+	}
+	return commands
+}
+
+func (h *SQLite) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, _ := h.recent()
+	return entries
+}
+
+func (h *SQLite) Sessions() []Session {
+	return groupSessions(h.Entries())
+}
+
+// Query searches the whole database, not just the entries listed.
+func (h *SQLite) Query(q Query) ([]Entry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	query := `SELECT id, command, time, session, dir, host, exit_code, duration_ms FROM history WHERE 1 = 1`
+	var args []interface{}
+	if q.Dir != "" {
+		query += ` AND dir = ?`
+		args = append(args, q.Dir)
+	}
+	if q.Failed {
+		query += ` AND exit_code != 0`
+	}
+	entries, _, err := h.scan(query+` ORDER BY id`, args...)
+	return entries, err
+}
+
+func (h *SQLite) Clear() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID = 0
+	_, err := h.db.Exec(`DELETE FROM history`)
+	return err
+}
+
+func (h *SQLite) Delete(n int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ids, err := h.scan(recentQuery, h.size)
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > len(ids) {
+		return fmt.Errorf("%d: history position out of range", n)
+	}
+	if ids[n-1] == h.lastID {
+		h.lastID = 0
+	}
+	_, err = h.db.Exec(`DELETE FROM history WHERE id = ?`, ids[n-1])
+	return err
+}
+
+// Write exports the listed entries to path in the history file format.
+// The database itself is always up to date, so an empty path does
+// nothing.
+func (h *SQLite) Write(path string) error {
+	if path == "" {
+		return nil
+	}
+	return writeFile(path, h.Entries())
+}
+
+// Read imports the entries of a history file into the database. An
+// empty path does nothing, since the database is read on every listing.
+func (h *SQLite) Read(path string) error {
+	if path == "" {
+		return nil
+	}
+	items, err := readEntries(path)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.Time.IsZero() {
+			item.Time = time.Now()
+		}
+		_, err := tx.Exec(`INSERT INTO history (command, time, session) VALUES (?, ?, ?)`,
+			item.Command, item.Time.Unix(), item.Session)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (h *SQLite) Close() error {
+	return h.db.Close()
+}
+
+// recentQuery selects the newest entries, oldest first.
+const recentQuery = `SELECT * FROM (
+	SELECT id, command, time, session, dir, host, exit_code, duration_ms
+	FROM history ORDER BY id DESC LIMIT ?
+) ORDER BY id`
+
+func (h *SQLite) recent() ([]Entry, error) {
+	entries, _, err := h.scan(recentQuery, h.size)
+	return entries, err
+}
+
+func (h *SQLite) scan(query string, args ...interface{}) ([]Entry, []int64, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	var ids []int64
+	for rows.Next() {
+		var (
+			id         int64
+			entry      Entry
+			stamp      int64
+			exitCode   sql.NullInt64
+			durationMs sql.NullInt64
+		)
+		err := rows.Scan(&id, &entry.Command, &stamp, &entry.Session, &entry.Dir, &entry.Host, &exitCode, &durationMs)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.Time = time.Unix(stamp, 0)
+		if exitCode.Valid {
+			entry.finish(int(exitCode.Int64), time.Duration(durationMs.Int64)*time.Millisecond)
+		}
+		entries = append(entries, entry)
+		ids = append(ids, id)
+	}
+	return entries, ids, rows.Err()
+}
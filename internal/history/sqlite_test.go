@@ -0,0 +1,148 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestSQLite(t *testing.T, path string, options Options) *SQLite {
+	t.Helper()
+	h, err := NewSQLite(path, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestSQLiteAdd(t *testing.T) {
+	h := newTestSQLite(t, filepath.Join(t.TempDir(), "history.db"), Options{IgnoreDups: true, IgnoreSpace: true})
+	for _, command := range []string{"ls", "ls", " secret", "make", "make", "git status"} {
+		h.Add(command)
+	}
+	if got, want := h.GetAll(), []string{"ls", "make", "git status"}; !slices.Equal(got, want) {
+		t.Errorf("GetAll() = %q, want %q", got, want)
+	}
+}
+
+func TestSQLiteFinishAndQuery(t *testing.T) {
+	h := newTestSQLite(t, filepath.Join(t.TempDir(), "history.db"), Options{})
+	h.Add("true")
+	h.Finish(0, 20*time.Millisecond)
+	h.Add("false")
+	h.Finish(1, 5*time.Millisecond)
+	h.Add("sleep 100")
+
+	entries := h.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Entries() = %v, want 3 entries", entries)
+	}
+	dir, _ := os.Getwd()
+	for _, e := range entries {
+		if e.Session != h.SessionID() || e.Dir != dir || e.Time.IsZero() {
+			t.Errorf("entry %q: session %q, dir %q, time %v; want this session and directory", e.Command, e.Session, e.Dir, e.Time)
+		}
+	}
+	if e := entries[1]; !e.Finished || e.ExitCode != 1 || e.Duration != 5*time.Millisecond {
+		t.Errorf("false: finished %v, exit code %d, duration %v; want true, 1, 5ms", e.Finished, e.ExitCode, e.Duration)
+	}
+	if entries[2].Finished {
+		t.Error("sleep 100 is finished before Finish was called")
+	}
+
+	failed, err := h.Query(Query{Failed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Command != "false" {
+		t.Errorf("Query(Failed) = %v, want only false", failed)
+	}
+	here, err := h.Query(Query{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(here) != 3 {
+		t.Errorf("Query(Dir) = %v, want all 3 entries", here)
+	}
+	elsewhere, err := h.Query(Query{Dir: "/nonexistent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elsewhere) != 0 {
+		t.Errorf("Query(Dir: /nonexistent) = %v, want none", elsewhere)
+	}
+}
+
+func TestSQLiteSharedAndSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	a := newTestSQLite(t, path, Options{Size: 3})
+	b := newTestSQLite(t, path, Options{Size: 3})
+	a.Add("one")
+	b.Add("two")
+	a.Add("three")
+	b.Add("four")
+
+	// Both shells list the newest entries of either.
+	want := []string{"two", "three", "four"}
+	for _, h := range []*SQLite{a, b} {
+		if got := h.GetAll(); !slices.Equal(got, want) {
+			t.Errorf("GetAll() = %q, want %q", got, want)
+		}
+	}
+	// Queries search everything, not just what is listed.
+	all, err := a.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Errorf("Query() = %v, want 4 entries", all)
+	}
+}
+
+func TestSQLiteDeleteAndClear(t *testing.T) {
+	h := newTestSQLite(t, filepath.Join(t.TempDir(), "history.db"), Options{})
+	for _, command := range []string{"a", "b", "c"} {
+		h.Add(command)
+	}
+	if err := h.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.GetAll(), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("after Delete(2), GetAll() = %q, want %q", got, want)
+	}
+	if err := h.Delete(3); err == nil {
+		t.Error("Delete(3) of 2 entries did not fail")
+	}
+	if err := h.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.GetAll(); len(got) != 0 {
+		t.Errorf("after Clear, GetAll() = %q", got)
+	}
+}
+
+func TestSQLiteWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestSQLite(t, filepath.Join(dir, "history.db"), Options{})
+	h.Add("echo one")
+	h.Add("echo two")
+	export := filepath.Join(dir, "history.txt")
+	if err := h.Write(export); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestSQLite(t, filepath.Join(dir, "other.db"), Options{})
+	if err := other.Read(export); err != nil {
+		t.Fatal(err)
+	}
+	entries := other.Entries()
+	if got, want := other.GetAll(), []string{"echo one", "echo two"}; !slices.Equal(got, want) {
+		t.Fatalf("read back %q, want %q", got, want)
+	}
+	if entries[0].Session != h.SessionID() {
+		t.Errorf("read back session %q, want %q", entries[0].Session, h.SessionID())
+	}
+}
@@ -0,0 +1,116 @@
+package lineedit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// readlineEditor is an Editor backed by chzyer/readline, for platforms
+// the native editor does not support and for anyone who prefers it.
+type readlineEditor struct {
+	rl *readline.Instance
+}
+
+type completeFunc func(line []rune, pos int) ([][]rune, int)
+
+// Do returns what each completion adds to the word, as readline wants.
+// It can only add to it, so completions that do not start with the word
+// are left out.
+func (f completeFunc) Do(line []rune, pos int) ([][]rune, int) {
+	completions, length := f(line, pos)
+	word := string(line[pos-length : pos])
+	var suffixes [][]rune
+	for _, completion := range completions {
+		if text := string(completion); strings.HasPrefix(text, word) {
+			suffixes = append(suffixes, []rune(text[len(word):]))
+		}
+	}
+	return suffixes, length
+}
+
+type silentPainter struct{}
+
+func (silentPainter) Paint(line []rune, pos int) []rune {
+	return nil
+}
+
+func newReadline(cfg Config) (Editor, error) {
+	// readline reads the process's stdin through a reader it can cancel
+	// on Close, so only the output is passed on.
+	rlConfig := &readline.Config{
+		Prompt: cfg.Prompt,
+		Stdout: cfg.Stdout,
+	}
+	if cfg.Complete != nil {
+		rlConfig.AutoComplete = completeFunc(cfg.Complete)
+	}
+	if cfg.FilterKey != nil {
+		rlConfig.FuncFilterInputRune = cfg.FilterKey
+	}
+	if cfg.OnChange != nil {
+		rlConfig.Listener = readline.FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+			cfg.OnChange(line, pos, key)
+			return nil, 0, false
+		})
+	}
+	rlConfig.VimMode = cfg.Keymap == KeymapVi
+	if cfg.LineMode {
+		rlConfig.FuncIsTerminal = func() bool { return false }
+	}
+
+	rl, err := readline.NewEx(rlConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing readline: %w", err)
+	}
+	return &readlineEditor{rl: rl}, nil
+}
+
+func (e *readlineEditor) Readline() (string, error) {
+	return e.ReadlineWithDefault("")
+}
+
+func (e *readlineEditor) ReadlineWithDefault(text string) (string, error) {
+	line, err := e.rl.ReadlineWithDefault(text)
+	if err == readline.ErrInterrupt {
+		err = ErrInterrupt
+	}
+	return line, err
+}
+
+func (e *readlineEditor) ReadPassword(prompt string) (string, error) {
+	cfg := e.rl.GenPasswordConfig()
+	cfg.Prompt = prompt
+	cfg.EnableMask = false
+	cfg.Painter = silentPainter{}
+	line, err := e.rl.ReadPasswordWithConfig(cfg)
+	if err == readline.ErrInterrupt {
+		err = ErrInterrupt
+	}
+	return string(line), err
+}
+
+func (e *readlineEditor) SetPrompt(prompt string)     { e.rl.SetPrompt(prompt) }
+func (e *readlineEditor) SetBuffer(line string)       { e.rl.Operation.SetBuffer(line) }
+func (e *readlineEditor) Refresh()                    { e.rl.Refresh() }
+func (e *readlineEditor) Write(p []byte) (int, error) { return e.rl.Write(p) }
+func (e *readlineEditor) IsTerminal() bool            { return e.rl.Config.FuncIsTerminal() }
+func (e *readlineEditor) SetKeymap(keymap string)     { e.rl.SetVimMode(keymap == KeymapVi) }
+
+// Mode returns "", as readline does not say which vi mode it is in.
+func (e *readlineEditor) Mode() string { return "" }
+
+func (e *readlineEditor) ResetHistory() { e.rl.ResetHistory() }
+func (e *readlineEditor) SaveHistory(line string) error {
+	return e.rl.SaveHistory(line)
+}
+func (e *readlineEditor) SetHistory(lines []string) {
+	e.rl.ResetHistory()
+	for _, line := range lines {
+		e.rl.SaveHistory(line)
+	}
+}
+func (e *readlineEditor) HistoryEnable()  { e.rl.HistoryEnable() }
+func (e *readlineEditor) HistoryDisable() { e.rl.HistoryDisable() }
+func (e *readlineEditor) Close() error    { return e.rl.Close() }
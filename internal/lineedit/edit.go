@@ -0,0 +1,375 @@
+package lineedit
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// action is a kind of edit.
+type action int
+
+const (
+	actNone action = iota
+	actInsert
+	actKill
+	actYank
+	actComplete
+	actOther
+)
+
+// snapshot is a state of the line to undo back to.
+type snapshot struct {
+	buf []rune
+	pos int
+}
+
+// killRing holds killed text for yanking back, most recent last.
+type killRing struct {
+	texts [][]rune
+	// yank is the index of the text last yanked.
+	yank int
+}
+
+const killRingSize = 32
+
+// add adds killed text. When merge is set it joins the most recent kill
+// instead, in front of it if before is set, as consecutive kills do.
+func (k *killRing) add(text []rune, merge, before bool) {
+	if len(text) == 0 {
+		return
+	}
+	if merge && len(k.texts) > 0 {
+		last := k.texts[len(k.texts)-1]
+		if before {
+			k.texts[len(k.texts)-1] = append(slices.Clone(text), last...)
+		} else {
+			k.texts[len(k.texts)-1] = append(last, text...)
+		}
+		return
+	}
+	k.texts = append(k.texts, slices.Clone(text))
+	if len(k.texts) > killRingSize {
+		k.texts = k.texts[1:]
+	}
+}
+
+// key applies a key to the line. Whoever calls it must hold e.mu. done is
+// set when the line is finished, with the line and the error Readline
+// should return.
+func (e *native) key(r rune) (line string, done bool, err error) {
+	act := actOther
+	switch r {
+	case CharEnter, CharCtrlJ:
+		line = string(e.buf)
+		e.finish("")
+		if !e.historyOff {
+			e.saveHistory(line)
+		}
+		return line, true, nil
+	case CharInterrupt:
+		line = string(e.buf)
+		e.finish("^C")
+		return line, true, ErrInterrupt
+	case CharDelete:
+		if len(e.buf) == 0 {
+			e.finish("")
+			return "", true, io.EOF
+		}
+		e.edit(act)
+		e.delete(e.pos, e.pos+1)
+	case KeyDelete:
+		e.edit(act)
+		e.delete(e.pos, e.pos+1)
+	case CharBackspace, CharCtrlH:
+		if e.pos > 0 {
+			e.edit(act)
+			e.delete(e.pos-1, e.pos)
+		}
+
+	case CharLineStart:
+		e.pos = 0
+	case CharLineEnd:
+		e.pos = len(e.buf)
+	case CharBackward:
+		e.pos = max(e.pos-1, 0)
+	case CharForward:
+		e.pos = min(e.pos+1, len(e.buf))
+	case MetaBackward:
+		e.pos = e.wordStart(e.pos)
+	case MetaForward:
+		e.pos = e.wordEnd(e.pos)
+
+	case CharPrev:
+		e.older()
+	case CharNext:
+		e.newer()
+
+	case CharKill:
+		act = actKill
+		e.kill(e.pos, len(e.buf), false)
+	case CharCtrlU:
+		act = actKill
+		e.kill(0, e.pos, true)
+	case CharCtrlW:
+		act = actKill
+		start := e.pos
+		for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		e.kill(start, e.pos, true)
+	case MetaBackspace:
+		act = actKill
+		e.kill(e.wordStart(e.pos), e.pos, true)
+	case MetaDelete:
+		act = actKill
+		e.kill(e.pos, e.wordEnd(e.pos), false)
+	case CharCtrlY:
+		if len(e.kills.texts) > 0 {
+			act = actYank
+			e.edit(act)
+			e.kills.yank = len(e.kills.texts) - 1
+			e.yank()
+		}
+	case MetaYankPop:
+		if e.last == actYank {
+			act = actYank
+			e.delete(e.yankFrom, e.yankFrom+e.yankLen)
+			e.pos = e.yankFrom
+			e.kills.yank = (e.kills.yank + len(e.kills.texts) - 1) % len(e.kills.texts)
+			e.yank()
+		}
+
+	case CharTranspose:
+		if e.pos > 0 && len(e.buf) > 1 {
+			e.edit(act)
+			if e.pos == len(e.buf) {
+				e.pos--
+			}
+			e.buf[e.pos-1], e.buf[e.pos] = e.buf[e.pos], e.buf[e.pos-1]
+			e.pos++
+		}
+	case CharUndo:
+		if len(e.undo) > 0 {
+			last := e.undo[len(e.undo)-1]
+			e.undo = e.undo[:len(e.undo)-1]
+			e.buf, e.pos = last.buf, last.pos
+		}
+	case CharCtrlL:
+		io.WriteString(e.cfg.Stdout, "\033[H\033[2J")
+		e.row = 0
+
+	default:
+		if r < ' ' || r == CharBackspace {
+			// Other control keys do nothing.
+			return "", false, nil
+		}
+		act = actInsert
+		e.edit(act)
+		e.insert([]rune{r})
+	}
+	e.last = act
+	e.draw()
+	return "", false, nil
+}
+
+// edit records the line for undo before an edit of kind act. A run of
+// inserted characters is undone as one.
+func (e *native) edit(act action) {
+	if act == actInsert && e.last == actInsert {
+		return
+	}
+	e.undo = append(e.undo, snapshot{slices.Clone(e.buf), e.pos})
+}
+
+// older recalls the history line before the one shown.
+func (e *native) older() {
+	if e.recall > 0 {
+		if e.recall == len(e.history) {
+			e.draft = slices.Clone(e.buf)
+		}
+		e.recall--
+		e.show([]rune(e.history[e.recall]))
+	}
+}
+
+// newer recalls the history line after the one shown, or the new line
+// after the last.
+func (e *native) newer() {
+	if e.recall < len(e.history) {
+		e.recall++
+		if e.recall == len(e.history) {
+			e.show(e.draft)
+		} else {
+			e.show([]rune(e.history[e.recall]))
+		}
+	}
+}
+
+// show replaces the line with one recalled from the history.
+func (e *native) show(line []rune) {
+	e.buf = slices.Clone(line)
+	e.pos = len(e.buf)
+	e.undo = nil
+}
+
+func (e *native) insert(text []rune) {
+	e.buf = slices.Insert(e.buf, e.pos, text...)
+	e.pos += len(text)
+}
+
+// delete removes the runes from start to end, returning them.
+func (e *native) delete(start, end int) []rune {
+	end = min(end, len(e.buf))
+	if start >= end {
+		return nil
+	}
+	removed := slices.Clone(e.buf[start:end])
+	e.buf = slices.Delete(e.buf, start, end)
+	if e.pos > end {
+		e.pos -= end - start
+	} else if e.pos > start {
+		e.pos = start
+	}
+	return removed
+}
+
+// kill deletes the runes from start to end into the kill ring. before is
+// set for kills backwards from the cursor.
+func (e *native) kill(start, end int, before bool) {
+	if start >= end {
+		return
+	}
+	e.edit(actKill)
+	e.kills.add(e.delete(start, end), e.last == actKill, before)
+}
+
+func (e *native) yank() {
+	text := e.kills.texts[e.kills.yank]
+	e.yankFrom, e.yankLen = e.pos, len(text)
+	e.insert(text)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// wordStart returns the start of the word before pos.
+func (e *native) wordStart(pos int) int {
+	for pos > 0 && !isWordRune(e.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(e.buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// wordEnd returns the end of the word after pos.
+func (e *native) wordEnd(pos int) int {
+	for pos < len(e.buf) && !isWordRune(e.buf[pos]) {
+		pos++
+	}
+	for pos < len(e.buf) && isWordRune(e.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// complete completes the word before the cursor: with the one
+// completion there is, or as far as all of them agree. When they do not
+// agree on anything more they are offered in the menu, or listed.
+func (e *native) complete() {
+	if e.cfg.Complete == nil {
+		return
+	}
+	e.mu.Lock()
+	line, pos := slices.Clone(e.buf), e.pos
+	e.mu.Unlock()
+	completions, length := e.cfg.Complete(line, pos)
+	length = min(length, pos)
+
+	names := make([]string, len(completions))
+	for i, completion := range completions {
+		names[i] = strings.TrimSuffix(string(completion), " ")
+	}
+	var prefix []rune
+	if len(completions) > 0 {
+		prefix = commonPrefix(completions)
+	}
+	// Completions that are not matched by their start may agree on less
+	// than the word.
+	extends := len(completions) == 1 || len(prefix) > length
+	var descriptions []string
+	if len(completions) > 1 && !extends && !e.cfg.NoMenu && e.cfg.Describe != nil {
+		descriptions = e.cfg.Describe(line, pos, names)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.last = actComplete
+	if len(completions) == 0 {
+		io.WriteString(e.cfg.Stdout, "\a")
+		return
+	}
+	if extends {
+		if !slices.Equal(prefix, line[pos-length:pos]) {
+			e.edit(actComplete)
+			e.delete(e.pos-length, e.pos)
+			e.insert(prefix)
+			e.draw()
+		}
+		return
+	}
+	if !e.cfg.NoMenu {
+		e.openMenu(names, completions, length, descriptions)
+		return
+	}
+
+	var b strings.Builder
+	e.clear(&b)
+	b.WriteString(columnate(names, e.columns()))
+	io.WriteString(e.cfg.Stdout, b.String())
+	e.draw()
+}
+
+func commonPrefix(texts [][]rune) []rune {
+	prefix := texts[0]
+	for _, text := range texts[1:] {
+		n := 0
+		for n < len(prefix) && n < len(text) && prefix[n] == text[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+// columnate lays names out in columns down the page, as ls does, to fit
+// a terminal cols wide.
+func columnate(names []string, cols int) string {
+	width := 0
+	for _, name := range names {
+		width = max(width, runewidth.StringWidth(name)+2)
+	}
+	perRow := max(cols/width, 1)
+	rows := (len(names) + perRow - 1) / perRow
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		for i := row; i < len(names); i += rows {
+			name := names[i]
+			b.WriteString(name)
+			if i+rows < len(names) {
+				b.WriteString(strings.Repeat(" ", width-runewidth.StringWidth(name)))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
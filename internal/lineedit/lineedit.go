@@ -0,0 +1,208 @@
+// Package lineedit reads command lines from the terminal with emacs-style
+// editing: cursor movement, a kill ring, undo, history recall and
+// completion.
+//
+// The native editor puts the terminal in raw mode only while it reads a
+// line, and reads its input a byte at a time, so nothing typed ahead for
+// the commands the shell runs is consumed. Where it is not supported, or
+// when asked for, the chzyer/readline package does the editing behind
+// the same Editor interface.
+package lineedit
+
+import (
+	"errors"
+	"os"
+)
+
+// Backends name the editors New can return.
+const (
+	BackendNative   = "native"
+	BackendReadline = "readline"
+)
+
+// Keymaps choose the keys an Editor edits with.
+const (
+	KeymapEmacs = "emacs"
+	KeymapVi    = "vi"
+)
+
+// Modes are the vi modes Mode reports.
+const (
+	ModeInsert = "insert"
+	ModeNormal = "normal"
+)
+
+// ErrInterrupt is returned by Readline, along with the line so far, when
+// ctrl-c is pressed.
+var ErrInterrupt = errors.New("Interrupt")
+
+// Keys as an Editor's FilterKey and OnChange see them. Control keys are
+// their ASCII codes, and other special keys negative.
+const (
+	CharLineStart = 1
+	CharBackward  = 2
+	CharInterrupt = 3
+	CharDelete    = 4
+	CharLineEnd   = 5
+	CharForward   = 6
+	CharBell      = 7
+	CharCtrlH     = 8
+	CharTab       = 9
+	CharCtrlJ     = 10
+	CharKill      = 11
+	CharCtrlL     = 12
+	CharEnter     = 13
+	CharNext      = 14
+	CharPrev      = 16
+	CharBckSearch = 18
+	CharFwdSearch = 19
+	CharTranspose = 20
+	CharCtrlU     = 21
+	CharCtrlW     = 23
+	CharCtrlY     = 25
+	CharCtrlZ     = 26
+	CharEsc       = 27
+	CharUndo      = 31
+	CharBackspace = 127
+)
+
+// Alt keys and the keys that send escape sequences. The first are those
+// of readline, which reports them the same way.
+const (
+	MetaBackward rune = -iota - 1
+	MetaForward
+	MetaDelete
+	MetaBackspace
+	MetaTranspose
+	MetaYankPop
+	KeyDelete
+	// KeyFocusIn and KeyFocusOut are the terminal's reports that its
+	// window gained or lost the focus, passed to OnFocus.
+	KeyFocusIn
+	KeyFocusOut
+	// KeyBackTab is shift-Tab.
+	KeyBackTab
+)
+
+// Functions are the editing functions keys can be bound to, by their
+// readline names, each with the key that does it in the emacs keymap. A
+// FilterKey function binds a key by returning that key in its place.
+var Functions = map[string]rune{
+	"accept-line":          CharEnter,
+	"backward-char":        CharBackward,
+	"backward-delete-char": CharBackspace,
+	"backward-kill-word":   MetaBackspace,
+	"backward-word":        MetaBackward,
+	"beginning-of-line":    CharLineStart,
+	"clear-screen":         CharCtrlL,
+	"complete":             CharTab,
+	"delete-char":          KeyDelete,
+	"end-of-line":          CharLineEnd,
+	"forward-char":         CharForward,
+	"forward-word":         MetaForward,
+	"kill-line":            CharKill,
+	"kill-word":            MetaDelete,
+	"next-history":         CharNext,
+	"previous-history":     CharPrev,
+	"transpose-chars":      CharTranspose,
+	"undo":                 CharUndo,
+	"unix-line-discard":    CharCtrlU,
+	"unix-word-rubout":     CharCtrlW,
+	"yank":                 CharCtrlY,
+	"yank-pop":             MetaYankPop,
+}
+
+// Editor reads lines from the terminal, keeping a history of those
+// entered.
+type Editor interface {
+	// Readline reads a line, without its newline. It returns io.EOF at
+	// the end of the input, or once Close is called.
+	Readline() (string, error)
+	// ReadlineWithDefault reads a line that starts out as text.
+	ReadlineWithDefault(text string) (string, error)
+	// ReadPassword reads a line without echoing it, or history.
+	ReadPassword(prompt string) (string, error)
+
+	SetPrompt(prompt string)
+	// SetBuffer replaces the line being edited.
+	SetBuffer(line string)
+	// Refresh draws the line being edited again.
+	Refresh()
+	// Write prints above the line being edited, which is drawn again
+	// after it.
+	Write(p []byte) (int, error)
+	// IsTerminal reports whether lines are edited on a terminal rather
+	// than read as they come.
+	IsTerminal() bool
+
+	// SetKeymap switches between KeymapEmacs and KeymapVi.
+	SetKeymap(keymap string)
+	// Mode returns the vi mode, or "" when it is not known or the
+	// keymap is emacs.
+	Mode() string
+
+	ResetHistory()
+	SaveHistory(line string) error
+	// SetHistory replaces the history with lines, oldest first, as
+	// ResetHistory and SaveHistory of each would, but all at once, so
+	// that it can be done while a line is edited.
+	SetHistory(lines []string)
+	HistoryEnable()
+	HistoryDisable()
+
+	Close() error
+}
+
+// Config sets up an Editor.
+type Config struct {
+	Prompt string
+	// Backend is BackendNative or BackendReadline; empty means native.
+	Backend string
+	// Keymap is KeymapEmacs or KeymapVi; empty means emacs.
+	Keymap string
+
+	// Complete returns the completions of the word before pos in line,
+	// each the text to replace it with, and the length of the word.
+	Complete func(line []rune, pos int) ([][]rune, int)
+	// Describe, if set, describes the completions of the word before pos
+	// in line, given in full, for the menu the native editor offers them
+	// in; "" leaves one undescribed.
+	Describe func(line []rune, pos int, names []string) []string
+	// NoMenu lists the completions Tab cannot choose between, rather
+	// than offering them in a menu.
+	NoMenu bool
+	// FilterKey sees every key first. It may replace the key, or
+	// swallow it by returning false.
+	FilterKey func(r rune) (rune, bool)
+	// OnChange is called after each key with the line and the cursor
+	// position.
+	OnChange func(line []rune, pos int, key rune)
+	// OnModeChange is called when vi editing switches mode.
+	OnModeChange func(mode string)
+	// OnFocus, if set, is called when the terminal window gains or
+	// loses the focus while a line is edited. Only the native editor
+	// asks the terminal to report it.
+	OnFocus func(focused bool)
+
+	// LineMode leaves the line editing to the terminal's cooked mode,
+	// for terminals that cannot take redraws and for screen readers.
+	LineMode bool
+
+	// Stdin and Stdout default to the process's own.
+	Stdin  *os.File
+	Stdout *os.File
+}
+
+// New returns an editor for cfg.
+func New(cfg Config) (Editor, error) {
+	if cfg.Stdin == nil {
+		cfg.Stdin = os.Stdin
+	}
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Backend == BackendReadline || !nativeSupported {
+		return newReadline(cfg)
+	}
+	return newNative(cfg), nil
+}
@@ -0,0 +1,142 @@
+package lineedit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// menuRows is the most completions the menu shows at once.
+const menuRows = 10
+
+// menu holds the completions of a word, shown below the line. Tab and
+// the down arrow select the next, shift-Tab and the up arrow the one
+// before, and the one selected takes the word's place in the line.
+type menu struct {
+	names        []string
+	completions  [][]rune
+	descriptions []string
+	// length is that of the word the completions replace.
+	length int
+	// selected is the completion in the line, or -1 until one is; first
+	// is the first shown.
+	selected, first int
+	// buf and pos are the line as it was before the menu opened.
+	buf []rune
+	pos int
+}
+
+// openMenu offers completions in the menu. Whoever calls it must hold
+// e.mu.
+func (e *native) openMenu(names []string, completions [][]rune, length int, descriptions []string) {
+	e.edit(actComplete)
+	e.menu = &menu{
+		names:        names,
+		completions:  completions,
+		descriptions: descriptions,
+		length:       length,
+		selected:     -1,
+		buf:          slices.Clone(e.buf),
+		pos:          e.pos,
+	}
+	e.draw()
+}
+
+// menuKey applies a key to the open menu, and reports whether it was
+// used. Enter takes the completion selected and escape or ctrl-g goes
+// back to the line as it was; any other key closes the menu and then
+// edits the line as usual. Whoever calls it must hold e.mu.
+func (e *native) menuKey(r rune) bool {
+	m := e.menu
+	n := len(m.names)
+	switch r {
+	case CharTab, CharNext:
+		e.selectCompletion((m.selected + 1) % n)
+	case KeyBackTab, CharPrev:
+		if m.selected <= 0 {
+			e.selectCompletion(n - 1)
+		} else {
+			e.selectCompletion(m.selected - 1)
+		}
+	case CharEnter, CharCtrlJ:
+		e.menu = nil
+		if m.selected < 0 {
+			// Nothing was chosen, so the line is entered.
+			return false
+		}
+	case CharEsc, CharBell:
+		e.menu = nil
+		e.buf, e.pos = m.buf, m.pos
+	default:
+		e.menu = nil
+		e.draw()
+		return false
+	}
+	e.last = actComplete
+	e.draw()
+	return true
+}
+
+// selectCompletion puts the i'th completion in the line.
+func (e *native) selectCompletion(i int) {
+	m := e.menu
+	m.selected = i
+	start := m.pos - m.length
+	e.buf = slices.Concat(m.buf[:start], m.completions[i], m.buf[m.pos:])
+	e.pos = start + len(m.completions[i])
+}
+
+// lines lays out the menu to fit a terminal cols wide and rows high: a
+// row for each completion shown, the one selected in reverse video,
+// with its description beside it, and a last row with the position in
+// the menu when it does not all fit.
+func (m *menu) lines(cols, rows int) []string {
+	height := min(menuRows, max(rows/2, 1), len(m.names))
+	if m.selected >= 0 {
+		if m.selected < m.first {
+			m.first = m.selected
+		} else if m.selected >= m.first+height {
+			m.first = m.selected - height + 1
+		}
+	}
+	width := 0
+	for _, name := range m.names {
+		width = max(width, runewidth.StringWidth(name))
+	}
+	width = min(width, cols/2)
+
+	var lines []string
+	for i := m.first; i < m.first+height; i++ {
+		// Rows must not wrap, or they would not be cleared again.
+		line := fit(m.names[i], width)
+		if i < len(m.descriptions) && m.descriptions[i] != "" {
+			line += strings.Repeat(" ", width-runewidth.StringWidth(line)) + "  " + m.descriptions[i]
+		}
+		line = fit(line, cols-1)
+		if i == m.selected {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		lines = append(lines, line)
+	}
+	if height < len(m.names) {
+		position := m.first + 1
+		if m.selected >= 0 {
+			position = m.selected + 1
+		}
+		lines = append(lines, fit(fmt.Sprintf("%d of %d", position, len(m.names)), cols-1))
+	}
+	return lines
+}
+
+// fit cuts text to width columns, marking the cut with an ellipsis.
+func fit(text string, width int) string {
+	if runewidth.StringWidth(text) <= width {
+		return text
+	}
+	if width <= 1 {
+		return runewidth.Truncate(text, max(width, 0), "")
+	}
+	return runewidth.Truncate(text, width, "…")
+}
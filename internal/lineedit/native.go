@@ -0,0 +1,574 @@
+package lineedit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// native is the package's own editor.
+type native struct {
+	cfg    Config
+	in     *input
+	closed chan struct{}
+	once   sync.Once
+
+	// mu guards what follows, for the Refresh and Write calls that come
+	// from other goroutines while a line is edited.
+	mu      sync.Mutex
+	prompt  string
+	editing bool
+	buf     []rune
+	pos     int
+	// row is the row of the cursor in what was last drawn, counting
+	// from the prompt's first.
+	row int
+
+	history    []string
+	historyOff bool
+	// recall is the index of the history line on show, or
+	// len(history) for the new line, kept in draft meanwhile.
+	recall int
+	draft  []rune
+
+	keymap string
+	vi     viState
+
+	kills killRing
+	undo  []snapshot
+	// last is the kind of the last edit, which decides whether the next
+	// merges with it.
+	last action
+	// yankFrom and yankLen locate the text last yanked.
+	yankFrom, yankLen int
+	// menu is the menu of completions open below the line, if any.
+	menu *menu
+}
+
+func newNative(cfg Config) *native {
+	return &native{
+		cfg:    cfg,
+		in:     &input{f: cfg.Stdin},
+		closed: make(chan struct{}),
+		prompt: cfg.Prompt,
+		keymap: cfg.Keymap,
+	}
+}
+
+func (e *native) Readline() (string, error) {
+	return e.ReadlineWithDefault("")
+}
+
+func (e *native) ReadlineWithDefault(text string) (string, error) {
+	if !e.IsTerminal() {
+		return e.readCooked(e.prompt)
+	}
+	restore, err := MakeRaw(int(e.cfg.Stdin.Fd()))
+	if err != nil {
+		return e.readCooked(e.prompt)
+	}
+	defer restore()
+	if e.cfg.OnFocus != nil {
+		io.WriteString(e.cfg.Stdout, "\x1b[?1004h")
+		defer io.WriteString(e.cfg.Stdout, "\x1b[?1004l")
+	}
+
+	e.mu.Lock()
+	e.begin(text)
+	e.mu.Unlock()
+	for {
+		r, err := e.readKey()
+		if err != nil {
+			e.mu.Lock()
+			e.finish("")
+			e.mu.Unlock()
+			return "", err
+		}
+		if r == 0 {
+			continue
+		}
+		if r == KeyFocusIn || r == KeyFocusOut {
+			if e.cfg.OnFocus != nil {
+				e.cfg.OnFocus(r == KeyFocusIn)
+			}
+			continue
+		}
+		// The callbacks may call back into the editor, so they are made
+		// without the lock.
+		if e.cfg.FilterKey != nil {
+			var ok bool
+			if r, ok = e.cfg.FilterKey(r); !ok {
+				continue
+			}
+		}
+		// The menu of completions, while it is open, has the keys first.
+		e.mu.Lock()
+		inMenu := e.menu != nil && e.menuKey(r)
+		e.mu.Unlock()
+		switch {
+		case inMenu:
+		case r == CharTab:
+			e.complete()
+		default:
+			e.mu.Lock()
+			mode := e.mode()
+			var line string
+			var done bool
+			if e.keymap == KeymapVi {
+				line, done, err = e.viKey(r)
+			} else {
+				line, done, err = e.key(r)
+			}
+			changed := e.mode() != mode
+			e.mu.Unlock()
+			if changed && !done && e.cfg.OnModeChange != nil {
+				e.cfg.OnModeChange(e.Mode())
+			}
+			if done {
+				return line, err
+			}
+		}
+		if e.cfg.OnChange != nil {
+			e.mu.Lock()
+			line, pos := slices.Clone(e.buf), e.pos
+			e.mu.Unlock()
+			e.cfg.OnChange(line, pos, r)
+		}
+	}
+}
+
+// readCooked reads a line as the terminal's cooked mode, or a pipe,
+// delivers it.
+func (e *native) readCooked(prompt string) (string, error) {
+	io.WriteString(e.cfg.Stdout, prompt)
+	var line []byte
+	for {
+		b, err := e.in.readByte(0, e.closed)
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b)
+	}
+}
+
+func (e *native) ReadPassword(prompt string) (string, error) {
+	if !e.IsTerminal() {
+		return e.readCooked(prompt)
+	}
+	restore, err := MakeRaw(int(e.cfg.Stdin.Fd()))
+	if err != nil {
+		return e.readCooked(prompt)
+	}
+	defer restore()
+
+	io.WriteString(e.cfg.Stdout, prompt)
+	var line []rune
+	for {
+		r, err := e.readKey()
+		if err != nil {
+			io.WriteString(e.cfg.Stdout, "\n")
+			return "", err
+		}
+		switch r {
+		case CharEnter, CharCtrlJ:
+			io.WriteString(e.cfg.Stdout, "\n")
+			return string(line), nil
+		case CharInterrupt:
+			io.WriteString(e.cfg.Stdout, "^C\n")
+			return string(line), ErrInterrupt
+		case CharDelete:
+			if len(line) == 0 {
+				io.WriteString(e.cfg.Stdout, "\n")
+				return "", io.EOF
+			}
+		case CharBackspace, CharCtrlH:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case CharCtrlU:
+			line = line[:0]
+		default:
+			if r >= ' ' {
+				line = append(line, r)
+			}
+		}
+	}
+}
+
+func (e *native) SetPrompt(prompt string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.prompt = prompt
+	if e.editing {
+		e.draw()
+	}
+}
+
+func (e *native) SetBuffer(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+	if e.editing {
+		e.draw()
+	}
+}
+
+func (e *native) Refresh() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.editing {
+		e.draw()
+	}
+}
+
+func (e *native) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.editing {
+		return e.cfg.Stdout.Write(p)
+	}
+	var b strings.Builder
+	e.clear(&b)
+	io.WriteString(e.cfg.Stdout, b.String())
+	n, err := e.cfg.Stdout.Write(p)
+	e.draw()
+	return n, err
+}
+
+func (e *native) SetKeymap(keymap string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keymap = keymap
+	e.vi = viState{}
+}
+
+func (e *native) Mode() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mode()
+}
+
+func (e *native) mode() string {
+	switch {
+	case e.keymap != KeymapVi:
+		return ""
+	case e.vi.normal:
+		return ModeNormal
+	}
+	return ModeInsert
+}
+
+func (e *native) IsTerminal() bool {
+	return !e.cfg.LineMode && IsTerminal(int(e.cfg.Stdin.Fd())) && IsTerminal(int(e.cfg.Stdout.Fd()))
+}
+
+func (e *native) ResetHistory() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history = nil
+}
+
+func (e *native) SaveHistory(line string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.saveHistory(line)
+	return nil
+}
+
+func (e *native) SetHistory(lines []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	recalling := e.recall < len(e.history)
+	e.history = nil
+	for _, line := range lines {
+		e.saveHistory(line)
+	}
+	// Up on the new line starts from the newest entry.
+	if !recalling || e.recall > len(e.history) {
+		e.recall = len(e.history)
+	}
+}
+
+func (e *native) saveHistory(line string) {
+	if line != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+		e.history = append(e.history, line)
+	}
+}
+
+func (e *native) HistoryEnable() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.historyOff = false
+}
+
+func (e *native) HistoryDisable() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.historyOff = true
+}
+
+// Close makes Readline return io.EOF, now or when next called.
+func (e *native) Close() error {
+	e.once.Do(func() { close(e.closed) })
+	return nil
+}
+
+// begin starts editing a new line.
+func (e *native) begin(text string) {
+	e.buf = []rune(text)
+	e.pos = len(e.buf)
+	e.editing = true
+	e.row = 0
+	e.recall = len(e.history)
+	e.draft = nil
+	e.undo = nil
+	e.last = actNone
+	e.menu = nil
+	e.draw()
+}
+
+// finish ends editing, leaving the line on the screen followed by mark.
+func (e *native) finish(mark string) {
+	e.pos = len(e.buf)
+	e.menu = nil
+	e.draw()
+	io.WriteString(e.cfg.Stdout, mark+"\n")
+	e.editing = false
+	// The next line starts out in insert mode.
+	e.vi = viState{}
+}
+
+var escapes = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// measure returns the row and column the cursor ends up at after text
+// is written from the start of a row cols wide, and whether it is left
+// past the end of a full row, where terminals wait for more before
+// moving it to the next. Wide characters, such as CJK ones, take two
+// columns, and go to the next row whole; combining ones take none.
+func measure(text string, cols int) (row, col int, full bool) {
+	for _, r := range escapes.ReplaceAllString(text, "") {
+		if r == '\n' {
+			row, col, full = row+1, 0, false
+			continue
+		}
+		width := runewidth.RuneWidth(r)
+		if width == 0 {
+			continue
+		}
+		full = false
+		if col+width > cols {
+			row, col = row+1, 0
+		}
+		if col += width; col >= cols {
+			row, col, full = row+1, 0, true
+		}
+	}
+	return row, col, full
+}
+
+func (e *native) columns() int {
+	cols, _, err := GetSize(int(e.cfg.Stdout.Fd()))
+	if err != nil || cols <= 0 {
+		return 80
+	}
+	return cols
+}
+
+func (e *native) rows() int {
+	_, rows, err := GetSize(int(e.cfg.Stdout.Fd()))
+	if err != nil || rows <= 0 {
+		return 24
+	}
+	return rows
+}
+
+// clear moves the cursor back to the start of the prompt and erases what
+// was drawn from there.
+func (e *native) clear(b *strings.Builder) {
+	if e.row > 0 {
+		fmt.Fprintf(b, "\033[%dA", e.row)
+	}
+	b.WriteString("\r\033[J")
+	e.row = 0
+}
+
+// draw draws the prompt and the line again, and the menu below them if
+// it is open, and puts the cursor in place.
+func (e *native) draw() {
+	cols := e.columns()
+	var b strings.Builder
+	e.clear(&b)
+	text := e.prompt + string(e.buf)
+	b.WriteString(text)
+	endRow, _, full := measure(text, cols)
+	if full {
+		// Give the cursor somewhere to be on the next row.
+		b.WriteString(" \r\033[K")
+	}
+	if e.menu != nil {
+		lines := e.menu.lines(cols, e.rows())
+		b.WriteString("\n" + strings.Join(lines, "\n"))
+		endRow += len(lines)
+	}
+	row, col, _ := measure(e.prompt+string(e.buf[:e.pos]), cols)
+	if endRow > row {
+		fmt.Fprintf(&b, "\033[%dA", endRow-row)
+	}
+	b.WriteString("\r")
+	if col > 0 {
+		fmt.Fprintf(&b, "\033[%dC", col)
+	}
+	e.row = row
+	io.WriteString(e.cfg.Stdout, b.String())
+}
+
+// escWait is how long to wait for the rest of an escape sequence before
+// taking the escape as a key of its own.
+const escWait = 50 * time.Millisecond
+
+// escapeKeys maps the escape sequences of special keys, after the
+// leading ESC [ or ESC O, to keys.
+var escapeKeys = map[string]rune{
+	"A": CharPrev, "B": CharNext, "C": CharForward, "D": CharBackward,
+	"H": CharLineStart, "F": CharLineEnd,
+	"1~": CharLineStart, "7~": CharLineStart,
+	"4~": CharLineEnd, "8~": CharLineEnd,
+	"3~":   KeyDelete,
+	"1;5C": MetaForward, "1;5D": MetaBackward,
+	"1;3C": MetaForward, "1;3D": MetaBackward,
+	"I": KeyFocusIn, "O": KeyFocusOut,
+	"Z": KeyBackTab,
+}
+
+// metaKeys maps the keys typed with alt, which sends ESC before them.
+var metaKeys = map[byte]rune{
+	'b': MetaBackward, 'f': MetaForward, 'd': MetaDelete,
+	CharBackspace: MetaBackspace, CharCtrlH: MetaBackspace,
+	't': MetaTranspose, 'y': MetaYankPop,
+}
+
+// readKey reads the next key. It returns 0 for keys the editor does not
+// know.
+func (e *native) readKey() (rune, error) {
+	b, err := e.in.readByte(0, e.closed)
+	if err != nil {
+		return 0, err
+	}
+	if b == CharEsc {
+		return e.readEscape()
+	}
+	if b < utf8.RuneSelf {
+		return rune(b), nil
+	}
+	seq := []byte{b}
+	for !utf8.FullRune(seq) {
+		b, err := e.in.readByte(0, e.closed)
+		if err != nil {
+			return 0, err
+		}
+		seq = append(seq, b)
+	}
+	r, _ := utf8.DecodeRune(seq)
+	return r, nil
+}
+
+func (e *native) readEscape() (rune, error) {
+	b, err := e.in.readByte(escWait, e.closed)
+	if err == errTimeout {
+		return CharEsc, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if b != '[' && b != 'O' {
+		return metaKeys[b], nil
+	}
+	var seq []byte
+	for {
+		b, err := e.in.readByte(escWait, e.closed)
+		if err == errTimeout {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			return escapeKeys[string(seq)], nil
+		}
+	}
+}
+
+var errTimeout = errors.New("timed out")
+
+// input reads a file a byte at a time on a goroutine of its own, and only
+// when asked to, so that what the editor does not wait for is left for
+// whoever reads the file next.
+type input struct {
+	f     *os.File
+	once  sync.Once
+	want  chan struct{}
+	got   chan readResult
+	asked bool
+}
+
+type readResult struct {
+	b   byte
+	err error
+}
+
+func (in *input) start() {
+	in.want = make(chan struct{})
+	in.got = make(chan readResult)
+	go func() {
+		buf := make([]byte, 1)
+		for range in.want {
+			n, err := in.f.Read(buf)
+			for n == 0 && err == nil {
+				n, err = in.f.Read(buf)
+			}
+			in.got <- readResult{buf[0], err}
+		}
+	}()
+}
+
+// readByte returns the next byte. It returns errTimeout once wait has
+// passed, if it is not 0, and io.EOF once done is closed.
+func (in *input) readByte(wait time.Duration, done <-chan struct{}) (byte, error) {
+	in.once.Do(in.start)
+	if !in.asked {
+		in.want <- struct{}{}
+		in.asked = true
+	}
+	var timeout <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case r := <-in.got:
+		in.asked = false
+		return r.b, r.err
+	case <-timeout:
+		return 0, errTimeout
+	case <-done:
+		return 0, io.EOF
+	}
+}
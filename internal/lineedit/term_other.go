@@ -0,0 +1,27 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package lineedit
+
+import (
+	"errors"
+
+	"github.com/chzyer/readline"
+)
+
+// The native editor needs a Unix terminal; elsewhere New returns the
+// readline editor.
+const nativeSupported = false
+
+// IsTerminal reports whether fd is a terminal.
+func IsTerminal(fd int) bool {
+	return readline.IsTerminal(fd)
+}
+
+// GetSize returns the width and height of the terminal fd is on.
+func GetSize(fd int) (cols, rows int, err error) {
+	return readline.GetSize(fd)
+}
+
+func MakeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported")
+}
@@ -0,0 +1,381 @@
+package lineedit
+
+import (
+	"slices"
+	"unicode"
+)
+
+// viState is the state of vi editing between keys.
+type viState struct {
+	normal bool
+	// count is the count typed before a command, or 0 for none.
+	count int
+	// op is the operator (d, c or y) waiting for its motion, and opCount
+	// the count typed before it.
+	op      rune
+	opCount int
+	// pending is the command (f, F, t, T or r) waiting for its character.
+	pending rune
+	// find and findChar are the last f, F, t or T command, for ; and ,.
+	find, findChar rune
+}
+
+// viKey applies a key in vi mode. Whoever calls it must hold e.mu.
+func (e *native) viKey(r rune) (line string, done bool, err error) {
+	v := &e.vi
+	if !v.normal {
+		if r != CharEsc {
+			// Insert mode edits as emacs mode does.
+			return e.key(r)
+		}
+		v.normal = true
+		e.pos = max(e.pos-1, 0)
+		e.last = actOther
+		e.draw()
+		return "", false, nil
+	}
+
+	switch {
+	case r == CharEsc:
+		v.reset()
+		return "", false, nil
+	case r == CharBackspace || r == CharCtrlH:
+		r = 'h'
+	case r < ' ' && v.pending == 0 || r < 0:
+		// Control keys and special keys do what they do in emacs mode.
+		v.reset()
+		line, done, err = e.key(r)
+		if !done {
+			e.viClamp()
+			e.draw()
+		}
+		return line, done, err
+	}
+	e.viCommand(r)
+	e.viClamp()
+	e.draw()
+	return "", false, nil
+}
+
+func (v *viState) reset() {
+	v.count, v.op, v.opCount, v.pending = 0, 0, 0, 0
+}
+
+// viClamp keeps the cursor on a character in normal mode.
+func (e *native) viClamp() {
+	if e.vi.normal && e.pos >= len(e.buf) {
+		e.pos = max(len(e.buf)-1, 0)
+	}
+}
+
+// viInsert switches to insert mode. What is typed until Esc is undone as
+// one edit.
+func (e *native) viInsert(pos int) {
+	e.edit(actOther)
+	e.vi.normal = false
+	e.pos = pos
+	e.last = actInsert
+}
+
+// viCommand applies a key in normal mode.
+func (e *native) viCommand(r rune) {
+	v := &e.vi
+	if v.pending != 0 {
+		cmd := v.pending
+		v.pending = 0
+		if cmd == 'r' {
+			count := max(v.count, 1)
+			v.count = 0
+			if e.pos+count <= len(e.buf) {
+				e.edit(actOther)
+				for i := 0; i < count; i++ {
+					e.buf[e.pos+i] = r
+				}
+				e.pos += count - 1
+			}
+			return
+		}
+		v.find, v.findChar = cmd, r
+		e.viMove(cmd, r)
+		return
+	}
+	if r >= '1' && r <= '9' || r == '0' && v.count > 0 {
+		v.count = v.count*10 + int(r-'0')
+		return
+	}
+	if v.op != 0 {
+		e.viMove(r, 0)
+		return
+	}
+
+	count := max(v.count, 1)
+	switch r {
+	case 'i':
+		e.viInsert(e.pos)
+	case 'a':
+		e.viInsert(min(e.pos+1, len(e.buf)))
+	case 'I':
+		e.viInsert(e.firstNonBlank())
+	case 'A':
+		e.viInsert(len(e.buf))
+	case 'x':
+		e.viApply('d', e.pos, min(e.pos+count, len(e.buf)))
+	case 'X':
+		e.viApply('d', max(e.pos-count, 0), e.pos)
+	case 'D':
+		e.viApply('d', e.pos, len(e.buf))
+	case 'C':
+		e.viApply('c', e.pos, len(e.buf))
+	case 'S':
+		e.viApply('c', 0, len(e.buf))
+	case 's':
+		e.viApply('c', e.pos, min(e.pos+count, len(e.buf)))
+	case 'p', 'P':
+		if len(e.kills.texts) > 0 {
+			e.edit(actOther)
+			if r == 'p' && len(e.buf) > 0 {
+				e.pos++
+			}
+			text := e.kills.texts[len(e.kills.texts)-1]
+			for i := 0; i < count; i++ {
+				e.insert(text)
+			}
+			e.pos--
+		}
+	case 'u':
+		if len(e.undo) > 0 {
+			last := e.undo[len(e.undo)-1]
+			e.undo = e.undo[:len(e.undo)-1]
+			e.buf, e.pos = last.buf, last.pos
+		}
+	case '~':
+		if e.pos < len(e.buf) {
+			e.edit(actOther)
+			for i := 0; i < count && e.pos < len(e.buf); i++ {
+				c := e.buf[e.pos]
+				if unicode.IsUpper(c) {
+					e.buf[e.pos] = unicode.ToLower(c)
+				} else {
+					e.buf[e.pos] = unicode.ToUpper(c)
+				}
+				e.pos++
+			}
+		}
+	case 'k', '-':
+		for i := 0; i < count; i++ {
+			e.older()
+		}
+		e.pos = 0
+	case 'j', '+':
+		for i := 0; i < count; i++ {
+			e.newer()
+		}
+		e.pos = 0
+	case 'd', 'c', 'y':
+		v.op, v.opCount = r, v.count
+		v.count = 0
+		return
+	case 'r', 'f', 'F', 't', 'T':
+		v.pending = r
+		return
+	default:
+		e.viMove(r, 0)
+		return
+	}
+	v.count = 0
+}
+
+// viMove moves the cursor by motion key r, with char the character
+// of an f, F, t or T motion, or applies the waiting operator over the
+// text it moves across.
+func (e *native) viMove(r, char rune) {
+	v := &e.vi
+	count := max(v.count, 1) * max(v.opCount, 1)
+	op := v.op
+	v.count, v.op, v.opCount = 0, 0, 0
+
+	if op != 0 && r == op {
+		// dd, cc and yy apply to the whole line.
+		e.viApply(op, 0, len(e.buf))
+		return
+	}
+	if op == 'c' && (r == 'w' || r == 'W') && e.pos < len(e.buf) && !unicode.IsSpace(e.buf[e.pos]) {
+		// cw changes to the end of the word, as ce does.
+		r -= 'w' - 'e'
+	}
+
+	to, inclusive, ok := e.viMotion(r, char, count)
+	if !ok {
+		return
+	}
+	if op == 0 {
+		e.pos = to
+		return
+	}
+	from := e.pos
+	if to < from {
+		from, to = to, from
+	} else if inclusive {
+		to++
+	}
+	e.viApply(op, from, min(to, len(e.buf)))
+}
+
+// viMotion returns where motion key r, repeated count times, moves the
+// cursor, and whether an operator applies to the character there too.
+func (e *native) viMotion(r, char rune, count int) (to int, inclusive, ok bool) {
+	pos := e.pos
+	switch r {
+	case 'h':
+		return max(pos-count, 0), false, true
+	case 'l', ' ':
+		return min(pos+count, len(e.buf)), false, true
+	case '0':
+		return 0, false, true
+	case '^':
+		return e.firstNonBlank(), false, true
+	case '$':
+		return max(len(e.buf)-1, 0), true, true
+	case 'w', 'W':
+		for i := 0; i < count; i++ {
+			pos = e.viWordStart(pos, r == 'W')
+		}
+		return pos, false, true
+	case 'b', 'B':
+		for i := 0; i < count; i++ {
+			pos = e.viPrevWordStart(pos, r == 'B')
+		}
+		return pos, false, true
+	case 'e', 'E':
+		for i := 0; i < count; i++ {
+			pos = e.viWordEnd(pos, r == 'E')
+		}
+		return pos, true, true
+	case ';', ',':
+		if e.vi.find == 0 {
+			return 0, false, false
+		}
+		find := e.vi.find
+		if r == ',' {
+			// , goes the other way.
+			find ^= 'f' ^ 'F'
+		}
+		return e.viFind(find, e.vi.findChar, count)
+	case 'f', 'F', 't', 'T':
+		return e.viFind(r, char, count)
+	}
+	return 0, false, false
+}
+
+// viFind finds the count'th char on the line, forwards for f and t and
+// backwards for F and T. t and T stop just short of it.
+func (e *native) viFind(cmd, char rune, count int) (to int, inclusive, ok bool) {
+	dir := 1
+	if cmd == 'F' || cmd == 'T' {
+		dir = -1
+	}
+	pos := e.pos
+	for found := 0; found < count; {
+		pos += dir
+		if pos < 0 || pos >= len(e.buf) {
+			return 0, false, false
+		}
+		if e.buf[pos] == char {
+			found++
+		}
+	}
+	if cmd == 't' || cmd == 'T' {
+		pos -= dir
+	}
+	return pos, dir > 0, true
+}
+
+// viApply applies operator op (d, c or y) to the text from start to end.
+// Deleted and yanked text goes into the kill ring for p and P.
+func (e *native) viApply(op rune, start, end int) {
+	if start >= end && op != 'c' {
+		return
+	}
+	switch op {
+	case 'y':
+		e.kills.add(slices.Clone(e.buf[start:end]), false, false)
+		e.pos = start
+	case 'd':
+		e.edit(actOther)
+		e.kills.add(e.delete(start, end), false, false)
+	case 'c':
+		e.edit(actOther)
+		e.kills.add(e.delete(start, end), false, false)
+		e.vi.normal = false
+		e.pos = start
+		e.last = actInsert
+	}
+}
+
+func (e *native) firstNonBlank() int {
+	pos := 0
+	for pos < len(e.buf) && unicode.IsSpace(e.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// viClass sorts runes into blanks (0), word characters (1) and other
+// characters (2), the last two the same for big words.
+func viClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big || isWordRune(r):
+		return 1
+	}
+	return 2
+}
+
+// viWordStart returns the start of the word after pos.
+func (e *native) viWordStart(pos int, big bool) int {
+	n := len(e.buf)
+	if pos >= n {
+		return n
+	}
+	class := viClass(e.buf[pos], big)
+	for pos < n && class != 0 && viClass(e.buf[pos], big) == class {
+		pos++
+	}
+	for pos < n && viClass(e.buf[pos], big) == 0 {
+		pos++
+	}
+	return pos
+}
+
+// viPrevWordStart returns the start of the word before pos.
+func (e *native) viPrevWordStart(pos int, big bool) int {
+	for pos > 0 && viClass(e.buf[pos-1], big) == 0 {
+		pos--
+	}
+	if pos == 0 {
+		return 0
+	}
+	class := viClass(e.buf[pos-1], big)
+	for pos > 0 && viClass(e.buf[pos-1], big) == class {
+		pos--
+	}
+	return pos
+}
+
+// viWordEnd returns the last character of the word after pos.
+func (e *native) viWordEnd(pos int, big bool) int {
+	n := len(e.buf)
+	pos++
+	for pos < n && viClass(e.buf[pos], big) == 0 {
+		pos++
+	}
+	if pos >= n {
+		return max(n-1, 0)
+	}
+	class := viClass(e.buf[pos], big)
+	for pos+1 < n && viClass(e.buf[pos+1], big) == class {
+		pos++
+	}
+	return pos
+}
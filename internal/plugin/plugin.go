@@ -2,7 +2,12 @@ package plugin
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"plugin"
+	"runtime"
+	"strings"
+	"time"
 )
 
 type Plugin interface {
@@ -10,7 +15,178 @@ type Plugin interface {
 	Execute(args []string) error
 }
 
+// ShellAPI is what the shell exposes to plugins. It is kept small and
+// stable so plugins built against one version keep working with the next.
+type ShellAPI interface {
+	// Getenv and Setenv access the environment passed to commands.
+	Getenv(name string) string
+	Setenv(name, value string) error
+	// Var and SetVar access shell variables.
+	Var(name string) (string, bool)
+	SetVar(name, value string)
+	Cwd() string
+	History() []string
+	// Execute runs a command line as if it had been typed.
+	Execute(command string) error
+	// RegisterBuiltin adds a command that is found before anything on
+	// PATH. Names of the shell's own builtins cannot be taken.
+	RegisterBuiltin(name string, fn Builtin) error
+}
+
+// Builtin handles a command registered by a plugin. args[0] is the
+// command name.
+type Builtin func(args []string) error
+
+// The interfaces below are optional; the shell checks for each of them
+// when a plugin is added.
+
+// Initializer is called once when the plugin is added to a shell. An
+// error keeps the plugin from being added.
+type Initializer interface {
+	Init(api ShellAPI) error
+}
+
+// Shutdowner is called once when the shell exits.
+type Shutdowner interface {
+	Shutdown()
+}
+
+// PreCommandHook is called before each command line runs.
+type PreCommandHook interface {
+	OnPreCommand(cmd string)
+}
+
+// PostCommandHook is called after each command line with its exit code
+// and how long it took.
+type PostCommandHook interface {
+	OnPostCommand(cmd string, exitCode int, duration time.Duration)
+}
+
+// PrePromptHook is called before each prompt is shown, after the
+// PostCommandHook of the command before it. Together with PreCommandHook
+// it gives plugins zsh's precmd and preexec hook points.
+type PrePromptHook interface {
+	OnPrePrompt()
+}
+
+// EnvProvider sets up the environment for a directory, as a Python
+// virtualenv or a Node or Go version does. Whenever the current
+// directory changes, what the providers set for the last one is undone,
+// and each is asked in turn for the variables to export in the new one;
+// a provider prepending to PATH sees it as it was before any of them, or
+// as those before it left it.
+type EnvProvider interface {
+	Environment(dir string) (map[string]string, error)
+}
+
+// Notifier is called to deliver a notification that a long command or
+// background job finished, as with notify-send, for instance. It may be
+// called from a goroutine of its own.
+type Notifier interface {
+	Notify(title, body string)
+}
+
+// SegmentProvider adds segments that prompt themes can show, by name.
+// Segment is called for each one shown every time a prompt is drawn, in
+// the background and possibly while the plugin's other methods run: the
+// prompt is shown without it if it is slow, and drawn again once it
+// returns. An empty result leaves the segment out.
+type SegmentProvider interface {
+	Segments() []string
+	Segment(name string) (string, error)
+}
+
+// HelpEntry documents a command for the help builtin.
+type HelpEntry struct {
+	// Usage shows the arguments, as "greet [-l] [NAME]".
+	Usage string `json:"usage"`
+	// Summary says what the command does, in a line.
+	Summary string `json:"summary"`
+	// Details describe the options and anything else worth knowing, in
+	// lines of up to 80 columns.
+	Details string `json:"details,omitempty"`
+}
+
+// HelpProvider documents the builtins a plugin registers, by name, for
+// the help builtin.
+type HelpProvider interface {
+	Help() map[string]HelpEntry
+}
+
+// Completion is something a word may complete to, with a description
+// for the completion menu to show beside it.
+type Completion struct {
+	Text        string `json:"text"`
+	Description string `json:"description,omitempty"`
+	// Partial is set for a completion that goes on, such as a directory
+	// or user@, which Tab does not follow with a space.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Completer completes the arguments of the commands Completes names.
+// Complete is given the words before the one being completed, the
+// command first, and returns what word may complete to; the shell keeps
+// those that match it. Returning none leaves the word to the shell,
+// which completes file names. It is called as Tab is pressed, so it
+// should be quick.
+type Completer interface {
+	Completes() []string
+	Complete(args []string, word string) ([]Completion, error)
+}
+
+// Session describes a finished shell session.
+type Session struct {
+	Start        time.Time
+	End          time.Time
+	Duration     time.Duration
+	CommandCount int
+	LastDir      string
+}
+
+// ExitHook is implemented by plugins that want to be told when the shell exits.
+type ExitHook interface {
+	OnExit(session Session)
+}
+
+// Discover returns the plugins in dir, sorted by name: Go plugin shared
+// objects and executables speaking the process plugin protocol. A
+// missing directory simply has no plugins.
+func Discover(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if filepath.Ext(entry.Name()) == ".so" || isExecutable(info) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+	}
+	return info.Mode()&0111 != 0
+}
+
+// Load opens a Go plugin (.so) or starts a process plugin, depending on
+// the file at path.
 func Load(path string) (Plugin, error) {
+	if filepath.Ext(path) != ".so" {
+		return LoadProcess(path)
+	}
+
 	p, err := plugin.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open plugin: %w", err)
@@ -0,0 +1,421 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Process plugins are standalone executables, written in any language,
+// that talk to the shell with JSON-RPC 2.0 messages over stdin and
+// stdout, one JSON object per line. Stderr is passed through.
+//
+// The shell sends these requests:
+//
+//	initialize  {"protocolVersion": 1}
+//	            -> {"name": "...", "builtins": ["..."], "hooks": ["preCommand", "postCommand", "prePrompt", "notify", "environment", "exit"], "segments": ["..."],
+//	                "help": {"NAME": {"usage": "...", "summary": "...", "details": "..."}}, "completes": ["..."]}
+//	execute     {"args": [...]}                       -> {"exitCode": 0, "stdout": "...", "stderr": "..."}
+//	builtin     {"name": "...", "args": [...]}        -> same as execute
+//	preCommand  {"command": "..."}                    -> null
+//	postCommand {"command": "...", "exitCode": 0, "durationMs": 12} -> null
+//	prePrompt   {}                                    -> null
+//	notify      {"title": "...", "body": "..."}       -> null
+//	environment {"dir": "..."}                        -> {"NAME": "value", ...}
+//	segment     {"name": "..."}                       -> "text"
+//	complete    {"args": [...], "word": "..."}        -> [{"text": "...", "description": "...", "partial": false}, ...]
+//	exit        {"durationMs": 0, "commandCount": 0, "lastDir": "..."} -> null
+//	shutdown    {}                                    -> null
+//
+// While a request is outstanding the plugin may call back into the shell
+// with getenv, setenv, getVar, setVar ({"name", "value"}), cwd, history
+// and execute ({"command"}) requests. The shell sends the plugin nothing
+// while it answers one: hooks that would run for that plugin, such as the
+// preCommand and postCommand of a command it executes, are skipped.
+const ProtocolVersion = 1
+
+const (
+	hookTimeout  = 2 * time.Second
+	startTimeout = 5 * time.Second
+)
+
+// ExitError reports a non-zero exit code from a process plugin command.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type processInfo struct {
+	Name      string               `json:"name"`
+	Builtins  []string             `json:"builtins"`
+	Hooks     []string             `json:"hooks"`
+	Segments  []string             `json:"segments"`
+	Help      map[string]HelpEntry `json:"help"`
+	Completes []string             `json:"completes"`
+}
+
+type commandResult struct {
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+type processPlugin struct {
+	path     string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	messages chan rpcMessage
+	info     processInfo
+	api      ShellAPI
+
+	mu     sync.Mutex
+	nextID int
+	// serving is set while the shell answers a request from the plugin,
+	// with mu held by the call waiting on the plugin.
+	serving atomic.Bool
+}
+
+// errServing is returned by call while the plugin is waiting for the
+// shell to answer one of its requests.
+var errServing = errors.New("plugin is waiting for the shell")
+
+// LoadProcess starts the plugin executable at path and performs the
+// initialize handshake.
+func LoadProcess(path string) (Plugin, error) {
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin: %w", err)
+	}
+
+	p := &processPlugin{
+		path:     path,
+		cmd:      cmd,
+		stdin:    stdin,
+		messages: make(chan rpcMessage),
+	}
+	go p.readMessages(stdout)
+
+	params := map[string]int{"protocolVersion": ProtocolVersion}
+	if err := p.call("initialize", params, &p.info, startTimeout); err != nil {
+		p.kill()
+		return nil, fmt.Errorf("plugin handshake failed: %w", err)
+	}
+	if p.info.Name == "" {
+		p.kill()
+		return nil, fmt.Errorf("plugin did not report a name")
+	}
+	return p, nil
+}
+
+func (p *processPlugin) readMessages(stdout io.Reader) {
+	defer close(p.messages)
+	dec := json.NewDecoder(stdout)
+	for {
+		var msg rpcMessage
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		p.messages <- msg
+	}
+}
+
+// call sends a request and waits for its response, serving any requests
+// the plugin makes back to the shell in the meantime. A zero timeout
+// waits indefinitely. Called while one of those requests is being served,
+// as when a command the plugin executes runs its hooks, it returns
+// errServing instead of waiting for itself.
+func (p *processPlugin) call(method string, params, result interface{}, timeout time.Duration) error {
+	if p.serving.Load() {
+		return errServing
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextID++
+	id := p.nextID
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if err := p.send(rpcMessage{ID: &id, Method: method, Params: raw}); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	for {
+		select {
+		case msg, ok := <-p.messages:
+			if !ok {
+				return fmt.Errorf("%s: plugin exited", method)
+			}
+			if msg.Method != "" {
+				p.serve(msg)
+				continue
+			}
+			if msg.ID == nil || *msg.ID != id {
+				continue
+			}
+			if msg.Error != nil {
+				return fmt.Errorf("%s: %s", method, msg.Error.Message)
+			}
+			if result == nil || len(msg.Result) == 0 {
+				return nil
+			}
+			return json.Unmarshal(msg.Result, result)
+		case <-deadline:
+			return fmt.Errorf("%s: plugin did not answer within %s", method, timeout)
+		}
+	}
+}
+
+func (p *processPlugin) send(msg rpcMessage) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// serve answers a request the plugin made to the shell.
+func (p *processPlugin) serve(msg rpcMessage) {
+	var params struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		Command string `json:"command"`
+	}
+	json.Unmarshal(msg.Params, &params)
+	p.serving.Store(true)
+	defer p.serving.Store(false)
+
+	var result interface{}
+	var err error
+	if p.api == nil {
+		err = errors.New("shell API is not available yet")
+	} else {
+		switch msg.Method {
+		case "getenv":
+			result = p.api.Getenv(params.Name)
+		case "setenv":
+			err = p.api.Setenv(params.Name, params.Value)
+		case "getVar":
+			result, _ = p.api.Var(params.Name)
+		case "setVar":
+			p.api.SetVar(params.Name, params.Value)
+		case "cwd":
+			result = p.api.Cwd()
+		case "history":
+			result = p.api.History()
+		case "execute":
+			err = p.api.Execute(params.Command)
+		default:
+			err = fmt.Errorf("unknown method %s", msg.Method)
+		}
+	}
+
+	if msg.ID == nil {
+		return
+	}
+	reply := rpcMessage{ID: msg.ID}
+	if err != nil {
+		reply.Error = &rpcError{Code: -32000, Message: err.Error()}
+	} else {
+		reply.Result, _ = json.Marshal(result)
+	}
+	p.send(reply)
+}
+
+func (p *processPlugin) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+func (p *processPlugin) hasHook(hook string) bool {
+	for _, h := range p.info.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *processPlugin) Name() string {
+	return p.info.Name
+}
+
+func (p *processPlugin) Init(api ShellAPI) error {
+	p.api = api
+	for _, name := range p.info.Builtins {
+		name := name
+		err := api.RegisterBuiltin(name, func(args []string) error {
+			return p.runCommand("builtin", map[string]interface{}{"name": name, "args": args[1:]})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *processPlugin) Execute(args []string) error {
+	return p.runCommand("execute", map[string]interface{}{"args": args})
+}
+
+func (p *processPlugin) runCommand(method string, params interface{}) error {
+	var result commandResult
+	if err := p.call(method, params, &result, 0); err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, result.Stdout)
+	fmt.Fprint(os.Stderr, result.Stderr)
+	if result.ExitCode != 0 {
+		return &ExitError{Code: result.ExitCode}
+	}
+	return nil
+}
+
+func (p *processPlugin) OnPreCommand(cmd string) {
+	if p.hasHook("preCommand") {
+		p.report(p.call("preCommand", map[string]string{"command": cmd}, nil, hookTimeout))
+	}
+}
+
+func (p *processPlugin) OnPostCommand(cmd string, exitCode int, duration time.Duration) {
+	if p.hasHook("postCommand") {
+		params := map[string]interface{}{
+			"command":    cmd,
+			"exitCode":   exitCode,
+			"durationMs": duration.Milliseconds(),
+		}
+		p.report(p.call("postCommand", params, nil, hookTimeout))
+	}
+}
+
+func (p *processPlugin) OnPrePrompt() {
+	if p.hasHook("prePrompt") {
+		p.report(p.call("prePrompt", struct{}{}, nil, hookTimeout))
+	}
+}
+
+func (p *processPlugin) Notify(title, body string) {
+	if p.hasHook("notify") {
+		p.report(p.call("notify", map[string]string{"title": title, "body": body}, nil, hookTimeout))
+	}
+}
+
+func (p *processPlugin) Environment(dir string) (map[string]string, error) {
+	if !p.hasHook("environment") {
+		return nil, nil
+	}
+	var env map[string]string
+	err := p.call("environment", map[string]string{"dir": dir}, &env, hookTimeout)
+	if err == errServing {
+		return nil, nil
+	}
+	return env, err
+}
+
+func (p *processPlugin) Segments() []string {
+	return p.info.Segments
+}
+
+func (p *processPlugin) Segment(name string) (string, error) {
+	var text string
+	err := p.call("segment", map[string]string{"name": name}, &text, hookTimeout)
+	if err == errServing {
+		return "", nil
+	}
+	return text, err
+}
+
+func (p *processPlugin) Help() map[string]HelpEntry {
+	return p.info.Help
+}
+
+func (p *processPlugin) Completes() []string {
+	return p.info.Completes
+}
+
+func (p *processPlugin) Complete(args []string, word string) ([]Completion, error) {
+	var completions []Completion
+	err := p.call("complete", map[string]interface{}{"args": args, "word": word}, &completions, hookTimeout)
+	if err == errServing {
+		return nil, nil
+	}
+	return completions, err
+}
+
+func (p *processPlugin) OnExit(session Session) {
+	if p.hasHook("exit") {
+		params := map[string]interface{}{
+			"durationMs":   session.Duration.Milliseconds(),
+			"commandCount": session.CommandCount,
+			"lastDir":      session.LastDir,
+		}
+		p.report(p.call("exit", params, nil, hookTimeout))
+	}
+}
+
+func (p *processPlugin) Shutdown() {
+	p.call("shutdown", struct{}{}, nil, hookTimeout)
+	p.stdin.Close()
+
+	done := make(chan struct{})
+	go func() {
+		p.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(hookTimeout):
+		p.cmd.Process.Kill()
+		<-done
+	}
+}
+
+func (p *processPlugin) report(err error) {
+	if err != nil && err != errServing {
+		fmt.Fprintf(os.Stderr, "Error: plugin %s: %v\n", p.info.Name, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package record writes terminal sessions in the asciicast v2 format of
+// asciinema, so they can be played back with myshell replay or with
+// asciinema itself.
+//
+// A recording is a line of JSON describing the terminal, followed by a
+// line for each event: [seconds, "o", text] for output, [seconds, "i",
+// text] for input and [seconds, "r", "COLSxROWS"] for a resize.
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header is the first line of a recording.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes a recording as the session goes. Its methods may be
+// called from several goroutines.
+type Recorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	w     *bufio.Writer
+	start time.Time
+	// partial holds the start of a character split between writes of
+	// each kind, as events must be whole UTF-8 text.
+	partial map[string][]byte
+}
+
+// Create starts a recording of a terminal of the given size in file.
+func Create(file string, width, height int) (*Recorder, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{f: f, w: bufio.NewWriter(f), start: time.Now(), partial: make(map[string][]byte)}
+	header := Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Env:       map[string]string{"SHELL": os.Getenv("SHELL"), "TERM": os.Getenv("TERM")},
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w.Write(append(data, '\n'))
+	return r, nil
+}
+
+// Output records text written to the terminal.
+func (r *Recorder) Output(p []byte) { r.event("o", p) }
+
+// Input records text typed at the terminal.
+func (r *Recorder) Input(p []byte) { r.event("i", p) }
+
+// Resize records the terminal changing size.
+func (r *Recorder) Resize(width, height int) {
+	r.event("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+func (r *Recorder) event(kind string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.partial[kind], p...)
+	// Hold back a character cut off at the end until the rest comes.
+	keep := 0
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				keep = len(data) - i
+			}
+			break
+		}
+	}
+	r.partial[kind] = append([]byte(nil), data[len(data)-keep:]...)
+	data = data[:len(data)-keep]
+	if len(data) == 0 {
+		return
+	}
+	line, err := json.Marshal([]any{time.Since(r.start).Seconds(), kind, string(data)})
+	if err != nil {
+		return
+	}
+	r.w.Write(append(line, '\n'))
+}
+
+// Close finishes the recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
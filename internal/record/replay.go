@@ -0,0 +1,62 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Replay writes the output of a recording to w as it was written,
+// speed times faster. Pauses longer than maxIdle, if it is set, are cut
+// short to it.
+func Replay(r io.Reader, w io.Writer, speed float64, maxIdle time.Duration) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("empty recording")
+	}
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("line 1: %w", err)
+	}
+	if header.Version != 2 {
+		return fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+
+	start := time.Now()
+	// skipped is the time taken out of long pauses so far.
+	var last, skipped time.Duration
+	for line := 2; scanner.Scan(); line++ {
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(event) != 3 {
+			return fmt.Errorf("line %d: malformed event", line)
+		}
+		secs, ok1 := event[0].(float64)
+		kind, ok2 := event[1].(string)
+		text, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return fmt.Errorf("line %d: malformed event", line)
+		}
+		if kind != "o" {
+			continue
+		}
+		at := time.Duration(secs * float64(time.Second))
+		if maxIdle > 0 && at-last > maxIdle {
+			skipped += at - last - maxIdle
+		}
+		last = at
+		time.Sleep(time.Until(start.Add(time.Duration(float64(at-skipped) / speed))))
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
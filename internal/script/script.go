@@ -0,0 +1,236 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"shell/internal/plugin"
+)
+
+// Scripts are Lua files that extend the shell without compiling a Go
+// plugin. They see a global myshell table:
+//
+//	myshell.prompt(fn)              fn() returns a string put before the prompt
+//	myshell.complete(command, fn)   fn(word, args) returns a list of completions
+//	myshell.on(event, fn)           "preCommand" fn(command) or
+//	                                "postCommand" fn(command, status, seconds) or
+//	                                "prePrompt" fn()
+//	myshell.getenv(name)            myshell.setenv(name, value)
+//	myshell.var(name)               myshell.setvar(name, value)
+//	myshell.cwd()                   myshell.exec(command) returns ok, err
+type Engine struct {
+	api   plugin.ShellAPI
+	state *lua.LState
+
+	mu          sync.Mutex
+	file        string
+	segments    []callback
+	completions map[string]callback
+	hooks       map[string][]callback
+}
+
+// callback is a Lua function together with the script that registered it,
+// so errors can be traced back to their file.
+type callback struct {
+	file string
+	fn   *lua.LFunction
+}
+
+var events = map[string]bool{"preCommand": true, "postCommand": true, "prePrompt": true}
+
+// Discover returns the Lua scripts in dir, sorted by name. A missing
+// directory holds no scripts.
+func Discover(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func New(api plugin.ShellAPI) *Engine {
+	e := &Engine{
+		api:         api,
+		state:       lua.NewState(),
+		completions: make(map[string]callback),
+		hooks:       make(map[string][]callback),
+	}
+	e.state.SetGlobal("myshell", e.state.SetFuncs(e.state.NewTable(), map[string]lua.LGFunction{
+		"prompt":   e.luaPrompt,
+		"complete": e.luaComplete,
+		"on":       e.luaOn,
+		"getenv":   e.luaGetenv,
+		"setenv":   e.luaSetenv,
+		"var":      e.luaVar,
+		"setvar":   e.luaSetVar,
+		"cwd":      e.luaCwd,
+		"exec":     e.luaExec,
+	}))
+	return e
+}
+
+// Load runs the script at path, which registers its callbacks.
+func (e *Engine) Load(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.file = path
+	defer func() { e.file = "" }()
+	return e.state.DoFile(path)
+}
+
+func (e *Engine) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state.Close()
+}
+
+// Prompt returns the concatenated output of every prompt segment.
+func (e *Engine) Prompt() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var b strings.Builder
+	for _, cb := range e.segments {
+		if ret, ok := e.call(cb, 1); ok && ret[0] != lua.LNil {
+			b.WriteString(lua.LVAsString(ret[0]))
+		}
+	}
+	return b.String()
+}
+
+// Complete returns the script's completions for word, the last argument
+// of a command line whose earlier words are args. ok is false when no
+// script completes args[0].
+func (e *Engine) Complete(args []string, word string) (candidates []string, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cb, found := e.completions[args[0]]
+	if !found {
+		return nil, false
+	}
+	list := e.state.NewTable()
+	for _, arg := range args {
+		list.Append(lua.LString(arg))
+	}
+	ret, ok := e.call(cb, 1, lua.LString(word), list)
+	if !ok {
+		return nil, true
+	}
+	if table, isTable := ret[0].(*lua.LTable); isTable {
+		table.ForEach(func(_, value lua.LValue) {
+			candidates = append(candidates, lua.LVAsString(value))
+		})
+	}
+	return candidates, true
+}
+
+func (e *Engine) OnPreCommand(cmd string) {
+	e.runHooks("preCommand", lua.LString(cmd))
+}
+
+func (e *Engine) OnPostCommand(cmd string, exitCode int, duration time.Duration) {
+	e.runHooks("postCommand", lua.LString(cmd), lua.LNumber(exitCode), lua.LNumber(duration.Seconds()))
+}
+
+func (e *Engine) OnPrePrompt() {
+	e.runHooks("prePrompt")
+}
+
+func (e *Engine) runHooks(event string, args ...lua.LValue) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, cb := range e.hooks[event] {
+		e.call(cb, 0, args...)
+	}
+}
+
+// call runs a callback and reports any error against its script. The
+// engine's lock must be held.
+func (e *Engine) call(cb callback, nret int, args ...lua.LValue) ([]lua.LValue, bool) {
+	err := e.state.CallByParam(lua.P{Fn: cb.fn, NRet: nret, Protect: true}, args...)
+	if err != nil {
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			// Leave out the stack trace; the message names the line.
+			err = fmt.Errorf("%s", apiErr.Object)
+		}
+		fmt.Fprintf(os.Stderr, "Error: script %s: %v\n", filepath.Base(cb.file), err)
+		return nil, false
+	}
+	ret := make([]lua.LValue, nret)
+	for i := nret - 1; i >= 0; i-- {
+		ret[i] = e.state.Get(-1)
+		e.state.Pop(1)
+	}
+	return ret, true
+}
+
+func (e *Engine) luaPrompt(L *lua.LState) int {
+	e.segments = append(e.segments, callback{e.file, L.CheckFunction(1)})
+	return 0
+}
+
+func (e *Engine) luaComplete(L *lua.LState) int {
+	e.completions[L.CheckString(1)] = callback{e.file, L.CheckFunction(2)}
+	return 0
+}
+
+func (e *Engine) luaOn(L *lua.LState) int {
+	event := L.CheckString(1)
+	if !events[event] {
+		L.ArgError(1, "unknown event "+event)
+	}
+	e.hooks[event] = append(e.hooks[event], callback{e.file, L.CheckFunction(2)})
+	return 0
+}
+
+func (e *Engine) luaGetenv(L *lua.LState) int {
+	L.Push(lua.LString(e.api.Getenv(L.CheckString(1))))
+	return 1
+}
+
+func (e *Engine) luaSetenv(L *lua.LState) int {
+	if err := e.api.Setenv(L.CheckString(1), L.CheckString(2)); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+func (e *Engine) luaVar(L *lua.LState) int {
+	value, ok := e.api.Var(L.CheckString(1))
+	if !ok {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(value))
+	}
+	return 1
+}
+
+func (e *Engine) luaSetVar(L *lua.LState) int {
+	e.api.SetVar(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (e *Engine) luaCwd(L *lua.LState) int {
+	L.Push(lua.LString(e.api.Cwd()))
+	return 1
+}
+
+func (e *Engine) luaExec(L *lua.LState) int {
+	if err := e.api.Execute(L.CheckString(1)); err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
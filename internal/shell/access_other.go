@@ -0,0 +1,12 @@
+//go:build !windows
+
+package shell
+
+import "syscall"
+
+// accessible reports whether the current user may read ('r'), write ('w')
+// or execute ('x') path.
+func accessible(path string, mode byte) bool {
+	bits := map[byte]uint32{'r': 4, 'w': 2, 'x': 1}[mode]
+	return syscall.Access(path, bits) == nil
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// accessible approximates access(2) on Windows: files are readable if
+// they exist, writable unless marked read-only, and executable when their
+// extension is listed in PATHEXT.
+func accessible(path string, mode byte) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	switch mode {
+	case 'w':
+		return info.Mode().Perm()&0200 != 0
+	case 'x':
+		if info.IsDir() {
+			return true
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		for _, e := range filepath.SplitList(strings.ToLower(os.Getenv("PATHEXT"))) {
+			if e == ext {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"shell/internal/config"
+	"shell/pkg/parser"
+)
+
+// aliasDef is an alias value and where it was defined: scope is empty
+// for global aliases, or the directory of the project config defining it.
+type aliasDef struct {
+	value string
+	scope string
+}
+
+// resolveAlias looks name up in the project configs that apply to the
+// current directory, nearest first, and then in the global aliases.
+func (s *Shell) resolveAlias(name string) (aliasDef, bool) {
+	for _, p := range s.projects() {
+		if value, ok := p.Aliases[name]; ok {
+			return aliasDef{value: value, scope: p.Dir}, true
+		}
+	}
+	value, ok := s.aliases[name]
+	return aliasDef{value: value}, ok
+}
+
+// expandAliases replaces the command word with its alias, repeating for
+// aliases that expand to other aliases but never expanding one twice.
+func (s *Shell) expandAliases(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for !seen[args[0]] {
+		stop := s.profiler.track("alias", args[0])
+		def, ok := s.resolveAlias(args[0])
+		if !ok {
+			break
+		}
+		seen[args[0]] = true
+
+		words, err := s.aliasWords(def.value)
+		stop()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing alias %s: %w", args[0], err)
+		}
+		if len(words) == 0 {
+			return args[1:], nil
+		}
+		args = append(words, args[1:]...)
+	}
+	return args, nil
+}
+
+func (s *Shell) alias(args []string) error {
+	if len(args) > 0 && args[0] == "-s" {
+		return s.suffixAlias(args[1:])
+	}
+	args, asJSON := jsonFlag(args)
+	if asJSON {
+		return s.aliasesJSON(args)
+	}
+	if len(args) == 0 {
+		s.listAliases()
+		return nil
+	}
+
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			def, found := s.resolveAlias(name)
+			if !found {
+				return fmt.Errorf("alias: %s: not found", name)
+			}
+			printAlias(name, def)
+			continue
+		}
+		if name == "" {
+			return fmt.Errorf("alias: invalid syntax")
+		}
+		s.aliases[name] = value
+	}
+	return nil
+}
+
+func (s *Shell) unalias(args []string) error {
+	aliases := s.aliases
+	if len(args) > 0 && args[0] == "-s" {
+		aliases, args = s.suffixes, args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("unalias: usage: unalias [-s] name [name ...]")
+	}
+	for _, name := range args {
+		if _, ok := aliases[name]; !ok {
+			return fmt.Errorf("unalias: %s: not found", name)
+		}
+		delete(aliases, name)
+	}
+	return nil
+}
+
+// suffixAlias implements alias -s [EXT[=COMMAND]...], which opens files
+// ending in .EXT with COMMAND when they are typed as a command.
+func (s *Shell) suffixAlias(args []string) error {
+	if len(args) == 0 {
+		exts := make([]string, 0, len(s.suffixes))
+		for ext := range s.suffixes {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		args = exts
+	}
+	for _, arg := range args {
+		ext, value, ok := strings.Cut(arg, "=")
+		ext = strings.TrimPrefix(ext, ".")
+		if !ok {
+			value, found := s.suffixes[ext]
+			if !found {
+				return fmt.Errorf("alias: -s %s: not found", ext)
+			}
+			fmt.Printf("alias -s %s=%s\n", ext, shellquote.Join(value))
+			continue
+		}
+		if ext == "" {
+			return fmt.Errorf("alias: invalid syntax")
+		}
+		s.suffixes[ext] = value
+	}
+	return nil
+}
+
+// listAliases prints the aliases in effect here. Project aliases shadow
+// global ones of the same name and are marked with their directory.
+func (s *Shell) listAliases() {
+	active := s.activeAliases()
+	for _, name := range sortedKeys(active) {
+		printAlias(name, active[name])
+	}
+}
+
+// activeAliases returns the aliases in effect here, by name.
+func (s *Shell) activeAliases() map[string]aliasDef {
+	active := make(map[string]aliasDef)
+	for name, value := range s.aliases {
+		active[name] = aliasDef{value: value}
+	}
+	projects := s.projects()
+	for i := len(projects) - 1; i >= 0; i-- {
+		for name, value := range projects[i].Aliases {
+			active[name] = aliasDef{value: value, scope: projects[i].Dir}
+		}
+	}
+	return active
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// aliasJSON is an alias as alias --json prints it, with the project
+// file that defines it, if any.
+type aliasJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	File  string `json:"file,omitempty"`
+}
+
+// aliasesJSON prints the named aliases, or all those in effect here, as
+// JSON.
+func (s *Shell) aliasesJSON(names []string) error {
+	active := s.activeAliases()
+	if len(names) == 0 {
+		names = sortedKeys(active)
+	}
+	list := make([]aliasJSON, 0, len(names))
+	for _, name := range names {
+		def, ok := active[name]
+		if !ok {
+			return fmt.Errorf("alias: %s: not found", name)
+		}
+		item := aliasJSON{Name: name, Value: def.value}
+		if def.scope != "" {
+			item.File = filepath.Join(def.scope, config.ProjectFile)
+		}
+		list = append(list, item)
+	}
+	if err := printJSON(list); err != nil {
+		return fmt.Errorf("alias: %w", err)
+	}
+	return nil
+}
+
+func printAlias(name string, def aliasDef) {
+	if def.scope == "" {
+		fmt.Printf("alias %s=%s\n", name, shellquote.Join(def.value))
+		return
+	}
+	fmt.Printf("alias %s=%s\t# %s\n", name, shellquote.Join(def.value), filepath.Join(def.scope, config.ProjectFile))
+}
+
+// aliasWords parses and expands the value of an alias, which must be a
+// simple command.
+func (s *Shell) aliasWords(value string) ([]string, error) {
+	list, err := parser.Parse(value)
+	if err != nil || len(list.Stmts) == 0 {
+		return nil, err
+	}
+	stmt := list.Stmts[0]
+	pipeline := stmt.AndOr.Pipelines[0]
+	cmd := pipeline.Commands[0]
+	if len(list.Stmts) > 1 || stmt.Background || len(stmt.AndOr.Pipelines) > 1 || pipeline.Negated ||
+		len(pipeline.Commands) > 1 || len(cmd.Assignments) > 0 || len(cmd.Redirects) > 0 {
+		return nil, errors.New("only a simple command is supported")
+	}
+	var words []string
+	for _, word := range cmd.Words {
+		fields, err := s.expandWord(word)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, fields...)
+	}
+	return words, nil
+}
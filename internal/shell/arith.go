@@ -0,0 +1,154 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// arith evaluates an integer expression, as the value of a variable
+// declared -i is: decimal numbers and variable names joined by + - * / %
+// with parentheses and unary minus. Empty and unset variables are 0.
+func (s *Shell) arith(expr string) (int64, error) {
+	a := &arithParser{shell: s, expr: []rune(expr)}
+	n, err := a.sum()
+	if err != nil {
+		return 0, err
+	}
+	a.space()
+	if a.i < len(a.expr) {
+		return 0, fmt.Errorf("%s: syntax error at %q", expr, string(a.expr[a.i:]))
+	}
+	return n, nil
+}
+
+// Arith evaluates an integer expression as a variable declared -i
+// evaluates its value.
+func (s *Shell) Arith(expr string) (int64, error) {
+	return s.arith(expr)
+}
+
+type arithParser struct {
+	shell *Shell
+	expr  []rune
+	i     int
+	// depth counts the variables being evaluated, so that one whose
+	// value names itself is an error rather than a loop.
+	depth int
+}
+
+var errArithDivide = errors.New("division by zero")
+
+func (a *arithParser) space() {
+	for a.i < len(a.expr) && unicode.IsSpace(a.expr[a.i]) {
+		a.i++
+	}
+}
+
+// next skips spaces and returns the rune after them, or 0 at the end.
+func (a *arithParser) next() rune {
+	a.space()
+	if a.i == len(a.expr) {
+		return 0
+	}
+	return a.expr[a.i]
+}
+
+func (a *arithParser) sum() (int64, error) {
+	n, err := a.product()
+	for err == nil {
+		op := a.next()
+		if op != '+' && op != '-' {
+			break
+		}
+		a.i++
+		var m int64
+		if m, err = a.product(); op == '+' {
+			n += m
+		} else {
+			n -= m
+		}
+	}
+	return n, err
+}
+
+func (a *arithParser) product() (int64, error) {
+	n, err := a.unary()
+	for err == nil {
+		op := a.next()
+		if op != '*' && op != '/' && op != '%' {
+			break
+		}
+		a.i++
+		var m int64
+		if m, err = a.unary(); err != nil {
+			break
+		}
+		switch {
+		case op == '*':
+			n *= m
+		case m == 0:
+			err = errArithDivide
+		case op == '/':
+			n /= m
+		default:
+			n %= m
+		}
+	}
+	return n, err
+}
+
+func (a *arithParser) unary() (int64, error) {
+	switch r := a.next(); {
+	case r == '-' || r == '+':
+		a.i++
+		n, err := a.unary()
+		if r == '-' {
+			n = -n
+		}
+		return n, err
+	case r == '(':
+		a.i++
+		n, err := a.sum()
+		if err == nil && a.next() != ')' {
+			err = errors.New("missing )")
+		}
+		a.i++
+		return n, err
+	case r >= '0' && r <= '9':
+		start := a.i
+		for a.i < len(a.expr) && a.expr[a.i] >= '0' && a.expr[a.i] <= '9' {
+			a.i++
+		}
+		return strconv.ParseInt(string(a.expr[start:a.i]), 10, 64)
+	case r == '_' || unicode.IsLetter(r):
+		start := a.i
+		for a.i < len(a.expr) && (a.expr[a.i] == '_' || unicode.IsLetter(a.expr[a.i]) || unicode.IsDigit(a.expr[a.i])) {
+			a.i++
+		}
+		return a.variable(string(a.expr[start:a.i]))
+	case r == 0:
+		return 0, errors.New("operand expected")
+	default:
+		return 0, fmt.Errorf("unexpected %q", r)
+	}
+}
+
+// variable evaluates the value of a variable as an expression itself.
+func (a *arithParser) variable(name string) (int64, error) {
+	value, _ := a.shell.lookupVar(name)
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	if a.depth == 16 {
+		return 0, fmt.Errorf("%s: expression recursion level exceeded", name)
+	}
+	inner := &arithParser{shell: a.shell, expr: []rune(value), depth: a.depth + 1}
+	n, err := inner.sum()
+	if err == nil && inner.next() != 0 {
+		err = fmt.Errorf("%s: not a number: %s", name, value)
+	}
+	return n, err
+}
@@ -0,0 +1,232 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Slow prompt fields, such as {git} and the segments plugins provide, are
+// computed in the background, so that the prompt never keeps the keys
+// waiting. A prompt waits for them for at most prompt_wait, showing those
+// not ready by then as they were for the last prompt in the same
+// directory, and is drawn again in place once they are.
+
+// slowFields compute the slow prompt fields built in, for a directory.
+var slowFields = map[string]func(dir string) string{
+	"git":  gitStatus,
+	"kube": kubeContext,
+}
+
+// promptScheduler runs the slow fields of each prompt in the background.
+type promptScheduler struct {
+	mu sync.Mutex
+	// generation counts the prompts; values computed for an earlier one
+	// are shown only until they have been computed again. Nothing is
+	// computed before the first.
+	generation int
+	deadline   time.Time
+	// Values, the generation each was computed for and the latest run
+	// started, with its done channel, are kept by field and directory.
+	values  map[string]string
+	fresh   map[string]int
+	started map[string]int
+	done    map[string]chan struct{}
+	// late gets the generation of a prompt drawn without a value that
+	// has turned out different since.
+	late chan int
+}
+
+func newPromptScheduler() *promptScheduler {
+	return &promptScheduler{
+		values:  make(map[string]string),
+		fresh:   make(map[string]int),
+		started: make(map[string]int),
+		done:    make(map[string]chan struct{}),
+		late:    make(chan int, 1),
+	}
+}
+
+// next starts a new prompt, which waits for its slow fields until wait
+// has passed.
+func (p *promptScheduler) next(wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.generation++
+	p.deadline = time.Now().Add(wait)
+}
+
+// current reports whether generation is that of the prompt on show.
+func (p *promptScheduler) current(generation int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return generation == p.generation
+}
+
+// value returns the value of a slow field in dir for the prompt, running
+// compute for it in the background if that has not been started for this
+// prompt, and waiting for it until the prompt's deadline. Until it is
+// ready, the last value is returned.
+func (p *promptScheduler) value(name, dir string, compute func() string) string {
+	key := name + "\x00" + dir
+	p.mu.Lock()
+	generation := p.generation
+	if generation == 0 || p.fresh[key] == generation {
+		defer p.mu.Unlock()
+		return p.values[key]
+	}
+	if p.started[key] != generation {
+		p.started[key] = generation
+		done := make(chan struct{})
+		p.done[key] = done
+		go func() {
+			value := compute()
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			close(done)
+			if generation < p.fresh[key] {
+				return
+			}
+			changed := value != p.values[key]
+			p.values[key] = value
+			p.fresh[key] = generation
+			if changed && generation == p.generation && !time.Now().Before(p.deadline) {
+				select {
+				case p.late <- generation:
+				default:
+				}
+			}
+		}()
+	}
+	done, wait := p.done[key], time.Until(p.deadline)
+	p.mu.Unlock()
+
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-done:
+		case <-t.C:
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.values[key]
+}
+
+// redrawPrompts draws the prompt on show again whenever slow fields it
+// was drawn without are ready.
+func (s *Shell) redrawPrompts() {
+	for generation := range s.prompts.late {
+		s.execMu.Lock()
+		if s.prompts.current(generation) {
+			s.reader.SetPrompt(s.prompt())
+		}
+		s.execMu.Unlock()
+	}
+}
+
+// slowValue returns the value of a slow field, as far as it is known.
+func (s *Shell) slowValue(name string, compute func(dir string) string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return s.prompts.value(name, dir, func() string { return compute(dir) })
+}
+
+// gitStatus is the {git} field: the branch checked out in dir, or the
+// commit when none is, marked with * when there are changes not
+// committed, and with ↑N and ↓N when it is ahead of or behind its
+// upstream. Outside a repository it is empty.
+func gitStatus(dir string) string {
+	cmd := exec.Command("git", "status", "--porcelain=v2", "--branch")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	var branch, commit, ahead, behind string
+	dirty := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "# ") {
+			dirty = true
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		switch {
+		case len(fields) >= 2 && fields[0] == "branch.head":
+			branch = fields[1]
+		case len(fields) >= 2 && fields[0] == "branch.oid":
+			commit = fields[1]
+		case len(fields) >= 3 && fields[0] == "branch.ab":
+			ahead, behind = strings.TrimPrefix(fields[1], "+"), strings.TrimPrefix(fields[2], "-")
+		}
+	}
+	if branch == "(detached)" || branch == "" {
+		branch = commit
+		if len(branch) > 7 {
+			branch = branch[:7]
+		}
+	}
+	if dirty {
+		branch += "*"
+	}
+	if ahead != "" && ahead != "0" {
+		branch += " ↑" + ahead
+	}
+	if behind != "" && behind != "0" {
+		branch += " ↓" + behind
+	}
+	return branch
+}
+
+// kubeContext is the {kube} field: the current context of the kubectl
+// config, followed by its namespace if it names one, as context:namespace.
+// The config is $KUBECONFIG, the first of its files that sets a context,
+// or ~/.kube/config.
+func kubeContext(string) string {
+	files := filepath.SplitList(os.Getenv("KUBECONFIG"))
+	if len(files) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		files = []string{filepath.Join(home, ".kube", "config")}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var config struct {
+			CurrentContext string `yaml:"current-context"`
+			Contexts       []struct {
+				Name    string `yaml:"name"`
+				Context struct {
+					Namespace string `yaml:"namespace"`
+				} `yaml:"context"`
+			} `yaml:"contexts"`
+		}
+		if yaml.Unmarshal(data, &config) != nil || config.CurrentContext == "" {
+			continue
+		}
+		for _, c := range config.Contexts {
+			if c.Name == config.CurrentContext && c.Context.Namespace != "" {
+				return fmt.Sprintf("%s:%s", config.CurrentContext, c.Context.Namespace)
+			}
+		}
+		return config.CurrentContext
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Bookmarks are named directories kept in the config's bookmarks file,
+// read afresh each time so that every shell sees the same ones.
+
+func (s *Shell) loadBookmarks() (map[string]string, error) {
+	bookmarks := make(map[string]string)
+	data, err := os.ReadFile(s.config.BookmarksFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return bookmarks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &bookmarks); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.config.BookmarksFile, err)
+	}
+	return bookmarks, nil
+}
+
+func (s *Shell) saveBookmarks(bookmarks map[string]string) error {
+	data, err := json.MarshalIndent(bookmarks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.config.BookmarksFile), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.config.BookmarksFile, append(data, '\n'), 0o644)
+}
+
+// bookmark manages bookmarks: bookmark add NAME [DIR] saves DIR, or the
+// working directory, under NAME; bookmark remove NAME forgets it; and
+// bookmark list, or bookmark alone, lists them.
+func (s *Shell) bookmark(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	bookmarks, err := s.loadBookmarks()
+	if err != nil {
+		return fmt.Errorf("bookmark: %w", err)
+	}
+
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "list" && len(args) == 0:
+		names := make([]string, 0, len(bookmarks))
+		for name := range bookmarks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-15s %s\n", name, bookmarks[name])
+		}
+		return nil
+	case cmd == "add" && (len(args) == 1 || len(args) == 2):
+		name := args[0]
+		if !isBookmarkName(name) {
+			return fmt.Errorf("bookmark: %q: names may only have letters, digits, '.', '-' and '_'", name)
+		}
+		dir := "."
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			return fmt.Errorf("bookmark: %w", err)
+		}
+		if !isDir(dir) {
+			return fmt.Errorf("bookmark: %s: not a directory", dir)
+		}
+		bookmarks[name] = dir
+	case (cmd == "remove" || cmd == "rm") && len(args) == 1:
+		if _, ok := bookmarks[args[0]]; !ok {
+			return fmt.Errorf("bookmark: %s: not found", args[0])
+		}
+		delete(bookmarks, args[0])
+	default:
+		return fmt.Errorf("bookmark: usage: bookmark [list | add NAME [DIR] | remove NAME]")
+	}
+	if err := s.saveBookmarks(bookmarks); err != nil {
+		return fmt.Errorf("bookmark: %w", err)
+	}
+	return nil
+}
+
+func isBookmarkName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && c != '-' && c != '.' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// namedDir expands a cd target starting with ~ or ~/ to the home
+// directory, and one starting with ~name or @name, followed by nothing
+// or a /, to the directory bookmarked as name, or for ~name with no such
+// bookmark to the home directory of the user name. It reports whether it
+// expanded anything.
+func (s *Shell) namedDir(target string) (string, bool, error) {
+	if target == "" || target[0] != '~' && target[0] != '@' {
+		return target, false, nil
+	}
+	name, rest, _ := strings.Cut(target[1:], "/")
+	if name == "" && target[0] == '~' {
+		return filepath.Join(s.config.HomeDir, rest), true, nil
+	}
+	if !isBookmarkName(name) {
+		return target, false, nil
+	}
+	bookmarks, err := s.loadBookmarks()
+	if err != nil {
+		return "", false, err
+	}
+	dir, ok := bookmarks[name]
+	if !ok {
+		if target[0] == '~' {
+			if home, ok := userHome(name); ok {
+				return filepath.Join(home, rest), true, nil
+			}
+			return "", false, fmt.Errorf("no such bookmark: %s", name)
+		}
+		// @name may just be a directory's name.
+		return target, false, nil
+	}
+	return filepath.Join(dir, rest), true, nil
+}
+
+// bookmarkCandidates completes ~name and @name to the bookmarks.
+func (s *Shell) bookmarkCandidates(word string) []string {
+	bookmarks, err := s.loadBookmarks()
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for name := range bookmarks {
+		if _, ok := s.matchCompletion(word[1:], name); ok {
+			candidates = append(candidates, word[:1]+name+"/")
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
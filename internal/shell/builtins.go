@@ -3,43 +3,329 @@ package shell
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"shell/internal/cdpath"
+	"shell/internal/history"
 )
 
 func (s *Shell) executeBuiltin(args []string) (bool, error) {
 	switch args[0] {
+	case "bind":
+		return true, s.bind(args[1:])
+	case "bookmark":
+		return true, s.bookmark(args[1:])
 	case "cd":
 		return true, s.changeDirectory(args[1:])
 	case "exit":
-		s.exit()
-		return true, nil
+		return true, s.exit(args[1:])
 	case "history":
-		return true, s.showHistory()
+		return true, s.paged(func() error { return s.showHistory(args[1:]) })
+	case "jobs":
+		return true, s.paged(func() error { return s.listJobs(args[1:]) })
+	case "env":
+		return true, s.env(args[1:])
+	case "kill":
+		return true, s.kill(args[1:])
+	case "copy":
+		return true, s.copyCommand(args[1:])
+	case "paste":
+		return true, s.pasteCommand(args[1:])
+	case "help":
+		return true, s.paged(func() error { return s.helpCommand(args[1:]) })
+	case "theme":
+		return true, s.themeCommand(args[1:])
+	case "pushenv":
+		return true, s.pushenv(args[1:])
+	case "popenv":
+		return true, s.popenv(args[1:])
+	case "envdiff":
+		return true, s.envdiff(args[1:])
+	case "envfile":
+		return true, s.envFileCommand(args[1:])
+	case "project":
+		return true, s.projectCommand(args[1:])
+	case "joblog":
+		return true, s.joblog(args[1:])
+	case "echo":
+		return true, s.echo(args[1:])
+	case "printf":
+		return true, s.printf(args[1:])
+	case "test", "[":
+		return true, s.test(args[0], args[1:])
+	case "read":
+		return true, s.read(args[1:])
+	case "alias":
+		return true, s.alias(args[1:])
+	case "unalias":
+		return true, s.unalias(args[1:])
+	case "profile":
+		return true, s.profile(args[1:])
+	case "plugin":
+		return true, s.pluginCommand(args[1:])
+	case "reload":
+		return true, s.reload(args[1:])
+	case "add-hook":
+		return true, s.addHook(args[1:])
+	case "trap":
+		return true, s.trap(args[1:])
+	case "set":
+		return true, s.set(args[1:])
+	case "shift":
+		return true, s.shift(args[1:])
+	case "declare", "typeset":
+		return true, s.declare(args[0], args[1:])
+	case "local":
+		return true, s.local(args[1:])
+	case "source", ".":
+		return true, s.source(args[1:])
+	case "eval":
+		return true, s.eval(args[1:])
+	case "ulimit":
+		return true, s.ulimit(args[1:])
+	case "umask":
+		return true, s.umask(args[1:])
+	case "output":
+		return true, s.output(args[1:])
+	case "record":
+		return true, s.recordBuiltin(args[1:])
+	case "remote":
+		return true, s.remoteBuiltin(args[1:])
 	default:
 		return false, nil
 	}
 }
 
 func (s *Shell) changeDirectory(args []string) error {
+	if s.remote != nil {
+		return s.remoteCd(args)
+	}
 	var dir string
-	if len(args) == 0 {
+	printDir := false
+	switch {
+	case len(args) == 0:
 		dir = s.config.HomeDir
-	} else {
-		dir = args[0]
+	case args[0] == "-":
+		if s.prevDir == "" {
+			return fmt.Errorf("cd: OLDPWD not set")
+		}
+		dir = s.prevDir
+		printDir = true
+	default:
+		named, ok, err := s.namedDir(args[0])
+		if err != nil {
+			return fmt.Errorf("cd: %w", err)
+		}
+		if ok {
+			dir = named
+			break
+		}
+		dir, printDir = cdpath.Resolve(args[0], os.Getenv("CDPATH"))
+		if _, err := os.Stat(dir); os.IsNotExist(err) && s.options[OptionCorrect] && s.interactive {
+			if dir, err = s.correctDir(dir); err != nil {
+				return err
+			}
+		}
 	}
 
+	prev, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("cd: %w", err)
+	}
 	if err := os.Chdir(dir); err != nil {
 		return fmt.Errorf("cd: %w", err)
 	}
+	s.prevDir = prev
+	os.Setenv("OLDPWD", prev)
+	if wd, err := os.Getwd(); err == nil {
+		os.Setenv("PWD", wd)
+		if printDir {
+			fmt.Println(wd)
+		}
+	}
 	return nil
 }
 
-func (s *Shell) exit() {
-	os.Exit(0)
+// exit makes the shell stop once the current command returns, with status
+// n or else the status of the last command. Whatever is running commands
+// then shuts the shell down cleanly.
+func (s *Shell) exit(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("exit: too many arguments")
+	}
+	s.exitRequested = true
+	if len(args) == 0 {
+		return ExitStatus(s.lastStatus)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: exit: %s: numeric argument required\n", args[0])
+		return ExitStatus(2)
+	}
+	return ExitStatus(n & 0xff)
 }
 
-func (s *Shell) showHistory() error {
-	for i, cmd := range s.history.GetAll() {
-		fmt.Printf("%d: %s\n", i+1, cmd)
+func (s *Shell) showHistory(args []string) error {
+	if len(args) == 0 {
+		// As in bash, HISTTIMEFORMAT adds each command's time.
+		format, _ := s.lookupVar("HISTTIMEFORMAT")
+		for i, entry := range s.history.Entries() {
+			stamp := ""
+			if format != "" && !entry.Time.IsZero() {
+				stamp = strftime(format, entry.Time.Local())
+			}
+			fmt.Printf("%d: %s%s\n", i+1, stamp, entry.Command)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "--sessions":
+		for _, session := range s.history.Sessions() {
+			printSession(session)
+		}
+		return nil
+	case "--session":
+		if len(args) != 2 {
+			return fmt.Errorf("history: --session: expected a session ID or 'current'")
+		}
+		id := args[1]
+		if id == "current" {
+			id = s.history.SessionID()
+		}
+		for _, session := range s.history.Sessions() {
+			if session.ID == id {
+				printSession(session)
+				return nil
+			}
+		}
+		if id == s.history.SessionID() {
+			return nil
+		}
+		return fmt.Errorf("history: %s: no such session", args[1])
+	case "-c":
+		if err := s.history.Clear(); err != nil {
+			return fmt.Errorf("history: %w", err)
+		}
+		s.reloadEditorHistory()
+		return nil
+	case "-d":
+		if len(args) != 2 {
+			return fmt.Errorf("history: -d: expected a history position")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("history: %s: history position out of range", args[1])
+		}
+		if err := s.history.Delete(n); err != nil {
+			return fmt.Errorf("history: %w", err)
+		}
+		s.reloadEditorHistory()
+		return nil
+	case "-w", "-r":
+		var file string
+		if len(args) > 2 {
+			return fmt.Errorf("history: %s: too many arguments", args[0])
+		} else if len(args) == 2 {
+			file = expandTilde(args[1])
+		}
+		if args[0] == "-w" {
+			if err := s.history.Write(file); err != nil {
+				return fmt.Errorf("history: %w", err)
+			}
+			return nil
+		}
+		if err := s.history.Read(file); err != nil {
+			return fmt.Errorf("history: %w", err)
+		}
+		s.reloadEditorHistory()
+		return nil
+	case "--json":
+		if len(args) != 1 {
+			return fmt.Errorf("history: --json: too many arguments")
+		}
+		if err := printJSON(historyJSON(s.history.Entries())); err != nil {
+			return fmt.Errorf("history: %w", err)
+		}
+		return nil
+	case "stats":
+		return s.historyStats(args[1:])
+	case "search":
+		if len(args) != 2 {
+			return fmt.Errorf("history: search: expected a pattern")
+		}
+		for i, cmd := range s.history.GetAll() {
+			if strings.Contains(cmd, args[1]) {
+				fmt.Printf("%d: %s\n", i+1, cmd)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("history: %s: invalid option", args[0])
+}
+
+// editorHistory is how many of the newest commands the line editor
+// recalls with the arrow keys. The history may keep many more, which the
+// searches go through instead.
+const editorHistory = 1000
+
+// reloadEditorHistory replaces the lines the line editor recalls with the
+// arrow keys after the history was changed behind its back.
+func (s *Shell) reloadEditorHistory() {
+	commands := s.history.GetAll()
+	s.reader.SetHistory(commands[max(len(commands)-editorHistory, 0):])
+}
+
+// historyEntryJSON is a history entry as history --json prints it. What
+// the backend did not record is left out.
+type historyEntryJSON struct {
+	Number     int    `json:"number"`
+	Command    string `json:"command"`
+	Time       string `json:"time,omitempty"`
+	Session    string `json:"session,omitempty"`
+	Dir        string `json:"dir,omitempty"`
+	Host       string `json:"host,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMS *int64 `json:"duration_ms,omitempty"`
+}
+
+func historyJSON(entries []history.Entry) []historyEntryJSON {
+	list := make([]historyEntryJSON, 0, len(entries))
+	for i, entry := range entries {
+		item := historyEntryJSON{
+			Number:  i + 1,
+			Command: entry.Command,
+			Session: entry.Session,
+			Dir:     entry.Dir,
+			Host:    entry.Host,
+		}
+		if !entry.Time.IsZero() {
+			item.Time = entry.Time.Format(time.RFC3339)
+		}
+		if entry.Finished {
+			code, ms := entry.ExitCode, entry.Duration.Milliseconds()
+			item.ExitCode, item.DurationMS = &code, &ms
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+func printSession(session history.Session) {
+	const layout = "2006-01-02 15:04:05"
+	id := session.ID
+	if id == "" {
+		id = "(unknown)"
+	}
+	if session.Start.IsZero() {
+		fmt.Printf("Session %s (%d commands)\n", id, len(session.Entries))
+	} else {
+		fmt.Printf("Session %s  %s - %s (%d commands)\n", id, session.Start.Format(layout),
+			session.End.Format(layout), len(session.Entries))
+	}
+	for i, entry := range session.Entries {
+		fmt.Printf("  %d: %s\n", session.Indexes[i]+1, entry.Command)
 	}
-	return nil
 }
@@ -0,0 +1,219 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// applyCapture handles capture VAR COMMAND [ARG...], which runs a
+// command, builtin or external, and sets VAR to its output rather than
+// showing it. Trailing newlines are dropped, as command substitution
+// does.
+func (s *Shell) applyCapture(st *stage) error {
+	if len(st.args) < 3 {
+		return fmt.Errorf("capture: usage: capture VAR COMMAND [ARG...]")
+	}
+	name := st.args[1]
+	if !isVarName(name) {
+		return fmt.Errorf("capture: `%s': not a valid identifier", name)
+	}
+	st.capture = name
+	st.args = st.args[2:]
+	st.builtin = s.isCommandBuiltin(st.args[0])
+	return nil
+}
+
+// runCaptured runs a stage whose output capture takes.
+func (s *Shell) runCaptured(st *stage, background bool) error {
+	if background {
+		return fmt.Errorf("capture: cannot run in the background")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		r.Close()
+		close(done)
+	}()
+
+	name := st.capture
+	st.capture, st.out = "", w
+	err = s.runStage(st, false)
+	w.Close()
+	<-done
+	if setErr := s.setVar(name, strings.TrimRight(out.String(), "\n")); setErr != nil {
+		return fmt.Errorf("capture: %w", setErr)
+	}
+	return err
+}
+
+// maxKeptOutput is how much of each stream of a command line's output
+// is kept; the rest is dropped.
+const maxKeptOutput = 1 << 20
+
+// outputRing keeps the output of the last command lines that ran an
+// external command, newest last.
+type outputRing struct {
+	keep    int
+	entries []*keptOutput
+	// current collects the output of the command line running.
+	current *keptOutput
+}
+
+type keptOutput struct {
+	stdout, stderr keptBuffer
+	// used is set once a command has written to it.
+	used bool
+}
+
+// keptBuffer is a stream of kept output, which commands in a pipeline
+// may write to at once.
+type keptBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *keptBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := maxKeptOutput - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *keptBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newOutputRing(keep int) *outputRing {
+	if keep <= 0 {
+		return nil
+	}
+	return &outputRing{keep: keep}
+}
+
+// resize returns a ring keeping keep command lines' output, with as much
+// of what o kept as fits.
+func (o *outputRing) resize(keep int) *outputRing {
+	ring := newOutputRing(keep)
+	if ring != nil && o != nil {
+		ring.entries = o.entries[max(0, len(o.entries)-keep):]
+		ring.current = o.current
+	}
+	return ring
+}
+
+// begin starts keeping the output of a command line.
+func (o *outputRing) begin() {
+	if o != nil {
+		o.current = &keptOutput{}
+	}
+}
+
+// end keeps the command line's output, if it ran anything whose output
+// was kept, dropping the oldest kept when there are too many.
+func (o *outputRing) end() {
+	if o == nil || o.current == nil {
+		return
+	}
+	if o.current.used {
+		o.entries = append(o.entries, o.current)
+		if len(o.entries) > o.keep {
+			o.entries = o.entries[1:]
+		}
+	}
+	o.current = nil
+}
+
+// get returns the output kept n command lines back, from 1.
+func (o *outputRing) get(n int) (*keptOutput, bool) {
+	if o == nil || n < 1 || n > len(o.entries) {
+		return nil, false
+	}
+	return o.entries[len(o.entries)-n], true
+}
+
+// keepOutput has an external command's output to the terminal written
+// to the command line's kept output too.
+func (s *Shell) keepOutput(args []string, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if s.outputs == nil {
+		return stdout, stderr
+	}
+	kept := s.outputs.current
+	if kept == nil || slices.Contains(s.config.CaptureOutput.Exclude, filepath.Base(args[0])) {
+		return stdout, stderr
+	}
+	if stdout == os.Stdout {
+		stdout = io.MultiWriter(stdout, &kept.stdout)
+		kept.used = true
+	}
+	if stderr == os.Stderr {
+		stderr = io.MultiWriter(stderr, &kept.stderr)
+		kept.used = true
+	}
+	return stdout, stderr
+}
+
+// keptParam returns $OUTPUT or $STDERR, the output of the last command
+// line kept, without trailing newlines.
+func (s *Shell) keptParam(name string) (string, bool) {
+	if s.outputs == nil || (name != "OUTPUT" && name != "STDERR") {
+		return "", false
+	}
+	kept, ok := s.outputs.get(1)
+	if !ok {
+		return "", true
+	}
+	text := kept.stdout.String()
+	if name == "STDERR" {
+		text = kept.stderr.String()
+	}
+	return strings.TrimRight(text, "\n"), true
+}
+
+// output prints the output kept N command lines back, the last by
+// default, or with -e what they wrote to standard error.
+func (s *Shell) output(args []string) error {
+	if s.outputs == nil {
+		return fmt.Errorf("output: no output is kept; set capture_output.keep in the config")
+	}
+	stderr := false
+	if len(args) > 0 && args[0] == "-e" {
+		stderr = true
+		args = args[1:]
+	}
+	n := 1
+	if len(args) > 1 {
+		return fmt.Errorf("output: usage: output [-e] [N]")
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("output: %s: numeric argument required", args[0])
+		}
+	}
+	kept, ok := s.outputs.get(n)
+	if !ok {
+		return fmt.Errorf("output: %d: only %d kept", n, len(s.outputs.entries))
+	}
+	if stderr {
+		fmt.Print(kept.stderr.String())
+	} else {
+		fmt.Print(kept.stdout.String())
+	}
+	return nil
+}
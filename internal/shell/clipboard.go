@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"shell/internal/lineedit"
+)
+
+// clipboardTool is a pair of commands that copy to and paste from the
+// system clipboard.
+type clipboardTool struct {
+	copy, paste []string
+}
+
+// clipboardTools are tried in order, where the environment says they
+// could work, for the first whose programs are installed.
+var clipboardTools = []struct {
+	when func() bool
+	clipboardTool
+}{
+	{func() bool { return runtime.GOOS == "darwin" }, clipboardTool{[]string{"pbcopy"}, []string{"pbpaste"}}},
+	{func() bool { return runtime.GOOS == "windows" || os.Getenv("WSL_DISTRO_NAME") != "" },
+		clipboardTool{[]string{"clip.exe"}, []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"}}},
+	{func() bool { return os.Getenv("WAYLAND_DISPLAY") != "" }, clipboardTool{[]string{"wl-copy"}, []string{"wl-paste", "--no-newline"}}},
+	{func() bool { return os.Getenv("DISPLAY") != "" },
+		clipboardTool{[]string{"xclip", "-selection", "clipboard", "-in"}, []string{"xclip", "-selection", "clipboard", "-out"}}},
+	{func() bool { return os.Getenv("DISPLAY") != "" },
+		clipboardTool{[]string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}}},
+	{func() bool { return os.Getenv("TERMUX_VERSION") != "" },
+		clipboardTool{[]string{"termux-clipboard-set"}, []string{"termux-clipboard-get"}}},
+}
+
+// errNoClipboard is returned for pasting when there is no clipboard
+// command to paste with.
+var errNoClipboard = errors.New("no clipboard command found; install wl-clipboard, xclip or xsel, or set clipboard.paste in the config")
+
+// clipboardCommands returns the commands to copy and paste with: the
+// config's, or else those found. Either is nil when there is none.
+func (s *Shell) clipboardCommands() clipboardTool {
+	tool := clipboardTool{s.config.Clipboard.Copy, s.config.Clipboard.Paste}
+	for _, t := range clipboardTools {
+		if tool.copy != nil && tool.paste != nil {
+			break
+		}
+		if !t.when() {
+			continue
+		}
+		if _, err := exec.LookPath(t.copy[0]); err == nil && tool.copy == nil {
+			tool.copy = t.copy
+		}
+		if _, err := exec.LookPath(t.paste[0]); err == nil && tool.paste == nil {
+			tool.paste = t.paste
+		}
+	}
+	return tool
+}
+
+// copyToClipboard puts text on the clipboard with the copy command or,
+// failing one, sends it to the terminal with OSC 52, which terminals
+// that allow it copy to the clipboard of the machine they run on.
+func (s *Shell) copyToClipboard(text string) error {
+	command := s.clipboardCommands().copy
+	if command == nil || len(command) == 1 && command[0] == "osc52" {
+		if !lineedit.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("no clipboard command found, and OSC 52 needs the output to be a terminal")
+		}
+		fmt.Printf("\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString([]byte(text)))
+		return nil
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", command[0], err)
+	}
+	return nil
+}
+
+// readClipboard returns what the clipboard holds.
+func (s *Shell) readClipboard() (string, error) {
+	command := s.clipboardCommands().paste
+	if command == nil {
+		return "", errNoClipboard
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", command[0], err)
+	}
+	return strings.ReplaceAll(string(out), "\r\n", "\n"), nil
+}
+
+// copyCommand is the copy builtin: copy TEXT... copies its arguments,
+// and copy alone its input, as in cmd | copy.
+func (s *Shell) copyCommand(args []string) error {
+	var text string
+	if len(args) > 0 {
+		text = strings.Join(args, " ")
+	} else if !s.stdinRedirected && lineedit.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("copy: usage: copy TEXT... or COMMAND | copy")
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		text = string(data)
+	}
+	if err := s.copyToClipboard(text); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	return nil
+}
+
+// pasteCommand is the paste builtin, which prints what the clipboard
+// holds. With arguments it runs the paste program, which merges the
+// lines of files, instead.
+func (s *Shell) pasteCommand(args []string) error {
+	if len(args) > 0 {
+		return s.runExternal(&stage{args: append([]string{"paste"}, args...)}, false)
+	}
+	text, err := s.readClipboard()
+	if err != nil {
+		return fmt.Errorf("paste: %w", err)
+	}
+	fmt.Print(text)
+	return nil
+}
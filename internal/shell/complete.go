@@ -0,0 +1,291 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var builtinNames = []string{
+	".", "[", "add-hook", "alias", "bind", "bookmark", "capture", "cd", "copy", "declare", "echo", "env", "envdiff", "envfile", "eval", "exec", "exit", "help", "history", "in-container", "joblog", "jobs", "kill", "limit", "local", "output", "paste", "plugin", "popenv", "printf", "profile",
+	"project", "pushenv", "read", "record", "reload", "remote", "sandbox", "set", "shift", "source", "test", "theme", "timeout", "trap", "typeset", "ulimit", "umask", "unalias",
+}
+
+func isBuiltin(name string) bool {
+	for _, builtin := range builtinNames {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
+
+type completer struct {
+	shell   *Shell
+	preview bool
+	// kind is what the last completions were, such as "commands" or
+	// "files", for Describe; described holds their descriptions when
+	// they came with them, as a completion provider's do.
+	kind      string
+	described map[string]string
+}
+
+// Do returns the completions for lineedit.Config.Complete.
+func (c *completer) Do(line []rune, pos int) ([][]rune, int) {
+	word, candidates, files := c.complete(line, pos)
+	if files && c.preview {
+		c.showPreview(word, candidates)
+	}
+
+	completions := make([][]rune, len(candidates))
+	for i, candidate := range candidates {
+		completions[i] = []rune(candidate)
+	}
+	return completions, len([]rune(word))
+}
+
+// complete returns the word before pos and its possible completions, the
+// best matches first. The first word completes to builtins and
+// executables on PATH, $NAME and ${NAME} to variables, ~name to users,
+// arguments of commands a script or a completion provider completes to
+// whatever they return, and the rest as the command's completion spec
+// says, mostly to file names, which is reported by files. A file name's
+// directory is read with its ~ and variables expanded, but completes as
+// typed.
+func (c *completer) complete(line []rune, pos int) (word string, candidates []string, files bool) {
+	word, candidates, files = c.candidates(line, pos)
+	return word, c.shell.rankCompletions(word, candidates), files
+}
+
+// candidates returns the word before pos and its completions, as
+// complete does, before they are ranked.
+func (c *completer) candidates(line []rune, pos int) (word string, candidates []string, files bool) {
+	c.kind, c.described = "", nil
+	word, args := completing(line, pos)
+	if strings.HasPrefix(word, "$") && !strings.ContainsRune(word, '/') {
+		c.kind = "variables"
+		return word, c.variableCandidates(word), false
+	}
+	if len(args) == 0 && !strings.ContainsRune(word, '/') {
+		c.kind = "commands"
+		return word, c.commandCandidates(word), false
+	}
+	if len(args) == 0 {
+		c.kind = "files"
+		return word, c.fileCandidates(word), true
+	}
+	if len(args) == 1 && args[0] == "cd" && isNamedDirPrefix(word) {
+		candidates := c.shell.bookmarkCandidates(word)
+		if word[0] == '~' {
+			candidates = append(candidates, c.userCandidates(word)...)
+		}
+		return word, candidates, false
+	}
+	if c.shell.scripts != nil {
+		if candidates, ok := c.shell.scripts.Complete(args, word); ok {
+			return word, c.scriptCandidates(word, candidates), false
+		}
+	}
+	if completions, ok := c.shell.provideCompletions(args, word); ok {
+		return word, c.providedCandidates(word, completions), false
+	}
+	if strings.HasPrefix(word, "-") && c.shell.config.Completion.Flags && !c.shell.isCommandBuiltin(args[0]) {
+		if candidates := c.shell.flagCandidates(args[0], word); len(candidates) > 0 {
+			c.kind = "flags"
+			return word, candidates, false
+		}
+	}
+	if strings.HasPrefix(word, "~") && !strings.ContainsRune(word, '/') {
+		c.kind = "users"
+		return word, c.userCandidates(word), false
+	}
+	candidates, files = c.specCandidates(c.shell.completionSpec(args[0]), word)
+	return word, candidates, files
+}
+
+// completing returns the word before pos in line, and the words before
+// it.
+func completing(line []rune, pos int) (word string, args []string) {
+	head := string(line[:pos])
+	start := strings.LastIndexAny(head, " \t") + 1
+	return head[start:], strings.Fields(head[:start])
+}
+
+// Describe describes the completions of the word before pos, for
+// lineedit.Config.Describe: commands by what they are, options by what
+// their command's help says of them, files by their kind, and others by
+// the descriptions they came with, such as the values of variables.
+func (c *completer) Describe(line []rune, pos int, names []string) []string {
+	_, args := completing(line, pos)
+	descriptions := make([]string, len(names))
+	switch c.kind {
+	case "commands":
+		for i, name := range names {
+			descriptions[i] = c.shell.describeCommand(name)
+		}
+	case "flags":
+		flags := make(map[string]string)
+		for _, flag := range c.shell.commandFlags(args[0]) {
+			flags[flag.Name] = flag.Description
+		}
+		for i, name := range names {
+			descriptions[i] = flags[name]
+		}
+	case "files", "directories":
+		for i, name := range names {
+			descriptions[i] = describeFile(c.expandPath(name))
+		}
+	default:
+		for i, name := range names {
+			descriptions[i] = c.described[name]
+		}
+	}
+	return descriptions
+}
+
+// describeCommand says what a command completed to is: a builtin by its
+// summary in help, and an executable by where it is.
+func (s *Shell) describeCommand(name string) string {
+	if entry, ok := builtinHelp[name]; ok {
+		return entry.Summary
+	}
+	if builtin, ok := s.pluginBuiltins[name]; ok {
+		return "Added by the " + builtin.owner + " plugin."
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return ""
+}
+
+// describeFile says what kind of file path names.
+func describeFile(path string) string {
+	info, err := os.Lstat(expandTilde(strings.TrimSuffix(path, "/")))
+	if err != nil {
+		return ""
+	}
+	switch mode := info.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		target, _ := os.Readlink(expandTilde(path))
+		return "link to " + target
+	case mode.IsDir():
+		return "directory"
+	case mode&0111 != 0:
+		return "executable"
+	case !mode.IsRegular():
+		return "special file"
+	}
+	return formatSize(info.Size())
+}
+
+// formatSize gives a number of bytes as ls -h does, with a K, M, G or T
+// suffix for the powers of 1024.
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len("KMGT") {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%c", size, "KMGT"[unit-1])
+}
+
+// isNamedDirPrefix reports whether word is the start of a ~name or @name
+// for a bookmark.
+func isNamedDirPrefix(word string) bool {
+	return (strings.HasPrefix(word, "@") || strings.HasPrefix(word, "~") && word != "~") && !strings.Contains(word, "/")
+}
+
+// scriptCandidates keeps the completions a script returned that match
+// word, ending each with a space unless it names a directory.
+func (c *completer) scriptCandidates(word string, completions []string) []string {
+	var candidates []string
+	for _, candidate := range completions {
+		if _, ok := c.shell.matchCompletion(word, candidate); !ok {
+			continue
+		}
+		if !strings.HasSuffix(candidate, "/") {
+			candidate += " "
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func (c *completer) commandCandidates(prefix string) []string {
+	seen := make(map[string]bool)
+	var candidates []string
+	add := func(name string) {
+		if _, ok := c.shell.matchCompletion(prefix, name); ok && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name+" ")
+		}
+	}
+
+	for _, name := range builtinNames {
+		add(name)
+	}
+	for name := range c.shell.pluginBuiltins {
+		add(name)
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				add(entry.Name())
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func (c *completer) fileCandidates(word string) []string {
+	dir, prefix := filepath.Split(word)
+	expanded := c.expandPath(dir)
+	entries, err := os.ReadDir(expanded)
+	if dir == "" {
+		entries, err = os.ReadDir(".")
+	}
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := c.shell.matchCompletion(prefix, name); !ok || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if isDir(filepath.Join(expanded, name)) {
+			candidates = append(candidates, dir+name+"/")
+		} else {
+			candidates = append(candidates, dir+name+" ")
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func expandTilde(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
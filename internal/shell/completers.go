@@ -0,0 +1,89 @@
+package shell
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"shell/internal/plugin"
+)
+
+// completionProvider completes the arguments of some commands: a plugin
+// implementing plugin.Completer, named by owner, or one built into the
+// shell, with no owner.
+type completionProvider struct {
+	owner string
+	plugin.Completer
+}
+
+// completionProviders returns the providers in the order they are asked:
+// those of plugins, which can take over from those built in, first.
+func (s *Shell) completionProviders() []completionProvider {
+	var providers []completionProvider
+	for _, p := range s.plugins {
+		if completer, ok := p.(plugin.Completer); ok {
+			providers = append(providers, completionProvider{p.Name(), completer})
+		}
+	}
+	for _, completer := range s.completers {
+		providers = append(providers, completionProvider{"", completer})
+	}
+	return providers
+}
+
+// provideCompletions returns the completions of word the first provider
+// for the command args names offers, if any does.
+func (s *Shell) provideCompletions(args []string, word string) ([]plugin.Completion, bool) {
+	command := filepath.Base(args[0])
+	for _, p := range s.completionProviders() {
+		if !slices.Contains(p.Completes(), command) {
+			continue
+		}
+		var completions []plugin.Completion
+		complete := func() (err error) {
+			completions, err = p.Complete(slices.Clone(args), word)
+			return err
+		}
+		var err error
+		if p.owner != "" {
+			err = s.guard(p.owner, "Complete", complete)
+		} else {
+			err = complete()
+		}
+		if err != nil {
+			what := "complete " + command
+			if p.owner != "" {
+				what = "plugin " + p.owner + ": " + what
+			}
+			s.reader.Write([]byte(fmt.Sprintf("Error: %s: %v\n", what, err)))
+			continue
+		}
+		if len(completions) > 0 {
+			return completions, true
+		}
+	}
+	return nil, false
+}
+
+// providedCandidates keeps the completions a provider offered that match
+// word, in its order, each ending with a space unless it is partial, and
+// notes their descriptions for Describe.
+func (c *completer) providedCandidates(word string, completions []plugin.Completion) []string {
+	c.described = make(map[string]string)
+	var candidates []string
+	for _, completion := range completions {
+		if _, ok := c.shell.matchCompletion(word, completion.Text); !ok {
+			continue
+		}
+		if _, seen := c.described[completion.Text]; seen {
+			continue
+		}
+		candidate := completion.Text
+		if !completion.Partial {
+			candidate += " "
+		}
+		candidates = append(candidates, candidate)
+		c.described[completion.Text] = completion.Description
+	}
+	return candidates
+}
@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"strings"
+)
+
+// completionSpecs say what the arguments of some commands complete to,
+// besides the file names most complete to. The config's
+// completion.specs adds to them and overrides them.
+var completionSpecs = map[string]string{
+	"cd":       "directories",
+	"pushd":    "directories",
+	"rmdir":    "directories",
+	"unset":    "variables",
+	"export":   "variables",
+	"declare":  "variables",
+	"typeset":  "variables",
+	"local":    "variables",
+	"readonly": "variables",
+	"which":    "commands",
+	"type":     "commands",
+	"command":  "commands",
+	"help":     "commands",
+	"man":      "commands",
+}
+
+// completionSpec returns what the arguments of command complete to.
+func (s *Shell) completionSpec(command string) string {
+	if kind, ok := s.config.Completion.Specs[command]; ok {
+		return kind
+	}
+	if kind, ok := completionSpecs[command]; ok {
+		return kind
+	}
+	return "files"
+}
+
+// specCandidates returns the completions of word of a kind that a
+// completion spec names, and reports whether they are file names.
+func (c *completer) specCandidates(kind, word string) (candidates []string, files bool) {
+	c.kind = kind
+	switch kind {
+	case "directories":
+		for _, candidate := range c.fileCandidates(word) {
+			if strings.HasSuffix(candidate, "/") {
+				candidates = append(candidates, candidate)
+			}
+		}
+		return candidates, true
+	case "variables":
+		if !strings.Contains(word, "=") {
+			return c.variableCandidates(word), false
+		}
+	case "commands":
+		return c.commandCandidates(word), false
+	case "none":
+		return nil, false
+	}
+	c.kind = "files"
+	return c.fileCandidates(word), true
+}
+
+// variableCandidates completes word to the names of the shell's
+// variables and the environment's, after the $ or ${ it starts with, if
+// it does, closing the brace of ${NAME}. $NAME is followed by a / when
+// the variable names a directory. Each is described by its value.
+func (c *completer) variableCandidates(word string) []string {
+	prefix, suffix := "", ""
+	switch {
+	case strings.HasPrefix(word, "${"):
+		prefix, suffix = "${", "}"
+	case strings.HasPrefix(word, "$"):
+		prefix = "$"
+	}
+	c.described = make(map[string]string)
+	var candidates []string
+	for _, name := range c.shell.varNames(true) {
+		if _, ok := c.shell.matchCompletion(word[len(prefix):], name); !ok {
+			continue
+		}
+		value, _ := c.shell.lookupVar(name)
+		candidate := prefix + name + suffix + " "
+		if prefix != "" && value != "" && isDir(value) {
+			candidate = prefix + name + suffix + "/"
+		}
+		candidates = append(candidates, candidate)
+		c.described[strings.TrimSuffix(candidate, " ")] = value
+	}
+	return candidates
+}
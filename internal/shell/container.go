@@ -0,0 +1,43 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+
+	"shell/internal/executor"
+)
+
+// applyContainer handles in-container IMAGE COMMAND [ARG...], which runs
+// an external command, in the foreground or as a job, in a container of
+// IMAGE with the working directory mounted.
+func (s *Shell) applyContainer(st *stage) error {
+	if len(st.args) < 3 {
+		return fmt.Errorf("in-container: usage: in-container IMAGE COMMAND [ARG...]")
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("in-container: %w", err)
+	}
+	name := st.args[2]
+	if s.isCommandBuiltin(name) && !isWrapper(name) {
+		return fmt.Errorf("in-container: %s: only external commands can run in a container", name)
+	}
+
+	st.executor = executor.Docker{Image: st.args[1], Mount: dir}
+	st.args = st.args[2:]
+	st.builtin = isWrapper(name)
+	return nil
+}
+
+// projectContainer returns an executor for the container the nearest
+// project config with a container setting names, or nil if there is
+// none. Like their aliases, a project's container is only used once the
+// user has allowed its file.
+func (s *Shell) projectContainer() executor.Executor {
+	for _, p := range s.projects() {
+		if p.Container != "" {
+			return executor.Docker{Image: p.Container, Mount: p.Dir}
+		}
+	}
+	return nil
+}
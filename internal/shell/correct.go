@@ -0,0 +1,121 @@
+package shell
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Spelling correction, as with zsh's correct option: a command or cd
+// target that does not exist is checked against the names that do, and
+// the user is asked whether to use the closest one instead.
+
+// correctCommand offers a correction for a command name that is not a
+// builtin, alias or executable on PATH.
+func (s *Shell) correctCommand(args []string) ([]string, error) {
+	name := args[0]
+	if strings.ContainsRune(name, '/') {
+		return args, nil
+	}
+	names := make([]string, 0, len(s.aliases))
+	for _, candidate := range s.completer.commandCandidates("") {
+		names = append(names, strings.TrimSuffix(candidate, " "))
+	}
+	for alias := range s.aliases {
+		names = append(names, alias)
+	}
+	fix, err := s.correct(name, names)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{fix}, args[1:]...), nil
+}
+
+// correctDir offers a correction for the last element of a directory
+// that does not exist, among the directories next to it.
+func (s *Shell) correctDir(dir string) (string, error) {
+	parent, base := filepath.Split(dir)
+	entries, err := os.ReadDir(cmp.Or(parent, "."))
+	if err != nil || base == "" {
+		return dir, nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	fix, err := s.correct(base, names)
+	return parent + fix, err
+}
+
+// correct asks whether to use the name closest to word instead, and
+// returns the one to use. Declining with a aborts the command line, and
+// e also puts it back at the prompt, corrected, for editing.
+func (s *Shell) correct(word string, names []string) (string, error) {
+	fix, ok := closest(word, names)
+	if !ok {
+		return word, nil
+	}
+	answer, err := s.readLine(fmt.Sprintf("correct '%s' to '%s' [nyae]? ", word, fix), false)
+	if err != nil {
+		return "", ExitStatus(1)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return fix, nil
+	case "a":
+		return "", ExitStatus(1)
+	case "e":
+		s.nextLine = strings.Replace(s.line, word, fix, 1)
+		return "", ExitStatus(1)
+	}
+	return word, nil
+}
+
+// closest returns the name nearest to word, if one is close enough to be
+// a likely typo: one edit away for short words, two for longer ones.
+func closest(word string, names []string) (string, bool) {
+	best, bestDist := "", 2
+	if len([]rune(word)) > 4 {
+		bestDist = 3
+	}
+	for _, name := range names {
+		if name == word {
+			return "", false
+		}
+		if d := editDistance(word, name); d < bestDist || d == bestDist && best != "" && name < best {
+			best, bestDist = name, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance is the number of insertions, deletions, substitutions and
+// swaps of adjacent characters that turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
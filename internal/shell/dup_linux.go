@@ -0,0 +1,9 @@
+package shell
+
+import "golang.org/x/sys/unix"
+
+// dup2 makes newfd a copy of oldfd. Not every Linux architecture has
+// dup2 itself.
+func dup2(oldfd, newfd int) error {
+	return unix.Dup3(oldfd, newfd, 0)
+}
@@ -0,0 +1,43 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// reportDurations hooks into preexec and precmd to report how long each
+// command line entered at the prompt took, when that is longer than the
+// config's report_time.
+func (s *Shell) reportDurations() {
+	var start time.Time
+	s.OnPreexec(func(string) {
+		start = time.Now()
+	})
+	s.OnPrecmd(func() {
+		s.lastDuration = 0
+		if start.IsZero() {
+			return
+		}
+		elapsed := time.Since(start)
+		start = time.Time{}
+		threshold := s.config.ReportDuration()
+		if threshold == 0 || elapsed < threshold {
+			return
+		}
+		s.lastDuration = elapsed
+		if !strings.Contains(s.config.Prompt, "{duration}") {
+			fmt.Fprintf(os.Stderr, "took %s, exit status %d\n", formatDuration(elapsed), s.lastStatus)
+		}
+	})
+}
+
+// formatDuration shows d to a tenth of a second under a minute, and to
+// the second above.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
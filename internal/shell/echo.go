@@ -0,0 +1,304 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kballard/go-shellquote"
+)
+
+func (s *Shell) echo(args []string) error {
+	newline, escapes := true, false
+	for len(args) > 0 && isEchoFlag(args[0]) {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+		args = args[1:]
+	}
+
+	out := strings.Join(args, " ")
+	if escapes {
+		var stop bool
+		out, stop = expandEscapes(out)
+		if stop {
+			newline = false
+		}
+	}
+	if newline {
+		out += "\n"
+	}
+	_, err := fmt.Fprint(os.Stdout, out)
+	return err
+}
+
+func isEchoFlag(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	return strings.Trim(arg[1:], "neE") == ""
+}
+
+// expandEscapes interprets backslash escapes the way echo -e and printf's
+// %b do. The second result is true when a \c asked for output to stop.
+func expandEscapes(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'c':
+			return b.String(), true
+		case 'e', 'E':
+			b.WriteByte(0x1b)
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\':
+			b.WriteByte('\\')
+		case '0':
+			n, width := parseDigits(s[i+1:], 8, 3)
+			b.WriteByte(byte(n))
+			i += width
+		case 'x':
+			n, width := parseDigits(s[i+1:], 16, 2)
+			if width == 0 {
+				b.WriteString("\\x")
+				continue
+			}
+			b.WriteByte(byte(n))
+			i += width
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), false
+}
+
+func parseDigits(s string, base, max int) (int, int) {
+	width := 0
+	for width < max && width < len(s) {
+		if _, err := strconv.ParseUint(s[width:width+1], base, 8); err != nil {
+			break
+		}
+		width++
+	}
+	if width == 0 {
+		return 0, 0
+	}
+	n, _ := strconv.ParseUint(s[:width], base, 16)
+	return int(n), width
+}
+
+// escapeLen returns the length of the backslash escape at the start of s.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '0':
+		_, width := parseDigits(s[2:], 8, 3)
+		return 2 + width
+	case 'x':
+		_, width := parseDigits(s[2:], 16, 2)
+		return 2 + width
+	}
+	return 2
+}
+
+func (s *Shell) printf(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("printf: usage: printf format [arguments]")
+	}
+	format, args := args[0], args[1:]
+
+	var b strings.Builder
+	for {
+		consumed, stop, err := formatOnce(&b, format, args)
+		if err != nil {
+			return fmt.Errorf("printf: %w", err)
+		}
+		args = args[consumed:]
+		// The format is reused until all arguments are consumed.
+		if stop || consumed == 0 || len(args) == 0 {
+			break
+		}
+	}
+	_, err := fmt.Fprint(os.Stdout, b.String())
+	return err
+}
+
+func formatOnce(b *strings.Builder, format string, args []string) (int, bool, error) {
+	used := 0
+	next := func() (string, bool) {
+		if used < len(args) {
+			used++
+			return args[used-1], true
+		}
+		return "", false
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c == '\\' && i+1 < len(format) && isOctal(format[i+1]) {
+			// Unlike in echo -e and %b, an octal escape in the format
+			// needs no leading 0: \101 is A.
+			n, width := parseDigits(format[i+1:], 8, 3)
+			b.WriteByte(byte(n))
+			i += width
+			continue
+		}
+		if c == '\\' {
+			n := escapeLen(format[i:])
+			out, stop := expandEscapes(format[i : i+n])
+			b.WriteString(out)
+			if stop {
+				return used, true, nil
+			}
+			i += n - 1
+			continue
+		}
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+ #0123456789.*", format[j]) >= 0 {
+			j++
+		}
+		if j == len(format) {
+			return used, false, fmt.Errorf("%s: missing format character", format[i:])
+		}
+		spec, err := starSpec(format[i+1:j], next)
+		if err != nil {
+			return used, false, err
+		}
+		verb := format[j]
+		i = j
+
+		switch verb {
+		case '%':
+			b.WriteByte('%')
+		case 's':
+			arg, _ := next()
+			fmt.Fprintf(b, "%"+spec+"s", arg)
+		case 'b':
+			arg, _ := next()
+			out, stop := expandEscapes(arg)
+			fmt.Fprintf(b, "%"+spec+"s", out)
+			if stop {
+				return used, true, nil
+			}
+		case 'q':
+			arg, _ := next()
+			fmt.Fprintf(b, "%"+spec+"s", shellquote.Join(arg))
+		case 'c':
+			arg, _ := next()
+			_, size := utf8.DecodeRuneInString(arg)
+			fmt.Fprintf(b, "%"+spec+"s", arg[:size])
+		case 'd', 'i', 'u', 'o', 'x', 'X':
+			arg, _ := next()
+			n, err := parseNumber(arg)
+			if err != nil {
+				return used, false, err
+			}
+			if verb == 'i' || verb == 'u' {
+				verb = 'd'
+			}
+			fmt.Fprintf(b, "%"+spec+string(verb), n)
+		case 'f', 'F', 'e', 'E', 'g', 'G':
+			arg, _ := next()
+			f := 0.0
+			if arg != "" {
+				var err error
+				if f, err = strconv.ParseFloat(arg, 64); err != nil {
+					return used, false, fmt.Errorf("%s: invalid number", arg)
+				}
+			}
+			if verb == 'F' {
+				verb = 'f'
+			}
+			fmt.Fprintf(b, "%"+spec+string(verb), f)
+		default:
+			return used, false, fmt.Errorf("%%%c: invalid directive", verb)
+		}
+	}
+	return used, false, nil
+}
+
+// starSpec replaces each * in a directive's flags, width and precision
+// with the next argument, as in printf '%*d' 5 42. A negative width
+// left-justifies, and a negative precision is left out, as in C.
+func starSpec(spec string, next func() (string, bool)) (string, error) {
+	if !strings.Contains(spec, "*") {
+		return spec, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '*' {
+			b.WriteByte(spec[i])
+			continue
+		}
+		arg, _ := next()
+		n, err := parseNumber(arg)
+		if err != nil {
+			return "", err
+		}
+		if n < 0 && i > 0 && spec[i-1] == '.' {
+			s := b.String()
+			b.Reset()
+			b.WriteString(s[:len(s)-1])
+			continue
+		}
+		b.WriteString(strconv.FormatInt(n, 10))
+	}
+	return b.String(), nil
+}
+
+func isOctal(c byte) bool {
+	return '0' <= c && c <= '7'
+}
+
+// parseNumber accepts decimal, octal (leading 0), hex (0x) and the
+// 'c character form printf uses.
+func parseNumber(arg string) (int64, error) {
+	if arg == "" {
+		return 0, nil
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		if len(arg) < 2 {
+			return 0, nil
+		}
+		return int64([]rune(arg[1:])[0]), nil
+	}
+	n, err := strconv.ParseInt(arg, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid number", arg)
+	}
+	return n, nil
+}
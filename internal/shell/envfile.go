@@ -0,0 +1,251 @@
+package shell
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shell/internal/config"
+)
+
+// envFile is the env file that applies to the current directory, and
+// what loading it changed.
+type envFile struct {
+	path    string
+	modTime time.Time
+	loaded  bool
+	names   []string
+	// saved are the values the variables had before, restored when the
+	// file is unloaded.
+	saved []savedEnv
+	// declined holds the files the user chose not to load this session,
+	// with the hash of their contents then.
+	declined map[string]string
+}
+
+type savedEnv struct {
+	name, value string
+	set         bool
+}
+
+// updateEnvFile is a precmd hook: when the env file that applies to the
+// current directory changes, or is edited, it unloads the one loaded and
+// loads the new one, asking first if it is not yet allowed.
+func (s *Shell) updateEnvFile() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	path, _ := config.FindEnvFile(dir, s.config.DirEnv.Files)
+	if path == s.envFile.path {
+		if path == "" {
+			return
+		}
+		if info, err := os.Stat(path); err == nil && info.ModTime().Equal(s.envFile.modTime) {
+			return
+		}
+	}
+	s.unloadEnvFile()
+	if path != "" {
+		if err := s.loadEnvFile(path, true); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: envfile: %v\n", err)
+		}
+	}
+}
+
+// loadEnvFile exports the variables path sets, if it is allowed, or if
+// ask is set and the user allows it.
+func (s *Shell) loadEnvFile(path string, ask bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	s.envFile.path, s.envFile.modTime = path, info.ModTime()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	vars, err := config.ParseEnvFile(data, os.LookupEnv)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = v.Name
+	}
+
+	hash := hashFile(data)
+	if !s.allowed(path, hash) {
+		if !ask || s.envFile.declined[path] == hash {
+			return nil
+		}
+		if !s.confirm(fmt.Sprintf("envfile: load %s, setting %s [yN]? ", path, strings.Join(names, " "))) {
+			if s.envFile.declined == nil {
+				s.envFile.declined = make(map[string]string)
+			}
+			s.envFile.declined[path] = hash
+			fmt.Fprintf(os.Stderr, "envfile: %s not loaded; envfile allow loads it\n", path)
+			return nil
+		}
+		if err := s.setAllowed(path, hash); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range vars {
+		value, set := os.LookupEnv(v.Name)
+		s.envFile.saved = append(s.envFile.saved, savedEnv{v.Name, value, set})
+		os.Setenv(v.Name, v.Value)
+	}
+	s.envFile.names, s.envFile.loaded = names, true
+	fmt.Fprintf(os.Stderr, "envfile: loaded %s: %s\n", path, strings.Join(names, " "))
+	return nil
+}
+
+// confirm asks a yes or no question, such as whether to load a file that
+// is not allowed yet. Without a terminal to ask on, the answer is no.
+func (s *Shell) confirm(question string) bool {
+	if !s.reader.IsTerminal() {
+		return false
+	}
+	answer, err := s.readLine(question, false)
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// unloadEnvFile restores the variables the loaded env file set.
+func (s *Shell) unloadEnvFile() {
+	if s.envFile.loaded {
+		for i := len(s.envFile.saved) - 1; i >= 0; i-- {
+			saved := s.envFile.saved[i]
+			if saved.set {
+				os.Setenv(saved.name, saved.value)
+			} else {
+				os.Unsetenv(saved.name)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "envfile: unloaded %s\n", s.envFile.path)
+	}
+	s.envFile = envFile{declined: s.envFile.declined}
+}
+
+func hashFile(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// allowed reports whether the allow file lists path, an env or project
+// file, with these contents.
+func (s *Shell) allowed(path, hash string) bool {
+	data, err := os.ReadFile(s.config.DirEnv.AllowFile)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == hash+" "+path {
+			return true
+		}
+	}
+	return false
+}
+
+// setAllowed records in the allow file that path may be loaded with the
+// contents hash has, or with none if hash is empty.
+func (s *Shell) setAllowed(path, hash string) error {
+	file := s.config.DirEnv.AllowFile
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasSuffix(line, " "+path) {
+			lines = append(lines, line)
+		}
+	}
+	if hash != "" {
+		lines = append(lines, hash+" "+path)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
+
+// envFileCommand is the envfile builtin. Alone it shows the env file that
+// applies here; envfile allow [FILE] allows and loads it, envfile deny
+// [FILE] unloads it and takes the permission back, and envfile reload
+// loads it again.
+func (s *Shell) envFileCommand(args []string) error {
+	if len(args) == 0 {
+		switch {
+		case s.envFile.path == "":
+			fmt.Println("no env file applies here")
+		case s.envFile.loaded:
+			fmt.Printf("%s (loaded): %s\n", s.envFile.path, strings.Join(s.envFile.names, " "))
+		default:
+			fmt.Printf("%s (not allowed)\n", s.envFile.path)
+		}
+		return nil
+	}
+	if len(args) > 2 || args[0] == "reload" && len(args) > 1 {
+		return fmt.Errorf("envfile: too many arguments")
+	}
+
+	switch args[0] {
+	case "reload":
+		s.unloadEnvFile()
+		s.updateEnvFile()
+		return nil
+	case "allow", "deny":
+	default:
+		return fmt.Errorf("envfile: %s: unknown command, expected allow, deny or reload", args[0])
+	}
+	path := s.envFile.path
+	if len(args) == 2 {
+		var err error
+		if path, err = filepath.Abs(args[1]); err != nil {
+			return fmt.Errorf("envfile: %w", err)
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("envfile: no env file applies here")
+	}
+
+	if args[0] == "deny" {
+		if err := s.setAllowed(path, ""); err != nil {
+			return fmt.Errorf("envfile: %w", err)
+		}
+		if path == s.envFile.path {
+			s.unloadEnvFile()
+			s.envFile.path = path
+			if info, err := os.Stat(path); err == nil {
+				s.envFile.modTime = info.ModTime()
+			}
+		}
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("envfile: %w", err)
+	}
+	if err := s.setAllowed(path, hashFile(data)); err != nil {
+		return fmt.Errorf("envfile: %w", err)
+	}
+	if dir, err := os.Getwd(); err == nil {
+		if current, _ := config.FindEnvFile(dir, s.config.DirEnv.Files); current == path {
+			s.unloadEnvFile()
+			if err := s.loadEnvFile(path, false); err != nil {
+				return fmt.Errorf("envfile: %w", err)
+			}
+		}
+	}
+	return nil
+}
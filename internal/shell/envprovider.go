@@ -0,0 +1,55 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+
+	"shell/internal/plugin"
+)
+
+// providedEnv is what the environment providers set for dir, with the
+// values it replaced.
+type providedEnv struct {
+	dir   string
+	saved []savedEnv
+}
+
+// updateProvidedEnv is a precmd hook: when the current directory has
+// changed, it undoes what the environment providers set for the last
+// one and applies what they set for the new one.
+func (s *Shell) updateProvidedEnv() {
+	dir, err := os.Getwd()
+	if err != nil || dir == s.provided.dir {
+		return
+	}
+	for i := len(s.provided.saved) - 1; i >= 0; i-- {
+		saved := s.provided.saved[i]
+		if saved.set {
+			os.Setenv(saved.name, saved.value)
+		} else {
+			os.Unsetenv(saved.name)
+		}
+	}
+	s.provided = providedEnv{dir: dir}
+
+	for _, p := range s.plugins {
+		provider, ok := p.(plugin.EnvProvider)
+		if !ok {
+			continue
+		}
+		var env map[string]string
+		err := s.guard(p.Name(), "Environment", func() (err error) {
+			env, err = provider.Environment(dir)
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: plugin %s: %v\n", p.Name(), err)
+			continue
+		}
+		for _, name := range sortedKeys(env) {
+			value, set := os.LookupEnv(name)
+			s.provided.saved = append(s.provided.saved, savedEnv{name, value, set})
+			os.Setenv(name, env[name])
+		}
+	}
+}
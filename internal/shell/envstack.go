@@ -0,0 +1,147 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// environ returns the environment as a map.
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok && name != "" {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// pushenv saves the environment on a stack for popenv to restore, then
+// exports each NAME=value and unsets each -u NAME given, in order.
+func (s *Shell) pushenv(args []string) error {
+	type change struct {
+		name, value string
+		unset       bool
+	}
+	var changes []change
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-u" {
+			if i+1 == len(args) {
+				return fmt.Errorf("pushenv: -u: option requires an argument")
+			}
+			i++
+			changes = append(changes, change{name: args[i], unset: true})
+			continue
+		}
+		name, value, ok := strings.Cut(args[i], "=")
+		if !ok {
+			return fmt.Errorf("pushenv: %s: expected NAME=value or -u NAME", args[i])
+		}
+		changes = append(changes, change{name: name, value: value})
+	}
+	for _, c := range changes {
+		if !isVarName(c.name) {
+			return fmt.Errorf("pushenv: `%s': not a valid identifier", c.name)
+		}
+		if s.attrs[c.name]&attrReadonly != 0 {
+			return fmt.Errorf("pushenv: %s: readonly variable", c.name)
+		}
+	}
+
+	s.envStack = append(s.envStack, environ())
+	for _, c := range changes {
+		if c.unset {
+			os.Unsetenv(c.name)
+		} else {
+			os.Setenv(c.name, c.value)
+		}
+	}
+	return nil
+}
+
+// popenv restores the environment pushenv saved last, undoing whatever
+// changed it since.
+func (s *Shell) popenv(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("popenv: too many arguments")
+	}
+	if len(s.envStack) == 0 {
+		return fmt.Errorf("popenv: environment stack empty")
+	}
+	saved := s.envStack[len(s.envStack)-1]
+	s.envStack = s.envStack[:len(s.envStack)-1]
+	for name := range environ() {
+		if _, ok := saved[name]; !ok {
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range saved {
+		if current, ok := os.LookupEnv(name); !ok || current != value {
+			os.Setenv(name, value)
+		}
+	}
+	return nil
+}
+
+// envdiff shows how the environment differs from what pushenv saved
+// last, or from what the shell started with: + for variables added, -
+// for those removed and ~ for those changed.
+func (s *Shell) envdiff(args []string) error {
+	args, asJSON := jsonFlag(args)
+	if len(args) > 0 {
+		return fmt.Errorf("envdiff: too many arguments")
+	}
+	base := s.startEnv
+	if len(s.envStack) > 0 {
+		base = s.envStack[len(s.envStack)-1]
+	}
+	current := environ()
+
+	type change struct {
+		Name   string  `json:"name"`
+		Change string  `json:"change"`
+		Old    *string `json:"old,omitempty"`
+		New    *string `json:"new,omitempty"`
+	}
+	names := make(map[string]bool)
+	for name := range base {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+	changes := []change{}
+	for _, name := range sortedKeys(names) {
+		old, hadOld := base[name]
+		value, hasNew := current[name]
+		switch {
+		case !hadOld:
+			changes = append(changes, change{Name: name, Change: "added", New: &value})
+		case !hasNew:
+			changes = append(changes, change{Name: name, Change: "removed", Old: &old})
+		case old != value:
+			changes = append(changes, change{Name: name, Change: "changed", Old: &old, New: &value})
+		}
+	}
+
+	if asJSON {
+		if err := printJSON(changes); err != nil {
+			return fmt.Errorf("envdiff: %w", err)
+		}
+		return nil
+	}
+	for _, c := range changes {
+		switch c.Change {
+		case "added":
+			fmt.Printf("+%s=%s\n", c.Name, shellquote.Join(*c.New))
+		case "removed":
+			fmt.Printf("-%s\n", c.Name)
+		default:
+			fmt.Printf("~%s=%s (was %s)\n", c.Name, shellquote.Join(*c.New), shellquote.Join(*c.Old))
+		}
+	}
+	return nil
+}
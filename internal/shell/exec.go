@@ -0,0 +1,232 @@
+package shell
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"shell/internal/executor"
+)
+
+// SetExecutor makes the shell run external commands through e instead
+// of as local processes.
+func (s *Shell) SetExecutor(e executor.Executor) {
+	s.executor = e
+}
+
+func (s *Shell) runExternal(st *stage, background bool) error {
+	s.updateSize()
+	cmd := executor.Command{
+		Args:  translateCommand(st.args),
+		Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr,
+	}
+	if background {
+		// Background jobs only get the files they were redirected to.
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	}
+	if st.in != nil {
+		cmd.Stdin = st.in
+	}
+	if st.out != nil {
+		cmd.Stdout = st.out
+	}
+	if st.errOut != nil {
+		cmd.Stderr = st.errOut
+	}
+	if !background {
+		cmd.Stdout, cmd.Stderr = s.keepOutput(cmd.Args, cmd.Stdout, cmd.Stderr)
+	}
+	if len(st.env) > 0 {
+		cmd.Env = append(os.Environ(), st.env...)
+	}
+	cmd.ExtraFiles = s.extraFiles(st)
+	cmd.Limits = st.limits
+	cmd.Sandbox = st.sandbox
+	timeout := st.timeout
+	switch timeout {
+	case 0:
+		timeout = s.config.Timeout()
+	case noTimeout:
+		timeout = 0
+	}
+	e := cmp.Or(st.executor, s.executor)
+	if background {
+		return s.startJob(e, cmd, timeout)
+	}
+
+	ctx, cancel := withTimeout(timeout)
+	defer cancel()
+	res, err := e.Run(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	s.usage.add(res)
+	if ctx.Err() == context.DeadlineExceeded {
+		return timedOut(timeout)
+	}
+	if res.Signaled {
+		// The terminal shows ^C; there is nothing more to report.
+		return ExitStatus(res.ExitCode)
+	}
+	if res.ExitCode != 0 {
+		return commandFailed(res.ExitCode)
+	}
+	return nil
+}
+
+// withTimeout returns a context that is done after timeout, or never if
+// it is 0.
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// startJob runs cmd through e in the background and returns once it has
+// started, with its output kept for joblog. A job still running after
+// timeout is killed and marked "Timed out".
+func (s *Shell) startJob(e executor.Executor, cmd executor.Command, timeout time.Duration) error {
+	job := s.CreateJob(cmd.Args, true)
+	out := s.keepJobOutput(job, &cmd)
+	started := make(chan error, 1)
+	running := false
+	cmd.Detach = true
+	cmd.Started = func(pid int) {
+		job.PID = pid
+		running = true
+		started <- nil
+	}
+	go func() {
+		ctx, cancel := withTimeout(timeout)
+		defer cancel()
+		start := time.Now()
+		_, err := e.Run(ctx, cmd)
+		out.close()
+		if !running {
+			started <- err
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			job.setStatus("Timed out")
+		} else {
+			job.setStatus("Done")
+		}
+		if running {
+			s.notifyJob(job, time.Since(start))
+		}
+	}()
+
+	if err := <-started; err != nil {
+		delete(s.jobs, job.ID)
+		if out != nil {
+			delete(s.jobOutputs, job.ID)
+			os.Remove(out.path)
+		}
+		return err
+	}
+	fmt.Printf("[%d] %d\n", job.ID, job.PID)
+	return nil
+}
+
+// commandFailed is the error for an external command that exits with a
+// non-zero status.
+type commandFailed int
+
+func (c commandFailed) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+func (c commandFailed) ExitCode() int {
+	return int(c)
+}
+
+// timedOut is the error for a command killed because it ran longer than
+// its timeout. Its status is 124, as with coreutils' timeout.
+type timedOut time.Duration
+
+func (t timedOut) Error() string {
+	return fmt.Sprintf("timed out after %v", time.Duration(t))
+}
+
+func (t timedOut) ExitCode() int {
+	return 124
+}
+
+// exec runs a command in place of the shell, after saving the history.
+// Without a command, its redirections apply to the shell from then on, as
+// with exec 3<file or exec 2>errors.log.
+func (s *Shell) exec(st *stage) error {
+	args := st.args[1:]
+	if len(args) == 0 {
+		s.keepRedirects(st)
+		return nil
+	}
+
+	if _, local := s.executor.(executor.Local); !local {
+		// Other executors cannot replace the shell, so the command runs
+		// as the last one.
+		st.args, st.builtin = args, false
+		err := s.runExternal(st, false)
+		s.exitRequested = true
+		return err
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		// The error starts "exec:" already.
+		return err
+	}
+	files := []*os.File{cmp.Or(st.in, os.Stdin), cmp.Or(st.out, os.Stdout), cmp.Or(st.errOut, os.Stderr)}
+	files = append(files, s.extraFiles(st)...)
+
+	if err := s.history.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving history: %v\n", err)
+	}
+	s.closeProjectHistories()
+	err = replaceProcess(path, args, append(os.Environ(), st.env...), files)
+	// The history is closed, so the shell cannot carry on.
+	report(fmt.Errorf("exec: %s: %w", args[0], err))
+	s.exitRequested = true
+	return ExitStatus(126)
+}
+
+// keepRedirects makes a stage's redirections the shell's own, closing
+// any files they replace.
+func (s *Shell) keepRedirects(st *stage) {
+	if s.fds == nil {
+		s.fds = make(map[int]*os.File)
+	}
+	keep := func(fd int, f *os.File) {
+		if old := s.fds[fd]; old != nil && old != f {
+			old.Close()
+		}
+		s.fds[fd] = f
+	}
+	if st.in != nil {
+		keep(0, st.in)
+		os.Stdin, s.stdinRedirected = st.in, true
+	}
+	if st.out != nil {
+		keep(1, st.out)
+		os.Stdout = st.out
+	}
+	if st.errOut != nil {
+		keep(2, st.errOut)
+		os.Stderr = st.errOut
+	}
+	for fd, f := range st.fds {
+		if f == nil {
+			// Closed with exec N>&-.
+			if old := s.fds[fd]; old != nil {
+				old.Close()
+			}
+			delete(s.fds, fd)
+			continue
+		}
+		keep(fd, f)
+	}
+	// The files stay open now they are the shell's.
+	st.files = nil
+}
@@ -0,0 +1,179 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shell/internal/config"
+	"shell/internal/executor"
+)
+
+// fakeExecutor records the commands the shell runs instead of running
+// them. "say ARGS" writes its arguments, "warn ARGS" writes them to
+// standard error and "to N ARGS" to descriptor N. "upper" copies its
+// input in upper case, and "status N" finishes with status N.
+type fakeExecutor struct {
+	mu       sync.Mutex
+	commands []executor.Command
+}
+
+func (e *fakeExecutor) Run(ctx context.Context, cmd executor.Command) (executor.Result, error) {
+	e.mu.Lock()
+	e.commands = append(e.commands, cmd)
+	e.mu.Unlock()
+	if cmd.Started != nil {
+		cmd.Started(0)
+	}
+
+	switch cmd.Args[0] {
+	case "say":
+		fmt.Fprintln(cmd.Stdout, strings.Join(cmd.Args[1:], " "))
+	case "warn":
+		fmt.Fprintln(cmd.Stderr, strings.Join(cmd.Args[1:], " "))
+	case "to":
+		var fd int
+		fmt.Sscan(cmd.Args[1], &fd)
+		if fd < 3 || fd-3 >= len(cmd.ExtraFiles) || cmd.ExtraFiles[fd-3] == nil {
+			return executor.Result{ExitCode: 1}, nil
+		}
+		fmt.Fprintln(cmd.ExtraFiles[fd-3], strings.Join(cmd.Args[2:], " "))
+	case "upper":
+		in := bufio.NewScanner(cmd.Stdin)
+		for in.Scan() {
+			fmt.Fprintln(cmd.Stdout, strings.ToUpper(in.Text()))
+		}
+	case "status":
+		var code int
+		fmt.Sscan(cmd.Args[1], &code)
+		return executor.Result{ExitCode: code}, nil
+	default:
+		return executor.Result{}, fmt.Errorf("%s: not found", cmd.Args[0])
+	}
+	return executor.Result{}, nil
+}
+
+// command returns the command recorded with the name given.
+func (e *fakeExecutor) command(t *testing.T, name string) executor.Command {
+	t.Helper()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, cmd := range e.commands {
+		if cmd.Args[0] == name {
+			return cmd
+		}
+	}
+	t.Fatalf("%s was not run; ran %v", name, e.commands)
+	return executor.Command{}
+}
+
+// newTestShell starts a shell with the default config in a home directory
+// of its own, running external commands through e.
+func newTestShell(t *testing.T, e executor.Executor) *Shell {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	cfg, err := config.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetExecutor(e)
+	return s
+}
+
+func TestExecutorPipeline(t *testing.T) {
+	e := &fakeExecutor{}
+	s := newTestShell(t, e)
+	out := filepath.Join(t.TempDir(), "out")
+
+	if err := s.Execute("GREETING=hi say hello 'big world' | upper > " + out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "HELLO BIG WORLD\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	say := e.command(t, "say")
+	if want := []string{"say", "hello", "big world"}; !slices.Equal(say.Args, want) {
+		t.Errorf("say args = %q, want %q", say.Args, want)
+	}
+	if !slices.Contains(say.Env, "GREETING=hi") {
+		t.Errorf("say env does not set GREETING=hi: %q", say.Env)
+	}
+	if upper := e.command(t, "upper"); upper.Env != nil {
+		t.Errorf("upper env = %q, want the shell's", upper.Env)
+	}
+}
+
+func TestExecutorExitStatus(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+		// ran is how many commands reach the executor.
+		ran int
+	}{
+		{"status 0", 0, 1},
+		{"status 3", 3, 1},
+		{"status 3 | status 0", 0, 2},
+		{"status 0 | status 4", 4, 2},
+		{"! status 3", 0, 1},
+		{"status 2 || status 5", 5, 2},
+		{"status 2 && status 5", 2, 1},
+	}
+	for _, tt := range tests {
+		e := &fakeExecutor{}
+		s := newTestShell(t, e)
+		if got := exitCode(s.Execute(tt.line)); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.line, got, tt.want)
+		}
+		if len(e.commands) != tt.ran {
+			t.Errorf("%s: ran %d commands, want %d", tt.line, len(e.commands), tt.ran)
+		}
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	s := newTestShell(t, &fakeExecutor{})
+	if err := s.Execute("status 0 &"); err != nil {
+		t.Fatal(err)
+	}
+	jobs := s.ListJobs()
+	if len(jobs) != 1 {
+		t.Fatalf("%d jobs, want 1", len(jobs))
+	}
+	// The job's goroutine marks it done while the shell reads its status,
+	// which the race detector checks.
+	deadline := time.Now().Add(5 * time.Second)
+	for jobs[0].Status() != "Done" {
+		if time.Now().After(deadline) {
+			t.Fatalf("job status is %q, want Done", jobs[0].Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSandboxOnlyLocal(t *testing.T) {
+	e := &fakeExecutor{}
+	s := newTestShell(t, e)
+	err := s.Execute("sandbox in-container alpine say hi")
+	if err == nil || !strings.Contains(err.Error(), "only local commands") {
+		t.Errorf("sandbox in-container: error %v, want one saying only local commands can be sandboxed", err)
+	}
+	if len(e.commands) != 0 {
+		t.Errorf("ran %v, want nothing", e.commands)
+	}
+}
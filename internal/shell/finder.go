@@ -0,0 +1,163 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// maxFinderFiles bounds how many files are offered to the finder, so
+// that Ctrl+T in a huge tree does not walk all of it.
+const maxFinderFiles = 100000
+
+// finder returns the command line of the fuzzy finder, such as fzf, that
+// the config's fuzzy_finder names, or nil when there is none to run: the
+// config names none, it is not installed, or the line editor is
+// readline, which would read the keys meant for it.
+func (s *Shell) finder() []string {
+	if s.config.FuzzyFinder == "" || s.config.FuzzyFinder == "none" || s.config.LineEditor == "readline" {
+		return nil
+	}
+	args, err := shellquote.Split(s.config.FuzzyFinder)
+	if err != nil || len(args) == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil
+	}
+	return args
+}
+
+// runFinder runs the finder with the extra arguments, writes the
+// candidates feed sends to it, NUL-terminated, and returns those picked.
+// It returns none when nothing was, or the finder was cancelled.
+func runFinder(finder []string, feed func(send func(candidate string) bool), extra ...string) ([]string, error) {
+	cmd := exec.Command(finder[0], slices.Concat(finder[1:], []string{"--read0", "--print0"}, extra)...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	var out strings.Builder
+	cmd.Stdout = &out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		w := bufio.NewWriter(in)
+		feed(func(candidate string) bool {
+			_, err := w.WriteString(candidate + "\x00")
+			return err == nil
+		})
+		w.Flush()
+		in.Close()
+	}()
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		// fzf exits with 1 when nothing matched and 130 when cancelled.
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return strings.FieldsFunc(out.String(), func(r rune) bool { return r == 0 }), nil
+}
+
+// findHistory picks a command from the history with the finder, the
+// line so far as the query, and puts it on the line. It reports whether
+// there was a finder to run.
+func (s *Shell) findHistory() bool {
+	finder := s.finder()
+	if finder == nil {
+		return false
+	}
+	commands := s.history.GetAll()
+	feed := func(send func(string) bool) {
+		seen := make(map[string]bool)
+		for i := len(commands) - 1; i >= 0; i-- {
+			if command := commands[i]; !seen[command] {
+				seen[command] = true
+				if !send(command) {
+					return
+				}
+			}
+		}
+	}
+	picked, err := runFinder(finder, feed, "--no-multi", "--query", string(s.editLine))
+	s.reader.Refresh()
+	if err != nil {
+		s.reader.Write([]byte(fmt.Sprintf("Error: %s: %v\n", finder[0], err)))
+	} else if len(picked) > 0 {
+		s.reader.SetBuffer(picked[0])
+	}
+	return true
+}
+
+// findFiles picks files below the current directory, or below the
+// directory the word before the cursor names, and inserts them at the
+// cursor. Without a finder, the completion menu offers the files the
+// word completes to instead.
+func (s *Shell) findFiles() {
+	finder := s.finder()
+	if finder == nil {
+		word, _ := completing(s.editLine, s.editPos)
+		s.showMenu(word, s.completer.fileCandidates(word))
+		return
+	}
+
+	word, _ := completing(s.editLine, s.editPos)
+	root := "."
+	if word != "" && isDir(expandTilde(word)) {
+		root = word
+	}
+	feed := func(send func(string) bool) {
+		count := 0
+		filepath.WalkDir(expandTilde(root), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || path == expandTilde(root) {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if root != "." {
+				path = filepath.Join(root, strings.TrimPrefix(path, expandTilde(root)))
+			}
+			if count++; count > maxFinderFiles || !send(path) {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+	}
+	picked, err := runFinder(finder, feed, "--multi")
+	s.reader.Refresh()
+	if err != nil {
+		s.reader.Write([]byte(fmt.Sprintf("Error: %s: %v\n", finder[0], err)))
+		return
+	}
+	if len(picked) == 0 {
+		return
+	}
+
+	head := string(s.editLine[:s.editPos])
+	if root != "." {
+		// The directory picked from is replaced by the files in it.
+		head = strings.TrimSuffix(head, word)
+	} else if head != "" && !strings.HasSuffix(head, " ") {
+		head += " "
+	}
+	for i, path := range picked {
+		picked[i] = shellquote.Join(path)
+	}
+	s.reader.SetBuffer(head + strings.Join(picked, " ") + " " + string(s.editLine[s.editPos:]))
+}
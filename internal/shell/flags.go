@@ -0,0 +1,156 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandFlag is an option of an external command. Name ends with = for
+// an option that takes its value that way.
+type commandFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// flagCache keeps the options read for each command, by executable
+// path, with the modification time of the executable they were read
+// from, in the config's completion.flag_cache.
+type flagCache struct {
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]flagEntry
+}
+
+type flagEntry struct {
+	ModTime time.Time     `json:"mod_time"`
+	Flags   []commandFlag `json:"flags"`
+}
+
+// helpTimeout bounds how long a command may take to print its help.
+const helpTimeout = 2 * time.Second
+
+// flagCandidates returns the options of command that start with word,
+// reading them the first time.
+func (s *Shell) flagCandidates(command, word string) []string {
+	var candidates []string
+	for _, flag := range s.commandFlags(command) {
+		if _, ok := s.matchCompletion(word, flag.Name); !ok {
+			continue
+		}
+		if strings.HasSuffix(flag.Name, "=") {
+			candidates = append(candidates, flag.Name)
+		} else {
+			candidates = append(candidates, flag.Name+" ")
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// commandFlags returns the options of command, from the cache if they
+// were read from the same executable, and otherwise read afresh.
+func (s *Shell) commandFlags(command string) []commandFlag {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	cache := &s.flags
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !cache.loaded {
+		cache.loaded = true
+		cache.entries = make(map[string]flagEntry)
+		if data, err := os.ReadFile(s.config.Completion.FlagCache); err == nil {
+			json.Unmarshal(data, &cache.entries)
+		}
+	}
+	if entry, ok := cache.entries[path]; ok && entry.ModTime.Equal(info.ModTime()) {
+		return entry.Flags
+	}
+
+	flags := parseFlags(helpOutput(path, "--help"))
+	if len(flags) == 0 {
+		flags = parseFlags(helpOutput("man", filepath.Base(path)))
+	}
+	cache.entries[path] = flagEntry{ModTime: info.ModTime(), Flags: flags}
+	if data, err := json.Marshal(cache.entries); err == nil {
+		os.MkdirAll(filepath.Dir(s.config.Completion.FlagCache), 0700)
+		os.WriteFile(s.config.Completion.FlagCache, data, 0600)
+	}
+	return flags
+}
+
+// helpOutput runs a command for its help and returns what it printed,
+// with pagers and colours turned off.
+func helpOutput(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), helpTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "PAGER=cat", "MANPAGER=cat", "MANWIDTH=100", "COLUMNS=100", "NO_COLOR=1")
+	cmd.WaitDelay = helpTimeout
+	out, _ := cmd.CombinedOutput()
+	return string(out)
+}
+
+var (
+	// overstrike is how man pages printed for a terminal make text bold
+	// or underlined.
+	overstrike = regexp.MustCompile(".\b")
+	// optionLine is a line describing options, as "-a, --all  do not
+	// ignore entries starting with .", and optionName one of them.
+	optionLine = regexp.MustCompile(`^(\s*)(-\S.*)$`)
+	optionName = regexp.MustCompile(`^--?[A-Za-z0-9?][A-Za-z0-9_-]*(\[?=)?`)
+	columnGap  = regexp.MustCompile(`\s{2,}|\t`)
+)
+
+// parseFlags picks out the options described in help output or a man
+// page, with the description that follows them on their line or on the
+// next, more indented one.
+func parseFlags(text string) []commandFlag {
+	lines := strings.Split(overstrike.ReplaceAllString(text, ""), "\n")
+	seen := make(map[string]bool)
+	var flags []commandFlag
+	for i, line := range lines {
+		m := optionLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		spec, description := m[2], ""
+		if loc := columnGap.FindStringIndex(spec); loc != nil {
+			spec, description = spec[:loc[0]], strings.TrimSpace(spec[loc[1]:])
+		} else if i+1 < len(lines) {
+			next := lines[i+1]
+			if indent := len(next) - len(strings.TrimLeft(next, " \t")); indent > len(m[1]) && !strings.HasPrefix(strings.TrimSpace(next), "-") {
+				description = strings.TrimSpace(next)
+			}
+		}
+		for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' || r == '|' }) {
+			name := optionName.FindString(part)
+			if name == "" || name == "-" || name == "--" {
+				continue
+			}
+			name = strings.TrimSuffix(name, "[=")
+			if !seen[name] {
+				seen[name] = true
+				flags = append(flags, commandFlag{name, description})
+			}
+		}
+	}
+	return flags
+}
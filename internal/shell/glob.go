@@ -0,0 +1,230 @@
+package shell
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Pathname expansion. Patterns are matched a path segment at a time with
+// filepath.Match, except that a segment of just ** matches any number of
+// directories, as in bash with globstar set. Hidden files only match a
+// segment that starts with a dot, and ** does not descend into them or
+// follow symlinks to directories, so it cannot loop.
+
+// globQuote escapes the pattern characters in text, for text that was
+// quoted and so matches only itself.
+func globQuote(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '*' || r == '?' || r == '[':
+			b.WriteString("[" + string(r) + "]")
+		case r == '\\' && runtime.GOOS != "windows":
+			b.WriteString(`\\`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isPattern reports whether pattern has pattern characters and is one
+// filepath.Match accepts. A lone [, as in the test command, is not.
+func isPattern(pattern string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return false
+	}
+	_, err := filepath.Match(pattern, "")
+	return err == nil
+}
+
+// globber matches one pattern against the file system.
+type globber struct {
+	maxDepth   int
+	maxEntries int
+	// entries counts the directory entries read, for maxEntries.
+	entries int
+	matches []string
+	seen    map[string]bool
+}
+
+var errGlobLimit = errors.New("too many directory entries")
+
+// glob returns the paths pattern matches, ordered as glob.sort says.
+func (s *Shell) glob(pattern string) ([]string, error) {
+	cfg := s.config.Glob
+	g := &globber{maxDepth: cfg.MaxDepth, maxEntries: cfg.MaxEntries, seen: make(map[string]bool)}
+
+	pattern = filepath.ToSlash(pattern)
+	prefix := ""
+	if strings.HasPrefix(pattern, "/") {
+		prefix = "/"
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+	if err := g.walk(prefix, strings.Split(pattern, "/"), 0); err != nil {
+		if err == errGlobLimit {
+			return nil, fmt.Errorf("gave up after reading %d directory entries; raise glob.max_entries to search further", g.maxEntries)
+		}
+		return nil, err
+	}
+
+	switch cfg.Sort {
+	case "mtime":
+		// Most recently modified first, as ls -t lists them.
+		times := make(map[string]int64, len(g.matches))
+		for _, match := range g.matches {
+			if info, err := os.Lstat(match); err == nil {
+				times[match] = info.ModTime().UnixNano()
+			}
+		}
+		slices.SortStableFunc(g.matches, func(a, b string) int {
+			if times[a] != times[b] {
+				if times[a] > times[b] {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a, b)
+		})
+	default:
+		slices.Sort(g.matches)
+	}
+	return g.matches, nil
+}
+
+// walk matches the pattern segments segs below the directory prefix, at
+// depth directories below where ** started.
+func (g *globber) walk(prefix string, segs []string, depth int) error {
+	if len(segs) == 0 {
+		g.match(prefix)
+		return nil
+	}
+	seg, rest := segs[0], segs[1:]
+
+	switch {
+	case seg == "**" && len(rest) == 0:
+		// A trailing ** matches everything below.
+		return g.walkAll(prefix, depth)
+	case seg == "**":
+		if err := g.walk(prefix, rest, depth); err != nil {
+			return err
+		}
+		if g.maxDepth > 0 && depth >= g.maxDepth {
+			return nil
+		}
+		entries, err := g.readDir(prefix)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				if err := g.walk(globJoin(prefix, entry.Name()), segs, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case seg == "" && len(rest) == 0:
+		// A trailing slash matches only directories.
+		if info, err := os.Stat(cmp.Or(prefix, ".")); err == nil && info.IsDir() {
+			g.match(prefix + "/")
+		}
+		return nil
+	case !isPattern(seg):
+		if runtime.GOOS != "windows" {
+			seg = strings.ReplaceAll(seg, `\\`, `\`)
+		}
+		path := globJoin(prefix, seg)
+		if len(rest) == 0 {
+			if _, err := os.Lstat(path); err == nil {
+				g.match(path)
+			}
+			return nil
+		}
+		return g.walk(path, rest, depth)
+	}
+
+	entries, err := g.readDir(prefix)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(seg, ".") {
+			continue
+		}
+		if ok, _ := filepath.Match(seg, name); !ok {
+			continue
+		}
+		path := globJoin(prefix, name)
+		if len(rest) == 0 {
+			g.match(path)
+		} else if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if err := g.walk(path, rest, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkAll matches everything below prefix that is not hidden.
+func (g *globber) walkAll(prefix string, depth int) error {
+	entries, err := g.readDir(prefix)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := globJoin(prefix, entry.Name())
+		g.match(path)
+		if entry.IsDir() && (g.maxDepth == 0 || depth < g.maxDepth) {
+			if err := g.walkAll(path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *globber) match(path string) {
+	if path != "" && !g.seen[path] {
+		g.seen[path] = true
+		g.matches = append(g.matches, path)
+	}
+}
+
+// readDir reads a directory for matching, counting its entries against
+// maxEntries. Directories that cannot be read have nothing in them that
+// matches.
+func (g *globber) readDir(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(cmp.Or(dir, "."))
+	if err != nil {
+		return nil, nil
+	}
+	g.entries += len(entries)
+	if g.maxEntries > 0 && g.entries > g.maxEntries {
+		return nil, errGlobLimit
+	}
+	return entries, nil
+}
+
+// join adds name to the path prefix, which is empty for the current
+// directory.
+func globJoin(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return prefix + name
+	}
+	return prefix + "/" + name
+}
@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"shell/internal/executor"
+)
+
+// globTree creates files, and the directories they are in, below a new
+// temporary directory, and makes it the working directory for the test.
+// A name ending in a slash is an empty directory.
+func globTree(t *testing.T, files ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if strings.HasSuffix(file, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestGlob(t *testing.T) {
+	s := newTestShell(t, executor.Local{})
+	globTree(t, "a.go", "b.go", "c.txt", ".hidden.go", "dir/x.go", "dir/deep/y.go",
+		"dir/.git/z.go", "other/", "d1r/a.c", "d1r/b.c", "d1r/c.c")
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"echo *.go", []string{"echo", "a.go", "b.go"}},
+		{"echo .*.go", []string{"echo", ".hidden.go"}},
+		{"echo *.md", []string{"echo", "*.md"}},
+		{"echo '*.go' \\*.go", []string{"echo", "*.go", "*.go"}},
+		{"echo \"d\"*/*.c", []string{"echo", "d1r/a.c", "d1r/b.c", "d1r/c.c"}},
+		{"echo d?r/[ab].c", []string{"echo", "d1r/a.c", "d1r/b.c"}},
+		{"echo */", []string{"echo", "d1r/", "dir/", "other/"}},
+		{"echo **/*.go", []string{"echo", "a.go", "b.go", "dir/deep/y.go", "dir/x.go"}},
+		{"echo dir/**", []string{"echo", "dir/deep", "dir/deep/y.go", "dir/x.go"}},
+		{"echo [ x", []string{"echo", "[", "x"}},
+	}
+	for _, tt := range tests {
+		got, err := s.Expand(tt.input)
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expands to %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGlobLimits(t *testing.T) {
+	s := newTestShell(t, executor.Local{})
+	globTree(t, "a/b/c/d.go", "a/e.go", "f.go")
+
+	s.config.Glob.MaxDepth = 1
+	got, err := s.glob("**/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/e.go", "f.go"}; !slices.Equal(got, want) {
+		t.Errorf("with max_depth 1, **/*.go matches %q, want %q", got, want)
+	}
+
+	s.config.Glob.MaxDepth, s.config.Glob.MaxEntries = 0, 3
+	if _, err := s.glob("**/*.go"); err == nil {
+		t.Error("with max_entries 3, **/*.go did not fail")
+	}
+}
+
+func TestGlobSortByTime(t *testing.T) {
+	s := newTestShell(t, executor.Local{})
+	globTree(t, "old", "new", "mid")
+	now := time.Now()
+	for i, name := range []string{"old", "mid", "new"} {
+		stamp := now.Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(name, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.config.Glob.Sort = "mtime"
+	got, err := s.glob("*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"new", "mid", "old"}; !slices.Equal(got, want) {
+		t.Errorf("sorted by time, * matches %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,322 @@
+package shell
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"shell/internal/plugin"
+)
+
+// builtinHelp documents the builtins for the help builtin, by name.
+var builtinHelp = map[string]plugin.HelpEntry{
+	".": {Usage: ". FILE [ARG...]", Summary: "Run a file's commands in this shell, as source does."},
+	"[": {Usage: "[ EXPRESSION ]", Summary: "Evaluate a conditional expression, as test does."},
+	"add-hook": {
+		Usage:   "add-hook [-d] [EVENT COMMAND]",
+		Summary: "Run a command at each preexec or precmd event.",
+		Details: "preexec runs before each command line entered at the prompt, with the line in\n" +
+			"$HOOK_COMMAND, and precmd before each prompt. Without arguments, the hooks are\n" +
+			"listed.\n\n" +
+			"  -d  delete the hook instead",
+	},
+	"alias": {
+		Usage:   "alias [--json] [-s] [NAME[=VALUE]...]",
+		Summary: "Define or list aliases.",
+		Details: "alias NAME=VALUE defines one, alias NAME shows it and alias alone lists them.\n\n" +
+			"  -s      suffix aliases, which open files by extension: alias -s py=python3\n" +
+			"  --json  print the aliases as JSON, with the file defining each",
+	},
+	"bind": {
+		Usage:   "bind [-l | -p | -r KEY | KEY ACTION | KEY TEXT]",
+		Summary: "Bind a control key to an action, a line editor function or a macro.",
+		Details: "  -l  list the actions and functions keys can be bound to\n" +
+			"  -p  list the bindings, as the config's keybindings section would have them\n" +
+			"  -r  unbind KEY",
+	},
+	"bookmark": {
+		Usage:   "bookmark [list | add NAME [DIR] | remove NAME]",
+		Summary: "Save directories under names, for cd ~NAME and cd @NAME.",
+		Details: "add saves DIR, or the working directory, under NAME; remove forgets it; list, or\n" +
+			"bookmark alone, lists them.",
+	},
+	"capture": {
+		Usage:   "capture VAR COMMAND [ARG...]",
+		Summary: "Run a command and set VAR to its output instead of showing it.",
+		Details: "Trailing newlines are dropped, as command substitution does.",
+	},
+	"cd": {
+		Usage:   "cd [DIR | - | ~BOOKMARK | @BOOKMARK]",
+		Summary: "Change the working directory.",
+		Details: "Without DIR, cd goes to the home directory, and cd - to the previous one.\n" +
+			"Relative directories are also looked for in $CDPATH.",
+	},
+	"copy": {
+		Usage:   "copy [TEXT...]",
+		Summary: "Copy the arguments, or the input, to the system clipboard.",
+		Details: "As in cmd | copy. Without a clipboard command, the text is sent to the terminal\n" +
+			"with OSC 52.",
+	},
+	"declare": {
+		Usage:   "declare [-p] [--json] [-irx] [+ix] [NAME[=VALUE]...]",
+		Summary: "Give variables attributes and values, or print them.",
+		Details: "  -i      integer: values are evaluated as arithmetic\n" +
+			"  -r      readonly\n" +
+			"  -x      exported to commands\n" +
+			"  +i, +x  take the attribute away\n" +
+			"  -p      print the variables as declare commands\n" +
+			"  --json  print them as JSON",
+	},
+	"echo": {
+		Usage:   "echo [-neE] [ARG...]",
+		Summary: "Print the arguments, separated by spaces.",
+		Details: "  -n  do not print a newline at the end\n" +
+			"  -e  interpret backslash escapes such as \\n and \\t\n" +
+			"  -E  do not interpret them, the default",
+	},
+	"env": {
+		Usage:   "env [NAME=VALUE...] [COMMAND [ARG...]]",
+		Summary: "List the environment, sorted; with arguments, run the env program.",
+	},
+	"envdiff": {
+		Usage:   "envdiff [--json]",
+		Summary: "Show how the environment changed since pushenv, or since the shell started.",
+		Details: "+NAME=VALUE is a variable added, -NAME one removed and ~NAME=VALUE one changed.",
+	},
+	"envfile": {
+		Usage:   "envfile [allow [FILE] | deny [FILE] | reload]",
+		Summary: "Show or manage the env file of the working directory.",
+		Details: "  allow   allow the file and load it\n" +
+			"  deny    unload the file and take its permission back\n" +
+			"  reload  load the file again",
+	},
+	"eval": {Usage: "eval [ARG...]", Summary: "Run the arguments, joined with spaces, as a command line."},
+	"exec": {
+		Usage:   "exec [COMMAND [ARG...]] [REDIRECTION...]",
+		Summary: "Replace the shell with a command, or redirect the shell's own files.",
+		Details: "Without a command, the redirections apply to the shell from then on, as with\n" +
+			"exec 2>errors.log.",
+	},
+	"exit": {Usage: "exit [N]", Summary: "Exit the shell with status N, or that of the last command."},
+	"help": {
+		Usage:   "help [NAME...]",
+		Summary: "Describe the builtins.",
+		Details: "help alone lists the builtins, those of plugins too, and help NAME shows one's\n" +
+			"usage and options.",
+	},
+	"history": {
+		Usage:   "history [-c | -d N | -w [FILE] | -r [FILE] | --sessions | --session ID | --json | stats | search TEXT]",
+		Summary: "List or manage the command history.",
+		Details: "Set HISTTIMEFORMAT to show when each command ran.\n\n" +
+			"  -c                   clear the history\n" +
+			"  -d N                 delete entry N\n" +
+			"  -w, -r [FILE]        write the history to, or read it from, FILE\n" +
+			"  --sessions           list the sessions\n" +
+			"  --session ID         list the commands of a session, or 'current'\n" +
+			"  --json               print the entries as JSON\n" +
+			"  stats                show the commands used most\n" +
+			"  search TEXT          search the history",
+	},
+	"in-container": {
+		Usage:   "in-container IMAGE COMMAND [ARG...]",
+		Summary: "Run a command in a container of IMAGE, with the working directory mounted.",
+	},
+	"joblog": {
+		Usage:   "joblog [-p] [%N]",
+		Summary: "Print the output of a background job, the last one by default.",
+		Details: "  -p  print the path of the job's log file instead",
+	},
+	"jobs": {
+		Usage:   "jobs [-l] [--json]",
+		Summary: "List the background jobs.",
+		Details: "  -l      with their process IDs\n" +
+			"  --json  as JSON",
+	},
+	"kill": {
+		Usage:   "kill [-SIGNAL] PID|%JOB...",
+		Summary: "Send a signal to processes, or to background jobs given as %N, with the kill program.",
+		Details: "%% or %+ is the last job started.",
+	},
+	"limit": {
+		Usage:   "limit [--mem SIZE] [--cpu DURATION] [--nice N] COMMAND [ARG...]",
+		Summary: "Run a command with limits of its own on memory, CPU time and niceness.",
+	},
+	"local": {
+		Usage:   "local [NAME[=VALUE]...]",
+		Summary: "Declare variables local to the function call running, or list them.",
+	},
+	"output": {
+		Usage:   "output [-e] [N]",
+		Summary: "Print the output kept N command lines back, the last by default.",
+		Details: "  -e  what was written to standard error instead\n\n" +
+			"Output is only kept with capture_output.keep in the config.",
+	},
+	"paste": {
+		Usage:   "paste",
+		Summary: "Print what the system clipboard holds.",
+		Details: "With arguments, paste runs the paste program, which merges lines of files.",
+	},
+	"plugin": {
+		Usage:   "plugin list | load NAME|PATH | unload NAME",
+		Summary: "List, load and unload plugins.",
+	},
+	"popenv": {Usage: "popenv", Summary: "Restore the environment pushenv saved last."},
+	"printf": {
+		Usage:   "printf FORMAT [ARG...]",
+		Summary: "Print the arguments as FORMAT says, as printf(1) does.",
+	},
+	"profile": {
+		Usage:   "profile on|off|report|reset",
+		Summary: "Time startup, hooks, plugins and commands, and report where the time went.",
+	},
+	"project": {
+		Usage:   "project [allow [FILE] | deny [FILE]]",
+		Summary: "List the project files that apply here, or allow or deny one.",
+		Details: "  allow  let the shell use the file, the nearest one by default\n" +
+			"  deny   take that back",
+	},
+	"pushenv": {
+		Usage:   "pushenv [NAME=VALUE...] [-u NAME...]",
+		Summary: "Save the environment for popenv, then set and unset variables.",
+	},
+	"read": {
+		Usage:   "read [-rs] [-p PROMPT] [NAME...]",
+		Summary: "Read a line and split it into variables, REPLY by default.",
+		Details: "  -p PROMPT  show PROMPT first\n" +
+			"  -r         do not treat backslashes as escapes\n" +
+			"  -s         do not echo what is typed",
+	},
+	"record": {
+		Usage:   "record [start FILE | stop]",
+		Summary: "Record the session to FILE, in asciicast v2 format.",
+		Details: "record alone says whether a recording is running.",
+	},
+	"reload": {Usage: "reload", Summary: "Read the config file again and apply it."},
+	"remote": {
+		Usage:   "remote [connect HOST | disconnect]",
+		Summary: "Run external commands on another machine over SSH.",
+		Details: "remote alone says where commands run.",
+	},
+	"sandbox": {
+		Usage:   "sandbox [--network] [--writable PATH]... COMMAND [ARG...]",
+		Summary: "Run a command where it cannot change files or reach the network.",
+	},
+	"set": {
+		Usage:   "set [-ex] [+ex] [-o NAME] [+o NAME] [-- ARG...]",
+		Summary: "Set options, or the positional parameters.",
+		Details: "set -o lists the options, set +o prints commands that restore them, and set\n" +
+			"alone lists the variables.\n\n" +
+			"  -o NAME, +o NAME  turn an option on or off\n" +
+			"  -e                errexit: exit when a command fails\n" +
+			"  -x                xtrace: print commands as they run",
+	},
+	"shift":  {Usage: "shift [N]", Summary: "Drop the first N positional parameters, 1 by default."},
+	"source": {Usage: "source FILE [ARG...]", Summary: "Run a file's commands in this shell."},
+	"test": {
+		Usage:   "test EXPRESSION",
+		Summary: "Evaluate a conditional expression.",
+		Details: "Files: -b -c -d -e -f -g -h -k -L -p -r -s -S -u -w -x FILE,\n" +
+			"       FILE -nt FILE, FILE -ot FILE, FILE -ef FILE\n" +
+			"Strings: -z -n STRING, STRING = STRING, STRING != STRING\n" +
+			"Numbers: N -eq -ne -lt -le -gt -ge N\n" +
+			"Terminals: -t FD\n" +
+			"Combined with ! EXPR, EXPR -a EXPR, EXPR -o EXPR and ( EXPR ).",
+	},
+	"theme": {
+		Usage:   "theme [NAME | list | preview [NAME...]]",
+		Summary: "Show or switch the prompt theme.",
+		Details: "theme none goes back to the prompt format.",
+	},
+	"timeout": {
+		Usage:   "timeout DURATION COMMAND [ARG...]",
+		Summary: "Run a command and kill it if it runs for longer than DURATION.",
+		Details: "A DURATION of 0 lifts the configured command_timeout.",
+	},
+	"trap": {
+		Usage:   "trap [-p] [[ACTION] SIGNAL...]",
+		Summary: "Run ACTION when the shell receives a signal, or exits (EXIT).",
+		Details: "An empty ACTION ignores the signals and - restores their default handling. trap\n" +
+			"alone lists the traps.",
+	},
+	"typeset": {Usage: "typeset [-p] [-irx] [+ix] [NAME[=VALUE]...]", Summary: "The same as declare."},
+	"ulimit": {
+		Usage:   "ulimit [-SHa] [-RESOURCE [LIMIT]]",
+		Summary: "Show or set the shell's resource limits, which its commands inherit.",
+		Details: "  -S, -H  the soft or the hard limit; both are set when neither is given\n" +
+			"  -a      show them all\n\n" +
+			"The file size limit (-f) is meant when no resource is given.",
+	},
+	"umask": {
+		Usage:   "umask [-S] [MODE]",
+		Summary: "Show or set the permissions taken away from the files created.",
+		Details: "MODE is octal (022) or symbolic (u=rwx,g=rx,o=).\n\n" +
+			"  -S  show the mask symbolically",
+	},
+	"unalias": {Usage: "unalias [-s] NAME...", Summary: "Remove aliases, or with -s suffix aliases."},
+}
+
+// helpCommand is the help builtin: help lists the builtins with what
+// each does, and help NAME... shows their usage and options.
+func (s *Shell) helpCommand(args []string) error {
+	entries := s.helpEntries()
+	if len(args) == 0 {
+		names := sortedKeys(entries)
+		width := 0
+		for _, name := range names {
+			width = max(width, len(name))
+		}
+		for _, name := range names {
+			fmt.Printf("%-*s  %s\n", width, name, entries[name].Summary)
+		}
+		return nil
+	}
+	for i, name := range args {
+		entry, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("help: %s: no help for it", name)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s\n    %s\n", cmp.Or(entry.Usage, name), entry.Summary)
+		if entry.Details != "" {
+			fmt.Println()
+			for _, line := range strings.Split(entry.Details, "\n") {
+				fmt.Println(strings.TrimRight("    "+line, " "))
+			}
+		}
+	}
+	return nil
+}
+
+// helpEntries returns the help for the builtins and for those plugins
+// registered, which plugins implementing plugin.HelpProvider document.
+func (s *Shell) helpEntries() map[string]plugin.HelpEntry {
+	entries := make(map[string]plugin.HelpEntry, len(builtinHelp))
+	for name, entry := range builtinHelp {
+		entries[name] = entry
+	}
+	// Plugins are commands under their own names too.
+	for _, p := range s.plugins {
+		if _, builtin := builtinHelp[p.Name()]; !builtin {
+			entries[p.Name()] = plugin.HelpEntry{Summary: fmt.Sprintf("Run the %s plugin.", p.Name())}
+		}
+	}
+	for name, builtin := range s.pluginBuiltins {
+		entries[name] = plugin.HelpEntry{Summary: fmt.Sprintf("Added by the %s plugin.", builtin.owner)}
+	}
+	for _, p := range s.plugins {
+		provider, ok := p.(plugin.HelpProvider)
+		if !ok {
+			continue
+		}
+		var help map[string]plugin.HelpEntry
+		s.callPlugin(p, "Help", func() { help = provider.Help() })
+		for name, entry := range help {
+			if _, builtin := builtinHelp[name]; !builtin {
+				entries[name] = entry
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,102 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expandHistory replaces bash-style history references in line before it
+// is parsed:
+//
+//	!!        the previous command
+//	!n        command n, as numbered by the history builtin
+//	!-n       the command n entries back
+//	!prefix   the latest command starting with prefix
+//	!$        the last word of the previous command
+//
+// References inside single quotes or after a backslash are left alone, as
+// is a ! followed by a space, '=', '(', '"' or the end of the line. changed
+// reports whether anything was replaced.
+func (s *Shell) expandHistory(line string) (expanded string, changed bool, err error) {
+	if !strings.ContainsRune(line, '!') {
+		return line, false, nil
+	}
+	commands := s.history.GetAll()
+
+	var b strings.Builder
+	inSingle := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\'':
+			inSingle = !inSingle
+		case c == '\\' && !inSingle && i+1 < len(line):
+			b.WriteByte(c)
+			i++
+			c = line[i]
+		case c == '!' && !inSingle && i+1 < len(line) && !strings.ContainsRune(" \t=(\"", rune(line[i+1])):
+			event, n := historyEvent(line[i+1:])
+			text, err := lookupEvent(commands, event)
+			if err != nil {
+				return "", false, err
+			}
+			b.WriteString(text)
+			i += n
+			changed = true
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), changed, nil
+}
+
+// ExpandHistory replaces the history references in line as the shell
+// does before parsing a line typed, and reports whether there were any.
+func (s *Shell) ExpandHistory(line string) (string, bool, error) {
+	return s.expandHistory(line)
+}
+
+// historyEvent splits the event designator off the text following a '!'
+// and returns it with its length.
+func historyEvent(rest string) (string, int) {
+	if rest[0] == '!' || rest[0] == '$' {
+		return rest[:1], 1
+	}
+	end := strings.IndexAny(rest, " \t;|&<>()'\"")
+	if end < 0 {
+		end = len(rest)
+	}
+	return rest[:end], end
+}
+
+func lookupEvent(commands []string, event string) (string, error) {
+	notFound := fmt.Errorf("!%s: event not found", event)
+	if len(commands) == 0 {
+		return "", notFound
+	}
+	last := commands[len(commands)-1]
+
+	switch event {
+	case "!":
+		return last, nil
+	case "$":
+		words := strings.Fields(last)
+		return words[len(words)-1], nil
+	}
+	if n, err := strconv.Atoi(event); err == nil {
+		if n < 0 {
+			n += len(commands) + 1
+		}
+		if n < 1 || n > len(commands) {
+			return "", notFound
+		}
+		return commands[n-1], nil
+	}
+	for i := len(commands) - 1; i >= 0; i-- {
+		if strings.HasPrefix(commands[i], event) {
+			return commands[i], nil
+		}
+	}
+	return "", notFound
+}
@@ -0,0 +1,110 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"shell/internal/history"
+)
+
+const (
+	statsTopCommands = 10
+	statsListed      = 20
+)
+
+// historyStats implements `history stats [--here | --dir DIR] [--failed]`:
+// a summary of the matching commands, followed by the latest of them when
+// a filter was given. The file backend only knows the directory and exit
+// code of this session's commands.
+func (s *Shell) historyStats(args []string) error {
+	var q history.Query
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--here":
+			q.Dir, _ = os.Getwd()
+		case "--dir":
+			if i+1 == len(args) {
+				return fmt.Errorf("history: stats: --dir: expected a directory")
+			}
+			i++
+			q.Dir = expandTilde(args[i])
+		case "--failed":
+			q.Failed = true
+		default:
+			return fmt.Errorf("history: stats: %s: invalid option", args[i])
+		}
+	}
+
+	entries, err := s.history.Query(q)
+	if err != nil {
+		return fmt.Errorf("history: stats: %w", err)
+	}
+
+	var failed, finished int
+	var total time.Duration
+	dirs := make(map[string]bool)
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		if entry.Finished {
+			finished++
+			total += entry.Duration
+			if entry.ExitCode != 0 {
+				failed++
+			}
+		}
+		if entry.Dir != "" {
+			dirs[entry.Dir] = true
+		}
+		if fields := strings.Fields(entry.Command); len(fields) > 0 {
+			counts[fields[0]]++
+		}
+	}
+
+	fmt.Printf("Commands: %d (%d failed) in %d directories\n", len(entries), failed, len(dirs))
+	if finished > 0 {
+		fmt.Printf("Average duration: %s\n", (total / time.Duration(finished)).Round(time.Millisecond))
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > statsTopCommands {
+		names = names[:statsTopCommands]
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if len(names) > 0 {
+		fmt.Println("Top commands:")
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "%d\t  %s\n", counts[name], name)
+	}
+	w.Flush()
+
+	if q == (history.Query{}) {
+		return nil
+	}
+	if len(entries) > statsListed {
+		entries = entries[len(entries)-statsListed:]
+	}
+	fmt.Println("Latest:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, entry := range entries {
+		status := "-"
+		if entry.Finished {
+			status = fmt.Sprint(entry.ExitCode)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04"), status, entry.Command, entry.Dir)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,186 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+	"shell/internal/config"
+	"shell/internal/plugin"
+)
+
+type ExitHook func(session plugin.Session)
+
+func (s *Shell) OnExit(hook ExitHook) {
+	s.exitHooks = append(s.exitHooks, hook)
+}
+
+// The zsh hook points at which commands registered with add-hook or in
+// the config's hooks section run.
+const (
+	// hookPreexec runs before each command line entered at the prompt,
+	// which is in $HOOK_COMMAND.
+	hookPreexec = "preexec"
+	// hookPrecmd runs before each prompt.
+	hookPrecmd = "precmd"
+)
+
+var hookEvents = []string{hookPreexec, hookPrecmd}
+
+type (
+	PreexecHook func(line string)
+	PrecmdHook  func()
+)
+
+// OnPreexec registers hook to run before each command line entered at
+// the prompt runs.
+func (s *Shell) OnPreexec(hook PreexecHook) {
+	s.preexecHooks = append(s.preexecHooks, hook)
+}
+
+// OnPrecmd registers hook to run before each prompt is shown.
+func (s *Shell) OnPrecmd(hook PrecmdHook) {
+	s.precmdHooks = append(s.precmdHooks, hook)
+}
+
+// runPreexec runs the preexec hooks for line, in an interactive shell.
+func (s *Shell) runPreexec(line string) {
+	if !s.interactive {
+		return
+	}
+	for _, hook := range s.preexecHooks {
+		hook(line)
+	}
+	s.setVar("HOOK_COMMAND", line)
+	s.runHookCommands(hookPreexec)
+}
+
+// runPrecmd runs the hooks due before a prompt.
+func (s *Shell) runPrecmd() {
+	for _, p := range s.plugins {
+		if h, ok := p.(plugin.PrePromptHook); ok {
+			stop := s.profiler.track("hook", p.Name()+".OnPrePrompt")
+			s.callPlugin(p, "OnPrePrompt", h.OnPrePrompt)
+			stop()
+		}
+	}
+	if s.scripts != nil {
+		stop := s.profiler.track("hook", "scripts.OnPrePrompt")
+		s.scripts.OnPrePrompt()
+		stop()
+	}
+	for _, hook := range s.precmdHooks {
+		hook()
+	}
+	s.runHookCommands(hookPrecmd)
+}
+
+// runHookCommands runs the commands added for event. Like traps, they
+// leave $? alone.
+func (s *Shell) runHookCommands(event string) {
+	status := s.lastStatus
+	for _, command := range s.hooks[event] {
+		err := s.Execute(command)
+		var exitStatus ExitStatus
+		if err != nil && !errors.As(err, &exitStatus) {
+			fmt.Fprintf(os.Stderr, "Error: %s hook: %v\n", event, err)
+		}
+	}
+	s.lastStatus = status
+}
+
+// addHook implements add-hook [-d] EVENT COMMAND, after zsh's
+// add-zsh-hook: COMMAND runs at every EVENT, preexec or precmd, until it
+// is deleted with -d. Without arguments the hooks are listed.
+func (s *Shell) addHook(args []string) error {
+	if len(args) == 0 {
+		for _, event := range hookEvents {
+			for _, command := range s.hooks[event] {
+				fmt.Printf("add-hook %s %s\n", event, shellquote.Join(command))
+			}
+		}
+		return nil
+	}
+	remove := args[0] == "-d"
+	if remove {
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("add-hook: usage: add-hook [-d] EVENT COMMAND")
+	}
+	event, command := args[0], args[1]
+	if !slices.Contains(hookEvents, event) {
+		return fmt.Errorf("add-hook: %s: unknown event, expected preexec or precmd", event)
+	}
+
+	i := slices.Index(s.hooks[event], command)
+	switch {
+	case remove && i < 0:
+		return fmt.Errorf("add-hook: %s: no such %s hook", command, event)
+	case remove:
+		s.hooks[event] = slices.Delete(s.hooks[event], i, i+1)
+	case i < 0:
+		s.hooks[event] = append(s.hooks[event], command)
+	}
+	return nil
+}
+
+// configHooks returns the hook commands of a config by event.
+func configHooks(cfg *config.Config) map[string][]string {
+	return map[string][]string{
+		hookPreexec: slices.Clone(cfg.Hooks.Preexec),
+		hookPrecmd:  slices.Clone(cfg.Hooks.Precmd),
+	}
+}
+
+func (s *Shell) session() plugin.Session {
+	end := time.Now()
+	dir, _ := os.Getwd()
+	return plugin.Session{
+		Start:        s.startTime,
+		End:          end,
+		Duration:     end.Sub(s.startTime),
+		CommandCount: s.commandCount,
+		LastDir:      dir,
+	}
+}
+
+// shutdown notifies plugins and registered hooks that the session is
+// over. It only runs once, no matter how the shell exits.
+func (s *Shell) shutdown() {
+	if s.exited {
+		return
+	}
+	s.exited = true
+
+	s.runExitTrap()
+	s.logout()
+	if s.config.HupOnExit {
+		s.hangUpJobs()
+	}
+	s.runExitHooks()
+	s.shutdownPlugins()
+	if s.recording != nil {
+		s.stopRecording()
+	}
+	s.removeJobLogs()
+	if err := s.history.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving history: %v\n", err)
+	}
+	s.closeProjectHistories()
+}
+
+func (s *Shell) runExitHooks() {
+	session := s.session()
+	for _, p := range s.plugins {
+		if h, ok := p.(plugin.ExitHook); ok {
+			s.callPlugin(p, "OnExit", func() { h.OnExit(session) })
+		}
+	}
+	for _, hook := range s.exitHooks {
+		hook(session)
+	}
+}
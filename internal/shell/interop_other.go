@@ -0,0 +1,7 @@
+//go:build !windows
+
+package shell
+
+func translateCommand(args []string) []string {
+	return args
+}
@@ -0,0 +1,123 @@
+//go:build windows
+
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unixCommands maps common Unix commands onto cmd.exe or PowerShell
+// equivalents. They are only used when no real executable of that name
+// (e.g. from Git for Windows or MSYS) is on PATH.
+var unixCommands = map[string]func(args []string) []string{
+	"ls":    translateLs,
+	"rm":    translateRm,
+	"cp":    translateCp,
+	"mv":    func(args []string) []string { return powershell("Move-Item", args) },
+	"cat":   func(args []string) []string { return append([]string{"cmd", "/c", "type"}, args...) },
+	"pwd":   func(args []string) []string { return []string{"cmd", "/c", "cd"} },
+	"clear": func(args []string) []string { return []string{"cmd", "/c", "cls"} },
+	"which": func(args []string) []string { return append([]string{"where"}, args...) },
+	"touch": func(args []string) []string { return powershell("New-Item -ItemType File -Force", args) },
+	"grep":  func(args []string) []string { return append([]string{"findstr"}, args...) },
+}
+
+// translateCommand returns the command to run for args. Only the Unix
+// commands in unixCommands are translated, and only their arguments that
+// name existing files are turned into Windows paths; everything else is
+// passed through as typed, since a slash in an argument such as
+// origin/main or s/a/b/ is not a path separator.
+func translateCommand(args []string) []string {
+	translate, ok := unixCommands[args[0]]
+	if !ok {
+		return args
+	}
+	if _, err := exec.LookPath(args[0]); err == nil {
+		return args
+	}
+	paths := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		paths[i] = toWindowsPath(arg)
+	}
+	return translate(paths)
+}
+
+// toWindowsPath expands a leading ~ in an argument, and turns forward
+// slashes into backslashes when it names an existing file. Anything else,
+// such as a /switch or a URL, is returned unchanged.
+func toWindowsPath(arg string) string {
+	if arg == "~" || strings.HasPrefix(arg, "~/") || strings.HasPrefix(arg, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			arg = home + arg[1:]
+		}
+	}
+	if strings.HasPrefix(arg, "/") {
+		return arg
+	}
+	if path := filepath.FromSlash(arg); path != arg {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return arg
+}
+
+func splitFlags(args []string) (string, []string) {
+	var flags strings.Builder
+	var rest []string
+	for _, arg := range args {
+		if len(arg) > 1 && arg[0] == '-' {
+			flags.WriteString(strings.TrimLeft(arg, "-"))
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return flags.String(), rest
+}
+
+func translateLs(args []string) []string {
+	flags, paths := splitFlags(args)
+	cmd := []string{"cmd", "/c", "dir"}
+	if strings.Contains(flags, "a") {
+		cmd = append(cmd, "/a")
+	}
+	if !strings.Contains(flags, "l") {
+		cmd = append(cmd, "/w")
+	}
+	return append(cmd, paths...)
+}
+
+func translateRm(args []string) []string {
+	flags, paths := splitFlags(args)
+	verb := "Remove-Item"
+	if strings.ContainsAny(flags, "rR") {
+		verb += " -Recurse"
+	}
+	if strings.Contains(flags, "f") {
+		verb += " -Force -ErrorAction SilentlyContinue"
+	}
+	return powershell(verb, paths)
+}
+
+func translateCp(args []string) []string {
+	flags, paths := splitFlags(args)
+	verb := "Copy-Item"
+	if strings.ContainsAny(flags, "rR") {
+		verb += " -Recurse"
+	}
+	return powershell(verb, paths)
+}
+
+func powershell(verb string, args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+	}
+	return []string{"powershell.exe", "-NoProfile", "-Command", verb + " " + strings.Join(quoted, ",")}
+}
+
+// command builds the process for args, running PowerShell scripts and
+// batch files through their interpreters so they can be typed directly.
@@ -1,20 +1,41 @@
 package shell
 
 import (
-	"os/exec"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 )
 
 type Job struct {
-	Command    *exec.Cmd
-	Status     string
+	Args       []string
+	PID        int
 	ID         int
 	Background bool
+
+	// mu guards status, which the goroutine waiting for a background job
+	// changes once it ends.
+	mu     sync.Mutex
+	status string
+}
+
+// Status returns the job's status: "Running", "Done" or "Timed out".
+func (j *Job) Status() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
 }
 
-func (s *Shell) CreateJob(cmd *exec.Cmd, background bool) *Job {
+func (j *Job) setStatus(status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+}
+
+func (s *Shell) CreateJob(args []string, background bool) *Job {
 	job := &Job{
-		Command:    cmd,
-		Status:     "Running",
+		Args:       args,
+		status:     "Running",
 		ID:         s.nextJobID,
 		Background: background,
 	}
@@ -23,10 +44,67 @@ func (s *Shell) CreateJob(cmd *exec.Cmd, background bool) *Job {
 	return job
 }
 
+// ListJobs returns the jobs, in the order they were started.
 func (s *Shell) ListJobs() []*Job {
 	jobs := make([]*Job, 0, len(s.jobs))
 	for _, job := range s.jobs {
 		jobs = append(jobs, job)
 	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
 	return jobs
 }
+
+// jobJSON is a job as jobs --json prints it.
+type jobJSON struct {
+	ID      int      `json:"id"`
+	PID     int      `json:"pid"`
+	Status  string   `json:"status"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// listJobs is the jobs builtin: it lists the background jobs, with their
+// process IDs for -l. As in bash, the jobs that have finished are
+// forgotten once listed.
+func (s *Shell) listJobs(args []string) error {
+	long, asJSON := false, false
+	for _, arg := range args {
+		switch arg {
+		case "-l":
+			long = true
+		case "--json":
+			asJSON = true
+		default:
+			return fmt.Errorf("jobs: %s: invalid option", arg)
+		}
+	}
+
+	jobs := s.ListJobs()
+	// Each job is listed with the status it had when it was forgotten,
+	// even if it ends meanwhile.
+	statuses := make([]string, len(jobs))
+	for i, job := range jobs {
+		statuses[i] = job.Status()
+		if statuses[i] != "Running" {
+			delete(s.jobs, job.ID)
+		}
+	}
+	if asJSON {
+		list := make([]jobJSON, 0, len(jobs))
+		for i, job := range jobs {
+			list = append(list, jobJSON{job.ID, job.PID, statuses[i], strings.Join(job.Args, " "), job.Args})
+		}
+		if err := printJSON(list); err != nil {
+			return fmt.Errorf("jobs: %w", err)
+		}
+		return nil
+	}
+	for i, job := range jobs {
+		if long {
+			fmt.Printf("[%d]  %d %-10s %s\n", job.ID, job.PID, statuses[i], strings.Join(job.Args, " "))
+		} else {
+			fmt.Printf("[%d]  %-10s %s\n", job.ID, statuses[i], strings.Join(job.Args, " "))
+		}
+	}
+	return nil
+}
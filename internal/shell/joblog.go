@@ -0,0 +1,175 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"shell/internal/executor"
+)
+
+// maxJobOutput is how much of a background job's output is kept when the
+// config keeps it in memory; older output is dropped.
+const maxJobOutput = 64 << 10
+
+// jobOutput is where the output of a background job goes: a log file of
+// its own, or the end of it kept in memory.
+type jobOutput struct {
+	path string
+	file *os.File
+	tail *tailBuffer
+}
+
+// newJobOutput sets up the output of job id as jobs.output in the config
+// asks, or returns nil if it is to be discarded.
+func (s *Shell) newJobOutput(id int) (*jobOutput, error) {
+	switch s.config.Jobs.Output {
+	case "discard":
+		return nil, nil
+	case "memory":
+		return &jobOutput{tail: &tailBuffer{}}, nil
+	}
+	dir := s.config.Jobs.LogDir
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d-%d.log", os.Getpid(), id))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &jobOutput{path: path, file: f}, nil
+}
+
+func (o *jobOutput) writer() io.Writer {
+	if o.file != nil {
+		return o.file
+	}
+	return o.tail
+}
+
+// close closes the log file once the job has finished writing to it.
+func (o *jobOutput) close() {
+	if o != nil && o.file != nil {
+		o.file.Close()
+	}
+}
+
+func (o *jobOutput) contents() ([]byte, error) {
+	if o.tail != nil {
+		return o.tail.Bytes(), nil
+	}
+	return os.ReadFile(o.path)
+}
+
+// keepJobOutput sends the output of a background job that was not
+// redirected elsewhere to the job's output, and returns that, or nil if
+// there is none.
+func (s *Shell) keepJobOutput(job *Job, cmd *executor.Command) *jobOutput {
+	if cmd.Stdout != nil && cmd.Stderr != nil {
+		return nil
+	}
+	out, err := s.newJobOutput(job.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: keeping the output of job %d: %v\n", job.ID, err)
+		return nil
+	}
+	if out == nil {
+		return nil
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = out.writer()
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = out.writer()
+	}
+	s.jobOutputs[job.ID] = out
+	return out
+}
+
+// removeJobLogs removes the log files of the session's jobs as the shell
+// exits.
+func (s *Shell) removeJobLogs() {
+	for _, out := range s.jobOutputs {
+		if out.path != "" {
+			os.Remove(out.path)
+		}
+	}
+}
+
+// joblog prints the output of a background job, named as N or %N, or of
+// the last one started. -p prints the path of its log file instead.
+func (s *Shell) joblog(args []string) error {
+	pathOnly := len(args) > 0 && args[0] == "-p"
+	if pathOnly {
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("joblog: too many arguments")
+	}
+
+	id := 0
+	for n := range s.jobOutputs {
+		id = max(id, n)
+	}
+	if len(args) == 1 {
+		n, err := strconv.Atoi(strings.TrimPrefix(args[0], "%"))
+		if err != nil {
+			return fmt.Errorf("joblog: %s: no such job", args[0])
+		}
+		id = n
+	}
+	out, ok := s.jobOutputs[id]
+	switch {
+	case !ok && len(args) == 1:
+		return fmt.Errorf("joblog: %s: no output kept for that job", args[0])
+	case !ok:
+		return fmt.Errorf("joblog: no job output kept")
+	}
+
+	if pathOnly {
+		if out.path == "" {
+			return fmt.Errorf("joblog: %%%d: output kept in memory, not in a file", id)
+		}
+		fmt.Println(out.path)
+		return nil
+	}
+	data, err := out.contents()
+	if err != nil {
+		return fmt.Errorf("joblog: %w", err)
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+// tailBuffer keeps the last lines written to it, up to maxJobOutput
+// bytes.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - maxJobOutput; over > 0 {
+		// Drop the rest of the line cut into as well.
+		if i := bytes.IndexByte(b.buf[over:], '\n'); i >= 0 {
+			over += i + 1
+		}
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf...)
+}
@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"shell/internal/plugin"
+)
+
+// jobSpec returns the job a job spec names: %N is job N, and %% or %+
+// the last one started.
+func (s *Shell) jobSpec(spec string) (*Job, error) {
+	var job *Job
+	switch spec {
+	case "%%", "%+":
+		for _, j := range s.jobs {
+			if job == nil || j.ID > job.ID {
+				job = j
+			}
+		}
+	default:
+		if id, err := strconv.Atoi(strings.TrimPrefix(spec, "%")); err == nil {
+			job = s.jobs[id]
+		}
+	}
+	if job == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return job, nil
+}
+
+// kill is the kill builtin: the kill program, to which job specs are
+// given as the process IDs of their jobs.
+func (s *Shell) kill(args []string) error {
+	args = slices.Clone(args)
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "%") {
+			continue
+		}
+		job, err := s.jobSpec(arg)
+		if err != nil {
+			return fmt.Errorf("kill: %w", err)
+		}
+		args[i] = strconv.Itoa(job.PID)
+	}
+	return s.runExternal(&stage{args: append([]string{"kill"}, args...)}, false)
+}
+
+// jobSpecs completes the job specs of the jobs running for kill, fg and
+// bg, described by their commands, and for kill the process IDs of the
+// processes running, described by their command lines.
+type jobSpecs struct {
+	shell *Shell
+}
+
+func (jobSpecs) Completes() []string {
+	return []string{"kill", "fg", "bg"}
+}
+
+func (j jobSpecs) Complete(args []string, word string) ([]plugin.Completion, error) {
+	if strings.HasPrefix(word, "-") {
+		return nil, nil
+	}
+	var completions []plugin.Completion
+	for _, job := range j.shell.ListJobs() {
+		if job.Status() == "Running" {
+			completions = append(completions, plugin.Completion{
+				Text:        "%" + strconv.Itoa(job.ID),
+				Description: strings.Join(job.Args, " "),
+			})
+		}
+	}
+	if filepath.Base(args[0]) == "kill" && !strings.HasPrefix(word, "%") {
+		completions = append(completions, processes()...)
+	}
+	return completions, nil
+}
+
+// processes returns the process IDs in /proc, in order, each described by
+// its command line. Kernel threads, which have none, are left out, and
+// where there is no /proc there are none.
+func processes() []plugin.Completion {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	slices.Sort(pids)
+
+	var completions []plugin.Completion
+	for _, pid := range pids {
+		cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+		description := strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+		if err != nil || description == "" {
+			continue
+		}
+		completions = append(completions, plugin.Completion{Text: strconv.Itoa(pid), Description: description})
+	}
+	return completions
+}
@@ -0,0 +1,23 @@
+package shell
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// jsonFlag takes a leading --json off a builtin's arguments, and reports
+// whether it was there.
+func jsonFlag(args []string) ([]string, bool) {
+	if len(args) > 0 && args[0] == "--json" {
+		return args[1:], true
+	}
+	return args, false
+}
+
+// printJSON prints v as one line of JSON, for the builtins' --json
+// output to be read by scripts.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
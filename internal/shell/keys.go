@@ -0,0 +1,179 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"shell/internal/config"
+	"shell/internal/lineedit"
+)
+
+// bindKeys maps keys to what they are bound to: config.DefaultKeybindings,
+// overridden by the config's keybindings.
+func bindKeys(cfg *config.Config) map[rune]string {
+	keys := make(map[rune]string)
+	for _, bindings := range []map[string]string{config.DefaultKeybindings, cfg.Keybindings} {
+		for spec, action := range bindings {
+			// The config was validated, so the keys parse.
+			if r, err := config.ParseKey(spec); err == nil {
+				keys[r] = action
+			}
+		}
+	}
+	return keys
+}
+
+// filterKey sees every key before the line editor does. Returning false
+// swallows the key.
+func (s *Shell) filterKey(r rune) (rune, bool) {
+	if s.menu != nil {
+		s.menuKey(r)
+		return r, false
+	}
+	if s.search != nil {
+		return r, s.searchKey(r)
+	}
+
+	binding := s.keys[r]
+	if key, ok := lineedit.Functions[binding]; ok {
+		return key, true
+	}
+	if config.IsMacro(binding) && binding != "" {
+		return s.typeMacro(binding)
+	}
+	switch binding {
+	case config.ActionCopyLine:
+		if err := s.copyToClipboard(string(s.editLine)); err != nil {
+			s.reader.Write([]byte(fmt.Sprintf("Error: %v\n", err)))
+		}
+		return r, false
+	case config.ActionPasteClipboard:
+		text, err := s.readClipboard()
+		if err != nil {
+			s.reader.Write([]byte(fmt.Sprintf("Error: %v\n", err)))
+			return r, false
+		}
+		return s.insertText(strings.TrimSuffix(text, "\n"))
+	}
+	if !s.term.Fancy() {
+		return r, true
+	}
+
+	switch binding {
+	case config.ActionTogglePreview:
+		s.togglePreview()
+		return r, false
+	case config.ActionSelectCompletions:
+		s.openMenu()
+		return r, false
+	case config.ActionSearchHistory:
+		if !s.findHistory() {
+			s.openSearch()
+		}
+		return r, false
+	case config.ActionSearchScope:
+		s.findFiles()
+		return r, false
+	}
+	return r, true
+}
+
+// typeMacro inserts the text of a macro at the cursor, with backslash
+// escapes such as \n and \t. A macro ending in a newline then runs the
+// line.
+func (s *Shell) typeMacro(macro string) (rune, bool) {
+	text, run := strings.CutSuffix(unescapeMacro(macro), "\n")
+	s.insertText(text)
+	if run {
+		return lineedit.CharEnter, true
+	}
+	return 0, false
+}
+
+// insertText inserts text at the cursor, swallowing the key that asked
+// for it.
+func (s *Shell) insertText(text string) (rune, bool) {
+	pos := min(s.editPos, len(s.editLine))
+	s.reader.SetBuffer(string(s.editLine[:pos]) + text + string(s.editLine[pos:]))
+	return 0, false
+}
+
+func unescapeMacro(macro string) string {
+	var b strings.Builder
+	for i := 0; i < len(macro); i++ {
+		c := macro[i]
+		if c != '\\' || i == len(macro)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch macro[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'e':
+			b.WriteByte('\033')
+		default:
+			b.WriteByte(macro[i])
+		}
+	}
+	return b.String()
+}
+
+// trackLine remembers the line being edited so key handlers that run
+// outside the line editor's own bindings can see and replace it.
+func (s *Shell) trackLine(line []rune, pos int, key rune) {
+	s.editLine = append(s.editLine[:0], line...)
+	s.editPos = pos
+}
+
+// bind binds a key for the session, to an action or line editor function
+// (bind -l lists them) or to a macro, text typed when it is pressed.
+// bind -p, or bind alone, lists the bindings as the config's keybindings
+// section would have them, and bind -r unbinds a key.
+func (s *Shell) bind(args []string) error {
+	switch {
+	case len(args) == 0 || len(args) == 1 && args[0] == "-p":
+		s.listBindings()
+	case len(args) == 1 && args[0] == "-l":
+		for _, name := range config.Actions() {
+			fmt.Println(name)
+		}
+	case len(args) == 2 && args[0] == "-r":
+		r, err := config.ParseKey(args[1])
+		if err != nil {
+			return fmt.Errorf("bind: %w", err)
+		}
+		delete(s.keys, r)
+	case len(args) == 2 && !strings.HasPrefix(args[0], "-"):
+		r, err := config.ParseKey(args[0])
+		if err != nil {
+			return fmt.Errorf("bind: %w", err)
+		}
+		if err := config.CheckBinding(args[1]); err != nil {
+			return fmt.Errorf("bind: %w", err)
+		}
+		s.keys[r] = args[1]
+	default:
+		return fmt.Errorf("bind: usage: bind [-l | -p | -r KEY | KEY ACTION | KEY TEXT]")
+	}
+	return nil
+}
+
+func (s *Shell) listBindings() {
+	keys := make([]rune, 0, len(s.keys))
+	for r := range s.keys {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, r := range keys {
+		binding := s.keys[r]
+		if config.IsMacro(binding) {
+			binding = strconv.Quote(binding)
+		}
+		fmt.Printf("%s: %s\n", config.KeyName(r), binding)
+	}
+}
@@ -0,0 +1,303 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"shell/internal/config"
+)
+
+// rlimit is a resource limit ulimit can show and set, by its option
+// letter. Values are counted in units of scale bytes, or of the resource
+// itself when scale is 1.
+type rlimit struct {
+	letter   byte
+	name     string
+	unit     string
+	resource int
+	scale    uint64
+}
+
+var errLimitsUnsupported = errors.New("not supported on this system")
+
+// ulimit shows or sets the shell's resource limits, which the commands
+// it runs inherit: ulimit -n shows the open files limit and ulimit -n
+// 4096 sets it. -S and -H choose the soft or the hard limit, both being
+// set when neither is given; -a shows them all. The file size limit (-f)
+// is the one meant when no resource is.
+func (s *Shell) ulimit(args []string) error {
+	if len(rlimits) == 0 {
+		return fmt.Errorf("ulimit: %w", errLimitsUnsupported)
+	}
+	var limits []rlimit
+	soft, hard, all := false, false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		for _, letter := range []byte(args[0][1:]) {
+			switch letter {
+			case 'S':
+				soft = true
+			case 'H':
+				hard = true
+			case 'a':
+				all = true
+			default:
+				limit, ok := findRlimit(letter)
+				if !ok {
+					return fmt.Errorf("ulimit: -%c: invalid option", letter)
+				}
+				limits = append(limits, limit)
+			}
+		}
+		args = args[1:]
+	}
+	if all {
+		limits = rlimits
+	} else if len(limits) == 0 {
+		limits = append(limits, rlimits[0])
+	}
+
+	if len(args) == 0 {
+		for _, limit := range limits {
+			cur, max, err := getrlimit(limit.resource)
+			if err != nil {
+				return fmt.Errorf("ulimit: %s: %w", limit.name, err)
+			}
+			value := formatLimit(cur, limit.scale)
+			if hard && !soft {
+				value = formatLimit(max, limit.scale)
+			}
+			if len(limits) == 1 {
+				fmt.Println(value)
+			} else {
+				label := "-" + string(limit.letter)
+				if limit.unit != "" {
+					label = limit.unit + ", " + label
+				}
+				fmt.Printf("%-24s %-14s %s\n", limit.name, "("+label+")", value)
+			}
+		}
+		return nil
+	}
+	if len(args) > 1 || all || len(limits) > 1 {
+		return fmt.Errorf("ulimit: usage: ulimit [-SH] [-%s] [LIMIT]", rlimitLetters())
+	}
+
+	limit := limits[0]
+	value, err := parseLimit(args[0], limit.scale)
+	if err != nil {
+		return fmt.Errorf("ulimit: %w", err)
+	}
+	cur, max, err := getrlimit(limit.resource)
+	if err != nil {
+		return fmt.Errorf("ulimit: %s: %w", limit.name, err)
+	}
+	if soft || !hard {
+		cur = value
+	}
+	if hard || !soft {
+		max = value
+	}
+	if err := setrlimit(limit.resource, cur, max); err != nil {
+		return fmt.Errorf("ulimit: %s: %w", limit.name, err)
+	}
+	return nil
+}
+
+func findRlimit(letter byte) (rlimit, bool) {
+	for _, limit := range rlimits {
+		if limit.letter == letter {
+			return limit, true
+		}
+	}
+	return rlimit{}, false
+}
+
+func rlimitLetters() string {
+	var b strings.Builder
+	for _, limit := range rlimits {
+		b.WriteByte(limit.letter)
+	}
+	return b.String()
+}
+
+func formatLimit(value, scale uint64) string {
+	if value == rlimInfinity {
+		return "unlimited"
+	}
+	return strconv.FormatUint(value/scale, 10)
+}
+
+func parseLimit(text string, scale uint64) (uint64, error) {
+	if text == "unlimited" {
+		return rlimInfinity, nil
+	}
+	n, err := strconv.ParseUint(text, 10, 64)
+	if err != nil || n > rlimInfinity/scale {
+		return 0, fmt.Errorf("%s: invalid limit", text)
+	}
+	return n * scale, nil
+}
+
+// umask shows or sets the mask of permissions taken away from the files
+// the shell and its commands create, in octal (umask 022) or symbolically
+// (umask u=rwx,g=rx,o=). umask -S shows it symbolically.
+func (s *Shell) umask(args []string) error {
+	symbolic := false
+	if len(args) > 0 && args[0] == "-S" {
+		symbolic = true
+		args = args[1:]
+	}
+	mask, err := getUmask()
+	if err != nil {
+		return fmt.Errorf("umask: %w", err)
+	}
+	if len(args) == 0 {
+		if symbolic {
+			fmt.Println(symbolicMode(^mask & 0o777))
+		} else {
+			fmt.Printf("%04o\n", mask)
+		}
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("umask: usage: umask [-S] [MODE]")
+	}
+
+	if n, err := strconv.ParseUint(args[0], 8, 32); err == nil {
+		if n > 0o777 {
+			return fmt.Errorf("umask: %s: octal number out of range", args[0])
+		}
+		mask = int(n)
+	} else {
+		perms, err := applySymbolicMode(^mask&0o777, args[0])
+		if err != nil {
+			return fmt.Errorf("umask: %w", err)
+		}
+		mask = ^perms & 0o777
+	}
+	return setUmask(mask)
+}
+
+// permWho are the classes of user in a symbolic mode, with the shift of
+// their permission bits.
+var permWho = []struct {
+	letter byte
+	shift  uint
+}{{'u', 6}, {'g', 3}, {'o', 0}}
+
+// symbolicMode formats permission bits as chmod does, e.g. u=rwx,g=rx,o=.
+func symbolicMode(perms int) string {
+	parts := make([]string, len(permWho))
+	for i, who := range permWho {
+		bits := perms >> who.shift & 7
+		part := string(who.letter) + "="
+		for j, r := range "rwx" {
+			if bits&(4>>j) != 0 {
+				part += string(r)
+			}
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, ",")
+}
+
+// applySymbolicMode applies a mode such as u+w,go-rwx or a=rx to perms.
+func applySymbolicMode(perms int, mode string) (int, error) {
+	for _, clause := range strings.Split(mode, ",") {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return 0, fmt.Errorf("%s: invalid symbolic mode", mode)
+		}
+		who, op, what := clause[:i], clause[i], clause[i+1:]
+		if who == "" || who == "a" {
+			who = "ugo"
+		}
+		bits := 0
+		for _, r := range what {
+			j := strings.IndexRune("rwx", r)
+			if j < 0 {
+				return 0, fmt.Errorf("%s: invalid symbolic mode", mode)
+			}
+			bits |= 4 >> j
+		}
+		for _, c := range []byte(who) {
+			shift := -1
+			for _, w := range permWho {
+				if w.letter == c {
+					shift = int(w.shift)
+				}
+			}
+			if shift < 0 {
+				return 0, fmt.Errorf("%s: invalid symbolic mode", mode)
+			}
+			switch op {
+			case '=':
+				perms = perms&^(7<<shift) | bits<<shift
+			case '+':
+				perms |= bits << shift
+			case '-':
+				perms &^= bits << shift
+			}
+		}
+	}
+	return perms, nil
+}
+
+// applyLimits handles limit [--mem SIZE] [--cpu DURATION] [--nice N]
+// COMMAND [ARG...], which runs an external command, in the foreground or
+// as a job, with limits of its own rather than the shell's: at most SIZE
+// of memory (500M, 2G), DURATION of CPU time and niceness N.
+func (s *Shell) applyLimits(st *stage) error {
+	args := st.args[1:]
+	for len(args) > 1 && strings.HasPrefix(args[0], "--") {
+		option, value := args[0], args[1]
+		var err error
+		switch option {
+		case "--mem":
+			st.limits.Memory, err = parseSize(value)
+		case "--cpu":
+			st.limits.CPU, err = config.ParseDuration(value)
+		case "--nice":
+			st.limits.Nice, err = strconv.Atoi(value)
+			if err != nil {
+				err = fmt.Errorf("%s: not a number", value)
+			}
+		default:
+			return fmt.Errorf("limit: %s: invalid option", option)
+		}
+		if err != nil {
+			return fmt.Errorf("limit: %s: %w", option, err)
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "--") {
+		return fmt.Errorf("limit: usage: limit [--mem SIZE] [--cpu DURATION] [--nice N] COMMAND [ARG...]")
+	}
+	name := args[0]
+	if s.isCommandBuiltin(name) && !isWrapper(name) {
+		return fmt.Errorf("limit: %s: only external commands can be limited", name)
+	}
+
+	st.args = args
+	st.builtin = isWrapper(name)
+	return nil
+}
+
+// parseSize parses a number of bytes with an optional K, M, G or T
+// suffix for the powers of 1024.
+func parseSize(text string) (uint64, error) {
+	digits, scale := text, uint64(1)
+	if text != "" {
+		if i := strings.IndexByte("KMGT", strings.ToUpper(text)[len(text)-1]); i >= 0 {
+			digits, scale = text[:len(text)-1], 1<<(10*(i+1))
+		}
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || n == 0 || n > math.MaxUint64/scale {
+		return 0, fmt.Errorf("%s: invalid size", text)
+	}
+	return n * scale, nil
+}
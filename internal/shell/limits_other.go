@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package shell
+
+import "math"
+
+// Resource limits are only supported on Linux and macOS.
+var rlimits []rlimit
+
+const rlimInfinity = math.MaxUint64
+
+func getrlimit(resource int) (cur, max uint64, err error) {
+	return 0, 0, errLimitsUnsupported
+}
+
+func setrlimit(resource int, cur, max uint64) error {
+	return errLimitsUnsupported
+}
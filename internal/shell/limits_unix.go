@@ -0,0 +1,32 @@
+//go:build linux || darwin
+
+package shell
+
+import "golang.org/x/sys/unix"
+
+// rlimits are the limits ulimit knows, the one it shows by default
+// first.
+var rlimits = []rlimit{
+	{'f', "file size", "blocks", unix.RLIMIT_FSIZE, 1024},
+	{'c', "core file size", "blocks", unix.RLIMIT_CORE, 1024},
+	{'d', "data seg size", "kbytes", unix.RLIMIT_DATA, 1024},
+	{'l', "max locked memory", "kbytes", unix.RLIMIT_MEMLOCK, 1024},
+	{'m', "max memory size", "kbytes", unix.RLIMIT_RSS, 1024},
+	{'n', "open files", "", unix.RLIMIT_NOFILE, 1},
+	{'s', "stack size", "kbytes", unix.RLIMIT_STACK, 1024},
+	{'t', "cpu time", "seconds", unix.RLIMIT_CPU, 1},
+	{'u', "max user processes", "", unix.RLIMIT_NPROC, 1},
+	{'v', "virtual memory", "kbytes", unix.RLIMIT_AS, 1024},
+}
+
+const rlimInfinity = unix.RLIM_INFINITY
+
+func getrlimit(resource int) (cur, max uint64, err error) {
+	var lim unix.Rlimit
+	err = unix.Getrlimit(resource, &lim)
+	return lim.Cur, lim.Max, err
+}
+
+func setrlimit(resource int, cur, max uint64) error {
+	return unix.Setrlimit(resource, &unix.Rlimit{Cur: cur, Max: max})
+}
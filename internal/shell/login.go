@@ -0,0 +1,150 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"shell/pkg/parser"
+)
+
+// Files in the home directory that login shells source at startup and on
+// exit.
+const (
+	ProfileFile = ".myshell_profile"
+	LogoutFile  = ".myshell_logout"
+)
+
+// Login makes s a login shell: it fills in the variables a login session
+// is expected to have when whatever started the shell did not set them,
+// and sources LogoutFile when the shell exits. The caller sources
+// ProfileFile.
+func (s *Shell) Login() {
+	s.login = true
+
+	defaults := map[string]func() string{
+		"HOME": func() string { return s.config.HomeDir },
+		"SHELL": func() string {
+			exe, _ := os.Executable()
+			return exe
+		},
+		"USER":    currentUser,
+		"LOGNAME": currentUser,
+	}
+	for name, value := range defaults {
+		if _, ok := os.LookupEnv(name); !ok {
+			if v := value(); v != "" {
+				os.Setenv(name, v)
+			}
+		}
+	}
+}
+
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// logout sources LogoutFile if s is a login shell. The shell still exits
+// with the status it had before.
+func (s *Shell) logout() {
+	if !s.login {
+		return
+	}
+	status := s.lastStatus
+	s.exitRequested = false
+	s.SourceIfExists(filepath.Join(s.config.HomeDir, LogoutFile))
+	s.lastStatus = status
+}
+
+// SourceIfExists sources file if there is one, reporting any error other
+// than a command failing, which the command has already reported.
+func (s *Shell) SourceIfExists(file string) {
+	err := s.Source(file)
+	var status ExitStatus
+	if err != nil && !os.IsNotExist(err) && !errors.As(err, &status) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// Source runs the commands in file without adding them to the history.
+// Blank lines and lines starting with # are skipped. It returns the
+// status of the last command as an ExitStatus.
+func (s *Shell) Source(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	s.runLines(strings.Split(string(data), "\n"))
+	if s.lastStatus != 0 {
+		return ExitStatus(s.lastStatus)
+	}
+	return nil
+}
+
+// runLines runs lines one after the other until the shell is stopping. A
+// line ending inside quotes or after an operator such as | is joined with
+// the next.
+func (s *Shell) runLines(lines []string) {
+	pending := ""
+	for _, line := range lines {
+		if pending != "" {
+			line, pending = pending+"\n"+line, ""
+		} else if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if incomplete(line) {
+			pending = line
+			continue
+		}
+		s.runLine(line)
+		if s.stopping() {
+			return
+		}
+	}
+	if pending != "" {
+		// Report the syntax error.
+		s.runLine(pending)
+	}
+}
+
+// incomplete reports whether line needs more lines to complete it.
+func incomplete(line string) bool {
+	_, err := parser.Parse(line)
+	var syntaxErr *parser.SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.Incomplete
+}
+
+// source runs a file's commands, with any arguments after it as the
+// positional parameters while they run.
+func (s *Shell) source(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("source: usage: source FILE [ARG...]")
+	}
+	if len(args) > 1 {
+		saved := s.args
+		s.args = args[1:]
+		defer func() { s.args = saved }()
+	}
+	return s.Source(args[0])
+}
+
+// eval runs its arguments, joined with spaces, as a command line, so that
+// they are parsed and expanded again.
+func (s *Shell) eval(args []string) error {
+	line := strings.Join(args, " ")
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	list, err := parser.Parse(line)
+	if err != nil {
+		return fmt.Errorf("eval: %w", err)
+	}
+	return s.runList(list)
+}
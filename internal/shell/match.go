@@ -0,0 +1,110 @@
+package shell
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// matchCompletion reports whether name is a completion of word under the
+// config's completion.matching, and how well it matches it: the higher
+// the score, the better. Prefix matching is case-sensitive; the others
+// are only when word has capitals in it.
+func (s *Shell) matchCompletion(word, name string) (score int, ok bool) {
+	mode := s.config.Completion.Matching
+	if mode == "" || mode == "prefix" {
+		return 0, strings.HasPrefix(name, word)
+	}
+	if word == "" {
+		return 0, true
+	}
+	if !strings.ContainsFunc(word, unicode.IsUpper) {
+		word, name = strings.ToLower(word), strings.ToLower(name)
+	}
+	if mode == "substring" {
+		i := strings.Index(name, word)
+		if i < 0 {
+			return 0, false
+		}
+		// The sooner the better, and the start of a word best of all.
+		score = -i
+		if i == 0 {
+			score += 100
+		} else if isWordBoundary([]rune(name), utf8.RuneCountInString(name[:i])) {
+			score += 50
+		}
+		return score, true
+	}
+	return fuzzyScore(word, name)
+}
+
+// fuzzyScore matches the letters of word to name in order, each as soon
+// as it can be. Letters matched one after another score more than those
+// scattered, as do letters at the start of name or of a word in it.
+func fuzzyScore(word, name string) (score int, ok bool) {
+	pattern, runes := []rune(word), []rune(name)
+	i, last := 0, -1
+	for j := 0; j < len(runes) && i < len(pattern); j++ {
+		if runes[j] != pattern[i] {
+			continue
+		}
+		switch {
+		case j == 0:
+			score += 16
+		case last == j-1:
+			score += 8
+		case isWordBoundary(runes, j):
+			score += 6
+		default:
+			score++
+		}
+		if last >= 0 {
+			score -= min(j-last-1, 4)
+		}
+		i, last = i+1, j
+	}
+	if i < len(pattern) {
+		return 0, false
+	}
+	// Of two names matched as well, the shorter is nearer.
+	return score*8 - len(runes)/8, true
+}
+
+// isWordBoundary reports whether the rune at i starts a word in runes,
+// after a separator such as - or _ or a change to capitals.
+func isWordBoundary(runes []rune, i int) bool {
+	if i == 0 || i >= len(runes) {
+		return i == 0
+	}
+	before := runes[i-1]
+	return strings.ContainsRune("-_./ ", before) || unicode.IsLower(before) && unicode.IsUpper(runes[i])
+}
+
+// rankCompletions keeps the candidates that word matches and puts the
+// best matches first. Only the last element of a path is matched, and
+// candidates that match as well stay in order.
+func (s *Shell) rankCompletions(word string, candidates []string) []string {
+	type ranked struct {
+		candidate string
+		score     int
+	}
+	var matched []ranked
+	_, pattern := path.Split(word)
+	for _, candidate := range candidates {
+		name := strings.TrimRight(candidate, " /")
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		if score, ok := s.matchCompletion(pattern, name); ok {
+			matched = append(matched, ranked{candidate, score})
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].score > matched[j].score })
+	kept := make([]string, len(matched))
+	for i, m := range matched {
+		kept[i] = m.candidate
+	}
+	return kept
+}
@@ -0,0 +1,137 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"shell/internal/config"
+	"shell/internal/lineedit"
+)
+
+const menuHeight = 10
+
+// selectMenu lets several completion candidates be marked and inserted
+// at once. It is drawn above the prompt and driven by filterKey.
+type selectMenu struct {
+	line       []rune
+	pos        int
+	word       string
+	candidates []string
+	marked     []bool
+	cursor     int
+	drawn      int
+}
+
+func (s *Shell) openMenu() {
+	word, candidates, _ := s.completer.complete(s.editLine, s.editPos)
+	s.showMenu(word, candidates)
+}
+
+// showMenu offers candidates to replace word with.
+func (s *Shell) showMenu(word string, candidates []string) {
+	if len(candidates) == 0 {
+		return
+	}
+	s.menu = &selectMenu{
+		line:       append([]rune{}, s.editLine...),
+		pos:        s.editPos,
+		word:       word,
+		candidates: candidates,
+		marked:     make([]bool, len(candidates)),
+	}
+	s.drawMenu()
+}
+
+func (s *Shell) menuKey(r rune) {
+	m := s.menu
+	switch r {
+	case lineedit.CharTab, ' ':
+		m.marked[m.cursor] = !m.marked[m.cursor]
+		m.cursor = (m.cursor + 1) % len(m.candidates)
+	case lineedit.CharNext, lineedit.CharForward:
+		m.cursor = (m.cursor + 1) % len(m.candidates)
+	case lineedit.CharPrev, lineedit.CharBackward:
+		m.cursor = (m.cursor + len(m.candidates) - 1) % len(m.candidates)
+	case lineedit.CharEnter, lineedit.CharCtrlJ:
+		s.closeMenu()
+		s.insertSelection(m)
+		return
+	case lineedit.CharBell, lineedit.CharInterrupt:
+		s.closeMenu()
+		return
+	default:
+		if s.keys[r] == config.ActionSelectCompletions {
+			s.closeMenu()
+		}
+		return
+	}
+	s.drawMenu()
+}
+
+// insertSelection replaces the completed word with every marked
+// candidate, or the highlighted one if nothing was marked.
+func (s *Shell) insertSelection(m *selectMenu) {
+	var chosen []string
+	for i, candidate := range m.candidates {
+		if m.marked[i] {
+			chosen = append(chosen, candidate)
+		}
+	}
+	if len(chosen) == 0 {
+		chosen = []string{m.candidates[m.cursor]}
+	}
+	for i, candidate := range chosen {
+		if strings.HasSuffix(candidate, " ") {
+			chosen[i] = shellquote.Join(strings.TrimSuffix(candidate, " "))
+		} else {
+			chosen[i] = shellquote.Join(candidate)
+		}
+	}
+
+	head := string(m.line[:m.pos])
+	head = head[:len(head)-len(m.word)]
+	line := head + strings.Join(chosen, " ") + " " + string(m.line[m.pos:])
+	s.reader.SetBuffer(line)
+}
+
+func (s *Shell) drawMenu() {
+	m := s.menu
+	var b strings.Builder
+	b.WriteString(eraseLines(m.drawn))
+	b.WriteString(s.dim("Tab: mark  Enter: insert  Ctrl+G: cancel") + "\n")
+
+	first := 0
+	if m.cursor >= menuHeight {
+		first = m.cursor - menuHeight + 1
+	}
+	last := min(first+menuHeight, len(m.candidates))
+	for i := first; i < last; i++ {
+		pointer, box := "  ", "[ ]"
+		if i == m.cursor {
+			pointer = "> "
+		}
+		if m.marked[i] {
+			box = "[x]"
+		}
+		// Lines must not wrap, or they could not be erased again.
+		candidate := truncate(strings.TrimSuffix(m.candidates[i], " "), s.columns()-7)
+		fmt.Fprintf(&b, "%s%s %s\n", pointer, box, candidate)
+	}
+	m.drawn = 1 + last - first
+	s.reader.Write([]byte(b.String()))
+}
+
+func (s *Shell) closeMenu() {
+	s.reader.Write([]byte(eraseLines(s.menu.drawn)))
+	s.menu = nil
+}
+
+// eraseLines moves the cursor up over n previously printed lines and
+// clears them along with everything below.
+func eraseLines(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\033[%dA\033[J", n)
+}
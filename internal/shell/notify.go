@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"shell/internal/lineedit"
+	"shell/internal/plugin"
+)
+
+// What the shell knows of the focus of the terminal window, from the
+// reports the line editor passes on while it reads a line.
+const (
+	focusUnknown int32 = iota
+	focusIn
+	focusOut
+)
+
+// trackFocus is the line editor's OnFocus callback.
+func (s *Shell) trackFocus(focused bool) {
+	if focused {
+		s.focus.Store(focusIn)
+	} else {
+		s.focus.Store(focusOut)
+	}
+}
+
+// notifyLongCommands hooks into preexec and precmd to send a
+// notification when a command line entered at the prompt ran for at
+// least notify.after. The focus is not reported while a command runs, so
+// these go out whatever it is; most terminals only show them when their
+// window is not focused.
+func (s *Shell) notifyLongCommands() {
+	var start time.Time
+	var line string
+	s.OnPreexec(func(l string) {
+		start, line = time.Now(), l
+		s.focus.Store(focusUnknown)
+	})
+	s.OnPrecmd(func() {
+		if start.IsZero() {
+			return
+		}
+		elapsed := time.Since(start)
+		start = time.Time{}
+		if after := s.config.NotifyAfter(); after > 0 && elapsed >= after {
+			s.notify(fmt.Sprintf("%s finished after %s, exit status %d", line, formatDuration(elapsed), s.lastStatus))
+		}
+	})
+}
+
+// notifyJob sends a notification that a background job finished, if it
+// ran for at least notify.after and the terminal window is not known to
+// have the focus.
+func (s *Shell) notifyJob(job *Job, elapsed time.Duration) {
+	after := s.config.NotifyAfter()
+	if after == 0 || elapsed < after || s.focus.Load() == focusIn {
+		return
+	}
+	s.notify(fmt.Sprintf("[%d] %s: %s after %s", job.ID, strings.Join(job.Args, " "), job.Status(), formatDuration(elapsed)))
+}
+
+// notify sends body as the config's notify.method asks, and to the
+// plugins that deliver notifications.
+func (s *Shell) notify(body string) {
+	const title = "myshell"
+	body = printable(body)
+	if lineedit.IsTerminal(int(os.Stdout.Fd())) {
+		switch s.config.Notify.Method {
+		case "", "osc9":
+			fmt.Printf("\x1b]9;%s\x07", body)
+		case "osc777":
+			fmt.Printf("\x1b]777;notify;%s;%s\x07", title, strings.ReplaceAll(body, ";", ","))
+		case "bell":
+			fmt.Print("\a")
+		}
+	}
+	for _, p := range s.plugins {
+		if n, ok := p.(plugin.Notifier); ok {
+			s.callPlugin(p, "Notify", func() { n.Notify(title, body) })
+		}
+	}
+}
+
+// printable replaces control characters in text with spaces, so it can
+// go in an escape sequence.
+func printable(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,166 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kballard/go-shellquote"
+	"shell/internal/lineedit"
+)
+
+// Shell options, named as in bash's set -o.
+const (
+	// OptionErrexit stops the shell when a command fails.
+	OptionErrexit = "errexit"
+	// OptionXtrace prints each command to stderr before it runs.
+	OptionXtrace = "xtrace"
+	// OptionAutocd makes a directory name typed as a command cd into it.
+	OptionAutocd = "autocd"
+	// OptionCorrect offers to correct misspelt commands and cd targets.
+	OptionCorrect = "correct"
+	// OptionEmacs and OptionVi choose the line editor's keys; setting
+	// one unsets the other.
+	OptionEmacs = "emacs"
+	OptionVi    = "vi"
+	// OptionNullglob removes patterns that match no files, and
+	// OptionFailglob makes them an error, which wins if both are set.
+	// Otherwise such patterns are left as they are.
+	OptionNullglob = "nullglob"
+	OptionFailglob = "failglob"
+)
+
+var optionNames = []string{OptionAutocd, OptionCorrect, OptionEmacs, OptionErrexit, OptionFailglob, OptionNullglob, OptionVi, OptionXtrace}
+
+// optionLetters are the options set -e and set -x stand for.
+var optionLetters = map[byte]string{'e': OptionErrexit, 'x': OptionXtrace}
+
+func (s *Shell) SetOption(name string, on bool) error {
+	switch name {
+	case OptionEmacs, OptionVi:
+		vi := on == (name == OptionVi)
+		s.options[OptionVi], s.options[OptionEmacs] = vi, !vi
+		if vi {
+			s.reader.SetKeymap(lineedit.KeymapVi)
+		} else {
+			s.reader.SetKeymap(lineedit.KeymapEmacs)
+		}
+		return nil
+	}
+	for _, known := range optionNames {
+		if name == known {
+			s.options[name] = on
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: invalid option name", name)
+}
+
+// set turns options on with -o NAME, -e or -x, and off with +o NAME, +e or
+// +x. set -o lists the options, set +o prints the commands that would
+// restore them, and set alone lists the shell's variables. The words
+// after set -- become the positional parameters.
+func (s *Shell) set(args []string) error {
+	if len(args) == 0 {
+		s.listVars()
+		return nil
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			s.args = args[i+1:]
+			return nil
+		}
+		if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			return fmt.Errorf("set: %s: invalid option", arg)
+		}
+		on := arg[0] == '-'
+		if arg[1:] == "o" {
+			if i+1 == len(args) {
+				s.listOptions(on)
+				continue
+			}
+			i++
+			if err := s.SetOption(args[i], on); err != nil {
+				return fmt.Errorf("set: %w", err)
+			}
+			continue
+		}
+		for _, letter := range []byte(arg[1:]) {
+			name, ok := optionLetters[letter]
+			if !ok {
+				return fmt.Errorf("set: %c%c: invalid option", arg[0], letter)
+			}
+			s.SetOption(name, on)
+		}
+	}
+	return nil
+}
+
+func (s *Shell) listOptions(table bool) {
+	for _, name := range optionNames {
+		on := s.options[name]
+		switch {
+		case table && on:
+			fmt.Printf("%-15s\ton\n", name)
+		case table:
+			fmt.Printf("%-15s\toff\n", name)
+		case on:
+			fmt.Printf("set -o %s\n", name)
+		default:
+			fmt.Printf("set +o %s\n", name)
+		}
+	}
+}
+
+// listVars lists the shell's variables, with local ones in place of those
+// they hide.
+func (s *Shell) listVars() {
+	vars := make(map[string]string, len(s.vars))
+	for name, value := range s.vars {
+		vars[name] = value
+	}
+	for _, scope := range s.scopes {
+		for name, value := range scope {
+			vars[name] = value
+		}
+	}
+	printVars(vars)
+}
+
+func printVars(vars map[string]string) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s=%s\n", name, shellquote.Join(vars[name]))
+	}
+}
+
+// keymap returns the line editor keymap the options choose.
+func (s *Shell) keymap() string {
+	if s.options[OptionVi] {
+		return lineedit.KeymapVi
+	}
+	return lineedit.KeymapEmacs
+}
+
+// modeIndicator shows the vi mode in the prompt's {mode} field, as bash's
+// show-mode-in-prompt does.
+func (s *Shell) modeIndicator() string {
+	if s.reader == nil {
+		// The editor is being set up, and starts in insert mode.
+		if s.options[OptionVi] {
+			return "(ins)"
+		}
+		return ""
+	}
+	switch s.reader.Mode() {
+	case lineedit.ModeInsert:
+		return "(ins)"
+	case lineedit.ModeNormal:
+		return "(cmd)"
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"shell/internal/lineedit"
+)
+
+// reportToTerminal hooks into preexec and precmd to tell the terminal
+// emulator the working directory, with OSC 7, and to set its window
+// title to the command line running or, at the prompt, to
+// terminal.prompt_title.
+func (s *Shell) reportToTerminal() {
+	s.OnPreexec(func(line string) {
+		if s.toTerminal() {
+			s.setTitle(s.config.Terminal.Title, line)
+		}
+	})
+	s.OnPrecmd(func() {
+		if !s.toTerminal() {
+			return
+		}
+		if !s.config.Terminal.NoReportDir {
+			s.reportDir()
+		}
+		s.setTitle(s.config.Terminal.PromptTitle, "")
+	})
+}
+
+// toTerminal reports whether escape sequences meant for the terminal
+// emulator can be written: the output goes to one that is not dumb.
+func (s *Shell) toTerminal() bool {
+	return !s.term.Dumb && lineedit.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// reportDir sends the working directory as a file: URL, as terminals
+// expect it in OSC 7.
+func (s *Shell) reportDir() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	host, _ := os.Hostname()
+	u := url.URL{Scheme: "file", Host: host, Path: filepath.ToSlash(dir)}
+	fmt.Printf("\x1b]7;%s\x1b\\", u.String())
+}
+
+// markCommands hooks into preexec and precmd to mark where the output
+// of each command line entered at the prompt starts and where it ends,
+// with its exit status, in the OSC 133 sequences that FinalTerm
+// introduced; markPrompt marks the prompt itself.
+func (s *Shell) markCommands() {
+	ran := false
+	s.OnPreexec(func(string) {
+		if ran = s.markingPrompts(); ran {
+			fmt.Print("\x1b]133;C\x07")
+		}
+	})
+	s.OnPrecmd(func() {
+		if ran && s.markingPrompts() {
+			fmt.Printf("\x1b]133;D;%d\x07", s.lastStatus)
+		}
+		ran = false
+	})
+}
+
+// markPrompt marks where prompt starts and where the command line typed
+// after it starts.
+func (s *Shell) markPrompt(prompt string) string {
+	if !s.markingPrompts() {
+		return prompt
+	}
+	return "\x1b]133;A\x07" + prompt + "\x1b]133;B\x07"
+}
+
+// markingPrompts reports whether prompts and commands are marked. The
+// readline line editor cannot tell the marks take no room, so they are
+// left out with it.
+func (s *Shell) markingPrompts() bool {
+	return !s.config.Terminal.NoMarkPrompts && s.config.LineEditor != "readline" && s.toTerminal()
+}
+
+// setTitle sets the window title from format, with the prompt fields
+// and {command} filled in, unless format is "none".
+func (s *Shell) setTitle(format, command string) {
+	if format == "none" {
+		return
+	}
+	title := s.expandPrompt(format, s.displayDir())
+	title = strings.ReplaceAll(title, "{command}", command)
+	fmt.Printf("\x1b]0;%s\x07", printable(title))
+}
@@ -0,0 +1,161 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+
+	"shell/internal/lineedit"
+)
+
+// paged runs a builtin whose output may be long. When the output goes
+// to a terminal and turns out longer than its height, it is shown
+// through a pager: the config's pager, or else $PAGER, or else the
+// shell's own.
+func (s *Shell) paged(fn func() error) error {
+	if s.config.Pager == "none" || !lineedit.IsTerminal(int(os.Stdout.Fd())) || s.stdinRedirected || !lineedit.IsTerminal(int(os.Stdin.Fd())) {
+		return fn()
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fn()
+	}
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		r.Close()
+		close(done)
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+	err = fn()
+	os.Stdout = stdout
+	w.Close()
+	<-done
+
+	s.updateSize()
+	if displayRows(out.String(), s.columns()) < s.rows() {
+		os.Stdout.Write(out.Bytes())
+		return err
+	}
+	if perr := s.page(out.String()); perr != nil {
+		fmt.Fprintf(os.Stderr, "Error: pager: %v\n", perr)
+		os.Stdout.Write(out.Bytes())
+	}
+	return err
+}
+
+// page shows text through the pager.
+func (s *Shell) page(text string) error {
+	pager := s.config.Pager
+	if pager == "" {
+		pager = os.Getenv("PAGER")
+	}
+	if pager == "" || pager == "internal" {
+		return s.pageInternal(text)
+	}
+	args, err := shellquote.Split(pager)
+	if err != nil || len(args) == 0 {
+		return fmt.Errorf("%q: cannot be parsed", pager)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, exited := err.(*exec.ExitError); exited {
+			// The pager has shown what it could.
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// pageInternal shows text a screenful at a time: space shows the next
+// one, enter the next line, and q (or ctrl-c) stops.
+func (s *Shell) pageInternal(text string) error {
+	restore, err := lineedit.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	cols, height := s.columns(), s.rows()-1
+	lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	shown := 0
+	show := func(rows int) {
+		for ; rows > 0 && shown < len(lines); shown++ {
+			line := strings.TrimSuffix(lines[shown], "\n")
+			rows -= displayRows(line+"\n", cols)
+			fmt.Print(line + "\n")
+		}
+	}
+	show(height)
+	key := make([]byte, 1)
+	for shown < len(lines) {
+		fmt.Print(s.highlight(fmt.Sprintf("--More-- (%d%%)", shown*100/len(lines))))
+		if _, err := os.Stdin.Read(key); err != nil {
+			return err
+		}
+		fmt.Print("\r\x1b[K")
+		switch key[0] {
+		case ' ', 'f':
+			show(height)
+		case '\r', '\n', 'j':
+			show(1)
+		case 'q', 'Q', 3:
+			return nil
+		}
+	}
+	return nil
+}
+
+// displayRows is the number of terminal rows text takes up, its lines
+// wrapping at cols.
+func displayRows(text string, cols int) int {
+	rows := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		width := displayWidth(strings.TrimSuffix(line, "\n"))
+		rows += max(1, (width+cols-1)/cols)
+	}
+	return rows
+}
+
+// env is the env builtin alone, which lists the environment sorted by
+// name, and env --json, which prints it as a JSON object of names and
+// values. With other arguments, it runs the env program.
+func (s *Shell) env(args []string) error {
+	args, asJSON := jsonFlag(args)
+	if asJSON {
+		if len(args) > 0 {
+			return fmt.Errorf("env: --json: too many arguments")
+		}
+		vars := make(map[string]string)
+		for _, kv := range os.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			vars[name] = value
+		}
+		return printJSON(vars)
+	}
+	if len(args) > 0 {
+		return s.runExternal(&stage{args: append([]string{"env"}, args...)}, false)
+	}
+	return s.paged(func() error {
+		vars := os.Environ()
+		sort.Strings(vars)
+		for _, kv := range vars {
+			fmt.Println(kv)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,275 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shell/internal/plugin"
+	"shell/internal/script"
+)
+
+// pluginBuiltin is a command registered by the plugin named owner.
+type pluginBuiltin struct {
+	owner string
+	fn    plugin.Builtin
+}
+
+// AddPlugin initializes p and registers it for the shell's lifecycle
+// hooks. The plugin is also available as a command under its own name,
+// running its Execute method.
+func (s *Shell) AddPlugin(p plugin.Plugin) error {
+	for _, loaded := range s.plugins {
+		if loaded.Name() == p.Name() {
+			return fmt.Errorf("plugin %s is already loaded", p.Name())
+		}
+	}
+	if init, ok := p.(plugin.Initializer); ok {
+		err := s.guard(p.Name(), "Init", func() error {
+			return init.Init(pluginAPI{shell: s, owner: p.Name()})
+		})
+		if err != nil {
+			s.unregisterBuiltins(p.Name())
+			return fmt.Errorf("plugin %s: init: %w", p.Name(), err)
+		}
+	}
+	if _, taken := s.pluginBuiltins[p.Name()]; !taken && !isBuiltin(p.Name()) {
+		s.pluginBuiltins[p.Name()] = pluginBuiltin{owner: p.Name(), fn: func(args []string) error {
+			return p.Execute(args[1:])
+		}}
+	}
+	s.plugins = append(s.plugins, p)
+	if _, ok := p.(plugin.EnvProvider); ok {
+		// Set up the environment anew at the next prompt.
+		s.provided.dir = ""
+	}
+	return nil
+}
+
+// LoadPlugin opens the shared object at path and adds the plugin it exports.
+func (s *Shell) LoadPlugin(path string) (plugin.Plugin, error) {
+	var p plugin.Plugin
+	err := s.guard(path, "load", func() (err error) {
+		p, err = plugin.Load(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.AddPlugin(p); err != nil {
+		return nil, err
+	}
+	s.pluginPaths[p.Name()] = path
+	return p, nil
+}
+
+// LoadScript runs the Lua script at path. All scripts share one engine,
+// which is created with the first script.
+func (s *Shell) LoadScript(path string) error {
+	if s.scripts == nil {
+		s.scripts = script.New(pluginAPI{shell: s, owner: "script"})
+	}
+	return s.scripts.Load(path)
+}
+
+// RemovePlugin shuts a plugin down and forgets it and its builtins. Go
+// cannot unload the code itself, so loading it again reuses it.
+func (s *Shell) RemovePlugin(name string) error {
+	for i, p := range s.plugins {
+		if p.Name() != name {
+			continue
+		}
+		if h, ok := p.(plugin.Shutdowner); ok {
+			s.callPlugin(p, "Shutdown", h.Shutdown)
+		}
+		s.plugins = append(s.plugins[:i], s.plugins[i+1:]...)
+		if _, ok := p.(plugin.EnvProvider); ok {
+			s.provided.dir = ""
+		}
+		s.unregisterBuiltins(name)
+		delete(s.pluginPaths, name)
+		return nil
+	}
+	return fmt.Errorf("plugin %s is not loaded", name)
+}
+
+func (s *Shell) registerBuiltin(owner, name string, fn plugin.Builtin) error {
+	if name == "" || strings.ContainsAny(name, " \t/") {
+		return fmt.Errorf("invalid builtin name %q", name)
+	}
+	if isBuiltin(name) {
+		return fmt.Errorf("%s is a shell builtin", name)
+	}
+	if _, taken := s.pluginBuiltins[name]; taken {
+		return fmt.Errorf("builtin %s is already registered", name)
+	}
+	s.pluginBuiltins[name] = pluginBuiltin{owner: owner, fn: fn}
+	return nil
+}
+
+func (s *Shell) unregisterBuiltins(owner string) {
+	for name, builtin := range s.pluginBuiltins {
+		if builtin.owner == owner {
+			delete(s.pluginBuiltins, name)
+		}
+	}
+}
+
+func (s *Shell) executePluginBuiltin(args []string) (bool, error) {
+	builtin, ok := s.pluginBuiltins[args[0]]
+	if !ok {
+		return false, nil
+	}
+	return true, s.guard(builtin.owner, args[0], func() error {
+		return builtin.fn(args)
+	})
+}
+
+// guard runs fn, turning a panic into an error so a misbehaving plugin
+// cannot take the shell down with it.
+func (s *Shell) guard(owner, what string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin %s: %s panicked: %v", owner, what, r)
+		}
+	}()
+	return fn()
+}
+
+// callPlugin runs a plugin hook, reporting rather than propagating a panic.
+func (s *Shell) callPlugin(p plugin.Plugin, what string, fn func()) {
+	err := s.guard(p.Name(), what, func() error {
+		fn()
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+func (s *Shell) runPreCommand(line string) {
+	for _, p := range s.plugins {
+		if h, ok := p.(plugin.PreCommandHook); ok {
+			stop := s.profiler.track("hook", p.Name()+".OnPreCommand")
+			s.callPlugin(p, "OnPreCommand", func() { h.OnPreCommand(line) })
+			stop()
+		}
+	}
+	if s.scripts != nil {
+		stop := s.profiler.track("hook", "scripts.OnPreCommand")
+		s.scripts.OnPreCommand(line)
+		stop()
+	}
+	s.runPreexec(line)
+}
+
+func (s *Shell) runPostCommand(line string, exitCode int, duration time.Duration) {
+	for _, p := range s.plugins {
+		if h, ok := p.(plugin.PostCommandHook); ok {
+			stop := s.profiler.track("hook", p.Name()+".OnPostCommand")
+			s.callPlugin(p, "OnPostCommand", func() { h.OnPostCommand(line, exitCode, duration) })
+			stop()
+		}
+	}
+	if s.scripts != nil {
+		stop := s.profiler.track("hook", "scripts.OnPostCommand")
+		s.scripts.OnPostCommand(line, exitCode, duration)
+		stop()
+	}
+}
+
+func (s *Shell) shutdownPlugins() {
+	for _, p := range s.plugins {
+		if h, ok := p.(plugin.Shutdowner); ok {
+			s.callPlugin(p, "Shutdown", h.Shutdown)
+		}
+	}
+	if s.scripts != nil {
+		s.scripts.Close()
+	}
+}
+
+// pluginCommand implements the plugin builtin: list, load and unload.
+func (s *Shell) pluginCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("plugin: usage: plugin list | load PATH | unload NAME")
+	}
+	switch args[0] {
+	case "list":
+		for _, p := range s.plugins {
+			path := s.pluginPaths[p.Name()]
+			if path == "" {
+				path = "(built in)"
+			}
+			fmt.Printf("%s\t%s\n", p.Name(), path)
+		}
+		return nil
+	case "load":
+		if len(args) != 2 {
+			return fmt.Errorf("plugin: usage: plugin load PATH")
+		}
+		path := args[1]
+		if !strings.ContainsRune(path, '/') && s.config.PluginsDir != "" {
+			if !strings.HasSuffix(path, ".so") {
+				path += ".so"
+			}
+			path = filepath.Join(s.config.PluginsDir, path)
+		}
+		p, err := s.LoadPlugin(path)
+		if err != nil {
+			return fmt.Errorf("plugin: %w", err)
+		}
+		fmt.Printf("loaded %s\n", p.Name())
+		return nil
+	case "unload":
+		if len(args) != 2 {
+			return fmt.Errorf("plugin: usage: plugin unload NAME")
+		}
+		if err := s.RemovePlugin(args[1]); err != nil {
+			return fmt.Errorf("plugin: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("plugin: %s: unknown subcommand", args[0])
+}
+
+// pluginAPI adapts the shell to plugin.ShellAPI.
+type pluginAPI struct {
+	shell *Shell
+	owner string
+}
+
+func (a pluginAPI) Getenv(name string) string {
+	return os.Getenv(name)
+}
+
+func (a pluginAPI) Setenv(name, value string) error {
+	return os.Setenv(name, value)
+}
+
+func (a pluginAPI) Var(name string) (string, bool) {
+	return a.shell.lookupVar(name)
+}
+
+func (a pluginAPI) SetVar(name, value string) {
+	a.shell.setVar(name, value)
+}
+
+func (a pluginAPI) Cwd() string {
+	dir, _ := os.Getwd()
+	return dir
+}
+
+func (a pluginAPI) History() []string {
+	return a.shell.history.GetAll()
+}
+
+func (a pluginAPI) Execute(command string) error {
+	return a.shell.Execute(command)
+}
+
+func (a pluginAPI) RegisterBuiltin(name string, fn plugin.Builtin) error {
+	return a.shell.registerBuiltin(a.owner, name, fn)
+}
@@ -0,0 +1,124 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const previewLines = 6
+
+func (s *Shell) togglePreview() {
+	s.completer.preview = !s.completer.preview
+	state := "off"
+	if s.completer.preview {
+		state = "on"
+	}
+	fmt.Fprintf(s.reader, "completion preview %s\n", state)
+}
+
+// showPreview prints a short description of the file being completed
+// above the prompt: the only candidate left, or the directory typed so far.
+func (c *completer) showPreview(word string, candidates []string) {
+	var path string
+	switch {
+	case len(candidates) == 1:
+		path = strings.TrimSuffix(candidates[0], " ")
+	case strings.HasSuffix(word, "/"):
+		path = word
+	default:
+		return
+	}
+	path = c.expandPath(path)
+
+	lines := preview(path, c.shell.columns()-4)
+	if len(lines) == 0 {
+		return
+	}
+	var b strings.Builder
+	for i, line := range lines {
+		if i == 0 {
+			b.WriteString(c.shell.dim(line) + "\n")
+		} else {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+	c.shell.reader.Write([]byte(b.String()))
+}
+
+func (s *Shell) dim(text string) string {
+	if !s.term.Color {
+		return text
+	}
+	return "\033[2m" + text + "\033[0m"
+}
+
+// preview describes path in at most previewLines lines, the first being
+// a header: a listing for directories, dimensions for images and the
+// first lines of text files.
+func preview(path string, width int) []string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if width < 20 {
+		width = 20
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %v", path, err)}
+		}
+		lines := []string{fmt.Sprintf("%s: directory, %d entries", path, len(entries))}
+		for _, entry := range entries {
+			if len(lines) == previewLines {
+				lines = append(lines, "...")
+				break
+			}
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			lines = append(lines, truncate(name, width))
+		}
+		return lines
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	defer f.Close()
+
+	if cfg, format, err := image.DecodeConfig(f); err == nil {
+		return []string{fmt.Sprintf("%s: %s image, %dx%d", path, strings.ToUpper(format), cfg.Width, cfg.Height)}
+	}
+
+	head := make([]byte, 4096)
+	n, _ := f.ReadAt(head, 0)
+	head = head[:n]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return []string{fmt.Sprintf("%s: binary file, %d bytes", path, info.Size())}
+	}
+
+	lines := []string{fmt.Sprintf("%s: %d bytes", path, info.Size())}
+	for _, line := range strings.Split(strings.TrimRight(string(head), "\n"), "\n") {
+		if len(lines) == previewLines {
+			break
+		}
+		lines = append(lines, truncate(strings.ReplaceAll(line, "\t", "    "), width))
+	}
+	return lines
+}
+
+func truncate(s string, width int) string {
+	return runewidth.Truncate(s, width, "...")
+}
@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// profiler accumulates the time spent in user customizations (aliases,
+// functions, plugin hooks) so slow ones can be found.
+type profiler struct {
+	enabled bool
+	stats   map[profileKey]*profileStat
+}
+
+type profileKey struct {
+	kind string
+	name string
+}
+
+type profileStat struct {
+	calls int
+	total time.Duration
+	max   time.Duration
+}
+
+// track starts timing one call and returns the function that stops it.
+// It costs nothing but a branch while profiling is off.
+func (p *profiler) track(kind, name string) func() {
+	if !p.enabled {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		key := profileKey{kind, name}
+		stat, ok := p.stats[key]
+		if !ok {
+			stat = &profileStat{}
+			p.stats[key] = stat
+		}
+		stat.calls++
+		stat.total += elapsed
+		stat.max = max(stat.max, elapsed)
+	}
+}
+
+func (s *Shell) profile(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("profile: usage: profile on|off|report|reset")
+	}
+	switch args[0] {
+	case "on":
+		s.profiler.enabled = true
+		if s.profiler.stats == nil {
+			s.profiler.stats = make(map[profileKey]*profileStat)
+		}
+	case "off":
+		s.profiler.enabled = false
+	case "reset":
+		s.profiler.stats = make(map[profileKey]*profileStat)
+	case "report":
+		s.profileReport()
+	default:
+		return fmt.Errorf("profile: %s: invalid argument", args[0])
+	}
+	return nil
+}
+
+func (s *Shell) profileReport() {
+	if len(s.profiler.stats) == 0 {
+		if !s.profiler.enabled {
+			fmt.Println("profiling is off; start it with 'profile on'")
+		} else {
+			fmt.Println("nothing recorded yet")
+		}
+		return
+	}
+
+	keys := make([]profileKey, 0, len(s.profiler.stats))
+	for key := range s.profiler.stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.profiler.stats[keys[i]].total > s.profiler.stats[keys[j]].total
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tCALLS\tTOTAL\tAVG\tMAX")
+	for _, key := range keys {
+		stat := s.profiler.stats[key]
+		avg := stat.total / time.Duration(stat.calls)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", key.kind, key.name, stat.calls,
+			roundDuration(stat.total), roundDuration(avg), roundDuration(stat.max))
+	}
+	w.Flush()
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(time.Microsecond)
+	}
+	return d
+}
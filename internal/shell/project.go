@@ -0,0 +1,212 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shell/internal/config"
+)
+
+// projectCache holds the project files read so far, by directory, so
+// that they are parsed again only when they change.
+type projectCache struct {
+	files map[string]*projectFile
+	// allowTime is when the allow file last changed. When it changes
+	// again, whether each file is allowed is looked up again.
+	allowTime time.Time
+	// declined holds the files the user chose not to use this session,
+	// with the hash of their contents then.
+	declined map[string]string
+}
+
+// projectFile is a project file as it was last read.
+type projectFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	project *config.Project
+	hash    string
+	allowed bool
+}
+
+// projects returns the project configs that apply to the current
+// directory and are allowed, nearest first.
+func (s *Shell) projects() []*config.Project {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	var projects []*config.Project
+	for _, f := range s.findProjects(dir) {
+		if f.allowed {
+			projects = append(projects, f.project)
+		}
+	}
+	return projects
+}
+
+// findProjects returns the project files in dir and the directories above
+// it, nearest first, whether they are allowed or not. Files that cannot
+// be read or parsed are reported, once, and skipped.
+func (s *Shell) findProjects(dir string) []*projectFile {
+	if info, err := os.Stat(s.config.DirEnv.AllowFile); err == nil && !info.ModTime().Equal(s.projectFiles.allowTime) {
+		s.projectFiles.files, s.projectFiles.allowTime = nil, info.ModTime()
+	}
+	var files []*projectFile
+	for {
+		if f := s.readProject(dir); f != nil && f.project != nil {
+			files = append(files, f)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return files
+		}
+		dir = parent
+	}
+}
+
+// readProject returns the project file in dir, or nil if there is none.
+// It is read again only if it has changed since the last time.
+func (s *Shell) readProject(dir string) *projectFile {
+	path := filepath.Join(dir, config.ProjectFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(s.projectFiles.files, dir)
+		return nil
+	}
+	f, ok := s.projectFiles.files[dir]
+	if ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+		return f
+	}
+
+	f = &projectFile{path: path, modTime: info.ModTime(), size: info.Size()}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		f.project, err = config.ParseProject(dir, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", path, err)
+	} else {
+		f.hash = hashFile(data)
+		f.allowed = s.allowed(path, f.hash)
+	}
+	if s.projectFiles.files == nil {
+		s.projectFiles.files = make(map[string]*projectFile)
+	}
+	s.projectFiles.files[dir] = f
+	return f
+}
+
+// checkProjects is a precmd hook: it asks whether to use the project
+// files that apply to the current directory and are not allowed yet,
+// once for each version of a file. Until they are allowed, their
+// settings are ignored.
+func (s *Shell) checkProjects() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for _, f := range s.findProjects(dir) {
+		if f.allowed || s.projectFiles.declined[f.path] == f.hash {
+			continue
+		}
+		if !s.confirm(fmt.Sprintf("project: use %s, %s [yN]? ", f.path, describeProject(f.project))) {
+			if s.projectFiles.declined == nil {
+				s.projectFiles.declined = make(map[string]string)
+			}
+			s.projectFiles.declined[f.path] = f.hash
+			fmt.Fprintf(os.Stderr, "project: %s not used; project allow uses it\n", f.path)
+			continue
+		}
+		if err := s.setProjectAllowed(f.path, f.hash); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: project: %v\n", err)
+		}
+	}
+}
+
+// describeProject says what using a project file changes.
+func describeProject(p *config.Project) string {
+	var changes []string
+	if len(p.Aliases) > 0 {
+		changes = append(changes, "defining "+strings.Join(sortedKeys(p.Aliases), " "))
+	}
+	if p.Container != "" {
+		changes = append(changes, "running commands in a container of "+p.Container)
+	}
+	if len(changes) == 0 {
+		return "which changes nothing"
+	}
+	return strings.Join(changes, " and ")
+}
+
+// setProjectAllowed records whether the project file at path may be used,
+// as setAllowed does, and forgets the files read so that they are looked
+// up again.
+func (s *Shell) setProjectAllowed(path, hash string) error {
+	if err := s.setAllowed(path, hash); err != nil {
+		return err
+	}
+	s.projectFiles.files = nil
+	return nil
+}
+
+// projectCommand is the project builtin. Alone it lists the project files
+// that apply here; project allow [FILE] lets the shell use one, the
+// nearest by default, and project deny [FILE] takes that back.
+func (s *Shell) projectCommand(args []string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("project: %w", err)
+	}
+	files := s.findProjects(dir)
+	if len(args) == 0 {
+		if len(files) == 0 {
+			fmt.Println("no project file applies here")
+		}
+		for _, f := range files {
+			state := "allowed"
+			if !f.allowed {
+				state = "not allowed"
+			}
+			fmt.Printf("%s (%s)\n", f.path, state)
+		}
+		return nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("project: too many arguments")
+	}
+	if args[0] != "allow" && args[0] != "deny" {
+		return fmt.Errorf("project: %s: unknown command, expected allow or deny", args[0])
+	}
+
+	var path string
+	switch {
+	case len(args) == 2:
+		if path, err = filepath.Abs(args[1]); err != nil {
+			return fmt.Errorf("project: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, config.ProjectFile)
+		}
+	case len(files) > 0:
+		path = files[0].path
+	default:
+		return fmt.Errorf("project: no project file applies here")
+	}
+
+	hash := ""
+	if args[0] == "allow" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("project: %w", err)
+		}
+		hash = hashFile(data)
+	}
+	if err := s.setProjectAllowed(path, hash); err != nil {
+		return fmt.Errorf("project: %w", err)
+	}
+	return nil
+}
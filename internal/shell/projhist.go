@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"shell/internal/history"
+)
+
+// projectHistory returns the history of the git repository containing
+// the working directory, opening it on first use. It returns nil when
+// project histories are off or the shell is outside a repository.
+func (s *Shell) projectHistory() history.History {
+	if !s.config.History.Project {
+		return nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	root, ok := gitRoot(dir)
+	if !ok {
+		return nil
+	}
+	h, ok := s.projectHistories[root]
+	if !ok {
+		file := projectHistoryFile(s.config.History.ProjectDir, root)
+		h, err = history.NewFile(file, historyOptions(s.config))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening project history: %v\n", err)
+		}
+		// Failures are remembered too, so they are reported once.
+		s.projectHistories[root] = h
+	}
+	if h == nil {
+		return nil
+	}
+	return h
+}
+
+// addHistory records line in the global history and in the history of
+// the current project, and returns a function that completes both
+// entries once the command has run.
+func (s *Shell) addHistory(line string) func(exitCode int, duration time.Duration) {
+	s.history.Add(line)
+	project := s.projectHistory()
+	if project != nil {
+		project.Add(line)
+	}
+	return func(exitCode int, duration time.Duration) {
+		s.history.Finish(exitCode, duration)
+		if project != nil {
+			project.Finish(exitCode, duration)
+		}
+	}
+}
+
+func (s *Shell) closeProjectHistories() {
+	for _, h := range s.projectHistories {
+		if h != nil {
+			h.Close()
+		}
+	}
+}
+
+// projectHistoryFile names a project's history file after the project
+// directory, plus a hash of its full path to tell apart projects with
+// the same name.
+func projectHistoryFile(dir, root string) string {
+	sum := sha1.Sum([]byte(root))
+	return filepath.Join(dir, filepath.Base(root)+"-"+hex.EncodeToString(sum[:4])+".history")
+}
+
+// gitRoot returns the nearest directory at or above dir that contains a
+// .git directory or file.
+func gitRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
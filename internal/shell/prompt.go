@@ -0,0 +1,104 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var promptField = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// formatPrompt fills in the {field} placeholders of a prompt format; see
+// config.PromptFields.
+func (s *Shell) formatPrompt(format string) string {
+	return s.fitPrompt(func(cwd string) string { return s.expandPrompt(format, cwd) })
+}
+
+// fitPrompt draws a prompt with render, given the directory to show as
+// {cwd}. When the prompt would take more than half the terminal's width,
+// the directory is shortened to leave room for the command.
+func (s *Shell) fitPrompt(render func(cwd string) string) string {
+	dir := s.displayDir()
+	prompt := render(dir)
+	if excess := displayWidth(prompt) - s.columns()/2; excess > 0 {
+		prompt = render(shortenDir(dir, displayWidth(dir)-excess))
+	}
+	return prompt
+}
+
+func (s *Shell) expandPrompt(format, cwd string) string {
+	return promptField.ReplaceAllStringFunc(format, func(field string) string {
+		if value, ok := s.promptValue(field[1:len(field)-1], cwd); ok {
+			return value
+		}
+		return field
+	})
+}
+
+// promptValue returns the value of a prompt field, with cwd as {cwd}.
+func (s *Shell) promptValue(field, cwd string) (string, bool) {
+	switch field {
+	case "user":
+		if u, err := user.Current(); err == nil {
+			return u.Username, true
+		}
+		return os.Getenv("USER"), true
+	case "host":
+		host, _ := os.Hostname()
+		host, _, _ = strings.Cut(host, ".")
+		return host, true
+	case "cwd":
+		return cwd, true
+	case "dir":
+		return filepath.Base(s.displayDir()), true
+	case "status":
+		return strconv.Itoa(s.lastStatus), true
+	case "time":
+		return time.Now().Format("15:04:05"), true
+	case "mode":
+		return s.modeIndicator(), true
+	case "duration":
+		if s.lastDuration > 0 {
+			return formatDuration(s.lastDuration), true
+		}
+		return "", true
+	case "git", "kube":
+		return s.slowValue(field, slowFields[field]), true
+	}
+	return "", false
+}
+
+// displayDir is the working directory with the home directory shown as ~.
+func (s *Shell) displayDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "?"
+	}
+	home := s.config.HomeDir
+	if home != "" && (dir == home || strings.HasPrefix(dir, home+string(filepath.Separator))) {
+		return "~" + dir[len(home):]
+	}
+	return dir
+}
+
+// applyEnv exports the config's environment variables, in name order so
+// values referring to each other expand predictably.
+func applyEnv(env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := os.Setenv(name, os.ExpandEnv(env[name])); err != nil {
+			return fmt.Errorf("env %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"shell/internal/lineedit"
+)
+
+func (s *Shell) read(args []string) error {
+	var prompt string
+	silent, raw := false, false
+options:
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		flag := args[0]
+		args = args[1:]
+		switch flag {
+		case "-p":
+			if len(args) == 0 {
+				return fmt.Errorf("read: -p: option requires an argument")
+			}
+			prompt, args = args[0], args[1:]
+		case "-s":
+			silent = true
+		case "-r":
+			raw = true
+		case "--":
+			break options
+		default:
+			return fmt.Errorf("read: %s: invalid option", flag)
+		}
+	}
+
+	names := args
+	if len(names) == 0 {
+		names = []string{"REPLY"}
+	}
+	for _, name := range names {
+		if !isVarName(name) {
+			return fmt.Errorf("read: `%s': not a valid identifier", name)
+		}
+	}
+
+	line, err := s.readLine(prompt, silent)
+	if err != nil {
+		if err == io.EOF || err == lineedit.ErrInterrupt {
+			return ExitStatus(1)
+		}
+		return fmt.Errorf("read: %w", err)
+	}
+	// Without -r, a line ending in a backslash continues on the next.
+	var chars []rune
+	var escaped []bool
+	for {
+		c, e, more := unescapeRead(line, raw)
+		chars, escaped = append(chars, c...), append(escaped, e...)
+		if !more {
+			break
+		}
+		if line, err = s.readLine("", silent); err != nil {
+			break
+		}
+	}
+
+	fields := readFields(chars, escaped, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(fields) {
+			value = fields[i]
+		}
+		if err := s.setVar(name, value); err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+	}
+	return nil
+}
+
+// unescapeRead returns the characters of a line read and which of them
+// were escaped. Unless raw, a backslash escapes the character after it
+// and is removed, and one at the end of the line is removed and reported
+// as the line continuing.
+func unescapeRead(line string, raw bool) (chars []rune, escaped []bool, more bool) {
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		if raw || runes[i] != '\\' {
+			chars, escaped = append(chars, runes[i]), append(escaped, false)
+			continue
+		}
+		if i++; i == len(runes) {
+			return chars, escaped, true
+		}
+		chars, escaped = append(chars, runes[i]), append(escaped, true)
+	}
+	return chars, escaped, false
+}
+
+// readFields splits what read read into at most n fields at blanks that
+// were not escaped. The last field takes the rest of the line, without
+// the blanks around it.
+func readFields(chars []rune, escaped []bool, n int) []string {
+	blank := func(i int) bool {
+		return !escaped[i] && (chars[i] == ' ' || chars[i] == '\t')
+	}
+	var fields []string
+	i := 0
+	for len(fields) < n {
+		for i < len(chars) && blank(i) {
+			i++
+		}
+		if i == len(chars) {
+			break
+		}
+		start := i
+		if len(fields) == n-1 {
+			i = len(chars)
+			for blank(i - 1) {
+				i--
+			}
+		} else {
+			for i < len(chars) && !blank(i) {
+				i++
+			}
+		}
+		fields = append(fields, string(chars[start:i]))
+	}
+	return fields
+}
+
+// readLine reads one line through the shell's line editor so that
+// input typed ahead of, or piped into, the shell is shared with it.
+func (s *Shell) readLine(prompt string, silent bool) (string, error) {
+	if s.stdinRedirected {
+		return readRawLine(os.Stdin)
+	}
+	if silent && s.reader.IsTerminal() {
+		return s.reader.ReadPassword(prompt)
+	}
+
+	s.reader.HistoryDisable()
+	defer s.reader.HistoryEnable()
+	s.reader.SetPrompt(prompt)
+	defer s.reader.SetPrompt(s.prompt())
+	return s.reader.Readline()
+}
+
+// readRawLine reads a line from a redirected input a byte at a time, so
+// none of what follows it is consumed.
+func readRawLine(f *os.File) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := f.Read(b)
+		if n == 1 && b[0] != '\n' {
+			line = append(line, b[0])
+			continue
+		}
+		if n == 1 || len(line) > 0 && err == io.EOF {
+			return string(line), nil
+		}
+		if err == nil {
+			continue
+		}
+		return "", err
+	}
+}
@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+)
+
+// recordBuiltin handles record start FILE, which records the session,
+// everything typed and shown on the terminal with its timing, to FILE
+// for myshell replay, record stop and record on its own, which says
+// whether a recording is running.
+func (s *Shell) recordBuiltin(args []string) error {
+	switch {
+	case len(args) == 0:
+		if s.recording == nil {
+			fmt.Println("not recording")
+		} else {
+			fmt.Printf("recording to %s\n", s.recording.file)
+		}
+		return nil
+	case args[0] == "start" && len(args) == 2:
+		if s.recording != nil {
+			return fmt.Errorf("record: already recording to %s", s.recording.file)
+		}
+		rec, err := startRecording(args[1])
+		if err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		s.recording = rec
+		return nil
+	case args[0] == "stop" && len(args) == 1:
+		if s.recording == nil {
+			return fmt.Errorf("record: not recording")
+		}
+		return s.stopRecording()
+	default:
+		return fmt.Errorf("record: usage: record [start FILE | stop]")
+	}
+}
+
+func (s *Shell) stopRecording() error {
+	rec := s.recording
+	s.recording = nil
+	if err := rec.stop(); err != nil {
+		return fmt.Errorf("record: %s: %w", rec.file, err)
+	}
+	fmt.Fprintf(os.Stderr, "Recorded to %s\n", rec.file)
+	return nil
+}
@@ -0,0 +1,222 @@
+package shell
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"shell/internal/lineedit"
+	"shell/internal/record"
+)
+
+// recording puts a pseudo-terminal between the shell and the terminal,
+// so that everything the shell and its commands write and read passes
+// through the shell to be recorded. The pseudo-terminal takes over
+// descriptors 0 to 2, which commands inherit, while the terminal itself
+// is kept in raw mode and its descriptors saved for the shell to copy
+// to and from.
+type recording struct {
+	file   string
+	rec    *record.Recorder
+	master *os.File
+	// in and out are the terminal.
+	in, out *os.File
+	// saved are the terminal's descriptors 0 to 2 and mode, to put back.
+	saved   [3]int
+	termios *unix.Termios
+	winch   chan os.Signal
+	// outDone and inDone are closed when the copying stops.
+	outDone, inDone chan struct{}
+}
+
+func startRecording(file string) (*recording, error) {
+	if !lineedit.IsTerminal(0) || !lineedit.IsTerminal(1) {
+		return nil, errors.New("not a terminal")
+	}
+	termios, err := unix.IoctlGetTermios(0, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := unix.IoctlGetWinsize(1, unix.TIOCGWINSZ)
+	if err != nil {
+		return nil, err
+	}
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+	// The pseudo-terminal starts out like the terminal.
+	unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, termios)
+	unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, ws)
+
+	rec, err := record.Create(file, int(ws.Col), int(ws.Row))
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	r := &recording{file: file, rec: rec, master: master, termios: termios,
+		winch: make(chan os.Signal, 1), outDone: make(chan struct{}), inDone: make(chan struct{})}
+	for fd := range r.saved {
+		if r.saved[fd], err = unix.Dup(fd); err == nil {
+			unix.CloseOnExec(r.saved[fd])
+			err = dup2(int(slave.Fd()), fd)
+		}
+		if err != nil {
+			r.restore(fd)
+			master.Close()
+			rec.Close()
+			return nil, err
+		}
+	}
+
+	raw := *termios
+	raw.Iflag &^= unix.ICRNL | unix.INLCR | unix.IGNCR | unix.IXON | unix.ISTRIP
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	unix.IoctlSetTermios(r.saved[0], unix.TCSETS, &raw)
+	// Non-blocking, the terminal can be read with a deadline, so that
+	// stop can end the read without waiting for a key.
+	unix.SetNonblock(r.saved[0], true)
+	r.in = os.NewFile(uintptr(r.saved[0]), "terminal")
+	r.out = os.NewFile(uintptr(r.saved[1]), "terminal")
+
+	go r.copyOutput()
+	go r.copyInput()
+	signal.Notify(r.winch, syscall.SIGWINCH)
+	go r.resize()
+	return r, nil
+}
+
+// openPty opens a new pseudo-terminal, returning its two ends.
+func openPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err == nil {
+		// 0 unlocks the other end, so that it can be opened.
+		err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0)
+	}
+	if err == nil {
+		slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// copyOutput shows and records what is written to the pseudo-terminal.
+func (r *recording) copyOutput() {
+	defer close(r.outDone)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.master.Read(buf)
+		if n > 0 {
+			r.out.Write(buf[:n])
+			r.rec.Output(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// copyInput passes what is typed on to the pseudo-terminal and records
+// it. The terminal's signal keys are sent as signals, as the terminal
+// would, when the pseudo-terminal would make signals of them: it cannot
+// itself, as commands are not in a session of its own.
+func (r *recording) copyInput() {
+	defer close(r.inDone)
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.in.Read(buf)
+		if n > 0 {
+			r.rec.Input(buf[:n])
+			r.sendInput(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *recording) sendInput(p []byte) {
+	mode, err := unix.IoctlGetTermios(int(r.master.Fd()), unix.TCGETS)
+	if err != nil || mode.Lflag&unix.ISIG == 0 {
+		r.master.Write(p)
+		return
+	}
+	start := 0
+	for i, c := range p {
+		var sig syscall.Signal
+		switch c {
+		case mode.Cc[unix.VINTR]:
+			sig = syscall.SIGINT
+		case mode.Cc[unix.VQUIT]:
+			sig = syscall.SIGQUIT
+		case mode.Cc[unix.VSUSP]:
+			sig = syscall.SIGTSTP
+		default:
+			continue
+		}
+		r.master.Write(p[start:i])
+		start = i + 1
+		if pgrp, err := unix.IoctlGetInt(r.saved[0], unix.TIOCGPGRP); err == nil {
+			syscall.Kill(-pgrp, sig)
+		}
+	}
+	r.master.Write(p[start:])
+}
+
+// resize passes the terminal's size on to the pseudo-terminal.
+func (r *recording) resize() {
+	for range r.winch {
+		ws, err := unix.IoctlGetWinsize(r.saved[1], unix.TIOCGWINSZ)
+		if err != nil {
+			continue
+		}
+		unix.IoctlSetWinsize(int(r.master.Fd()), unix.TIOCSWINSZ, ws)
+		r.rec.Resize(int(ws.Col), int(ws.Row))
+	}
+}
+
+// stop puts the terminal back and finishes the recording.
+func (r *recording) stop() error {
+	signal.Stop(r.winch)
+	close(r.winch)
+
+	r.in.SetReadDeadline(time.Now())
+	<-r.inDone
+	// The terminal's descriptors share their mode flags with the saved
+	// copies.
+	unix.SetNonblock(r.saved[0], false)
+	r.restore(len(r.saved))
+	unix.IoctlSetTermios(0, unix.TCSETS, r.termios)
+
+	// Background jobs may still hold the pseudo-terminal open, so what
+	// is left of the output is read for a moment rather than to the end.
+	r.master.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	<-r.outDone
+	r.master.Close()
+	r.in.Close()
+	r.out.Close()
+	unix.Close(r.saved[2])
+	return r.rec.Close()
+}
+
+// restore puts the saved descriptors below n back.
+func (r *recording) restore(n int) {
+	for fd := 0; fd < n; fd++ {
+		dup2(r.saved[fd], fd)
+	}
+}
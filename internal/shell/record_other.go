@@ -0,0 +1,18 @@
+//go:build !linux
+
+package shell
+
+import "errors"
+
+// Recording needs a pseudo-terminal, which is only set up on Linux.
+type recording struct {
+	file string
+}
+
+func startRecording(file string) (*recording, error) {
+	return nil, errors.New("recording is only supported on Linux")
+}
+
+func (r *recording) stop() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDuplicateRedirects(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	if err := os.WriteFile(in, []byte("input\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"say o > out; warn e > out 2>&1", "e\n"},
+		{"say o >> out 2>&1; warn e >> out 2>&1", "o\ne\n"},
+		{"say o 3> out 1>&3", "o\n"},
+		{"to 4 o 4> out", "o\n"},
+		{"to 5 o 4> out 5>&4", "o\n"},
+		{"warn e >& out", "e\n"},
+		{"upper 3< in <&3 > out", "INPUT\n"},
+		{"say o > out 2>&1 1>&-", ""},
+	}
+	for _, tt := range tests {
+		e := &fakeExecutor{}
+		s := newTestShell(t, e)
+		os.Remove(out)
+		if err := s.Execute(tt.line); err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: out holds %q, want %q", tt.line, data, tt.want)
+		}
+	}
+}
+
+func TestDuplicateOrder(t *testing.T) {
+	e := &fakeExecutor{}
+	s := newTestShell(t, e)
+	out := filepath.Join(t.TempDir(), "out")
+
+	// Standard error goes where standard output went before it was
+	// redirected.
+	if err := s.Execute("warn e 2>&1 > " + out); err != nil {
+		t.Fatal(err)
+	}
+	cmd := e.command(t, "warn")
+	if cmd.Stderr != os.Stdout {
+		t.Errorf("2>&1 >out: standard error is %v, want the shell's standard output", cmd.Stderr)
+	}
+	if f, ok := cmd.Stdout.(*os.File); !ok || f.Name() != out {
+		t.Errorf("2>&1 >out: standard output is %v, want %s", cmd.Stdout, out)
+	}
+
+	// A closed standard file reads and writes nothing.
+	if err := s.Execute("say o >&- <&-"); err != nil {
+		t.Fatal(err)
+	}
+	cmd = e.command(t, "say")
+	for _, f := range []any{cmd.Stdin, cmd.Stdout} {
+		if f, ok := f.(*os.File); !ok || f.Name() != os.DevNull {
+			t.Errorf(">&- <&-: file is %v, want %s", f, os.DevNull)
+		}
+	}
+	// A closed descriptor above 2 is not passed on.
+	if err := s.Execute("to 3 o 3>" + out + " 3>&-"); exitCode(err) != 1 {
+		t.Errorf("to 3 with 3 closed: %v, want exit status 1", err)
+	}
+}
+
+func TestDuplicateErrors(t *testing.T) {
+	s := newTestShell(t, &fakeExecutor{})
+	for _, line := range []string{
+		"say o 1>&7",
+		"say o 10>out",
+		"say o 2>&x",
+	} {
+		if err := s.Execute(line); err == nil {
+			t.Errorf("%s did not fail", line)
+		}
+	}
+}
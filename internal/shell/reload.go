@@ -0,0 +1,105 @@
+package shell
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"shell/internal/config"
+)
+
+// reload re-reads the config file the shell started with and applies it:
+// aliases, hooks, environment, prompt settings, key bindings and history
+// options take effect at once.
+// Plugins and scripts are only loaded at startup, so changes to their
+// directories need a new shell.
+func (s *Shell) reload(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("reload: too many arguments")
+	}
+	if s.config.Path == "" {
+		return fmt.Errorf("reload: the shell was started without a config file")
+	}
+	cfg, err := config.Load(s.config.Path)
+	if err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+	old := s.config
+
+	// Aliases defined at the prompt survive; those from the old config
+	// are replaced by the new config's.
+	for name, value := range old.Aliases {
+		if s.aliases[name] == value {
+			delete(s.aliases, name)
+		}
+	}
+	for name, value := range cfg.Aliases {
+		s.aliases[name] = value
+	}
+
+	// Likewise for suffix aliases and hooks.
+	for ext, value := range old.SuffixAliases {
+		if s.suffixes[ext] == value {
+			delete(s.suffixes, ext)
+		}
+	}
+	for ext, value := range cfg.SuffixAliases {
+		s.suffixes[ext] = value
+	}
+	oldHooks, newHooks := configHooks(old), configHooks(cfg)
+	for _, event := range hookEvents {
+		s.hooks[event] = slices.DeleteFunc(s.hooks[event], func(command string) bool {
+			return slices.Contains(oldHooks[event], command)
+		})
+		for _, command := range newHooks[event] {
+			if !slices.Contains(s.hooks[event], command) {
+				s.hooks[event] = append(s.hooks[event], command)
+			}
+		}
+	}
+
+	if cfg.HistoryFile != old.HistoryFile || !reflect.DeepEqual(cfg.History, old.History) {
+		hist, err := openHistory(cfg)
+		if err != nil {
+			return fmt.Errorf("reload: history: %w", err)
+		}
+		s.history.Close()
+		s.history = hist
+		s.closeProjectHistories()
+		for root := range s.projectHistories {
+			delete(s.projectHistories, root)
+		}
+		s.reloadEditorHistory()
+	}
+
+	if err := applyEnv(cfg.Env); err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+	if cfg.AutoCD != old.AutoCD {
+		s.options[OptionAutocd] = cfg.AutoCD
+	}
+	if cfg.Correct != old.Correct {
+		s.options[OptionCorrect] = cfg.Correct
+	}
+	if cfg.CaptureOutput.Keep != old.CaptureOutput.Keep {
+		s.outputs = s.outputs.resize(cfg.CaptureOutput.Keep)
+	}
+	if cfg.Theme != old.Theme {
+		s.theme = cfg.Theme
+	}
+	if cfg.EditingMode != old.EditingMode {
+		s.SetOption(OptionVi, cfg.EditingMode == "vi")
+	}
+	// Keys bound at the prompt stay bound.
+	keys, oldKeys := bindKeys(cfg), bindKeys(old)
+	for r, binding := range s.keys {
+		if oldKeys[r] != binding {
+			keys[r] = binding
+		}
+	}
+	s.keys = keys
+	s.term.ScreenReader = cfg.ScreenReader
+	s.config = cfg
+	fmt.Printf("Reloaded %s\n", cfg.Path)
+	return nil
+}
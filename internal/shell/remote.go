@@ -0,0 +1,99 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"shell/internal/executor"
+)
+
+// remoteBuiltin handles remote connect HOST, after which external
+// commands run on HOST over SSH and cd changes the remote directory,
+// remote disconnect, which goes back to running them locally, and
+// remote on its own, which says where they run.
+func (s *Shell) remoteBuiltin(args []string) error {
+	switch {
+	case len(args) == 0:
+		if s.remote == nil {
+			fmt.Println("not connected")
+		} else {
+			fmt.Printf("connected to %s:%s\n", s.remote.Host, s.remote.Dir)
+		}
+		return nil
+	case args[0] == "connect" && len(args) == 2:
+		if !executor.ValidHost(args[1]) {
+			return fmt.Errorf("remote: %s: invalid host name", args[1])
+		}
+		ssh := &executor.SSH{Host: args[1]}
+		dir, err := ssh.Pwd(context.Background(), "")
+		if err != nil {
+			return fmt.Errorf("remote: %s: %w", args[1], err)
+		}
+		ssh.Dir = dir
+		if s.remote != nil {
+			s.remote.Close()
+		} else {
+			s.localExecutor = s.executor
+		}
+		s.remote = ssh
+		s.executor = ssh
+		return nil
+	case args[0] == "disconnect" && len(args) == 1:
+		if s.remote == nil {
+			return fmt.Errorf("remote: not connected")
+		}
+		s.remote.Close()
+		s.remote = nil
+		s.executor = s.localExecutor
+		return nil
+	default:
+		return fmt.Errorf("remote: usage: remote [connect HOST | disconnect]")
+	}
+}
+
+// remoteCd changes the remote working directory, with no argument to the
+// login directory. cd - goes back to the one before.
+func (s *Shell) remoteCd(args []string) error {
+	dir := ""
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if dir == "-" {
+		if s.prevDir == "" {
+			return fmt.Errorf("cd: OLDPWD not set")
+		}
+		dir = s.prevDir
+	}
+	wd, err := s.remote.Pwd(context.Background(), dir)
+	if err != nil {
+		return fmt.Errorf("cd: %w", err)
+	}
+	if len(args) > 0 && args[0] == "-" {
+		fmt.Println(wd)
+	}
+	s.prevDir, s.remote.Dir = s.remote.Dir, wd
+	return nil
+}
+
+// isRemoteHost reports whether a command word is @HOST, which runs the
+// rest of the command on HOST.
+func isRemoteHost(word string) bool {
+	return len(word) > 1 && strings.HasPrefix(word, "@")
+}
+
+// applyRemoteHost handles @HOST COMMAND [ARG...], which runs a command on
+// HOST over SSH, in its login directory. Every command is run there,
+// even one the shell has as a builtin.
+func (s *Shell) applyRemoteHost(st *stage) error {
+	if len(st.args) < 2 {
+		return fmt.Errorf("%s: usage: @HOST COMMAND [ARG...]", st.args[0])
+	}
+	if !executor.ValidHost(st.args[0][1:]) {
+		return fmt.Errorf("%s: invalid host name", st.args[0])
+	}
+	st.executor = &executor.SSH{Host: st.args[0][1:]}
+	st.args = st.args[1:]
+	st.builtin = false
+	return nil
+}
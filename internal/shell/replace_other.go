@@ -0,0 +1,30 @@
+//go:build !windows
+
+package shell
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// replaceProcess runs path in place of the shell, with files as its
+// descriptors from 0 on. A nil file leaves the descriptor as it is. It
+// only returns if the command could not be run.
+func replaceProcess(path string, args, env []string, files []*os.File) error {
+	for fd, f := range files {
+		if f == nil {
+			continue
+		}
+		if old := int(f.Fd()); old != fd {
+			if err := dup2(old, fd); err != nil {
+				return err
+			}
+		} else if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, 0); err != nil {
+			// Files the shell opens are closed on exec unless told not
+			// to be.
+			return err
+		}
+	}
+	return unix.Exec(path, args, env)
+}
@@ -0,0 +1,26 @@
+package shell
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// replaceProcess runs path as the shell's last command: Windows cannot
+// replace a process with another, so the shell waits for it and exits
+// with its status. Descriptors past 2 are not passed on.
+func replaceProcess(path string, args, env []string, files []*os.File) error {
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = files[0], files[1], files[2]
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
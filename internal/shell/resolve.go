@@ -0,0 +1,50 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// isCommandBuiltin reports whether name is run by the shell itself, as
+// one of its builtins or one a plugin registered.
+func (s *Shell) isCommandBuiltin(name string) bool {
+	_, plugin := s.pluginBuiltins[name]
+	return isBuiltin(name) || plugin
+}
+
+// resolveCommand is the last chance for a command with no executable
+// behind it: with autocd a directory is changed into, a file with a
+// suffix alias is opened with the alias's command, and otherwise a
+// correction may be offered.
+func (s *Shell) resolveCommand(args []string) ([]string, error) {
+	name := args[0]
+	if _, err := exec.LookPath(name); err == nil {
+		return args, nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		if s.options[OptionCorrect] && s.interactive {
+			return s.correctCommand(args)
+		}
+		return args, nil
+	}
+	if info.IsDir() {
+		if s.options[OptionAutocd] && len(args) == 1 {
+			return []string{"cd", name}, nil
+		}
+		return args, nil
+	}
+
+	value, ok := s.suffixes[strings.TrimPrefix(filepath.Ext(name), ".")]
+	if !ok {
+		return args, nil
+	}
+	words, err := s.aliasWords(value)
+	if err != nil {
+		return nil, fmt.Errorf("suffix alias %s: %w", filepath.Ext(name), err)
+	}
+	return append(words, args...), nil
+}
@@ -0,0 +1,61 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"shell/internal/executor"
+)
+
+// applySandbox handles sandbox [--network] [--writable PATH]... COMMAND
+// [ARG...], which runs an external command, in the foreground or as a
+// job, where it cannot change files or reach the network, on top of what
+// the config's sandbox section allows.
+func (s *Shell) applySandbox(st *stage) error {
+	sb := s.sandboxPolicy()
+	args := st.args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		switch {
+		case args[0] == "--network":
+			sb.Network = true
+			args = args[1:]
+		case args[0] == "--writable" && len(args) > 1:
+			sb.Writable = append(sb.Writable, args[1])
+			args = args[2:]
+		default:
+			return fmt.Errorf("sandbox: %s: invalid option", args[0])
+		}
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("sandbox: usage: sandbox [--network] [--writable PATH]... COMMAND [ARG...]")
+	}
+	name := args[0]
+	if s.isCommandBuiltin(name) && !isWrapper(name) {
+		return fmt.Errorf("sandbox: %s: only external commands can be sandboxed", name)
+	}
+
+	st.args = args
+	st.builtin = isWrapper(name)
+	st.sandbox = sb
+	return nil
+}
+
+// sandboxPolicy returns the sandbox the config sets up.
+func (s *Shell) sandboxPolicy() *executor.Sandbox {
+	cfg := s.config.Sandbox
+	sb := &executor.Sandbox{Network: cfg.Network}
+	for _, path := range cfg.Writable {
+		sb.Writable = append(sb.Writable, os.ExpandEnv(path))
+	}
+	return sb
+}
+
+// alwaysSandboxed reports whether the config's sandbox.commands names the
+// command, by its name or its path.
+func (s *Shell) alwaysSandboxed(name string) bool {
+	commands := s.config.Sandbox.Commands
+	return slices.Contains(commands, name) || slices.Contains(commands, filepath.Base(name))
+}
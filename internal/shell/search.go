@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"strings"
+	"unicode"
+
+	"shell/internal/config"
+	"shell/internal/history"
+	"shell/internal/lineedit"
+)
+
+// historySearch is a reverse incremental search through the history,
+// opened with Ctrl+R. Like the completion menu it is drawn above the
+// prompt and driven by filterKey. Inside a project with its own history
+// the search starts there; the search-scope key (Ctrl+T) switches
+// between it and the global history.
+type historySearch struct {
+	project  history.History
+	global   bool
+	commands []string
+	query    []rune
+	// match is the index in commands of the current match, or -1.
+	match   int
+	failing bool
+	drawn   int
+}
+
+func (s *Shell) openSearch() {
+	h := &historySearch{project: s.projectHistory(), match: -1}
+	h.global = h.project == nil
+	s.search = h
+	s.loadSearch()
+	s.drawSearch()
+}
+
+// loadSearch fills the search with the commands of its current scope.
+func (s *Shell) loadSearch() {
+	h := s.search
+	if h.global {
+		h.commands = s.history.GetAll()
+	} else {
+		h.commands = h.project.GetAll()
+	}
+	h.match = -1
+	h.next(-1)
+}
+
+// searchKey handles a key while the search is open and reports whether
+// the line editor should still process it.
+func (s *Shell) searchKey(r rune) bool {
+	h := s.search
+	switch action := s.keys[r]; {
+	case action == config.ActionSearchHistory:
+		h.next(-1)
+	case action == config.ActionSearchScope:
+		if h.project != nil {
+			h.global = !h.global
+			s.loadSearch()
+		}
+	case r == lineedit.CharFwdSearch:
+		h.next(1)
+	case r == lineedit.CharBackspace || r == lineedit.CharCtrlH:
+		if len(h.query) > 0 {
+			h.query = h.query[:len(h.query)-1]
+			h.match = -1
+			h.next(-1)
+		}
+	case r == lineedit.CharBell || r == lineedit.CharInterrupt:
+		s.closeSearch()
+		return false
+	case r == lineedit.CharEnter || r == lineedit.CharCtrlJ:
+		s.acceptSearch()
+		return true
+	default:
+		if !unicode.IsPrint(r) {
+			// Any other key ends the search with the match on the line
+			// and then does what it normally does, as in bash.
+			s.acceptSearch()
+			return true
+		}
+		h.query = append(h.query, r)
+		// The longer query may still match the current command.
+		if h.match < 0 || !strings.Contains(h.commands[h.match], string(h.query)) {
+			h.next(-1)
+		}
+	}
+	s.drawSearch()
+	return false
+}
+
+// next moves the match to the nearest command in direction dir (-1 for
+// older) that contains the query, skipping repeats of the current match.
+// When there is none the match stays and the search is marked failing.
+func (h *historySearch) next(dir int) {
+	query := string(h.query)
+	h.failing = false
+	if query == "" {
+		return
+	}
+	from, current := len(h.commands), ""
+	if h.match >= 0 {
+		from, current = h.match, h.commands[h.match]
+	}
+	for i := from + dir; i >= 0 && i < len(h.commands); i += dir {
+		if cmd := h.commands[i]; cmd != current && strings.Contains(cmd, query) {
+			h.match = i
+			return
+		}
+	}
+	h.failing = true
+}
+
+func (s *Shell) acceptSearch() {
+	h := s.search
+	s.closeSearch()
+	if h.match >= 0 {
+		s.reader.SetBuffer(h.commands[h.match])
+	}
+}
+
+func (s *Shell) closeSearch() {
+	s.reader.Write([]byte(eraseLines(s.search.drawn)))
+	s.search = nil
+}
+
+func (s *Shell) drawSearch() {
+	h := s.search
+	var b strings.Builder
+	b.WriteString(eraseLines(h.drawn))
+
+	query := string(h.query)
+	b.WriteString("(")
+	if h.failing {
+		b.WriteString("failing ")
+	}
+	if !h.global {
+		b.WriteString("project ")
+	}
+	b.WriteString("reverse-i-search)`" + query + "': ")
+	if h.match >= 0 {
+		cmd := h.commands[h.match]
+		if i := strings.LastIndex(cmd, query); i >= 0 && query != "" {
+			cmd = cmd[:i] + s.highlight(query) + cmd[i+len(query):]
+		}
+		b.WriteString(cmd)
+	}
+	b.WriteString("\n")
+	h.drawn = 1
+	s.reader.Write([]byte(b.String()))
+}
+
+// highlight marks text in reverse video, or with brackets when the
+// terminal cannot show colours.
+func (s *Shell) highlight(text string) string {
+	if !s.term.Color {
+		return "[" + text + "]"
+	}
+	return "\033[7m" + text + "\033[27m"
+}
@@ -1,55 +1,291 @@
 package shell
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/chzyer/readline"
 	"shell/internal/config"
+	"shell/internal/executor"
 	"shell/internal/history"
+	"shell/internal/lineedit"
 	"shell/internal/plugin"
+	"shell/internal/script"
+	"shell/internal/terminal"
 )
 
 type Shell struct {
 	config     *config.Config
-	history    *history.History
+	history    history.History
 	plugins    []plugin.Plugin
 	jobs       map[int]*Job
+	executor   executor.Executor
 	nextJobID  int
 	signalChan chan os.Signal
-	reader     *readline.Instance
+	reader     lineedit.Editor
+	prevDir    string
+	term       terminal.Capabilities
+	vars       map[string]string
+	aliases    map[string]string
+	suffixes   map[string]string // suffix aliases, by file extension
+	completer  *completer
+	// completers are the completion providers built into the shell.
+	completers []plugin.Completer
+	keys       map[rune]string
+	menu       *selectMenu
+	search     *historySearch
+	editLine   []rune
+	editPos    int
+	profiler   profiler
+	size       termSize
+	usage      cpuUsage
+	// theme is the prompt theme in use, if any.
+	theme string
+	// prompts computes the slow fields of the prompt.
+	prompts *promptScheduler
+
+	// line is the command line being run, and nextLine one to offer for
+	// editing at the next prompt.
+	line, nextLine string
+
+	startTime    time.Time
+	commandCount int
+	lastStatus   int
+	// lastDuration is how long the last command took, if it was worth
+	// reporting.
+	lastDuration time.Duration
+	options      map[string]bool
+	login        bool
+	exitHooks    []ExitHook
+	preexecHooks []PreexecHook
+	precmdHooks  []PrecmdHook
+	hooks        map[string][]string // commands to run at each hook event
+	exited       bool
+	// exitRequested is set by the exit builtin.
+	exitRequested bool
+	// scopes are the local variables of the function calls running,
+	// innermost last.
+	scopes []map[string]string
+	// arg0 and args are $0 and the positional parameters, $1 on.
+	arg0 string
+	args []string
+	// attrs are the attributes declare has given variables.
+	attrs map[string]varAttrs
+	// interactive is set while Run reads commands from the user.
+	interactive bool
+	// stdinRedirected is set while a builtin's input is not the shell's.
+	stdinRedirected bool
+	// fds are the files exec redirected descriptors to for good.
+	fds map[int]*os.File
+	// remote is the host remote connect sends commands to, and
+	// localExecutor the executor it replaced.
+	remote        *executor.SSH
+	localExecutor executor.Executor
+	// recording is set while record start records the session.
+	recording *recording
+	// outputs keeps the output of the last command lines, when the
+	// config asks for it.
+	outputs *outputRing
+	// jobOutputs holds the output of the background jobs, by ID.
+	jobOutputs map[int]*jobOutput
+	// envFile is the env file that applies to the current directory.
+	envFile envFile
+	// projectFiles are the project files read so far.
+	projectFiles projectCache
+	// provided is what the environment providers set up for it.
+	provided providedEnv
+	// envStack holds the environments pushenv saved, and startEnv the
+	// one the shell started with, for envdiff.
+	envStack []map[string]string
+	startEnv map[string]string
+	// flags caches the options of external commands, for completion.
+	flags flagCache
+	// focus is whether the terminal window has the focus, as far as
+	// the shell knows.
+	focus atomic.Int32
+
+	traps map[string]string
+	// pendingSignals are the signals whose traps are waiting to run.
+	pendingSignals []string
+	trapMu         sync.Mutex
+	// execMu is held while the shell runs commands, so that traps run
+	// between them.
+	execMu sync.Mutex
+
+	pluginBuiltins map[string]pluginBuiltin
+	pluginPaths    map[string]string
+	scripts        *script.Engine
+	// deferred is what LoadLater put off, in order.
+	deferred []func()
+
+	// projectHistories holds the history of each project visited, or
+	// nil for one that could not be opened.
+	projectHistories map[string]*history.File
 }
 
 func New(cfg *config.Config) (*Shell, error) {
-	hist, err := history.New(cfg.HistoryFile)
+	hist, err := openHistory(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing history: %w", err)
 	}
 
-	rl, err := readline.NewEx(&readline.Config{
-		Prompt:      "> ",
-		HistoryFile: cfg.HistoryFile,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error initializing readline: %w", err)
-	}
+	term := terminal.Detect()
+	term.ScreenReader = cfg.ScreenReader
 
-	return &Shell{
+	s := &Shell{
 		config:     cfg,
 		history:    hist,
 		jobs:       make(map[int]*Job),
+		jobOutputs: make(map[int]*jobOutput),
+		executor:   executor.Local{},
 		nextJobID:  1,
 		signalChan: make(chan os.Signal, 1),
-		reader:     rl,
-	}, nil
+		traps:      make(map[string]string),
+		term:       term,
+		vars:       make(map[string]string),
+		options:    map[string]bool{OptionAutocd: cfg.AutoCD, OptionCorrect: cfg.Correct},
+		aliases:    make(map[string]string),
+		suffixes:   make(map[string]string),
+		hooks:      configHooks(cfg),
+		theme:      cfg.Theme,
+		prompts:    newPromptScheduler(),
+
+		pluginBuiltins: make(map[string]pluginBuiltin),
+		pluginPaths:    make(map[string]string),
+		startTime:      time.Now(),
+
+		projectHistories: make(map[string]*history.File),
+		startEnv:         environ(),
+	}
+	s.completer = &completer{shell: s}
+	s.completers = []plugin.Completer{sshHosts{files: s.completer.fileCandidates}, jobSpecs{s}}
+	s.keys = bindKeys(cfg)
+	s.outputs = newOutputRing(cfg.CaptureOutput.Keep)
+	s.options[OptionVi] = cfg.EditingMode == "vi"
+	s.options[OptionEmacs] = !s.options[OptionVi]
+	for name, value := range cfg.Aliases {
+		s.aliases[name] = value
+	}
+	for ext, value := range cfg.SuffixAliases {
+		s.suffixes[ext] = value
+	}
+	if err := applyEnv(cfg.Env); err != nil {
+		return nil, err
+	}
+
+	// The history file carries metadata the line editor does not
+	// understand, so the editor keeps its history in memory and is
+	// seeded from ours, in the background once Run starts.
+	reader, err := lineedit.New(lineedit.Config{
+		Prompt:    s.prompt(),
+		Backend:   cfg.LineEditor,
+		Keymap:    s.keymap(),
+		Complete:  s.completer.Do,
+		Describe:  s.completer.Describe,
+		NoMenu:    cfg.Completion.NoMenu,
+		FilterKey: s.filterKey,
+		OnChange:  s.trackLine,
+		// The prompt shows the vi mode in its {mode} field.
+		OnModeChange: func(string) { s.reader.SetPrompt(s.prompt()) },
+		OnFocus:      s.trackFocus,
+		// Let the terminal's cooked mode (or Emacs) do the line editing
+		// rather than emitting redraw escapes it cannot interpret, or
+		// that a screen reader would read out again on every keystroke.
+		LineMode: term.LineMode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.reader = reader
+	go s.redrawPrompts()
+	s.setupSignalHandling()
+	s.markCommands()
+	s.reportDurations()
+	s.notifyLongCommands()
+	s.reportToTerminal()
+	s.OnPrecmd(s.updateEnvFile)
+	s.OnPrecmd(s.checkProjects)
+	s.OnPrecmd(s.updateProvidedEnv)
+	return s, nil
+}
+
+func historyOptions(cfg *config.Config) history.Options {
+	return history.Options{
+		IgnoreDups:  cfg.History.IgnoreDups,
+		IgnoreSpace: cfg.History.IgnoreSpace,
+		Ignore:      cfg.History.Ignore,
+
+		Secrets:      cfg.History.SecretPatterns,
+		SecretAction: cfg.History.Secrets,
+
+		Size: cfg.History.Size,
+		Sync: cfg.History.Sync,
+	}
+}
+
+func openHistory(cfg *config.Config) (history.History, error) {
+	options := historyOptions(cfg)
+	switch cfg.History.Backend {
+	case "", "file":
+		return history.NewFile(cfg.HistoryFile, options)
+	case "sqlite":
+		return history.NewSQLite(cfg.History.Database, options)
+	}
+	return nil, fmt.Errorf("unknown history backend %q", cfg.History.Backend)
+}
+
+const defaultPrompt = "> "
+
+// Prompt returns the prompt as it would be drawn now, with the slow
+// fields as far as they are known.
+func (s *Shell) Prompt() string {
+	return s.prompt()
+}
+
+func (s *Shell) prompt() string {
+	prompt := defaultPrompt
+	if t := themes[s.theme]; t != nil {
+		prompt = s.fitPrompt(func(cwd string) string { return s.themePrompt(t, cwd) })
+	} else if s.config.Prompt != "" {
+		prompt = s.formatPrompt(s.config.Prompt)
+	}
+	if s.scripts != nil {
+		prompt = s.scripts.Prompt() + prompt
+	}
+	if s.term.ScreenReader {
+		prompt = terminal.Plain(prompt)
+	}
+	return s.markPrompt(prompt)
 }
 
-func (s *Shell) Run() {
+// Run reads and runs commands until the input ends, and returns the
+// status of the last one.
+func (s *Shell) Run() int {
+	s.interactive = true
+	signal.Notify(s.signalChan, os.Interrupt)
+	go s.reloadEditorHistory()
+	s.execMu.Lock()
 	for {
-		line, err := s.reader.Readline()
-		if err == readline.ErrInterrupt {
+		s.runPendingTraps()
+		if s.exitRequested {
+			break
+		}
+		s.prompts.next(s.config.PromptWaitDuration())
+		s.runPrecmd()
+		s.updateSize()
+		s.reader.SetPrompt(s.prompt())
+		s.trackLine([]rune(s.nextLine), len(s.nextLine), 0)
+		s.execMu.Unlock()
+		line, err := s.reader.ReadlineWithDefault(s.nextLine)
+		s.nextLine = ""
+		s.execMu.Lock()
+		if err == lineedit.ErrInterrupt {
 			if len(line) == 0 {
 				break
 			} else {
@@ -59,23 +295,122 @@ func (s *Shell) Run() {
 			break
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
+		// Leading blanks are kept for the history, where they can mean
+		// the command should not be recorded.
+		line = strings.TrimRight(line, " \t")
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 
-		s.history.Add(line)
+		if !s.config.NoHistoryExpansion {
+			expanded, changed, err := s.expandHistory(line)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			if changed {
+				fmt.Println(expanded)
+				line = expanded
+			}
+		}
 
-		if err := s.Execute(line); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		finish := s.addHistory(line)
+		duration := s.runLine(line)
+		finish(s.lastStatus, duration)
+		if s.stopping() {
+			break
 		}
 	}
+
+	s.shutdown()
+	return s.lastStatus
+}
+
+// RunScript runs the commands in file, as for myshell FILE, and returns
+// the status of the last one run.
+func (s *Shell) RunScript(file string) int {
+	s.execMu.Lock()
+	err := s.Source(file)
+	var status ExitStatus
+	if err != nil && !errors.As(err, &status) {
+		fmt.Fprintf(os.Stderr, "myshell: %v\n", err)
+		s.lastStatus = 127
+	}
+	s.shutdown()
+	return s.lastStatus
+}
+
+// RunCommand runs command, which may hold several lines, as for -c, and
+// returns the status of the last line run. Nothing goes into the
+// history.
+func (s *Shell) RunCommand(command string) int {
+	s.execMu.Lock()
+	s.runLines(strings.Split(command, "\n"))
+	s.shutdown()
+	return s.lastStatus
 }
 
-func (s *Shell) Execute(input string) error {
-	args := strings.Split(input, " ")
-	if ok, err := s.executeBuiltin(args); ok {
-		return err
+// LoadLater puts load, such as loading the plugins, off until the first
+// command line is about to run, so that the prompt comes up sooner.
+func (s *Shell) LoadLater(load func()) {
+	s.deferred = append(s.deferred, load)
+}
+
+// loadDeferred runs what LoadLater put off.
+func (s *Shell) loadDeferred() {
+	for len(s.deferred) > 0 {
+		load := s.deferred[0]
+		s.deferred = s.deferred[1:]
+		load()
+	}
+}
+
+// runLine runs a command line with its hooks, reports any error and
+// returns how long it took.
+func (s *Shell) runLine(line string) time.Duration {
+	s.loadDeferred()
+	s.commandCount++
+	s.line = line
+	s.runPreCommand(line)
+	start := time.Now()
+	s.outputs.begin()
+	err := s.Execute(line)
+	s.outputs.end()
+	duration := time.Since(start)
+	s.lastStatus = exitCode(err)
+	s.runPostCommand(line, s.lastStatus, duration)
+
+	report(err)
+	s.runPendingTraps()
+	return duration
+}
+
+// stopping reports whether the shell should stop running commands: exit
+// was run, or errexit is set and the last command failed.
+func (s *Shell) stopping() bool {
+	return s.exitRequested || s.options[OptionErrexit] && s.lastStatus != 0
+}
+
+// ExitStatus is returned by builtins that finish unsuccessfully without
+// anything worth reporting, such as a false test.
+type ExitStatus int
+
+func (e ExitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// exitCode maps the result of running a command to a shell exit status.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var status ExitStatus
+	if errors.As(err, &status) {
+		return int(status)
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
 	}
-	return s.runExternal(args)
+	return 1
 }
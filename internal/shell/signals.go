@@ -1,36 +1,52 @@
+//go:build !windows
+
 package shell
 
 import (
-	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
+// signalNames are the signals trap accepts, by name without the SIG.
+var signalNames = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// exitSignals make the shell exit cleanly unless they are trapped.
+var exitSignals = []os.Signal{syscall.SIGHUP, syscall.SIGTERM}
+
+func signalNumber(sig os.Signal) int {
+	return int(sig.(syscall.Signal))
+}
+
 func (s *Shell) setupSignalHandling() {
-	signal.Notify(s.signalChan, syscall.SIGINT, syscall.SIGTSTP, syscall.SIGCHLD)
+	signal.Notify(s.signalChan, exitSignals...)
+	s.watchResize()
 	go s.handleSignals()
 }
 
-func (s *Shell) handleSignals() {
-	for sig := range s.signalChan {
-		switch sig {
-		case syscall.SIGINT:
-			fmt.Println("\nReceived SIGINT")
-		case syscall.SIGTSTP:
-			fmt.Println("\nReceived SIGTSTP")
-		case syscall.SIGCHLD:
-			s.reapChildren()
-		}
+// hangUp sends SIGHUP to the process group of a job, whose ID is that of
+// its first process, and then SIGCONT so that a stopped job sees it.
+func hangUp(pgid int) error {
+	if err := syscall.Kill(-pgid, syscall.SIGHUP); err != nil {
+		return err
 	}
+	return syscall.Kill(-pgid, syscall.SIGCONT)
 }
 
-// Handle child process status changes
-func (s *Shell) reapChildren() {
-	for {
-		pid, _ := syscall.Wait4(-1, nil, syscall.WNOHANG, nil)
-		if pid <= 0 {
-			break
+// watchResize keeps the terminal size up to date as the window changes.
+func (s *Shell) watchResize() {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	go func() {
+		for range resized {
+			s.updateSize()
 		}
-	}
+	}()
 }
@@ -0,0 +1,43 @@
+//go:build windows
+
+package shell
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// signalNames are the signals trap accepts. Windows delivers Ctrl+C as
+// INT, and closing the console or logging off as TERM.
+var signalNames = map[string]os.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+}
+
+// exitSignals make the shell exit cleanly unless they are trapped.
+var exitSignals = []os.Signal{syscall.SIGTERM}
+
+func signalNumber(sig os.Signal) int {
+	return int(sig.(syscall.Signal))
+}
+
+func (s *Shell) setupSignalHandling() {
+	signal.Notify(s.signalChan, exitSignals...)
+	s.watchResize()
+	go s.handleSignals()
+}
+
+// hangUp ends the process of a job. Windows has no SIGHUP or process
+// groups, so it is killed.
+func hangUp(pgid int) error {
+	p, err := os.FindProcess(pgid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+// watchResize does nothing: Windows has no SIGWINCH, so the size is only
+// read before each prompt and command.
+func (s *Shell) watchResize() {}
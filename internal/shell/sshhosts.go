@@ -0,0 +1,209 @@
+package shell
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"shell/internal/plugin"
+)
+
+// sshHosts completes host names, and user@host, for ssh and the commands
+// that copy files over it, from the ssh configs and the known_hosts
+// files. scp and rsync complete them as host: among the local files.
+type sshHosts struct {
+	// files completes local file names, as completer.fileCandidates.
+	files func(word string) []string
+}
+
+// sshValueOptions are the options of each command that take a value,
+// such as ssh -i FILE.
+var sshValueOptions = map[string]string{
+	"ssh":   "BbcDEeFIiJLlmOoPpQRSWw",
+	"sftp":  "BbcDFiJloPRSs",
+	"scp":   "cDFiJlOoPS",
+	"rsync": "eTf",
+}
+
+func (sshHosts) Completes() []string {
+	return []string{"ssh", "sftp", "scp", "rsync"}
+}
+
+func (h sshHosts) Complete(args []string, word string) ([]plugin.Completion, error) {
+	command := filepath.Base(args[0])
+	if strings.HasPrefix(word, "-") || takesValue(args[len(args)-1], sshValueOptions[command]) {
+		return nil, nil
+	}
+	copying := command == "scp" || command == "rsync"
+	if copying && (strings.ContainsAny(word, ":/") || strings.HasPrefix(word, "~") || strings.HasPrefix(word, ".")) {
+		return nil, nil
+	}
+	if !copying && hostGiven(args, sshValueOptions[command]) {
+		// What follows the host is a command to run there.
+		return nil, nil
+	}
+
+	user, _, ok := strings.Cut(word, "@")
+	if ok {
+		user += "@"
+	} else {
+		user = ""
+	}
+	var completions []plugin.Completion
+	for _, host := range sshKnownHosts() {
+		completion := plugin.Completion{Text: user + host.name, Description: host.description}
+		if copying {
+			completion.Text += ":"
+			completion.Partial = true
+		}
+		completions = append(completions, completion)
+	}
+	if copying && user == "" {
+		for _, file := range h.files(word) {
+			name := strings.TrimSuffix(file, " ")
+			completions = append(completions, plugin.Completion{
+				Text:        name,
+				Description: describeFile(name),
+				Partial:     strings.HasSuffix(name, "/"),
+			})
+		}
+	}
+	return completions, nil
+}
+
+// takesValue reports whether arg is a cluster of single-letter options
+// ending in one of those that take a value, which follows it.
+func takesValue(arg, valueOptions string) bool {
+	return len(arg) >= 2 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(valueOptions, rune(arg[len(arg)-1]))
+}
+
+// hostGiven reports whether args, after the command, already name the
+// host.
+func hostGiven(args []string, valueOptions string) bool {
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case takesValue(arg, valueOptions):
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			return true
+		}
+	}
+	return false
+}
+
+// sshHost is a host named in an ssh config or known_hosts file.
+type sshHost struct {
+	name, description string
+}
+
+// sshKnownHosts returns the hosts the user's and the system's ssh
+// configs name, described by their HostName, followed by the others in
+// the known_hosts files.
+func sshKnownHosts() []sshHost {
+	home, _ := os.UserHomeDir()
+	userDir := filepath.Join(home, ".ssh")
+	var hosts []sshHost
+	seen := make(map[string]bool)
+	add := func(name, description string) {
+		if name != "" && !seen[name] && !strings.ContainsAny(name, "*?!") {
+			seen[name] = true
+			hosts = append(hosts, sshHost{name, description})
+		}
+	}
+
+	visited := make(map[string]bool)
+	readSSHConfig(filepath.Join(userDir, "config"), userDir, visited, add)
+	readSSHConfig("/etc/ssh/ssh_config", "/etc/ssh", visited, add)
+	for _, file := range []string{filepath.Join(userDir, "known_hosts"), "/etc/ssh/ssh_known_hosts"} {
+		readKnownHosts(file, add)
+	}
+	return hosts
+}
+
+// readSSHConfig adds the hosts of the Host lines in an ssh config file,
+// and of the files it includes, relative paths in which are relative to
+// dir.
+func readSSHConfig(file, dir string, visited map[string]bool, add func(name, description string)) {
+	if visited[file] {
+		return
+	}
+	visited[file] = true
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// Hosts get their HostName as their description, which may come
+	// after them.
+	var section []string
+	hostNames := make(map[string]string)
+	var order []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool { return r == ' ' || r == '\t' || r == '=' })
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "host":
+			section = fields[1:]
+			order = append(order, section...)
+		case "match":
+			section = nil
+		case "hostname":
+			for _, name := range section {
+				if _, ok := hostNames[name]; !ok {
+					hostNames[name] = fields[1]
+				}
+			}
+		case "include":
+			for _, pattern := range fields[1:] {
+				if strings.HasPrefix(pattern, "~/") {
+					home, _ := os.UserHomeDir()
+					pattern = filepath.Join(home, pattern[2:])
+				} else if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(dir, pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					readSSHConfig(match, dir, visited, add)
+				}
+			}
+		}
+	}
+	for _, name := range order {
+		add(name, hostNames[name])
+	}
+}
+
+// readKnownHosts adds the hosts in a known_hosts file, but not those it
+// only has hashes of.
+func readKnownHosts(file string, add func(name, description string)) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+			// A marker such as @cert-authority comes before the hosts.
+			fields = fields[1:]
+		}
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "|") {
+			continue
+		}
+		for _, name := range strings.Split(fields[0], ",") {
+			// Hosts on another port than 22 are written [host]:port.
+			if strings.HasPrefix(name, "[") {
+				if end := strings.Index(name, "]"); end > 0 {
+					name = name[1:end]
+				}
+			}
+			add(name, "known host")
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"shell/internal/lineedit"
+)
+
+func (s *Shell) test(name string, args []string) error {
+	if name == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			return fmt.Errorf("[: missing ']'")
+		}
+		args = args[:len(args)-1]
+	}
+
+	ok, err := evalTest(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if !ok {
+		return ExitStatus(1)
+	}
+	return nil
+}
+
+func evalTest(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	p := &testParser{args: args}
+	ok, err := p.or()
+	if err != nil {
+		return false, err
+	}
+	if p.pos < len(p.args) {
+		return false, fmt.Errorf("%s: unexpected argument", p.args[p.pos])
+	}
+	return ok, nil
+}
+
+// testParser evaluates test expressions with the usual precedence:
+// -o binds loosest, then -a, then !, then primaries and parentheses.
+type testParser struct {
+	args []string
+	pos  int
+}
+
+func (p *testParser) peek(offset int) (string, bool) {
+	if p.pos+offset < len(p.args) {
+		return p.args[p.pos+offset], true
+	}
+	return "", false
+}
+
+func (p *testParser) or() (bool, error) {
+	ok, err := p.and()
+	for err == nil {
+		if tok, _ := p.peek(0); tok != "-o" {
+			break
+		}
+		p.pos++
+		var rhs bool
+		rhs, err = p.and()
+		ok = ok || rhs
+	}
+	return ok, err
+}
+
+func (p *testParser) and() (bool, error) {
+	ok, err := p.not()
+	for err == nil {
+		if tok, _ := p.peek(0); tok != "-a" {
+			break
+		}
+		p.pos++
+		var rhs bool
+		rhs, err = p.not()
+		ok = ok && rhs
+	}
+	return ok, err
+}
+
+func (p *testParser) not() (bool, error) {
+	if tok, _ := p.peek(0); tok == "!" {
+		if _, more := p.peek(1); more {
+			p.pos++
+			ok, err := p.not()
+			return !ok, err
+		}
+	}
+	return p.primary()
+}
+
+func (p *testParser) primary() (bool, error) {
+	tok, ok := p.peek(0)
+	if !ok {
+		return false, fmt.Errorf("argument expected")
+	}
+
+	if op, ok := p.peek(1); ok && isBinaryTestOp(op) {
+		if rhs, ok := p.peek(2); ok {
+			p.pos += 3
+			return binaryTest(tok, op, rhs)
+		}
+	}
+
+	if tok == "(" {
+		if _, more := p.peek(1); more {
+			p.pos++
+			ok, err := p.or()
+			if err != nil {
+				return false, err
+			}
+			if closing, _ := p.peek(0); closing != ")" {
+				return false, fmt.Errorf("missing ')'")
+			}
+			p.pos++
+			return ok, nil
+		}
+	}
+
+	if isUnaryTestOp(tok) {
+		if arg, ok := p.peek(1); ok {
+			p.pos += 2
+			return unaryTest(tok, arg)
+		}
+	}
+
+	p.pos++
+	return tok != "", nil
+}
+
+func isUnaryTestOp(op string) bool {
+	switch op {
+	case "-b", "-c", "-d", "-e", "-f", "-g", "-h", "-k", "-L", "-n", "-p",
+		"-r", "-s", "-S", "-t", "-u", "-w", "-x", "-z":
+		return true
+	}
+	return false
+}
+
+func isBinaryTestOp(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", ">", "-eq", "-ne", "-lt", "-le", "-gt", "-ge",
+		"-nt", "-ot", "-ef":
+		return true
+	}
+	return false
+}
+
+func unaryTest(op, arg string) (bool, error) {
+	switch op {
+	case "-n":
+		return arg != "", nil
+	case "-z":
+		return arg == "", nil
+	case "-t":
+		fd, err := strconv.Atoi(arg)
+		if err != nil {
+			return false, fmt.Errorf("%s: integer expression expected", arg)
+		}
+		return lineedit.IsTerminal(fd), nil
+	case "-r", "-w", "-x":
+		return accessible(arg, op[1]), nil
+	case "-h", "-L":
+		info, err := os.Lstat(arg)
+		return err == nil && info.Mode()&os.ModeSymlink != 0, nil
+	}
+
+	info, err := os.Stat(arg)
+	if err != nil {
+		return false, nil
+	}
+	mode := info.Mode()
+	switch op {
+	case "-e":
+		return true, nil
+	case "-f":
+		return mode.IsRegular(), nil
+	case "-d":
+		return mode.IsDir(), nil
+	case "-s":
+		return info.Size() > 0, nil
+	case "-b":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+	case "-c":
+		return mode&os.ModeCharDevice != 0, nil
+	case "-p":
+		return mode&os.ModeNamedPipe != 0, nil
+	case "-S":
+		return mode&os.ModeSocket != 0, nil
+	case "-g":
+		return mode&os.ModeSetgid != 0, nil
+	case "-u":
+		return mode&os.ModeSetuid != 0, nil
+	case "-k":
+		return mode&os.ModeSticky != 0, nil
+	}
+	return false, fmt.Errorf("%s: unary operator expected", op)
+}
+
+func binaryTest(lhs, op, rhs string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return lhs == rhs, nil
+	case "!=":
+		return lhs != rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case "-nt", "-ot", "-ef":
+		return fileCompare(lhs, op, rhs), nil
+	}
+
+	a, err := strconv.ParseInt(lhs, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", lhs)
+	}
+	b, err := strconv.ParseInt(rhs, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", rhs)
+	}
+	switch op {
+	case "-eq":
+		return a == b, nil
+	case "-ne":
+		return a != b, nil
+	case "-lt":
+		return a < b, nil
+	case "-le":
+		return a <= b, nil
+	case "-gt":
+		return a > b, nil
+	default:
+		return a >= b, nil
+	}
+}
+
+func fileCompare(lhs, op, rhs string) bool {
+	a, errA := os.Stat(lhs)
+	b, errB := os.Stat(rhs)
+	switch op {
+	case "-nt":
+		return errA == nil && (errB != nil || a.ModTime().After(b.ModTime()))
+	case "-ot":
+		return errB == nil && (errA != nil || a.ModTime().Before(b.ModTime()))
+	default:
+		return errA == nil && errB == nil && os.SameFile(a, b)
+	}
+}
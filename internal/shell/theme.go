@@ -0,0 +1,262 @@
+package shell
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"shell/internal/config"
+	"shell/internal/plugin"
+)
+
+// A theme draws the prompt from segments: the prompt fields, such as
+// {user} and {cwd}, and those plugins add. A segment with nothing to
+// show, such as {status} after a command that succeeded, is left out.
+type theme struct {
+	// segments are shown when the config does not choose them.
+	segments []string
+	// styles colour the segments; those not in it, such as the ones
+	// plugins add, get pluginStyle.
+	styles      map[string]segmentStyle
+	pluginStyle segmentStyle
+	// separator goes between the segments. Powerline separators are
+	// drawn in the colours of the segments either side, and stand in
+	// for end, which follows the segments otherwise, in endOK after a
+	// command that succeeded and endFailed after one that failed.
+	separator        string
+	powerline        bool
+	end              string
+	endOK, endFailed int
+}
+
+// segmentStyle gives a segment its colours from the 256-colour palette,
+// 0 leaving the terminal's own, and a format for its text.
+type segmentStyle struct {
+	fg, bg int
+	format string
+}
+
+var themes = map[string]*theme{
+	"plain": {
+		segments:  []string{"cwd", "status"},
+		styles:    map[string]segmentStyle{"status": {format: "[%s]"}},
+		separator: " ",
+		end:       "> ",
+	},
+	"minimal": {
+		segments: []string{"cwd", "git", "duration", "status"},
+		styles: map[string]segmentStyle{
+			"user":     {fg: 108},
+			"host":     {fg: 108},
+			"cwd":      {fg: 39},
+			"dir":      {fg: 39},
+			"git":      {fg: 170},
+			"kube":     {fg: 68},
+			"duration": {fg: 179},
+			"time":     {fg: 244},
+			"mode":     {fg: 244},
+			"status":   {fg: 196, format: "✘ %s"},
+		},
+		pluginStyle: segmentStyle{fg: 139},
+		separator:   " ",
+		end:         "❯ ",
+		endOK:       76,
+		endFailed:   196,
+	},
+	"powerline": {
+		segments: []string{"user", "host", "cwd", "git", "duration", "status"},
+		styles: map[string]segmentStyle{
+			"user":     {fg: 231, bg: 31},
+			"host":     {fg: 231, bg: 24},
+			"cwd":      {fg: 252, bg: 237},
+			"dir":      {fg: 252, bg: 237},
+			"git":      {fg: 16, bg: 113},
+			"kube":     {fg: 231, bg: 68},
+			"duration": {fg: 16, bg: 179},
+			"time":     {fg: 252, bg: 240},
+			"mode":     {fg: 16, bg: 148},
+			"status":   {fg: 231, bg: 160, format: "✘ %s"},
+		},
+		pluginStyle: segmentStyle{fg: 231, bg: 60},
+		separator:   "\ue0b0",
+		powerline:   true,
+		end:         "> ",
+	},
+}
+
+// themeSegment is a segment to draw, with its text formatted.
+type themeSegment struct {
+	text  string
+	style segmentStyle
+}
+
+// themePrompt draws the prompt in t, with cwd as the {cwd} segment.
+func (s *Shell) themePrompt(t *theme, cwd string) string {
+	var segments []themeSegment
+	for _, name := range s.themeSegments(t) {
+		text := s.segmentText(name, cwd)
+		if text == "" {
+			continue
+		}
+		style, ok := t.styles[name]
+		if !ok {
+			style = t.pluginStyle
+		}
+		if style.format != "" {
+			text = fmt.Sprintf(style.format, text)
+		}
+		segments = append(segments, themeSegment{text, style})
+	}
+
+	var b strings.Builder
+	if t.powerline && s.term.Color {
+		for i, seg := range segments {
+			if i > 0 {
+				b.WriteString(s.term.SGR(segments[i-1].style.bg, seg.style.bg) + t.separator)
+			}
+			b.WriteString(s.term.SGR(seg.style.fg, seg.style.bg) + " " + seg.text + " ")
+		}
+		if len(segments) > 0 {
+			b.WriteString(s.term.SGR(segments[len(segments)-1].style.bg, 0) + t.separator + s.term.Reset())
+		}
+		b.WriteString(" ")
+		return b.String()
+	}
+
+	separator := t.separator
+	if t.powerline {
+		separator = " "
+	}
+	for i, seg := range segments {
+		if i > 0 {
+			b.WriteString(separator)
+		}
+		b.WriteString(s.colored(seg.text, seg.style.fg, seg.style.bg))
+	}
+	if len(segments) > 0 {
+		b.WriteString(" ")
+	}
+	end := t.endOK
+	if s.lastStatus != 0 {
+		end = t.endFailed
+	}
+	b.WriteString(s.colored(t.end, end, 0))
+	return b.String()
+}
+
+// themeSegments returns the names of the segments to show: those the
+// config chooses, or else the theme's followed by the ones plugins add.
+func (s *Shell) themeSegments(t *theme) []string {
+	if len(s.config.ThemeSegments) > 0 {
+		return s.config.ThemeSegments
+	}
+	names := append([]string{}, t.segments...)
+	for _, p := range s.plugins {
+		if provider, ok := p.(plugin.SegmentProvider); ok {
+			for _, name := range provider.Segments() {
+				if !slices.Contains(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// segmentText returns what a segment shows, nothing for one that is not
+// worth showing or that no plugin provides. Those plugins provide are
+// slow fields, computed in the background.
+func (s *Shell) segmentText(name, cwd string) string {
+	if value, ok := s.promptValue(name, cwd); ok {
+		if name == "status" && s.lastStatus == 0 {
+			return ""
+		}
+		return value
+	}
+	for _, p := range s.plugins {
+		provider, ok := p.(plugin.SegmentProvider)
+		if !ok || !slices.Contains(provider.Segments(), name) {
+			continue
+		}
+		return s.slowValue(name, func(string) string {
+			var text string
+			err := s.guard(p.Name(), "Segment", func() (err error) {
+				text, err = provider.Segment(name)
+				return err
+			})
+			if err != nil {
+				s.reader.Write([]byte(fmt.Sprintf("Error: plugin %s: segment %s: %v\n", p.Name(), name, err)))
+				return ""
+			}
+			return strings.TrimSpace(text)
+		})
+	}
+	return ""
+}
+
+// colored shows text in the colours fg and bg, where the terminal can.
+func (s *Shell) colored(text string, fg, bg int) string {
+	if fg == 0 && bg == 0 {
+		return text
+	}
+	return s.term.SGR(fg, bg) + text + s.term.Reset()
+}
+
+// themeCommand is the theme builtin: theme shows the theme in use, theme
+// NAME switches to another ("none" for the prompt format), theme list
+// lists them and theme preview [NAME...] shows how each draws the prompt.
+func (s *Shell) themeCommand(args []string) error {
+	if len(args) == 0 {
+		name := s.theme
+		if name == "" {
+			name = "none"
+		}
+		fmt.Println(name)
+		return nil
+	}
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			return fmt.Errorf("theme: list: too many arguments")
+		}
+		for _, name := range append([]string{"none"}, config.Themes...) {
+			fmt.Println(name)
+		}
+		return nil
+	case "preview":
+		return s.previewThemes(args[1:])
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("theme: too many arguments")
+	}
+	if args[0] != "none" && themes[args[0]] == nil {
+		return fmt.Errorf("theme: %s: unknown theme, expected none, %s", args[0], strings.Join(config.Themes, ", "))
+	}
+	s.theme = args[0]
+	return nil
+}
+
+// previewThemes shows the prompt each theme draws, as it is now and as
+// it would be after a command that failed after a while.
+func (s *Shell) previewThemes(names []string) error {
+	if len(names) == 0 {
+		names = config.Themes
+	}
+	for _, name := range names {
+		if themes[name] == nil {
+			return fmt.Errorf("theme: preview: %s: unknown theme", name)
+		}
+	}
+	status, duration := s.lastStatus, s.lastDuration
+	defer func() { s.lastStatus, s.lastDuration = status, duration }()
+	for _, name := range names {
+		t := themes[name]
+		fmt.Printf("%s:\n", name)
+		fmt.Printf("  %sls\n", s.fitPrompt(func(cwd string) string { return s.themePrompt(t, cwd) }))
+		s.lastStatus, s.lastDuration = 1, 12*time.Second
+		fmt.Printf("  %sls\n", s.fitPrompt(func(cwd string) string { return s.themePrompt(t, cwd) }))
+		s.lastStatus, s.lastDuration = status, duration
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package shell
+
+import (
+	"fmt"
+
+	"shell/internal/config"
+)
+
+// applyTimeout handles timeout DURATION COMMAND [ARG...], which runs an
+// external command, in the foreground or as a job, and kills it if it is
+// still running after DURATION. A DURATION of 0 lifts the configured
+// command_timeout.
+func (s *Shell) applyTimeout(st *stage) error {
+	if len(st.args) < 3 {
+		return fmt.Errorf("timeout: usage: timeout DURATION COMMAND [ARG...]")
+	}
+	timeout, err := config.ParseDuration(st.args[1])
+	if err != nil {
+		return fmt.Errorf("timeout: %w", err)
+	}
+	name := st.args[2]
+	if s.isCommandBuiltin(name) && !isWrapper(name) {
+		return fmt.Errorf("timeout: %s: only external commands can be timed out", name)
+	}
+
+	st.args = st.args[2:]
+	st.builtin = isWrapper(name)
+	st.timeout = timeout
+	if timeout == 0 {
+		st.timeout = noTimeout
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"shell/internal/executor"
+	"shell/pkg/parser"
+)
+
+// cpuUsage adds up the CPU time of the external commands the shell has
+// waited for, which time reports.
+type cpuUsage struct {
+	mu        sync.Mutex
+	user, sys time.Duration
+}
+
+func (u *cpuUsage) add(res executor.Result) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.user += res.UserTime
+	u.sys += res.SystemTime
+}
+
+func (u *cpuUsage) get() (user, sys time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.user, u.sys
+}
+
+// timePipeline runs a pipeline started with the time keyword and reports
+// its real, user and system time on stderr, the way bash does.
+func (s *Shell) timePipeline(pipeline *parser.Pipeline, run func() error) error {
+	start := time.Now()
+	user, sys := s.usage.get()
+	err := run()
+	elapsed := time.Since(start)
+	endUser, endSys := s.usage.get()
+	user, sys = endUser-user, endSys-sys
+
+	if pipeline.TimePOSIX {
+		fmt.Fprintf(os.Stderr, "real %.2f\nuser %.2f\nsys %.2f\n", elapsed.Seconds(), user.Seconds(), sys.Seconds())
+	} else {
+		fmt.Fprintf(os.Stderr, "\nreal\t%s\nuser\t%s\nsys\t%s\n", bashTime(elapsed), bashTime(user), bashTime(sys))
+	}
+	return err
+}
+
+// bashTime formats d as bash's time does, e.g. 0m1.250s.
+func bashTime(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	minutes := d / time.Minute
+	return fmt.Sprintf("%dm%.3fs", minutes, (d - minutes*time.Minute).Seconds())
+}
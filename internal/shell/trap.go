@@ -0,0 +1,263 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// trapExit is the pseudo-signal whose trap runs when the shell exits.
+const trapExit = "EXIT"
+
+// Traps run between commands, on the shell's own goroutine: a signal that
+// arrives while a command runs is queued until it finishes. At the prompt
+// the signal goroutine runs the trap itself, holding execMu, which the
+// main loop holds whenever it is not waiting for input.
+
+// trap implements trap [-p] [[ACTION] SIGNAL...]. ACTION is run when one
+// of the signals arrives; an empty ACTION ignores them and - restores
+// their default handling.
+func (s *Shell) trap(args []string) error {
+	if len(args) > 0 && args[0] == "-l" {
+		fmt.Println(strings.Join(signalList(), " "))
+		return nil
+	}
+	if len(args) == 0 || args[0] == "-p" {
+		s.printTraps(args)
+		return nil
+	}
+	if len(args) == 1 {
+		return fmt.Errorf("trap: usage: trap [-lp] [[ACTION] SIGNAL...]")
+	}
+	if args[0] == "--" {
+		args = args[1:]
+	}
+
+	action, names := args[0], args[1:]
+	var errs []error
+	for _, name := range names {
+		sig, ok := parseSignal(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("trap: %s: invalid signal specification", name))
+			continue
+		}
+		s.setTrap(sig, action)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Shell) setTrap(name, action string) {
+	s.trapMu.Lock()
+	defer s.trapMu.Unlock()
+
+	if action == "-" {
+		delete(s.traps, name)
+	} else {
+		s.traps[name] = action
+	}
+	sig, ok := signalNames[name]
+	if !ok {
+		return
+	}
+	switch action {
+	case "-":
+		s.resetSignal(sig)
+	case "":
+		signal.Ignore(sig)
+	default:
+		signal.Notify(s.signalChan, sig)
+	}
+}
+
+func (s *Shell) printTraps(args []string) {
+	s.trapMu.Lock()
+	defer s.trapMu.Unlock()
+
+	names := make([]string, 0, len(s.traps))
+	if len(args) > 1 {
+		for _, name := range args[1:] {
+			if sig, ok := parseSignal(name); ok {
+				names = append(names, sig)
+			}
+		}
+	} else {
+		for name := range s.traps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if action, ok := s.traps[name]; ok {
+			fmt.Printf("trap -- %s %s\n", shellquote.Join(action), name)
+		}
+	}
+}
+
+// parseSignal returns the name used for a signal given as INT, SIGINT,
+// int, its number, or EXIT (0).
+func parseSignal(spec string) (string, bool) {
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	if name == trapExit || name == "0" {
+		return trapExit, true
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		for name, sig := range signalNames {
+			if signalNumber(sig) == n {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	_, ok := signalNames[name]
+	return name, ok
+}
+
+func signalList() []string {
+	names := []string{trapExit}
+	for name := range signalNames {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// signalName returns the trap name for sig.
+func signalName(sig os.Signal) string {
+	for name, known := range signalNames {
+		if known == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// resetSignal restores the handling sig had before it was trapped.
+func (s *Shell) resetSignal(sig os.Signal) {
+	signal.Reset(sig)
+	if s.handlesSignal(sig) {
+		signal.Notify(s.signalChan, sig)
+	}
+}
+
+// handlesSignal reports whether the shell catches sig even when it is
+// not trapped: the exitSignals, and Ctrl+C in an interactive shell, where
+// it should only stop the foreground command.
+func (s *Shell) handlesSignal(sig os.Signal) bool {
+	if sig == os.Interrupt && s.interactive {
+		return true
+	}
+	for _, exitSig := range exitSignals {
+		if sig == exitSig {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSignals queues the signals the shell is notified of and runs
+// their traps straight away if the shell is waiting at the prompt. An
+// untrapped Ctrl+C is left to the foreground command, which gets it from
+// the terminal too.
+func (s *Shell) handleSignals() {
+	for sig := range s.signalChan {
+		name := signalName(sig)
+		s.trapMu.Lock()
+		_, trapped := s.traps[name]
+		if trapped || sig != os.Interrupt {
+			s.pendingSignals = append(s.pendingSignals, name)
+		}
+		s.trapMu.Unlock()
+
+		if s.execMu.TryLock() {
+			s.runPendingTraps()
+			exiting := s.exitRequested
+			s.execMu.Unlock()
+			if exiting {
+				// Stop waiting for input so Run can exit.
+				s.reader.Close()
+			} else {
+				s.reader.Refresh()
+			}
+		}
+	}
+}
+
+// runPendingTraps runs the traps of the signals that arrived since it was
+// last called. Whoever calls it must hold execMu.
+func (s *Shell) runPendingTraps() {
+	s.trapMu.Lock()
+	pending := s.pendingSignals
+	s.pendingSignals = nil
+	s.trapMu.Unlock()
+
+	for _, name := range pending {
+		s.runTrap(name)
+	}
+}
+
+// runTrap runs the action trapped for name, if any. $? is kept, unless
+// the action runs exit.
+func (s *Shell) runTrap(name string) {
+	s.trapMu.Lock()
+	action, trapped := s.traps[name]
+	s.trapMu.Unlock()
+	if !trapped && name != trapExit {
+		// Only the exitSignals are delivered without a trap.
+		s.terminate(name)
+		return
+	}
+	if action == "" {
+		return
+	}
+
+	status := s.lastStatus
+	err := s.Execute(action)
+	var exitStatus ExitStatus
+	if err != nil && !errors.As(err, &exitStatus) {
+		fmt.Fprintf(os.Stderr, "Error: trap %s: %v\n", name, err)
+	}
+	if s.exitRequested {
+		s.lastStatus = exitCode(err)
+	} else {
+		s.lastStatus = status
+	}
+}
+
+// terminate makes the shell exit cleanly, as exit would, on a signal
+// such as SIGTERM that was not trapped. The exit status is that of a
+// process killed by the signal. A hangup is passed on to running jobs.
+func (s *Shell) terminate(name string) {
+	if name == "HUP" {
+		s.hangUpJobs()
+	}
+	s.exitRequested = true
+	s.lastStatus = 128 + signalNumber(signalNames[name])
+}
+
+// hangUpJobs sends SIGHUP to every process of the jobs that have not
+// finished, those stopped by a signal as well as those running: both
+// still have the status "Running".
+func (s *Shell) hangUpJobs() {
+	for _, job := range s.jobs {
+		if job.Status() == "Running" && job.PID != 0 {
+			hangUp(job.PID)
+		}
+	}
+}
+
+// runExitTrap runs the EXIT trap as the shell exits, without changing its
+// exit status.
+func (s *Shell) runExitTrap() {
+	status := s.lastStatus
+	s.exitRequested = false
+	s.runTrap(trapExit)
+	if !s.exitRequested {
+		s.lastStatus = status
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package shell
+
+import "syscall"
+
+func getUmask() (int, error) {
+	// The mask can only be read by setting it, so it is set back.
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return mask, nil
+}
+
+func setUmask(mask int) error {
+	syscall.Umask(mask)
+	return nil
+}
@@ -0,0 +1,11 @@
+package shell
+
+// Windows has no file creation mask.
+
+func getUmask() (int, error) {
+	return 0, errLimitsUnsupported
+}
+
+func setUmask(mask int) error {
+	return errLimitsUnsupported
+}
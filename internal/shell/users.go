@@ -0,0 +1,79 @@
+package shell
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+// systemUsers returns the names of the users in /etc/passwd and their
+// home directories. Where there is no /etc/passwd there are none.
+func systemUsers() map[string]string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 6 || fields[0] == "" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, ok := users[fields[0]]; !ok {
+			users[fields[0]] = fields[5]
+		}
+	}
+	return users
+}
+
+// userHome returns the home directory of the user name.
+func userHome(name string) (string, bool) {
+	u, err := user.Lookup(name)
+	if err != nil || u.HomeDir == "" {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// userCandidates completes ~name to ~user/ for the system's users, each
+// described by their home directory.
+func (c *completer) userCandidates(word string) []string {
+	if c.described == nil {
+		c.described = make(map[string]string)
+	}
+	var candidates []string
+	for name, home := range systemUsers() {
+		if _, ok := c.shell.matchCompletion(word[1:], name); ok {
+			candidate := "~" + name + "/"
+			candidates = append(candidates, candidate)
+			c.described[candidate] = home
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// expandPath expands what a path being completed starts with, ~ or
+// ~user, and the $NAME and ${NAME} in it, so that the files it names can
+// be read while the path stays as typed.
+func (c *completer) expandPath(path string) string {
+	if strings.HasPrefix(path, "~") {
+		name, rest, _ := strings.Cut(path[1:], "/")
+		if name == "" {
+			path = expandTilde(path)
+		} else if home, ok := userHome(name); ok {
+			path = home + "/" + rest
+		}
+	}
+	if strings.ContainsRune(path, '$') {
+		path = os.Expand(path, func(name string) string {
+			value, _ := c.shell.lookupVar(name)
+			return value
+		})
+	}
+	return path
+}
@@ -0,0 +1,346 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// varAttrs are the attributes declare gives variables.
+type varAttrs uint8
+
+const (
+	attrInteger varAttrs = 1 << iota
+	attrReadonly
+	attrExport
+)
+
+// attrLetters are declare's options for the attributes, in the order
+// declare -p prints them.
+const attrLetters = "irx"
+
+func attrFor(letter byte) varAttrs {
+	switch letter {
+	case 'i':
+		return attrInteger
+	case 'r':
+		return attrReadonly
+	case 'x':
+		return attrExport
+	}
+	return 0
+}
+
+// setVar sets a variable: the innermost local one of that name, if there
+// is one, or else the global one. Readonly variables cannot be set, the
+// values of integer ones are evaluated with arith, and exported ones are
+// passed on to commands.
+func (s *Shell) setVar(name, value string) error {
+	attrs := s.attrs[name]
+	if attrs&attrReadonly != 0 {
+		return fmt.Errorf("%s: readonly variable", name)
+	}
+	if attrs&attrInteger != 0 {
+		n, err := s.arith(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		value = strconv.FormatInt(n, 10)
+	}
+	if attrs&attrExport != 0 {
+		os.Setenv(name, value)
+	}
+	for i := len(s.scopes) - 1; i >= 0; i-- {
+		if _, ok := s.scopes[i][name]; ok {
+			s.scopes[i][name] = value
+			return nil
+		}
+	}
+	s.vars[name] = value
+	return nil
+}
+
+// lookupVar resolves a shell variable, local ones first, falling back to
+// the environment.
+func (s *Shell) lookupVar(name string) (string, bool) {
+	for i := len(s.scopes) - 1; i >= 0; i-- {
+		if v, ok := s.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+	if v, ok := s.vars[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+// pushScope starts a function call's scope, for its local variables, and
+// popScope ends it, so the variables they hid are seen again.
+func (s *Shell) pushScope() {
+	s.scopes = append(s.scopes, make(map[string]string))
+}
+
+func (s *Shell) popScope() {
+	s.scopes = s.scopes[:len(s.scopes)-1]
+}
+
+// local declares variables local to the function call running, as
+// local NAME or local NAME=VALUE. local alone lists them.
+func (s *Shell) local(args []string) error {
+	if len(s.scopes) == 0 {
+		return fmt.Errorf("local: can only be used in a function")
+	}
+	scope := s.scopes[len(s.scopes)-1]
+	if len(args) == 0 {
+		printVars(scope)
+		return nil
+	}
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		if !isVarName(name) {
+			return fmt.Errorf("local: `%s': not a valid identifier", name)
+		}
+		if s.attrs[name]&attrReadonly != 0 {
+			return fmt.Errorf("local: %s: readonly variable", name)
+		}
+		scope[name] = value
+	}
+	return nil
+}
+
+// declare gives variables attributes: -i (integer), -r (readonly) and -x
+// (exported), which +i and +x take away again. NAME=VALUE sets a value
+// too. declare -p prints variables as declare commands, and with
+// attributes alone lists the variables that have them; --json prints
+// them as JSON instead. cmd is declare or typeset.
+func (s *Shell) declare(cmd string, args []string) error {
+	var on, off varAttrs
+	print, asJSON := false, false
+	for len(args) > 0 && len(args[0]) > 1 && (args[0][0] == '-' || args[0][0] == '+') {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		if arg == "--json" {
+			print, asJSON = true, true
+			continue
+		}
+		for _, letter := range []byte(arg[1:]) {
+			if letter == 'p' && arg[0] == '-' {
+				print = true
+				continue
+			}
+			attr := attrFor(letter)
+			if attr == 0 {
+				return fmt.Errorf("%s: %c%c: invalid option", cmd, arg[0], letter)
+			}
+			if arg[0] == '-' {
+				on |= attr
+			} else {
+				off |= attr
+			}
+		}
+	}
+	if off&attrReadonly != 0 {
+		return fmt.Errorf("%s: +r: readonly variables stay readonly", cmd)
+	}
+
+	if len(args) == 0 {
+		if !print && on == 0 {
+			s.listVars()
+			return nil
+		}
+		// Listing the exported variables takes in the environment too.
+		for _, name := range s.varNames(on&attrExport != 0) {
+			if s.attrsOf(name)&on == on {
+				args = append(args, name)
+			}
+		}
+		if !asJSON {
+			for _, name := range args {
+				s.printDeclared(name)
+			}
+			return nil
+		}
+	} else if print {
+		for _, name := range args {
+			if _, ok := s.lookupVar(name); !ok && s.attrs[name] == 0 {
+				return fmt.Errorf("%s: %s: not found", cmd, name)
+			}
+			if !asJSON {
+				s.printDeclared(name)
+			}
+		}
+	}
+	if asJSON {
+		if err := printJSON(s.declaredJSON(args)); err != nil {
+			return fmt.Errorf("%s: %w", cmd, err)
+		}
+		return nil
+	}
+	if print {
+		return nil
+	}
+
+	for _, arg := range args {
+		name, value, assign := strings.Cut(arg, "=")
+		if !isVarName(name) {
+			return fmt.Errorf("%s: `%s': not a valid identifier", cmd, name)
+		}
+		attrs := s.attrs[name]
+		if attrs&attrReadonly != 0 && (assign || off != 0 || on&^attrReadonly&^attrs != 0) {
+			return fmt.Errorf("%s: %s: readonly variable", cmd, name)
+		}
+		if s.attrs == nil {
+			s.attrs = make(map[string]varAttrs)
+		}
+		// Readonly comes last, once the value is set.
+		s.attrs[name] = attrs&^off | on&^attrReadonly
+		if off&attrExport != 0 {
+			if value, ok := s.lookupVar(name); ok {
+				s.vars[name] = value
+			}
+			os.Unsetenv(name)
+		}
+		if assign {
+			if err := s.setVar(name, value); err != nil {
+				return fmt.Errorf("%s: %w", cmd, err)
+			}
+		} else if value, ok := s.lookupVar(name); ok && on&attrExport != 0 {
+			os.Setenv(name, value)
+		}
+		s.attrs[name] |= on & attrReadonly
+	}
+	return nil
+}
+
+// varNames returns the names of the shell's variables and of those given
+// attributes, with those of the environment variables if env is set,
+// sorted.
+func (s *Shell) varNames(env bool) []string {
+	seen := make(map[string]bool)
+	if env {
+		for _, kv := range os.Environ() {
+			if name, _, _ := strings.Cut(kv, "="); isVarName(name) {
+				seen[name] = true
+			}
+		}
+	}
+	for name := range s.vars {
+		seen[name] = true
+	}
+	for _, scope := range s.scopes {
+		for name := range scope {
+			seen[name] = true
+		}
+	}
+	for name := range s.attrs {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// attrsOf returns a variable's attributes. Environment variables are
+// exported whether or not declare made them so.
+func (s *Shell) attrsOf(name string) varAttrs {
+	attrs := s.attrs[name]
+	if _, ok := os.LookupEnv(name); ok {
+		attrs |= attrExport
+	}
+	return attrs
+}
+
+// printDeclared prints the declare command that gives a variable its
+// attributes and value.
+func (s *Shell) printDeclared(name string) {
+	flags := ""
+	for _, letter := range []byte(attrLetters) {
+		if s.attrsOf(name)&attrFor(letter) != 0 {
+			flags += string(letter)
+		}
+	}
+	if flags == "" {
+		flags = "-"
+	}
+	if value, ok := s.lookupVar(name); ok {
+		fmt.Printf("declare -%s %s=%s\n", flags, name, shellquote.Join(value))
+	} else {
+		fmt.Printf("declare -%s %s\n", flags, name)
+	}
+}
+
+// varJSON is a variable as declare --json prints it. Value is left out
+// for a variable given attributes but no value.
+type varJSON struct {
+	Name       string   `json:"name"`
+	Value      *string  `json:"value,omitempty"`
+	Attributes []string `json:"attributes"`
+}
+
+// attrNames are the names --json gives the attributes, by letter.
+var attrNames = map[byte]string{'i': "integer", 'r': "readonly", 'x': "export"}
+
+func (s *Shell) declaredJSON(names []string) []varJSON {
+	list := make([]varJSON, 0, len(names))
+	for _, name := range names {
+		item := varJSON{Name: name, Attributes: []string{}}
+		if value, ok := s.lookupVar(name); ok {
+			item.Value = &value
+		}
+		for _, letter := range []byte(attrLetters) {
+			if s.attrsOf(name)&attrFor(letter) != 0 {
+				item.Attributes = append(item.Attributes, attrNames[letter])
+			}
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// SetArgs sets $0 and the positional parameters, as for a script run
+// with arguments.
+func (s *Shell) SetArgs(arg0 string, args []string) {
+	s.arg0, s.args = arg0, args
+}
+
+// shift drops the first n positional parameters, 1 by default, so that
+// $n+1 becomes $1.
+func (s *Shell) shift(args []string) error {
+	n := 1
+	if len(args) > 1 {
+		return fmt.Errorf("shift: too many arguments")
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+			return fmt.Errorf("shift: %s: numeric argument required", args[0])
+		}
+	}
+	if n > len(s.args) {
+		return fmt.Errorf("shift: %d: shift count out of range", n)
+	}
+	s.args = s.args[n:]
+	return nil
+}
+
+func isVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && (i == 0 || !(c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
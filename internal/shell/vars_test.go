@@ -0,0 +1,148 @@
+package shell
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"shell/internal/executor"
+)
+
+// expectVar checks the value a variable has, or that it has none when
+// want is nil.
+func expectVar(t *testing.T, s *Shell, name string, want *string) {
+	t.Helper()
+	got, ok := s.lookupVar(name)
+	switch {
+	case want == nil && ok:
+		t.Errorf("$%s = %q, want it unset", name, got)
+	case want != nil && (!ok || got != *want):
+		t.Errorf("$%s = %q (set %v), want %q", name, got, ok, *want)
+	}
+}
+
+func value(v string) *string {
+	return &v
+}
+
+func TestLocal(t *testing.T) {
+	s := newTestShell(t, executor.Local{})
+	if err := s.Execute("local x=1"); err == nil {
+		t.Error("local outside a function did not fail")
+	}
+
+	run := func(line string) {
+		t.Helper()
+		if err := s.Execute(line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+	run("x=global y=global")
+	s.pushScope()
+	run("local x=outer z")
+	run("y=changed")
+	expectVar(t, s, "x", value("outer"))
+	expectVar(t, s, "z", value(""))
+
+	s.pushScope()
+	run("local x=inner")
+	run("x=set")
+	expectVar(t, s, "x", value("set"))
+	s.popScope()
+	expectVar(t, s, "x", value("outer"))
+
+	s.popScope()
+	expectVar(t, s, "x", value("global"))
+	expectVar(t, s, "y", value("changed"))
+	expectVar(t, s, "z", nil)
+}
+
+func TestDeclare(t *testing.T) {
+	s := newTestShell(t, executor.Local{})
+	run := func(line string) error {
+		t.Helper()
+		return s.Execute(line)
+	}
+
+	if err := run("declare -i n=2+3"); err != nil {
+		t.Fatal(err)
+	}
+	expectVar(t, s, "n", value("5"))
+	if err := run("n=n*4"); err != nil {
+		t.Fatal(err)
+	}
+	expectVar(t, s, "n", value("20"))
+	if err := run("declare +i n; n=1+1"); err != nil {
+		t.Fatal(err)
+	}
+	expectVar(t, s, "n", value("1+1"))
+
+	if err := run("typeset -r r=fixed"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"r=other", "declare r=other", "declare +r r", "declare -x r", "local r"} {
+		if err := run(line); err == nil {
+			t.Errorf("%s: changed a readonly variable", line)
+		}
+	}
+	expectVar(t, s, "r", value("fixed"))
+
+	const name = "MYSHELL_TEST_DECLARE"
+	t.Cleanup(func() { os.Unsetenv(name) })
+	if err := run("declare -x " + name + "=out"); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv(name); got != "out" {
+		t.Errorf("declare -x: environment has %q, want out", got)
+	}
+	if err := run("declare +x " + name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := os.LookupEnv(name); ok {
+		t.Error("declare +x left the variable in the environment")
+	}
+	expectVar(t, s, name, value("out"))
+
+	for _, line := range []string{"declare -q x", "declare 1x=2"} {
+		if err := run(line); err == nil {
+			t.Errorf("%s did not fail", line)
+		}
+	}
+}
+
+func TestShift(t *testing.T) {
+	s := newTestShell(t, executor.Local{})
+	s.SetArgs("script", []string{"a", "b", "c", "d"})
+
+	tests := []struct {
+		line string
+		args []string
+		fail bool
+	}{
+		{"shift", []string{"b", "c", "d"}, false},
+		{"shift 2", []string{"d"}, false},
+		{"shift 2", []string{"d"}, true},
+		{"shift x", []string{"d"}, true},
+		{"shift 1 2", []string{"d"}, true},
+		{"shift 0", []string{"d"}, false},
+		{"shift 1", []string{}, false},
+	}
+	for _, tt := range tests {
+		err := s.Execute(tt.line)
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: error %v, want failure %v", tt.line, err, tt.fail)
+		}
+		if !slices.Equal(s.args, tt.args) {
+			t.Errorf("after %s, the arguments are %q, want %q", tt.line, s.args, tt.args)
+		}
+	}
+
+	s.SetArgs("script", []string{"one", "two words"})
+	got, err := s.Expand(`echo $0 $# "$1" "$2" "$@"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"echo", "script", "2", "one", "two words", "one", "two words"}; !slices.Equal(got, want) {
+		t.Errorf("expands to %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,697 @@
+package shell
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"shell/internal/executor"
+	"shell/pkg/parser"
+)
+
+// Execute parses input and runs it, returning the result of the last
+// command run.
+func (s *Shell) Execute(input string) error {
+	list, err := parser.Parse(input)
+	if err != nil {
+		return err
+	}
+	return s.runList(list)
+}
+
+// Expand parses input and expands the words of its commands as running
+// it would, returning the fields they expand to, without running
+// anything.
+func (s *Shell) Expand(input string) ([]string, error) {
+	list, err := parser.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	for _, stmt := range list.Stmts {
+		for _, pipeline := range stmt.AndOr.Pipelines {
+			for _, cmd := range pipeline.Commands {
+				for _, word := range cmd.Words {
+					expanded, err := s.expandWord(word)
+					if err != nil {
+						return nil, err
+					}
+					fields = append(fields, expanded...)
+				}
+			}
+		}
+	}
+	return fields, nil
+}
+
+func (s *Shell) runList(list *parser.List) error {
+	var err error
+	for i, stmt := range list.Stmts {
+		err = s.runStmt(stmt)
+		if i == len(list.Stmts)-1 {
+			break
+		}
+		s.lastStatus = exitCode(err)
+		report(err)
+		if s.stopping() {
+			return ExitStatus(s.lastStatus)
+		}
+	}
+	return err
+}
+
+func (s *Shell) runStmt(stmt *parser.Stmt) error {
+	if !stmt.Background {
+		return s.runAndOr(stmt.AndOr)
+	}
+	pipelines := stmt.AndOr.Pipelines
+	if len(pipelines) > 1 || len(pipelines[0].Commands) > 1 || pipelines[0].Negated || pipelines[0].Timed {
+		return errors.New("only a single command can be run in the background")
+	}
+	return s.runCommand(pipelines[0].Commands[0], true)
+}
+
+// runAndOr runs the pipelines of an && or || list for as long as their
+// results call for the next one.
+func (s *Shell) runAndOr(andOr *parser.AndOr) error {
+	err := s.runPipeline(andOr.Pipelines[0])
+	for i, op := range andOr.Ops {
+		if s.exitRequested {
+			break
+		}
+		if (op == "&&") != (exitCode(err) == 0) {
+			continue
+		}
+		s.lastStatus = exitCode(err)
+		reportTested(err)
+		err = s.runPipeline(andOr.Pipelines[i+1])
+	}
+	return err
+}
+
+func (s *Shell) runPipeline(pipeline *parser.Pipeline) error {
+	run := func() error {
+		if len(pipeline.Commands) == 1 {
+			return s.runCommand(pipeline.Commands[0], false)
+		}
+		return s.runStages(pipeline.Commands)
+	}
+	var err error
+	if pipeline.Timed {
+		err = s.timePipeline(pipeline, run)
+	} else {
+		err = run()
+	}
+	if !pipeline.Negated {
+		return err
+	}
+	if exitCode(err) == 0 {
+		return ExitStatus(1)
+	}
+	reportTested(err)
+	return nil
+}
+
+func (s *Shell) runCommand(cmd *parser.Command, background bool) error {
+	st, err := s.prepare(cmd)
+	if err != nil {
+		return err
+	}
+	defer st.close()
+	if err := s.redirect(st, cmd.Redirects); err != nil {
+		return err
+	}
+	s.trace(st)
+	return s.runStage(st, background)
+}
+
+// stage is a command expanded and ready to run, on its own or as part of
+// a pipeline.
+type stage struct {
+	args []string
+	// env holds the NAME=value assignments written before the command.
+	env []string
+	// in, out and errOut replace the shell's standard files when set.
+	in, out, errOut *os.File
+	// fds are the files redirected to descriptors 3 to 9, nil for those
+	// closed with N>&-.
+	fds map[int]*os.File
+	// files are closed once the command finishes.
+	files   []*os.File
+	builtin bool
+	// timeout overrides the configured command timeout when set; it is
+	// noTimeout for none.
+	timeout time.Duration
+	// limits are those set with the limit builtin.
+	limits executor.Limits
+	// sandbox is set for a command run in a sandbox.
+	sandbox *executor.Sandbox
+	// executor runs the command instead of the shell's, as for one run
+	// in a container.
+	executor executor.Executor
+	// capture names the variable capture sets to the output.
+	capture string
+}
+
+const noTimeout time.Duration = -1
+
+func (st *stage) close() {
+	for _, f := range st.files {
+		f.Close()
+	}
+	st.files = nil
+}
+
+// prepare expands a command's words, aliases and assignments.
+// Assignments without a command set shell variables. Its redirections
+// are left to redirect, once any pipes are in place.
+func (s *Shell) prepare(cmd *parser.Command) (*stage, error) {
+	st := &stage{}
+	for _, word := range cmd.Words {
+		fields, err := s.expandWord(word)
+		if err != nil {
+			return nil, err
+		}
+		st.args = append(st.args, fields...)
+	}
+	if len(st.args) > 0 {
+		args, err := s.expandAliases(st.args)
+		if err != nil {
+			return nil, err
+		}
+		st.args = args
+	}
+	for _, assign := range cmd.Assignments {
+		value := s.expandString(assign.Value)
+		if len(st.args) == 0 {
+			if err := s.setVar(assign.Name, value); err != nil {
+				return nil, err
+			}
+		} else if s.attrs[assign.Name]&attrReadonly != 0 {
+			return nil, fmt.Errorf("%s: readonly variable", assign.Name)
+		} else {
+			st.env = append(st.env, assign.Name+"="+value)
+		}
+	}
+	if len(st.args) > 0 && isRemoteHost(st.args[0]) {
+		return st, s.applyRemoteHost(st)
+	}
+	if len(st.args) > 0 && !s.isCommandBuiltin(st.args[0]) && s.remote == nil {
+		args, err := s.resolveCommand(st.args)
+		if err != nil {
+			return nil, err
+		}
+		st.args = args
+	}
+	st.builtin = len(st.args) == 0 || s.isCommandBuiltin(st.args[0])
+	for st.builtin && len(st.args) > 0 && isWrapper(st.args[0]) {
+		var err error
+		switch st.args[0] {
+		case "timeout":
+			err = s.applyTimeout(st)
+		case "limit":
+			err = s.applyLimits(st)
+		case "sandbox":
+			err = s.applySandbox(st)
+		case "in-container":
+			err = s.applyContainer(st)
+		case "capture":
+			err = s.applyCapture(st)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !st.builtin && st.sandbox == nil && s.alwaysSandboxed(st.args[0]) {
+		st.sandbox = s.sandboxPolicy()
+	}
+	if !st.builtin && st.executor == nil && s.remote == nil {
+		st.executor = s.projectContainer()
+	}
+	// Containers and remote hosts have no sandbox, so a command that is
+	// meant to be sandboxed is not run there at all.
+	if st.sandbox != nil && (st.executor != nil || s.remote != nil) {
+		return nil, fmt.Errorf("sandbox: %s: only local commands can be sandboxed", st.args[0])
+	}
+	return st, nil
+}
+
+// isWrapper reports whether name is a builtin that runs an external
+// command with settings of its own, and so can wrap another.
+func isWrapper(name string) bool {
+	switch name {
+	case "timeout", "limit", "sandbox", "in-container", "capture":
+		return true
+	}
+	return false
+}
+
+// redirect opens a stage's redirections, in order, so that in 2>&1 >file
+// standard error goes where standard output went before.
+func (s *Shell) redirect(st *stage, redirects []*parser.Redirect) error {
+	for _, r := range redirects {
+		fd := r.Fd
+		if fd < 0 {
+			fd = 1
+			if r.Op[0] == '<' {
+				fd = 0
+			}
+		}
+		if fd > maxFd {
+			return fmt.Errorf("%d%s: only descriptors 0 to %d can be redirected", fd, r.Op, maxFd)
+		}
+		names, err := s.expandWord(r.Target)
+		if err != nil {
+			return err
+		}
+		if len(names) != 1 {
+			return fmt.Errorf("%s: ambiguous redirect", s.expandString(r.Target))
+		}
+		if r.Op == "<&" || r.Op == ">&" {
+			if err := s.duplicate(st, fd, r.Op, names[0]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		switch r.Op {
+		case "<":
+			flag = os.O_RDONLY
+		case ">>":
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		case "<>":
+			flag = os.O_RDWR | os.O_CREATE
+		}
+		f, err := os.OpenFile(names[0], flag, 0o666)
+		if err != nil {
+			return err
+		}
+		st.files = append(st.files, f)
+		st.setFile(fd, f)
+	}
+	return nil
+}
+
+// duplicate applies N>&M or N<&M, making descriptor fd a copy of M, or
+// N>&- to close it. >&FILE sends both standard output and error to FILE,
+// as in bash.
+func (s *Shell) duplicate(st *stage, fd int, op, target string) error {
+	if target == "-" {
+		if fd > 2 {
+			st.setFile(fd, nil)
+			return nil
+		}
+		// Commands need their standard files, so a closed one reads
+		// nothing and swallows what is written.
+		f, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		st.files = append(st.files, f)
+		st.setFile(fd, f)
+		return nil
+	}
+	from, err := strconv.Atoi(target)
+	if err != nil || from < 0 {
+		if op == ">&" && fd == 1 {
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+			if err != nil {
+				return err
+			}
+			st.files = append(st.files, f)
+			st.out, st.errOut = f, f
+			return nil
+		}
+		return fmt.Errorf("%s: ambiguous redirect", target)
+	}
+	f := st.file(s, from)
+	if f == nil {
+		return fmt.Errorf("%d%s%s: bad file descriptor", fd, op, target)
+	}
+	st.setFile(fd, f)
+	return nil
+}
+
+// file returns the file a stage has as descriptor fd so far, or nil if
+// it is not open.
+func (st *stage) file(s *Shell, fd int) *os.File {
+	switch fd {
+	case 0:
+		return cmp.Or(st.in, os.Stdin)
+	case 1:
+		return cmp.Or(st.out, os.Stdout)
+	case 2:
+		return cmp.Or(st.errOut, os.Stderr)
+	}
+	if f, ok := st.fds[fd]; ok {
+		return f
+	}
+	return s.fds[fd]
+}
+
+// setFile makes f the stage's descriptor fd. A nil f closes one of 3 to 9.
+func (st *stage) setFile(fd int, f *os.File) {
+	switch fd {
+	case 0:
+		st.in = f
+	case 1:
+		st.out = f
+	case 2:
+		st.errOut = f
+	default:
+		if st.fds == nil {
+			st.fds = make(map[int]*os.File)
+		}
+		st.fds[fd] = f
+	}
+}
+
+// maxFd is the highest descriptor that can be redirected, as in the
+// Bourne shell.
+const maxFd = 9
+
+// extraFiles returns the files external commands get as descriptors 3
+// on: those exec opened for the shell, and the stage's own.
+func (s *Shell) extraFiles(st *stage) []*os.File {
+	var files []*os.File
+	for fd := 3; fd <= maxFd; fd++ {
+		if f := st.file(s, fd); f != nil {
+			for len(files) < fd-3 {
+				files = append(files, nil)
+			}
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// runStages runs a pipeline of several commands. External commands run
+// concurrently; builtins run one after the other in the shell itself
+// while they do.
+func (s *Shell) runStages(cmds []*parser.Command) error {
+	stages := make([]*stage, 0, len(cmds))
+	defer func() {
+		for _, st := range stages {
+			st.close()
+		}
+	}()
+	for _, cmd := range cmds {
+		st, err := s.prepare(cmd)
+		if err != nil {
+			return err
+		}
+		stages = append(stages, st)
+	}
+
+	for i, st := range stages[:len(stages)-1] {
+		next := stages[i+1]
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		st.files = append(st.files, w)
+		if st.builtin && next.builtin {
+			// The second only starts once the first has finished, so
+			// its output is buffered rather than filling the pipe.
+			r = buffer(r)
+		}
+		next.files = append(next.files, r)
+		st.out, next.in = w, r
+	}
+	// Redirections come after the pipes, so they can override them and
+	// 2>&1 sends standard error down the pipe.
+	for i, st := range stages {
+		if err := s.redirect(st, cmds[i].Redirects); err != nil {
+			return err
+		}
+	}
+	for _, st := range stages {
+		st.in = cmp.Or(st.in, os.Stdin)
+		st.out = cmp.Or(st.out, os.Stdout)
+		st.errOut = cmp.Or(st.errOut, os.Stderr)
+		s.trace(st)
+	}
+
+	errs := make([]error, len(stages))
+	var wg sync.WaitGroup
+	for i, st := range stages {
+		if st.builtin {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.runStage(st, false)
+			st.close()
+		}()
+	}
+	for i, st := range stages {
+		if st.builtin {
+			errs[i] = s.runStage(st, false)
+			st.close()
+		}
+	}
+	wg.Wait()
+
+	for _, err := range errs[:len(errs)-1] {
+		reportTested(err)
+	}
+	return errs[len(errs)-1]
+}
+
+// buffer reads everything from r and returns a pipe to read it back from.
+func buffer(r *os.File) *os.File {
+	br, bw, err := os.Pipe()
+	if err != nil {
+		return r
+	}
+	go func() {
+		data, _ := io.ReadAll(r)
+		r.Close()
+		bw.Write(data)
+		bw.Close()
+	}()
+	return br
+}
+
+func (s *Shell) runStage(st *stage, background bool) error {
+	if len(st.args) == 0 {
+		return nil
+	}
+	if st.capture != "" {
+		return s.runCaptured(st, background)
+	}
+	if !st.builtin {
+		return s.runExternal(st, background)
+	}
+	if st.args[0] == "exec" {
+		return s.exec(st)
+	}
+
+	defer s.applyStage(st)()
+	if ok, err := s.executeBuiltin(st.args); ok {
+		return err
+	}
+	_, err := s.executePluginBuiltin(st.args)
+	return err
+}
+
+// applyStage points the shell's standard files and environment at those
+// of a builtin's stage, returning a function that puts them back.
+func (s *Shell) applyStage(st *stage) func() {
+	in, out, errOut, redirected := os.Stdin, os.Stdout, os.Stderr, s.stdinRedirected
+	if st.in != nil && st.in != os.Stdin {
+		os.Stdin = st.in
+		s.stdinRedirected = true
+	}
+	os.Stdout = cmp.Or(st.out, os.Stdout)
+	os.Stderr = cmp.Or(st.errOut, os.Stderr)
+
+	saved := make(map[string]*string)
+	for _, kv := range st.env {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, done := saved[name]; !done {
+			saved[name] = nil
+			if old, ok := os.LookupEnv(name); ok {
+				saved[name] = &old
+			}
+		}
+		os.Setenv(name, value)
+	}
+
+	return func() {
+		os.Stdin, os.Stdout, os.Stderr, s.stdinRedirected = in, out, errOut, redirected
+		for name, old := range saved {
+			if old == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *old)
+			}
+		}
+	}
+}
+
+// trace prints a command before it runs when xtrace is set.
+func (s *Shell) trace(st *stage) {
+	if s.options[OptionXtrace] && len(st.args) > 0 {
+		words := append(append([]string{}, st.env...), st.args...)
+		fmt.Fprintf(os.Stderr, "+ %s\n", strings.Join(words, " "))
+	}
+}
+
+// expandWord expands the parameters in a word. The values of those
+// outside double quotes are split into fields at whitespace, and then
+// fields with unquoted pattern characters are replaced by the paths they
+// match. What happens to those that match nothing depends on the
+// nullglob and failglob options.
+func (s *Shell) expandWord(word *parser.Word) ([]string, error) {
+	// Each field is kept twice: as it is, and as a pattern in which
+	// quoted text matches only itself.
+	var fields, patterns []string
+	var field, pattern strings.Builder
+	inField := false
+	write := func(text string, quoted bool) {
+		field.WriteString(text)
+		if quoted {
+			text = globQuote(text)
+		}
+		pattern.WriteString(text)
+		inField = true
+	}
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *parser.Lit:
+			write(part.Value, part.Quoted)
+		case *parser.Param:
+			if part.Name == "@" && part.Quoted {
+				// "$@" is a field for each positional parameter.
+				for i, arg := range s.args {
+					if i > 0 {
+						fields, patterns = append(fields, field.String()), append(patterns, pattern.String())
+						field.Reset()
+						pattern.Reset()
+					}
+					write(arg, true)
+				}
+				continue
+			}
+			value := s.param(part.Name)
+			if part.Quoted {
+				write(value, true)
+				continue
+			}
+			for _, r := range value {
+				if !unicode.IsSpace(r) {
+					write(string(r), false)
+				} else if inField {
+					fields, patterns = append(fields, field.String()), append(patterns, pattern.String())
+					field.Reset()
+					pattern.Reset()
+					inField = false
+				}
+			}
+		}
+	}
+	if inField {
+		fields, patterns = append(fields, field.String()), append(patterns, pattern.String())
+	}
+
+	var expanded []string
+	for i, field := range fields {
+		if !isPattern(patterns[i]) {
+			expanded = append(expanded, field)
+			continue
+		}
+		matches, err := s.glob(patterns[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		if len(matches) == 0 {
+			switch {
+			case s.options[OptionFailglob]:
+				return nil, fmt.Errorf("no match: %s", field)
+			case !s.options[OptionNullglob]:
+				// A pattern that matches nothing is left as it is.
+				matches = []string{field}
+			}
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// expandString expands the parameters in a word without splitting it, as
+// for the value of an assignment.
+func (s *Shell) expandString(word *parser.Word) string {
+	var b strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *parser.Lit:
+			b.WriteString(part.Value)
+		case *parser.Param:
+			b.WriteString(s.param(part.Name))
+		}
+	}
+	return b.String()
+}
+
+// param returns the value of a parameter: a special parameter such as $?
+// or a variable.
+func (s *Shell) param(name string) string {
+	switch name {
+	case "?":
+		return strconv.Itoa(s.lastStatus)
+	case "$":
+		return strconv.Itoa(os.Getpid())
+	case "0":
+		return cmp.Or(s.arg0, os.Args[0])
+	case "#":
+		return strconv.Itoa(len(s.args))
+	case "@", "*":
+		return strings.Join(s.args, " ")
+	}
+	if value, ok := s.keptParam(name); ok {
+		return value
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n > 0 && n <= len(s.args) {
+			return s.args[n-1]
+		}
+		return ""
+	}
+	value, _ := s.lookupVar(name)
+	return value
+}
+
+// report prints the error a command failed with, unless it only carries
+// an exit status.
+func report(err error) {
+	var status ExitStatus
+	var syntax *parser.SyntaxError
+	switch {
+	case err == nil || errors.As(err, &status):
+	case errors.As(err, &syntax):
+		// The line is shown with a caret under the problem.
+		fmt.Fprintf(os.Stderr, "Error: %s\n", syntax.Diagnostic())
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// reportTested reports the error of a command whose status is only being
+// tested, as before || or in a pipeline, where just a failure to run it
+// is worth a message.
+func reportTested(err error) {
+	var failed commandFailed
+	if !errors.As(err, &failed) {
+		report(err)
+	}
+}
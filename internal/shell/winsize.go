@@ -0,0 +1,79 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-runewidth"
+
+	"shell/internal/lineedit"
+)
+
+// termSize is the size of the terminal. It is read again on SIGWINCH,
+// where there is one, and before each prompt and command, and exported as
+// COLUMNS and LINES so commands can lay out their output to fit.
+type termSize struct {
+	mu   sync.Mutex
+	cols int
+	rows int
+}
+
+func (s *Shell) updateSize() {
+	cols, rows, err := lineedit.GetSize(int(os.Stdout.Fd()))
+	if err != nil || cols <= 0 || rows <= 0 {
+		return
+	}
+	s.size.mu.Lock()
+	changed := cols != s.size.cols || rows != s.size.rows
+	s.size.cols, s.size.rows = cols, rows
+	s.size.mu.Unlock()
+
+	if changed {
+		os.Setenv("COLUMNS", strconv.Itoa(cols))
+		os.Setenv("LINES", strconv.Itoa(rows))
+	}
+}
+
+// columns returns the width of the terminal, or 80 when it is unknown.
+func (s *Shell) columns() int {
+	s.size.mu.Lock()
+	defer s.size.mu.Unlock()
+	if s.size.cols <= 0 {
+		return 80
+	}
+	return s.size.cols
+}
+
+// rows returns the height of the terminal, or 24 when it is unknown.
+func (s *Shell) rows() int {
+	s.size.mu.Lock()
+	defer s.size.mu.Unlock()
+	if s.size.rows <= 0 {
+		return 24
+	}
+	return s.size.rows
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// displayWidth is the number of columns text takes up on the terminal,
+// not counting escape sequences.
+func displayWidth(text string) int {
+	return runewidth.StringWidth(ansiEscape.ReplaceAllString(text, ""))
+}
+
+// shortenDir drops leading directories from dir, replacing them with
+// "...", until it is at most width columns or only its last directory
+// is left.
+func shortenDir(dir string, width int) string {
+	sep := string(filepath.Separator)
+	parts := strings.Split(dir, sep)
+	for i := 1; runewidth.StringWidth(dir) > width && i < len(parts)-1; i++ {
+		dir = "..." + sep + strings.Join(parts[i+1:], sep)
+	}
+	return dir
+}
@@ -0,0 +1,118 @@
+package startup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxFailures is how many startups in a row may fail before the shell
+// falls back to safe mode.
+const MaxFailures = 2
+
+// Tracker leaves a breadcrumb on disk while the shell starts up. If the
+// process dies before Done is called, the next startup finds the
+// breadcrumb and knows which step it died in.
+type Tracker struct {
+	path     string
+	previous State
+	state    State
+
+	// profile, if set, gets the time each step took once it is over.
+	// begun is when the startup began and stepped when the step in
+	// progress did.
+	profile        io.Writer
+	begun, stepped time.Time
+	done           bool
+}
+
+type State struct {
+	Failures int    `json:"failures"`
+	Phase    string `json:"phase,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// Begin records the start of a startup attempt. The attempt counts as a
+// failure until Done is called.
+func Begin(path string) *Tracker {
+	t := &Tracker{path: path, begun: time.Now()}
+	t.stepped = t.begun
+	t.state.Phase = "begin"
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &t.previous)
+	}
+	t.state.Failures = t.previous.Failures + 1
+	t.save()
+	return t
+}
+
+// SafeMode reports whether the previous startups failed often enough
+// that this one should skip user configuration and plugins.
+func (t *Tracker) SafeMode() bool {
+	return t.previous.Failures >= MaxFailures
+}
+
+// Culprit describes the step the last failed startup died in.
+func (t *Tracker) Culprit() State {
+	return t.previous
+}
+
+// Profile has the time each step takes written to w once it is over,
+// and that of the whole startup once it is done.
+func (t *Tracker) Profile(w io.Writer) {
+	t.profile = w
+}
+
+// Step records that the startup is about to process file. Steps taken
+// after Done, for what was put off until later, count as a startup of
+// their own until Done is called again.
+func (t *Tracker) Step(phase, file string) {
+	t.report()
+	t.state.Phase = phase
+	t.state.File = file
+	t.save()
+}
+
+// Done marks the startup as successful.
+func (t *Tracker) Done() {
+	t.report()
+	if t.profile != nil && !t.done {
+		fmt.Fprintf(t.profile, "%-8s %10s\n", "total", roundDuration(time.Since(t.begun)))
+	}
+	t.done = true
+	os.Remove(t.path)
+}
+
+// report writes the time the step in progress took to the profile, and
+// starts timing the next.
+func (t *Tracker) report() {
+	now := time.Now()
+	if t.profile != nil && t.state.Phase != "" {
+		line := fmt.Sprintf("%-8s %10s  %s", t.state.Phase, roundDuration(now.Sub(t.stepped)), t.state.File)
+		fmt.Fprintln(t.profile, strings.TrimRight(line, " "))
+	}
+	t.state.Phase, t.state.File = "", ""
+	t.stepped = now
+}
+
+// roundDuration rounds d to the microsecond, or to the millisecond past
+// a second.
+func roundDuration(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+func (t *Tracker) save() {
+	data, err := json.Marshal(t.state)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(t.path), 0o755)
+	os.WriteFile(t.path, data, 0o644)
+}
@@ -0,0 +1,195 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Capabilities describes what the attached terminal can render.
+type Capabilities struct {
+	// Dumb terminals cannot move the cursor or interpret ANSI escapes.
+	Dumb bool
+	// Emacs is set when running inside Emacs shell-mode, which does its
+	// own line editing.
+	Emacs bool
+	// Color is set when escapes may colour the output, and Colors says
+	// how many colours there are: 16, 256 or 1<<24.
+	Color  bool
+	Colors int
+	// ScreenReader is set when the user asked for output that reads well
+	// through a screen reader: no redraws and no decorative glyphs.
+	ScreenReader bool
+}
+
+// Detect works out the capabilities from the environment and whether
+// standard output is a terminal. Colour is left out for dumb terminals,
+// when $NO_COLOR is set (see no-color.org) or $CLICOLOR is 0, and when
+// the output is not a terminal unless $CLICOLOR_FORCE or $FORCE_COLOR
+// asks for it.
+func Detect() Capabilities {
+	tty := false
+	if info, err := os.Stdout.Stat(); err == nil {
+		tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	return detect(os.Getenv, tty)
+}
+
+func detect(getenv func(string) string, tty bool) Capabilities {
+	caps := Capabilities{}
+
+	term := getenv("TERM")
+	if term == "" || term == "dumb" || term == "unknown" {
+		caps.Dumb = true
+	}
+
+	// vterm inside Emacs is a real terminal emulator, everything else
+	// (shell-mode, eshell, M-x compile) is not.
+	if emacs := getenv("INSIDE_EMACS"); emacs != "" && !strings.Contains(emacs, "vterm") {
+		caps.Emacs = true
+		caps.Dumb = true
+	} else if getenv("EMACS") == "t" {
+		caps.Emacs = true
+		caps.Dumb = true
+	}
+
+	forced := getenv("CLICOLOR_FORCE") != "" && getenv("CLICOLOR_FORCE") != "0" ||
+		getenv("FORCE_COLOR") != "" && getenv("FORCE_COLOR") != "0"
+	caps.Color = !caps.Dumb && getenv("NO_COLOR") == "" && getenv("CLICOLOR") != "0" && (tty || forced)
+	if caps.Color {
+		switch colorterm := getenv("COLORTERM"); {
+		case colorterm == "truecolor" || colorterm == "24bit":
+			caps.Colors = 1 << 24
+		case strings.Contains(term, "256color") || colorterm != "":
+			caps.Colors = 256
+		default:
+			caps.Colors = 16
+		}
+	}
+	return caps
+}
+
+// SGR returns the escape sequence that resets the attributes and sets
+// the colours fg and bg, given from the 256-colour palette with 0 for
+// the terminal's own. Terminals with 16 colours get the nearest of
+// those, and those without colour nothing at all.
+func (c Capabilities) SGR(fg, bg int) string {
+	if !c.Color {
+		return ""
+	}
+	params := "0"
+	if fg != 0 {
+		params += c.colorParam(fg, 30, 90, "38")
+	}
+	if bg != 0 {
+		params += c.colorParam(bg, 40, 100, "48")
+	}
+	return "\033[" + params + "m"
+}
+
+// Reset returns the escape sequence that undoes SGR.
+func (c Capabilities) Reset() string {
+	if !c.Color {
+		return ""
+	}
+	return "\033[0m"
+}
+
+func (c Capabilities) colorParam(color, base, bright int, extended string) string {
+	if c.Colors >= 256 {
+		return fmt.Sprintf(";%s;5;%d", extended, color)
+	}
+	if color = basicColor(color); color >= 8 {
+		return fmt.Sprintf(";%d", bright+color-8)
+	}
+	return fmt.Sprintf(";%d", base+color)
+}
+
+// basicColor maps a colour of the 256-colour palette to the nearest of
+// the first 16: the standard and bright ANSI colours.
+func basicColor(color int) int {
+	switch {
+	case color < 16:
+		return color
+	case color < 232:
+		// The 6x6x6 colour cube: each component on if at least half
+		// on, and the bright variant when any is nearly full.
+		color -= 16
+		r, g, b := color/36, color/6%6, color%6
+		basic := 0
+		if r >= 3 {
+			basic |= 1
+		}
+		if g >= 3 {
+			basic |= 2
+		}
+		if b >= 3 {
+			basic |= 4
+		}
+		if basic == 0 && r+g+b > 0 {
+			// Too dark for any one component: the strongest one.
+			switch max(r, g, b) {
+			case r:
+				basic = 1
+			case g:
+				basic = 2
+			default:
+				basic = 4
+			}
+		}
+		if max(r, g, b) >= 5 {
+			basic += 8
+		}
+		return basic
+	case color < 238:
+		return 0
+	case color < 250:
+		return 8
+	}
+	return 7
+}
+
+// Fancy reports whether redraw-heavy features such as autosuggestions,
+// right prompts and completion menus can be used.
+func (c Capabilities) Fancy() bool {
+	return !c.Dumb && !c.ScreenReader
+}
+
+// LineMode reports whether input should be read a line at a time in the
+// terminal's cooked mode instead of through the interactive editor.
+func (c Capabilities) LineMode() bool {
+	return c.Dumb || c.ScreenReader
+}
+
+// Plain drops decorative symbols (box drawing, arrows, powerline glyphs,
+// emoji and the like) from s and collapses the whitespace they leave.
+func Plain(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if decorative(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(b.String()), " ") + trailingSpace(s)
+}
+
+func decorative(r rune) bool {
+	switch {
+	case r <= unicode.MaxASCII:
+		return false
+	case r >= 0x2190 && r <= 0x21ff, // arrows
+		r >= 0x2500 && r <= 0x25ff, // box drawing, blocks, shapes
+		r >= 0x2700 && r <= 0x27bf: // dingbats
+		return true
+	}
+	return unicode.IsSymbol(r) || unicode.In(r, unicode.Co)
+}
+
+func trailingSpace(s string) string {
+	if strings.HasSuffix(s, " ") {
+		return " "
+	}
+	return ""
+}
@@ -2,17 +2,26 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/chzyer/readline"
 	"github.com/kballard/go-shellquote"
+	"golang.org/x/sys/unix"
+	"shell/internal/cdpath"
+	"shell/pkg/parser"
 )
 
 const (
@@ -21,16 +30,34 @@ const (
 )
 
 type Job struct {
-	cmd      *exec.Cmd
-	status   string
-	jobID    int
-	stopChan chan struct{}
+	cmd    *exec.Cmd
+	status string
+	jobID  int
+	// started is when the job was started, and finished when it ended,
+	// for jobs -l.
+	started, finished time.Time
+
+	// mu guards status, finished and foreground, which is set while fg
+	// waits for the job; its changes of state are then sent on changed
+	// instead of reported. fg closes foreground once it stops waiting,
+	// so that a change it will not receive is reported after all.
+	mu         sync.Mutex
+	foreground chan struct{}
+	changed    chan syscall.WaitStatus
+}
+
+// state returns the job's status and when it ended, if it has.
+func (j *Job) state() (status string, finished time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.finished
 }
 
 type Shell struct {
 	history        []string
 	historyFile    string
 	currentDir     string
+	prevDir        string
 	signalChan     chan os.Signal
 	interruptCount int
 	env            map[string]string
@@ -71,8 +98,11 @@ func NewShell() (*Shell, error) {
 }
 
 func (s *Shell) Run() {
-	signal.Notify(s.signalChan, syscall.SIGINT, syscall.SIGTSTP, syscall.SIGCHLD)
+	signal.Notify(s.signalChan, syscall.SIGINT, syscall.SIGTSTP)
 	defer signal.Stop(s.signalChan)
+	// The shell takes the terminal back from jobs fg ran while it is not
+	// in the foreground itself.
+	signal.Ignore(syscall.SIGTTOU)
 
 	go s.handleSignals()
 
@@ -120,6 +150,7 @@ func (s *Shell) getPrompt() string {
 }
 
 func (s *Shell) executeCommand(input string) error {
+	line := input
 	// Expand variables
 	for k, v := range s.variables {
 		input = strings.ReplaceAll(input, "$"+k, v)
@@ -127,13 +158,28 @@ func (s *Shell) executeCommand(input string) error {
 
 	parts, err := shellquote.Split(input)
 	if err != nil {
-		return fmt.Errorf("error parsing command: %w", err)
+		return syntaxError(line, err)
 	}
 
 	if len(parts) == 0 {
 		return nil
 	}
 
+	// Leading NAME=value words set variables in the environment of the
+	// command after them, or in the shell when there is no command.
+	var assigns []string
+	for len(parts) > 0 && isAssignment(parts[0]) {
+		assigns = append(assigns, parts[0])
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		for _, assign := range assigns {
+			name, value, _ := strings.Cut(assign, "=")
+			s.variables[name] = value
+		}
+		return nil
+	}
+
 	// Check for aliases
 	if alias, ok := s.aliases[parts[0]]; ok {
 		aliasParts, err := shellquote.Split(alias)
@@ -157,8 +203,7 @@ func (s *Shell) executeCommand(input string) error {
 	case "alias":
 		return s.setAlias(parts)
 	case "jobs":
-		s.listJobs()
-		return nil
+		return s.listJobs(parts[1:])
 	case "fg":
 		return s.foregroundJob(parts)
 	case "bg":
@@ -167,10 +212,36 @@ func (s *Shell) executeCommand(input string) error {
 		return s.setVariable(parts)
 	}
 
-	return s.runExternal(parts)
+	return s.runExternal(parts, assigns)
 }
 
-func (s *Shell) runExternal(parts []string) error {
+// syntaxError describes why a line could not be split into words. Where
+// the parser finds the problem in the line as typed, its diagnostic shows
+// the line with a caret under it and what was expected there.
+func syntaxError(line string, err error) error {
+	var syntax *parser.SyntaxError
+	if _, perr := parser.Parse(line); errors.As(perr, &syntax) {
+		return errors.New(syntax.Diagnostic())
+	}
+	return fmt.Errorf("syntax error: %w", err)
+}
+
+// isAssignment reports whether word has the form NAME=value.
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// runExternal runs a command, with env added to its environment.
+func (s *Shell) runExternal(parts, env []string) error {
 	background := false
 	if parts[len(parts)-1] == "&" {
 		background = true
@@ -182,19 +253,24 @@ func (s *Shell) runExternal(parts []string) error {
 	for k, v := range s.env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
+	cmd.Env = append(cmd.Env, env...)
 
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 	if background {
-		cmd.Stdin = nil
-		cmd.Stdout = nil
-		cmd.Stderr = nil
+		// A job gets a process group of its own, which fg can hand the
+		// terminal to; reading from it in the background stops the job.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 		if err := cmd.Start(); err != nil {
 			return err
 		}
 		job := &Job{
-			cmd:      cmd,
-			status:   "Running",
-			jobID:    s.nextJobID,
-			stopChan: make(chan struct{}),
+			cmd:     cmd,
+			status:  "Running",
+			jobID:   s.nextJobID,
+			started: time.Now(),
+			changed: make(chan syscall.WaitStatus),
 		}
 		s.jobs[s.nextJobID] = job
 		s.nextJobID++
@@ -202,48 +278,104 @@ func (s *Shell) runExternal(parts []string) error {
 		go s.waitForJob(job)
 		return nil
 	}
-
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
+// waitForJob follows a job until it ends, noting each time it stops,
+// continues or ends. Unless fg is waiting for it, it reports the change.
 func (s *Shell) waitForJob(job *Job) {
-	err := job.cmd.Wait()
-	select {
-	case <-job.stopChan:
-		return
-	default:
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				job.status = fmt.Sprintf("Exited (%d)", exitErr.ExitCode())
-			} else {
-				job.status = "Errored"
-			}
-		} else {
+	pid := job.cmd.Process.Pid
+	for {
+		var ws syscall.WaitStatus
+		_, err := syscall.Wait4(pid, &ws, syscall.WUNTRACED|syscall.WCONTINUED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		ended := err != nil || ws.Exited() || ws.Signaled()
+		job.mu.Lock()
+		switch {
+		case err != nil:
+			job.status = "Errored"
+		case ws.Stopped():
+			job.status = "Stopped"
+		case ws.Continued():
+			job.status = "Running"
+		case ws.Signaled():
+			job.status = fmt.Sprintf("Killed (%v)", ws.Signal())
+		case ws.ExitStatus() != 0:
+			job.status = fmt.Sprintf("Exited (%d)", ws.ExitStatus())
+		default:
 			job.status = "Done"
 		}
-		fmt.Printf("[%d]+ %s\t%s\n", job.jobID, job.status, job.cmd.Args[0])
+		if ended {
+			job.finished = time.Now()
+			job.cmd.Process.Release()
+		}
+		status, foreground := job.status, job.foreground
+		job.mu.Unlock()
+		received := false
+		if foreground != nil {
+			select {
+			case job.changed <- ws:
+				received = true
+			case <-foreground:
+			}
+		}
+		if !received && !ws.Continued() {
+			fmt.Printf("[%d]+ %s\t%s\n", job.jobID, status, job.cmd.Args[0])
+		}
+		if ended {
+			return
+		}
 	}
 }
 
 func (s *Shell) changeDirectory(parts []string) error {
-	if len(parts) < 2 {
-		return fmt.Errorf("cd: missing argument")
+	var path string
+	printDir := false
+	switch {
+	case len(parts) < 2:
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cd: %w", err)
+		}
+		path = homeDir
+	case parts[1] == "-":
+		if s.prevDir == "" {
+			return fmt.Errorf("cd: OLDPWD not set")
+		}
+		path = s.prevDir
+		printDir = true
+	default:
+		path, printDir = cdpath.Resolve(os.ExpandEnv(parts[1]), s.lookupVar("CDPATH"))
 	}
-	path := os.ExpandEnv(parts[1])
 	if err := os.Chdir(path); err != nil {
 		return fmt.Errorf("cd: %s: %w", path, err)
 	}
+	s.prevDir = s.currentDir
 	var err error
 	s.currentDir, err = os.Getwd()
 	if err != nil {
 		return fmt.Errorf("error getting current directory: %w", err)
 	}
+	if printDir {
+		fmt.Println(s.currentDir)
+	}
 	return nil
 }
 
+// lookupVar returns a shell variable, falling back to exported and
+// inherited environment variables.
+func (s *Shell) lookupVar(name string) string {
+	if v, ok := s.variables[name]; ok {
+		return v
+	}
+	if v, ok := s.env[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
 func (s *Shell) exportVar(parts []string) error {
 	if len(parts) != 2 {
 		return fmt.Errorf("export: invalid syntax")
@@ -256,73 +388,214 @@ func (s *Shell) exportVar(parts []string) error {
 	return nil
 }
 
+// setAlias defines an alias with alias NAME=VALUE. The value may be
+// quoted, as in alias ll='ls -la', or run on over the words after it, as
+// in alias ll=ls -la. alias NAME... prints those aliases and alias alone
+// lists them all.
 func (s *Shell) setAlias(parts []string) error {
-	if len(parts) != 2 {
-		return fmt.Errorf("alias: invalid syntax")
+	if len(parts) == 1 {
+		names := make([]string, 0, len(s.aliases))
+		for name := range s.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			printAlias(name, s.aliases[name])
+		}
+		return nil
 	}
-	kv := strings.SplitN(parts[1], "=", 2)
-	if len(kv) != 2 {
+
+	name, value, ok := strings.Cut(parts[1], "=")
+	if !ok {
+		for _, name := range parts[1:] {
+			value, ok := s.aliases[name]
+			if !ok {
+				return fmt.Errorf("alias: %s: not found", name)
+			}
+			printAlias(name, value)
+		}
+		return nil
+	}
+	if name == "" {
 		return fmt.Errorf("alias: invalid syntax")
 	}
-	s.aliases[kv[0]] = kv[1]
+	if len(parts) > 2 {
+		value += " " + shellquote.Join(parts[2:]...)
+	}
+	s.aliases[name] = value
 	return nil
 }
 
-func (s *Shell) listJobs() {
-	for _, job := range s.jobs {
-		fmt.Printf("[%d] %s\t%s\n", job.jobID, job.status, job.cmd.Args[0])
+func printAlias(name, value string) {
+	fmt.Printf("alias %s=%s\n", name, shellquote.Join(value))
+}
+
+// listJobs lists the jobs in the order they were started, as bash does:
+// -l adds each job's PID, process group, start time and how long it has
+// run, -p prints only the PIDs, and -r and -s keep to the running or the
+// stopped jobs.
+func (s *Shell) listJobs(args []string) error {
+	long, pidsOnly, running, stopped := false, false, false, false
+	for _, arg := range args {
+		if len(arg) < 2 || arg[0] != '-' {
+			return fmt.Errorf("jobs: %s: job specs are not supported", arg)
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'l':
+				long = true
+			case 'p':
+				pidsOnly = true
+			case 'r':
+				running = true
+			case 's':
+				stopped = true
+			default:
+				return fmt.Errorf("jobs: -%c: invalid option", flag)
+			}
+		}
 	}
+
+	ids := make([]int, 0, len(s.jobs))
+	for id := range s.jobs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		job := s.jobs[id]
+		status, end := job.state()
+		if running && status != "Running" || stopped && status != "Stopped" {
+			continue
+		}
+		pid := job.cmd.Process.Pid
+		switch {
+		case pidsOnly:
+			fmt.Println(pid)
+		case long:
+			pgid, err := syscall.Getpgid(pid)
+			group := strconv.Itoa(pgid)
+			if err != nil {
+				group = "-"
+			}
+			if end.IsZero() {
+				end = time.Now()
+			}
+			fmt.Printf("[%d]  %-7d %-7s %-12s %s %9s  %s\n", job.jobID, pid, group, status,
+				job.started.Format("15:04:05"), end.Sub(job.started).Round(time.Second), shellquote.Join(job.cmd.Args...))
+		default:
+			fmt.Printf("[%d]  %-12s %s\n", job.jobID, status, shellquote.Join(job.cmd.Args...))
+		}
+	}
+	return nil
 }
 
-func (s *Shell) foregroundJob(parts []string) error {
-	if len(parts) != 2 {
-		return fmt.Errorf("fg: invalid syntax")
+// findJob returns the job fg or bg names, as N or %N, or the most
+// recent job when none is named.
+func (s *Shell) findJob(parts []string) (*Job, error) {
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("%s: invalid syntax", parts[0])
+	}
+	if len(parts) == 1 {
+		var latest *Job
+		for _, job := range s.jobs {
+			if latest == nil || job.jobID > latest.jobID {
+				latest = job
+			}
+		}
+		if latest == nil {
+			return nil, fmt.Errorf("%s: no current job", parts[0])
+		}
+		return latest, nil
 	}
-	jobID := 0
-	_, err := fmt.Sscanf(parts[1], "%d", &jobID)
+	jobID, err := strconv.Atoi(strings.TrimPrefix(parts[1], "%"))
 	if err != nil {
-		return fmt.Errorf("fg: invalid job ID")
+		return nil, fmt.Errorf("%s: invalid job ID", parts[0])
 	}
 	job, ok := s.jobs[jobID]
 	if !ok {
-		return fmt.Errorf("fg: job not found")
+		return nil, fmt.Errorf("%s: job not found", parts[0])
 	}
-	delete(s.jobs, jobID)
-	close(job.stopChan)
-
-	job.cmd.Stdin = os.Stdin
-	job.cmd.Stdout = os.Stdout
-	job.cmd.Stderr = os.Stderr
+	return job, nil
+}
 
-	err = job.cmd.Wait()
+// foregroundJob gives a job the terminal, continues it if it is stopped
+// and waits until it ends or is stopped again, as by Ctrl+Z, before
+// taking the terminal back.
+func (s *Shell) foregroundJob(parts []string) error {
+	job, err := s.findJob(parts)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			fmt.Printf("Exited (%d)\n", exitErr.ExitCode())
-		} else {
-			fmt.Printf("Error: %v\n", err)
+		return err
+	}
+	pid := job.cmd.Process.Pid
+	fmt.Println(shellquote.Join(job.cmd.Args...))
+
+	job.mu.Lock()
+	if !job.finished.IsZero() {
+		status := job.status
+		job.mu.Unlock()
+		delete(s.jobs, job.jobID)
+		fmt.Println(status)
+		return nil
+	}
+	waiting := make(chan struct{})
+	job.foreground = waiting
+	job.mu.Unlock()
+	defer func() {
+		job.mu.Lock()
+		job.foreground = nil
+		job.mu.Unlock()
+		close(waiting)
+	}()
+
+	// Without a terminal there is nothing to hand over, but fg still
+	// waits for the job.
+	tty := int(os.Stdin.Fd())
+	termios, err := unix.IoctlGetTermios(tty, ioctlGetTermios)
+	if err == nil {
+		if err := unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, pid); err != nil {
+			return fmt.Errorf("fg: %w", err)
 		}
+		defer func() {
+			unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, syscall.Getpgrp())
+			unix.IoctlSetTermios(tty, ioctlSetTermios, termios)
+		}()
+	}
+	if err := syscall.Kill(-pid, syscall.SIGCONT); err != nil {
+		return fmt.Errorf("fg: %w", err)
+	}
+
+	for {
+		ws := <-job.changed
+		switch {
+		case ws.Continued():
+			continue
+		case ws.Stopped():
+			status, _ := job.state()
+			fmt.Printf("\n[%d]+ %s\t%s\n", job.jobID, status, job.cmd.Args[0])
+			return nil
+		}
+		delete(s.jobs, job.jobID)
+		if ws.Signaled() || ws.ExitStatus() != 0 {
+			status, _ := job.state()
+			fmt.Println(status)
+		}
+		return nil
 	}
-	return nil
 }
 
 func (s *Shell) backgroundJob(parts []string) error {
-	if len(parts) != 2 {
-		return fmt.Errorf("bg: invalid syntax")
-	}
-	jobID := 0
-	_, err := fmt.Sscanf(parts[1], "%d", &jobID)
+	job, err := s.findJob(parts)
 	if err != nil {
-		return fmt.Errorf("bg: invalid job ID")
-	}
-	job, ok := s.jobs[jobID]
-	if !ok {
-		return fmt.Errorf("bg: job not found")
+		return err
 	}
+	job.mu.Lock()
 	if job.status != "Stopped" {
+		job.mu.Unlock()
 		return fmt.Errorf("bg: job is not stopped")
 	}
 	job.status = "Running"
-	job.cmd.Process.Signal(syscall.SIGCONT)
+	job.mu.Unlock()
+	syscall.Kill(-job.cmd.Process.Pid, syscall.SIGCONT)
 	return nil
 }
 
@@ -347,18 +620,6 @@ func (s *Shell) handleSignals() {
 		case syscall.SIGTSTP:
 			// Handle Ctrl+Z
 			fmt.Println("\nStopped")
-		case syscall.SIGCHLD:
-			// Handle child process status changes
-			s.reapChildren()
-		}
-	}
-}
-
-func (s *Shell) reapChildren() {
-	for {
-		pid, _ := syscall.Wait4(-1, nil, syscall.WNOHANG, nil)
-		if pid <= 0 {
-			break
 		}
 	}
 }
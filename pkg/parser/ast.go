@@ -0,0 +1,143 @@
+// Package parser parses the shell's command language into a syntax tree.
+//
+// A line such as
+//
+//	FOO=1 make -j4 2>build.log && ./run | tee out; echo done &
+//
+// is a List of Stmts, each an AndOr of Pipelines joined by && and ||. A
+// Pipeline is a series of Commands joined by |, and a Command has its
+// Assignments, Words and Redirects. Every node records the position it
+// starts at.
+//
+// Parsing does no expansion: words keep their parameter references as
+// Param parts, with quotes and escapes already removed from the rest and
+// quoted text kept in Lits of its own.
+package parser
+
+// Pos is a position in the input. Line and Column count from 1, Column
+// in characters; Offset counts bytes from 0.
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+type Node interface {
+	Pos() Pos
+}
+
+// List is a sequence of statements separated by ';', '&' or newlines.
+type List struct {
+	Position Pos
+	Stmts    []*Stmt
+}
+
+// Stmt is an and-or list, run in the background if it ended with '&'.
+type Stmt struct {
+	Position   Pos
+	AndOr      *AndOr
+	Background bool
+}
+
+// AndOr is a series of pipelines joined by && and ||. Ops[i] joins
+// Pipelines[i] and Pipelines[i+1].
+type AndOr struct {
+	Position  Pos
+	Pipelines []*Pipeline
+	Ops       []string
+}
+
+// Pipeline is a series of commands joined by '|', each reading the
+// output of the one before. Negated pipelines start with '!'. Timed
+// pipelines start with the time keyword, and TimePOSIX is set by time -p.
+type Pipeline struct {
+	Position  Pos
+	Timed     bool
+	TimePOSIX bool
+	Negated   bool
+	Commands  []*Command
+}
+
+// Command is a simple command. Any of its parts may be empty, but not all
+// of them.
+type Command struct {
+	Position    Pos
+	Assignments []*Assignment
+	Words       []*Word
+	Redirects   []*Redirect
+}
+
+// Assignment is a NAME=value word before a command's name.
+type Assignment struct {
+	Position Pos
+	Name     string
+	Value    *Word
+}
+
+// Redirect is an I/O redirection such as 2>file. Fd is the descriptor
+// written before the operator, or -1 if there was none. Op is one of
+// < > >> >| <> <& >&.
+type Redirect struct {
+	Position Pos
+	Fd       int
+	Op       string
+	Target   *Word
+}
+
+// Word is one word of a command, made of literal text and parameter
+// references.
+type Word struct {
+	Position Pos
+	Parts    []WordPart
+}
+
+// WordPart is a *Lit or a *Param.
+type WordPart interface {
+	Node
+	wordPart()
+}
+
+// Lit is literal text, with any quotes and escapes removed. Quoted text
+// came from quotes or a backslash, so pattern characters in it match
+// only themselves.
+type Lit struct {
+	Position Pos
+	Value    string
+	Quoted   bool
+}
+
+// Param is a parameter reference, $NAME or ${NAME}, or a special
+// parameter such as $? or $1. Quoted references were inside double
+// quotes, so their value is not split into fields.
+type Param struct {
+	Position Pos
+	Name     string
+	Quoted   bool
+}
+
+func (n *List) Pos() Pos       { return n.Position }
+func (n *Stmt) Pos() Pos       { return n.Position }
+func (n *AndOr) Pos() Pos      { return n.Position }
+func (n *Pipeline) Pos() Pos   { return n.Position }
+func (n *Command) Pos() Pos    { return n.Position }
+func (n *Assignment) Pos() Pos { return n.Position }
+func (n *Redirect) Pos() Pos   { return n.Position }
+func (n *Word) Pos() Pos       { return n.Position }
+func (n *Lit) Pos() Pos        { return n.Position }
+func (n *Param) Pos() Pos      { return n.Position }
+
+func (*Lit) wordPart()   {}
+func (*Param) wordPart() {}
+
+// Literal returns the text of a word without parameter references.
+func (w *Word) Literal() (string, bool) {
+	text := ""
+	for _, part := range w.Parts {
+		lit, ok := part.(*Lit)
+		if !ok {
+			return "", false
+		}
+		text += lit.Value
+	}
+	return text, true
+}
@@ -0,0 +1,613 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError describes input that could not be parsed, with enough
+// detail to point at the problem and suggest a fix.
+type SyntaxError struct {
+	Input string
+	Pos   Pos
+	// Column is the 1-based position of the offending character on its
+	// line, the same as Pos.Column.
+	Column int
+	Token  string
+	Msg    string
+	// Expected names what should have come at Pos, such as "a command",
+	// or is empty.
+	Expected string
+	Hint     string
+	// Incomplete is set when the input ended too soon, inside quotes or
+	// after an operator, so more lines could complete it.
+	Incomplete bool
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("syntax error at %s: %s", e.where(), e.Msg)
+	if e.Token != "" {
+		msg += fmt.Sprintf(" (near %s)", e.Token)
+	}
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	return msg
+}
+
+// where is the position of the error: its column, and its line too when
+// the input has several.
+func (e *SyntaxError) where() string {
+	if strings.Contains(strings.TrimSuffix(e.Input, "\n"), "\n") {
+		return fmt.Sprintf("line %d, column %d", e.Pos.Line, e.Pos.Column)
+	}
+	return fmt.Sprintf("column %d", e.Pos.Column)
+}
+
+// Diagnostic describes the error over several lines: what is wrong and
+// where, the line of input it is on with a caret under the offending
+// character, naming what was expected there, and the hint.
+//
+//	syntax error at column 6: missing closing " (near "x)
+//	  echo "x
+//	       ^ expected a closing " for this one
+//	  hint: add a " at the end of the quoted text
+func (e *SyntaxError) Diagnostic() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "syntax error at %s: %s", e.where(), e.Msg)
+	if e.Token != "" {
+		fmt.Fprintf(&b, " (near %s)", e.Token)
+	}
+	lines := strings.Split(e.Input, "\n")
+	if e.Pos.Line >= 1 && e.Pos.Line <= len(lines) {
+		line := []rune(lines[e.Pos.Line-1])
+		// The caret lines up under tabs as the line does.
+		var pad strings.Builder
+		for _, r := range line[:min(e.Pos.Column-1, len(line))] {
+			switch {
+			case r == '\t':
+				pad.WriteRune('\t')
+			case !unicode.Is(unicode.Mn, r):
+				pad.WriteRune(' ')
+			}
+		}
+		fmt.Fprintf(&b, "\n  %s\n  %s^", string(line), pad.String())
+		if e.Expected != "" {
+			b.WriteString(" expected " + e.Expected)
+		}
+	}
+	if e.Hint != "" {
+		b.WriteString("\n  hint: " + e.Hint)
+	}
+	return b.String()
+}
+
+// Parse parses input, which may hold several lines.
+func Parse(input string) (*List, error) {
+	p := &parser{input: input, runes: []rune(input)}
+	return p.list()
+}
+
+// SpecialParams are the single-character parameter names, as in $?.
+const SpecialParams = "?$#!@*-0123456789"
+
+// operators are the characters that end a word when not quoted.
+const operators = ";&|<>\n"
+
+type parser struct {
+	input string
+	runes []rune
+	i     int
+	// at is the position of runes[last], the last one asked for.
+	// Positions further on are counted from there, and those before from
+	// the start of their line, found in lines, so that parsing stays
+	// linear.
+	last  int
+	at    Pos
+	lines []lineStart
+}
+
+// lineStart is where a line starts: the index of its first rune and the
+// offset of its first byte.
+type lineStart struct {
+	index, offset int
+}
+
+func (p *parser) pos(i int) Pos {
+	if p.at.Line == 0 {
+		p.at = Pos{Line: 1, Column: 1}
+	}
+	if i < p.last {
+		if p.lines == nil {
+			p.lines = []lineStart{{}}
+			j := 0
+			for offset, r := range p.input {
+				j++
+				if r == '\n' {
+					p.lines = append(p.lines, lineStart{j, offset + 1})
+				}
+			}
+		}
+		n := sort.Search(len(p.lines), func(n int) bool { return p.lines[n].index > i }) - 1
+		p.last, p.at = p.lines[n].index, Pos{Offset: p.lines[n].offset, Line: n + 1, Column: 1}
+	}
+	// Offsets are counted in the input rather than from the runes, in
+	// which a byte that is not UTF-8 takes three.
+	for ; p.last < i && p.at.Offset < len(p.input); p.last++ {
+		r, size := utf8.DecodeRuneInString(p.input[p.at.Offset:])
+		p.at.Offset += size
+		if r == '\n' {
+			p.at.Line++
+			p.at.Column = 1
+		} else {
+			p.at.Column++
+		}
+	}
+	return p.at
+}
+
+func (p *parser) errorAt(i int, token, msg, expected, hint string) *SyntaxError {
+	pos := p.pos(i)
+	return &SyntaxError{Input: p.input, Pos: pos, Column: pos.Column, Token: token, Msg: msg, Expected: expected, Hint: hint}
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.runes)
+}
+
+func (p *parser) peek(s string) bool {
+	return strings.HasPrefix(string(p.runes[p.i:min(p.i+len(s), len(p.runes))]), s)
+}
+
+// blanks skips spaces, tabs and a comment, but not newlines.
+func (p *parser) blanks() {
+	for !p.eof() {
+		switch r := p.runes[p.i]; {
+		case r == '#':
+			for !p.eof() && p.runes[p.i] != '\n' {
+				p.i++
+			}
+		case r == '\\' && p.i+1 < len(p.runes) && p.runes[p.i+1] == '\n':
+			p.i += 2
+		case r != '\n' && unicode.IsSpace(r):
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// linebreak skips blanks and newlines.
+func (p *parser) linebreak() {
+	for p.blanks(); !p.eof() && p.runes[p.i] == '\n'; p.blanks() {
+		p.i++
+	}
+}
+
+func (p *parser) list() (*List, error) {
+	list := &List{Position: p.pos(p.i)}
+	for p.linebreak(); !p.eof(); p.linebreak() {
+		stmt := &Stmt{Position: p.pos(p.i)}
+		andOr, err := p.andOr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.AndOr = andOr
+		list.Stmts = append(list.Stmts, stmt)
+
+		p.blanks()
+		if p.eof() {
+			break
+		}
+		switch p.runes[p.i] {
+		case '&':
+			stmt.Background = true
+			p.i++
+		case ';', '\n':
+			p.i++
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	return list, nil
+}
+
+func (p *parser) andOr() (*AndOr, error) {
+	andOr := &AndOr{Position: p.pos(p.i)}
+	for {
+		pipeline, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+
+		p.blanks()
+		if !p.peek("&&") && !p.peek("||") {
+			return andOr, nil
+		}
+		op := string(p.runes[p.i : p.i+2])
+		andOr.Ops = append(andOr.Ops, op)
+		p.i += 2
+		p.linebreak()
+		if p.eof() {
+			err := p.errorAt(p.i-2, "'"+op+"'", fmt.Sprintf("missing command after '%s'", op), "a command", "")
+			err.Incomplete = true
+			return nil, err
+		}
+	}
+}
+
+// keyword moves past word if it comes next, unquoted and on its own.
+func (p *parser) keyword(word string) bool {
+	end := p.i + len([]rune(word))
+	if !p.peek(word) || end < len(p.runes) && !unicode.IsSpace(p.runes[end]) {
+		return false
+	}
+	p.i = end
+	return true
+}
+
+func (p *parser) pipeline() (*Pipeline, error) {
+	p.blanks()
+	pipeline := &Pipeline{Position: p.pos(p.i)}
+	if p.keyword("time") {
+		pipeline.Timed = true
+		p.blanks()
+		pipeline.TimePOSIX = p.keyword("-p")
+		p.blanks()
+	}
+	if p.keyword("!") {
+		pipeline.Negated = true
+	}
+	for {
+		cmd, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Commands = append(pipeline.Commands, cmd)
+
+		p.blanks()
+		if !p.peek("|") || p.peek("||") {
+			return pipeline, nil
+		}
+		p.i++
+		p.linebreak()
+		if p.eof() {
+			err := p.errorAt(p.i-1, "'|'", "missing command after '|'", "a command", "")
+			err.Incomplete = true
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) command() (*Command, error) {
+	p.blanks()
+	cmd := &Command{Position: p.pos(p.i)}
+	for p.blanks(); !p.eof(); p.blanks() {
+		r := p.runes[p.i]
+		if r == '<' || r == '>' || p.ioNumber() > 0 {
+			redirect, err := p.redirect()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Redirects = append(cmd.Redirects, redirect)
+			continue
+		}
+		if strings.ContainsRune(operators, r) {
+			break
+		}
+		start := p.i
+		word, name, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		if name != "" && len(cmd.Words) == 0 {
+			cmd.Assignments = append(cmd.Assignments, p.assignment(start, name, word))
+		} else {
+			cmd.Words = append(cmd.Words, word)
+		}
+	}
+	if len(cmd.Assignments) == 0 && len(cmd.Words) == 0 && len(cmd.Redirects) == 0 {
+		return nil, p.unexpected()
+	}
+	return cmd, nil
+}
+
+// assignment makes an Assignment of a word starting NAME=.
+func (p *parser) assignment(start int, name string, word *Word) *Assignment {
+	value := &Word{Position: p.pos(start + len(name) + 1)}
+	first := word.Parts[0].(*Lit)
+	if rest := first.Value[len(name)+1:]; rest != "" {
+		value.Parts = append(value.Parts, &Lit{Position: value.Position, Value: rest})
+	}
+	value.Parts = append(value.Parts, word.Parts[1:]...)
+	return &Assignment{Position: word.Position, Name: name, Value: value}
+}
+
+// unexpected reports the operator at the current position, or the end of
+// the input, where a command should be.
+func (p *parser) unexpected() *SyntaxError {
+	if p.eof() {
+		return p.errorAt(p.i, "", "unexpected end of input", "a command", "")
+	}
+	op := string(p.runes[p.i])
+	if p.peek("&&") || p.peek("||") || p.peek(";;") {
+		op = string(p.runes[p.i : p.i+2])
+	}
+	if op == "\n" {
+		op = "newline"
+	}
+	hint := ""
+	if op == "&" || op == "&&" || op == "|" || op == "||" || op == ";" {
+		hint = fmt.Sprintf("put a command before it, or quote it as '%s' to pass it literally", op)
+	}
+	return p.errorAt(p.i, "'"+op+"'", fmt.Sprintf("unexpected '%s'", op), "a command", hint)
+}
+
+// ioNumber returns the length of the descriptor number starting a
+// redirection such as 2>, or 0.
+func (p *parser) ioNumber() int {
+	n := 0
+	for p.i+n < len(p.runes) && p.runes[p.i+n] >= '0' && p.runes[p.i+n] <= '9' {
+		n++
+	}
+	if n == 0 || p.i+n == len(p.runes) || (p.runes[p.i+n] != '<' && p.runes[p.i+n] != '>') {
+		return 0
+	}
+	return n
+}
+
+var redirectOps = []string{">>", ">|", ">&", "<>", "<&", "<<", ">", "<"}
+
+func (p *parser) redirect() (*Redirect, error) {
+	redirect := &Redirect{Position: p.pos(p.i), Fd: -1}
+	if n := p.ioNumber(); n > 0 {
+		fmt.Sscan(string(p.runes[p.i:p.i+n]), &redirect.Fd)
+		p.i += n
+	}
+	for _, op := range redirectOps {
+		if p.peek(op) {
+			redirect.Op = op
+			break
+		}
+	}
+	start := p.i
+	p.i += len(redirect.Op)
+	if redirect.Op == "<<" {
+		return nil, p.errorAt(start, "'<<'", "here-documents are not supported", "", "")
+	}
+
+	p.blanks()
+	if p.eof() || strings.ContainsRune(operators, p.runes[p.i]) {
+		return nil, p.errorAt(start, "'"+redirect.Op+"'", fmt.Sprintf("missing file name after '%s'", redirect.Op), "a file name", "")
+	}
+	target, _, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	redirect.Target = target
+	return redirect, nil
+}
+
+// word parses a word. When it has the form NAME=value, name is NAME.
+func (p *parser) word() (word *Word, name string, err error) {
+	word = &Word{Position: p.pos(p.i)}
+	var lit strings.Builder
+	litStart, litQuoted := p.i, false
+	flush := func() {
+		if lit.Len() > 0 {
+			word.Parts = append(word.Parts, &Lit{Position: p.pos(litStart), Value: lit.String(), Quoted: litQuoted})
+			lit.Reset()
+		}
+	}
+	// write adds text from start to the literal, which is flushed first
+	// if the text is quoted and the literal is not, or the other way
+	// round.
+	write := func(text string, quoted bool, start int) {
+		if lit.Len() > 0 && quoted != litQuoted {
+			flush()
+		}
+		if lit.Len() == 0 {
+			litStart, litQuoted = start, quoted
+		}
+		lit.WriteString(text)
+	}
+	// plain is set while the word is all unquoted name characters, so
+	// far, and could be the NAME of an assignment.
+	plain := true
+	quoted := false
+
+	for !p.eof() {
+		r := p.runes[p.i]
+		switch {
+		case unicode.IsSpace(r) || strings.ContainsRune(operators, r):
+			flush()
+			if len(word.Parts) == 0 && quoted {
+				word.Parts = append(word.Parts, &Lit{Position: word.Position})
+			}
+			return word, name, nil
+		case r == '=' && plain && name == "" && lit.Len() > 0 && len(word.Parts) == 0 && isName(lit.String()):
+			name = lit.String()
+			write("=", false, p.i)
+			p.i++
+			plain = false
+			continue
+		case r == '\\':
+			if p.i+1 == len(p.runes) {
+				err := p.errorAt(p.i, "'\\'",
+					"line ends with a backslash", "a character to escape",
+					"remove it, or write '\\' to pass a literal backslash")
+				err.Incomplete = true
+				return nil, "", err
+			}
+			if p.runes[p.i+1] != '\n' {
+				write(string(p.runes[p.i+1]), true, p.i)
+			}
+			p.i += 2
+			quoted = true
+		case r == '\'':
+			end := p.index(p.i+1, '\'')
+			if end < 0 {
+				return nil, "", p.unterminated(p.i, '\'')
+			}
+			write(string(p.runes[p.i+1:end]), true, p.i)
+			p.i = end + 1
+			quoted = true
+		case r == '"':
+			if err := p.doubleQuoted(word, write, flush); err != nil {
+				return nil, "", err
+			}
+			quoted = true
+		case r == '$' && p.param(false) != nil:
+			flush()
+			word.Parts = append(word.Parts, p.param(true))
+		default:
+			write(string(r), false, p.i)
+			p.i++
+			if !isNameRune(r, lit.Len() == 1) {
+				plain = false
+			}
+			continue
+		}
+		plain = false
+	}
+	flush()
+	if len(word.Parts) == 0 && quoted {
+		word.Parts = append(word.Parts, &Lit{Position: word.Position})
+	}
+	return word, name, nil
+}
+
+// doubleQuoted parses a double-quoted string, in which a backslash only
+// escapes \ " $ ` and newline.
+func (p *parser) doubleQuoted(word *Word, write func(string, bool, int), flush func()) error {
+	start := p.i
+	p.i++
+	for ; !p.eof() && p.runes[p.i] != '"'; p.i++ {
+		r := p.runes[p.i]
+		switch {
+		case r == '\\' && p.i+1 < len(p.runes) && strings.ContainsRune("\\\"$`\n", p.runes[p.i+1]):
+			p.i++
+			if p.runes[p.i] != '\n' {
+				write(string(p.runes[p.i]), true, start)
+			}
+		case r == '$' && p.param(false) != nil:
+			flush()
+			param := p.param(true)
+			param.Quoted = true
+			word.Parts = append(word.Parts, param)
+			p.i--
+		default:
+			write(string(r), true, start)
+		}
+	}
+	if p.eof() {
+		return p.unterminated(start, '"')
+	}
+	p.i++
+	return nil
+}
+
+// param parses the parameter reference at the current '$', moving past it
+// if consume is set. It returns nil if the '$' does not start one, in
+// which case it is literal.
+func (p *parser) param(consume bool) *Param {
+	start := p.i
+	rest := p.runes[p.i+1:]
+	var name string
+	var width int
+	switch {
+	case len(rest) > 0 && rest[0] == '{':
+		// Stop at the first rune no name could hold, so as not to look
+		// all the way to a '}' far off.
+		end := 1
+		for end < len(rest) && rest[end] != '}' && (isNameRune(rest[end], false) || end == 1) {
+			end++
+		}
+		if end == len(rest) || rest[end] != '}' {
+			return nil
+		}
+		name, width = string(rest[1:end]), end+1
+		if !isName(name) && !isDigits(name) && !(len(name) == 1 && strings.Contains(SpecialParams, name)) {
+			return nil
+		}
+	case len(rest) > 0 && strings.ContainsRune(SpecialParams, rest[0]):
+		name, width = string(rest[0]), 1
+	default:
+		for width < len(rest) && isNameRune(rest[width], width == 0) {
+			width++
+		}
+		if width == 0 {
+			return nil
+		}
+		name = string(rest[:width])
+	}
+	if consume {
+		p.i += 1 + width
+	}
+	return &Param{Position: p.pos(start), Name: name}
+}
+
+// isDigits reports whether s is a positional parameter number, as in
+// ${10}.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (p *parser) index(from int, r rune) int {
+	for i := from; i < len(p.runes); i++ {
+		if p.runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *parser) unterminated(start int, quote rune) *SyntaxError {
+	err := p.errorAt(start, p.tokenAt(start),
+		fmt.Sprintf("missing closing %c", quote), fmt.Sprintf("a closing %c for this one", quote),
+		fmt.Sprintf("add a %c at the end of the quoted text", quote))
+	err.Incomplete = true
+	// An apostrophe inside a word (don't, it's) was most likely not meant
+	// to open a quote at all.
+	runes := p.runes
+	if quote == '\'' && start > 0 && unicode.IsLetter(runes[start-1]) &&
+		start+1 < len(runes) && unicode.IsLetter(runes[start+1]) {
+		word := p.tokenAt(start)
+		err.Hint = fmt.Sprintf("to use an apostrophe, write %s or %q", strings.Replace(word, "'", "\\'", 1), word)
+	}
+	return err
+}
+
+// tokenAt returns the whitespace-delimited word containing position i.
+func (p *parser) tokenAt(i int) string {
+	start, end := i, i
+	for start > 0 && !unicode.IsSpace(p.runes[start-1]) {
+		start--
+	}
+	for end < len(p.runes) && !unicode.IsSpace(p.runes[end]) {
+		end++
+	}
+	return string(p.runes[start:end])
+}
+
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameRune(r, i == 0) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isNameRune(r rune, first bool) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (!first && r >= '0' && r <= '9')
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// show writes a list in a compact form that makes its shape plain: each
+// command in parentheses, each word in brackets, quoted text in single
+// quotes and parameters as $NAME, "$NAME" when quoted.
+func show(list *List) string {
+	var stmts []string
+	for _, stmt := range list.Stmts {
+		var b strings.Builder
+		for i, pipeline := range stmt.AndOr.Pipelines {
+			if i > 0 {
+				fmt.Fprintf(&b, " %s ", stmt.AndOr.Ops[i-1])
+			}
+			switch {
+			case pipeline.TimePOSIX:
+				b.WriteString("time -p ")
+			case pipeline.Timed:
+				b.WriteString("time ")
+			}
+			if pipeline.Negated {
+				b.WriteString("! ")
+			}
+			for j, cmd := range pipeline.Commands {
+				if j > 0 {
+					b.WriteString(" | ")
+				}
+				b.WriteString(showCommand(cmd))
+			}
+		}
+		if stmt.Background {
+			b.WriteString(" &")
+		}
+		stmts = append(stmts, b.String())
+	}
+	return strings.Join(stmts, "; ")
+}
+
+func showCommand(cmd *Command) string {
+	var items []string
+	for _, a := range cmd.Assignments {
+		items = append(items, a.Name+"="+showWord(a.Value))
+	}
+	for _, w := range cmd.Words {
+		items = append(items, showWord(w))
+	}
+	for _, r := range cmd.Redirects {
+		fd := ""
+		if r.Fd >= 0 {
+			fd = fmt.Sprint(r.Fd)
+		}
+		items = append(items, fd+r.Op+showWord(r.Target))
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
+func showWord(w *Word) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *Lit:
+			if part.Quoted {
+				fmt.Fprintf(&b, "'%s'", part.Value)
+			} else {
+				b.WriteString(part.Value)
+			}
+		case *Param:
+			if part.Quoted {
+				fmt.Fprintf(&b, `"$%s"`, part.Name)
+			} else {
+				b.WriteString("$" + part.Name)
+			}
+		}
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func TestParseShapes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"ls", "([ls])"},
+		{"  ls   -l  ", "([ls] [-l])"},
+		{"a; b & c", "([a]); ([b]) &; ([c])"},
+		{"a\nb", "([a]); ([b])"},
+		{"a && b || c", "([a]) && ([b]) || ([c])"},
+		{"a | b | c", "([a]) | ([b]) | ([c])"},
+		{"a &&\n b", "([a]) && ([b])"},
+		{"! a | b", "! ([a]) | ([b])"},
+		{"time a", "time ([a])"},
+		{"time -p a", "time -p ([a])"},
+		{"echo time", "([echo] [time])"},
+		{"FOO=1 BAR= make", "(FOO=[1] BAR=[] [make])"},
+		{"make FOO=1", "([make] [FOO=1])"},
+		{"FOO=1", "(FOO=[1])"},
+		{"a >out 2>>log <in", "([a] >[out] 2>>[log] <[in])"},
+		{"a 2>&1 >|f 3<>g", "([a] 2>&[1] >|[f] 3<>[g])"},
+		{"a 10>f", "([a] 10>[f])"},
+		{"echo 'a b' \"c d\"", "([echo] ['a b'] ['c d'])"},
+		{`echo a\ b \$x`, "([echo] [a' 'b] ['$'x])"},
+		{`echo a"b"c`, "([echo] [a'b'c])"},
+		{`echo $x ${y}z $? $1`, "([echo] [$x] [$yz] [$?] [$1])"},
+		{`echo "a $x b" "$@"`, `([echo] ['a '"$x"' b'] ["$@"])`},
+		{`echo "\$x \" \a"`, `([echo] ['$x " \a'])`},
+		{"echo $ a$", "([echo] [$] [a$])"},
+		{"echo a # comment", "([echo] [a])"},
+		{"echo a\\\nb", "([echo] [ab])"},
+	}
+	for _, tt := range tests {
+		list, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := show(list); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	tests := []struct {
+		input string
+		node  func(*List) Node
+		want  Pos
+	}{
+		{"ls", func(l *List) Node { return l.Stmts[0] }, Pos{0, 1, 1}},
+		{"  ls", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[0] }, Pos{2, 1, 3}},
+		{"a; b", func(l *List) Node { return l.Stmts[1] }, Pos{3, 1, 4}},
+		{"a && b", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[1] }, Pos{5, 1, 6}},
+		{"a | b", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[1] }, Pos{4, 1, 5}},
+		{"echo a\n  b c", func(l *List) Node { return l.Stmts[1].AndOr.Pipelines[0].Commands[0].Words[1] }, Pos{11, 2, 5}},
+		{"X=1 a", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[0].Assignments[0] }, Pos{0, 1, 1}},
+		{"a 2>f", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[0].Redirects[0] }, Pos{2, 1, 3}},
+		{"a 2>f", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[0].Redirects[0].Target }, Pos{4, 1, 5}},
+		{`a x"$y"`, func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[0].Words[1].Parts[1] }, Pos{4, 1, 5}},
+		// Columns count characters, offsets bytes.
+		{"echo é b", func(l *List) Node { return l.Stmts[0].AndOr.Pipelines[0].Commands[0].Words[2] }, Pos{8, 1, 8}},
+	}
+	for _, tt := range tests {
+		list, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := tt.node(list).Pos(); got != tt.want {
+			t.Errorf("Parse(%q): position %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		pos        Pos
+		incomplete bool
+	}{
+		{`echo "x`, Pos{5, 1, 6}, true},
+		{"echo 'x", Pos{5, 1, 6}, true},
+		{"a &&", Pos{2, 1, 3}, true},
+		{"a |", Pos{2, 1, 3}, true},
+		{"a ;; b", Pos{3, 1, 4}, false},
+		{"| a", Pos{0, 1, 1}, false},
+		{"a >", Pos{2, 1, 3}, false},
+		{"a\n&& b", Pos{2, 2, 1}, false},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) = %v, want a syntax error", tt.input, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || syntaxErr.Incomplete != tt.incomplete {
+			t.Errorf("Parse(%q): error at %+v, incomplete %v, want %+v, %v",
+				tt.input, syntaxErr.Pos, syntaxErr.Incomplete, tt.pos, tt.incomplete)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+-- Copy to ~/.config/myshell/scripts to show the current directory in the prompt,
+-- complete a few git subcommands and remember the last failing command.
+
+myshell.prompt(function()
+  return myshell.cwd():match("[^/]*$") .. " "
+end)
+
+myshell.complete("git", function(word, args)
+  return {"add", "checkout", "commit", "diff", "log", "pull", "push", "status"}
+end)
+
+myshell.on("postCommand", function(command, status, seconds)
+  if status ~= 0 then
+    myshell.setvar("LAST_FAILED", command)
+  end
+end)
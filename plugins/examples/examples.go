@@ -3,9 +3,12 @@ package main
 import (
 	"fmt"
 	"shell/internal/plugin"
+	"time"
 )
 
-type ExamplePlugin struct{}
+type ExamplePlugin struct {
+	api plugin.ShellAPI
+}
 
 func (p *ExamplePlugin) Name() string {
 	return "example"
@@ -16,4 +19,26 @@ func (p *ExamplePlugin) Execute(args []string) error {
 	return nil
 }
 
+func (p *ExamplePlugin) Init(api plugin.ShellAPI) error {
+	p.api = api
+	return api.RegisterBuiltin("hello", func(args []string) error {
+		fmt.Println("Hello from the example plugin!")
+		return nil
+	})
+}
+
+func (p *ExamplePlugin) OnPostCommand(cmd string, exitCode int, duration time.Duration) {
+	p.api.SetVar("CMD_DURATION", duration.String())
+	if duration > 5*time.Second {
+		fmt.Printf("%q took %s (exit %d)\n", cmd, duration.Round(time.Millisecond), exitCode)
+	}
+}
+
+func (p *ExamplePlugin) OnExit(session plugin.Session) {
+	fmt.Printf("Session lasted %s, %d commands, ended in %s\n",
+		session.Duration.Round(time.Second), session.CommandCount, session.LastDir)
+}
+
 var Plugin ExamplePlugin
+
+func main() {}
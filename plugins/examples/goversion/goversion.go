@@ -0,0 +1,87 @@
+// The goversion plugin switches to the Go version a .go-version file, or
+// the toolchain line of a go.mod, asks for, in its directory and below,
+// among those installed in ~/sdk by golang.org/dl.
+//
+//	go build -buildmode=plugin -o ~/.config/myshell/plugins/goversion.so ./plugins/examples/goversion
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"shell/internal/plugin"
+)
+
+type GoVersionPlugin struct{}
+
+func (GoVersionPlugin) Name() string {
+	return "goversion"
+}
+
+// Execute shows the Go version in use.
+func (GoVersionPlugin) Execute(args []string) error {
+	if root := os.Getenv("GOROOT"); root != "" {
+		fmt.Println(filepath.Base(root))
+	} else {
+		fmt.Println("no Go version set here")
+	}
+	return nil
+}
+
+// Environment sets GOROOT to the version asked for and puts its bin
+// directory first on PATH.
+func (GoVersionPlugin) Environment(dir string) (map[string]string, error) {
+	version, from, err := wantedVersion(dir)
+	if err != nil || version == "" {
+		return nil, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(home, "sdk", version)
+	if _, err := os.Stat(filepath.Join(root, "bin")); err != nil {
+		return nil, fmt.Errorf("%s, from %s, is not installed; go install golang.org/dl/%[1]s@latest && %[1]s download installs it", version, from)
+	}
+	return map[string]string{
+		"GOROOT": root,
+		"PATH":   filepath.Join(root, "bin") + string(os.PathListSeparator) + os.Getenv("PATH"),
+	}, nil
+}
+
+// wantedVersion finds the nearest .go-version or go.mod with a toolchain
+// line, and returns the version it names, as go1.22.2, and the file.
+func wantedVersion(dir string) (string, string, error) {
+	for {
+		path := filepath.Join(dir, ".go-version")
+		if data, err := os.ReadFile(path); err == nil {
+			return "go" + strings.TrimPrefix(strings.TrimSpace(string(data)), "go"), path, nil
+		}
+		path = filepath.Join(dir, "go.mod")
+		if f, err := os.Open(path); err == nil {
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if version, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "toolchain "); ok {
+					return strings.TrimSpace(version), path, nil
+				}
+			}
+			// A module without a toolchain line uses the default Go.
+			return "", "", scanner.Err()
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+var _ plugin.EnvProvider = GoVersionPlugin{}
+
+var Plugin GoVersionPlugin
+
+func main() {}
@@ -0,0 +1,105 @@
+// The nvm plugin switches to the Node version an .nvmrc file asks for,
+// in its directory and below, among those nvm installed.
+//
+//	go build -buildmode=plugin -o ~/.config/myshell/plugins/nvm.so ./plugins/examples/nvm
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"shell/internal/plugin"
+)
+
+type NvmPlugin struct{}
+
+func (NvmPlugin) Name() string {
+	return "nvm"
+}
+
+// Execute shows the Node version in use.
+func (NvmPlugin) Execute(args []string) error {
+	if bin := os.Getenv("NVM_BIN"); bin != "" {
+		fmt.Println(filepath.Base(filepath.Dir(bin)))
+	} else {
+		fmt.Println("no .nvmrc applies")
+	}
+	return nil
+}
+
+// Environment puts the bin directory of the newest installed version
+// matching .nvmrc, such as 18 or v18.17, first on PATH.
+func (NvmPlugin) Environment(dir string) (map[string]string, error) {
+	rc, ok := findUp(dir, ".nvmrc")
+	if !ok {
+		return nil, nil
+	}
+	data, err := os.ReadFile(rc)
+	if err != nil {
+		return nil, err
+	}
+	want := strings.TrimPrefix(strings.TrimSpace(string(data)), "v")
+
+	nvmDir := os.Getenv("NVM_DIR")
+	if nvmDir == "" {
+		home, _ := os.UserHomeDir()
+		nvmDir = filepath.Join(home, ".nvm")
+	}
+	entries, _ := os.ReadDir(filepath.Join(nvmDir, "versions", "node"))
+	var found []string
+	for _, entry := range entries {
+		v := strings.TrimPrefix(entry.Name(), "v")
+		if v == want || strings.HasPrefix(v, want+".") {
+			found = append(found, entry.Name())
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("node %s, from %s, is not installed; nvm install %s installs it", want, rc, want)
+	}
+	newest := slices.MaxFunc(found, compareVersions)
+	bin := filepath.Join(nvmDir, "versions", "node", newest, "bin")
+	return map[string]string{
+		"NVM_BIN": bin,
+		"PATH":    bin + string(os.PathListSeparator) + os.Getenv("PATH"),
+	}, nil
+}
+
+// compareVersions orders versions such as v18.9.0 and v18.17.1 by number.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		if c := cmp.Compare(an, bn); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+// findUp returns the file name in dir or the nearest directory above it.
+func findUp(dir, name string) (string, bool) {
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+var _ plugin.EnvProvider = NvmPlugin{}
+
+var Plugin NvmPlugin
+
+func main() {}
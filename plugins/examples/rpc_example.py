@@ -0,0 +1,53 @@
+#!/usr/bin/env python3
+"""Example process plugin for myshell.
+
+Copy (or symlink) this file into the plugins directory and make it
+executable. It adds a `greet` builtin and counts failed commands.
+"""
+import json
+import sys
+
+failures = 0
+next_id = 0
+
+
+def send(msg):
+    msg["jsonrpc"] = "2.0"
+    sys.stdout.write(json.dumps(msg) + "\n")
+    sys.stdout.flush()
+
+
+def call(method, **params):
+    """Call back into the shell while one of its requests is pending."""
+    global next_id
+    next_id += 1
+    send({"id": next_id, "method": method, "params": params})
+    reply = json.loads(sys.stdin.readline())
+    return reply.get("result")
+
+
+def handle(method, params):
+    global failures
+    if method == "initialize":
+        return {"name": "rpc-example", "builtins": ["greet"], "hooks": ["postCommand"]}
+    if method == "builtin" and params["name"] == "greet":
+        who = " ".join(params["args"]) or call("getenv", name="USER") or "there"
+        return {"exitCode": 0, "stdout": "Hello, %s!\n" % who}
+    if method == "execute":
+        return {"exitCode": 0, "stdout": "%d failed commands so far\n" % failures}
+    if method == "postCommand":
+        if params["exitCode"] != 0:
+            failures += 1
+            call("setVar", name="FAILED_COMMANDS", value=str(failures))
+        return None
+    if method == "shutdown":
+        return None
+    raise ValueError("unknown method " + method)
+
+
+for line in sys.stdin:
+    request = json.loads(line)
+    try:
+        send({"id": request["id"], "result": handle(request["method"], request.get("params") or {})})
+    except Exception as e:
+        send({"id": request["id"], "error": {"code": -32603, "message": str(e)}})
@@ -0,0 +1,56 @@
+// The venv plugin activates the Python virtualenv of the project a
+// directory is in: a .venv or venv directory in it or one above it.
+//
+//	go build -buildmode=plugin -o ~/.config/myshell/plugins/venv.so ./plugins/examples/venv
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"shell/internal/plugin"
+)
+
+type VenvPlugin struct{}
+
+func (VenvPlugin) Name() string {
+	return "venv"
+}
+
+// Execute shows the virtualenv active.
+func (VenvPlugin) Execute(args []string) error {
+	if env := os.Getenv("VIRTUAL_ENV"); env != "" {
+		fmt.Println(env)
+	} else {
+		fmt.Println("no virtualenv")
+	}
+	return nil
+}
+
+// Environment puts the virtualenv's bin directory first on PATH and sets
+// VIRTUAL_ENV, as its activate script does.
+func (VenvPlugin) Environment(dir string) (map[string]string, error) {
+	for {
+		for _, name := range []string{".venv", "venv"} {
+			venv := filepath.Join(dir, name)
+			if _, err := os.Stat(filepath.Join(venv, "bin", "activate")); err == nil {
+				return map[string]string{
+					"VIRTUAL_ENV": venv,
+					"PATH":        filepath.Join(venv, "bin") + string(os.PathListSeparator) + os.Getenv("PATH"),
+				}, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+var _ plugin.EnvProvider = VenvPlugin{}
+
+var Plugin VenvPlugin
+
+func main() {}
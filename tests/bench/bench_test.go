@@ -0,0 +1,177 @@
+// Package bench measures the parts of the shell that run on every line
+// typed: tokenizing and parsing, expansion, drawing the prompt and the
+// history. Run the benchmarks with
+//
+//	go test -bench . -benchmem ./tests/bench
+//
+// and compare runs before and after a change with benchstat.
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shell/internal/config"
+	"shell/internal/history"
+	"shell/internal/shell"
+	"shell/pkg/parser"
+)
+
+// lines are typical command lines, from the trivial to the long.
+var lines = []string{
+	"ls",
+	"cd ~/src/project && git status",
+	`FOO=1 make -j4 2>build.log && ./run --verbose "$HOME/out dir" | tee out; echo done &`,
+	`grep -rn 'func main' . | sort | uniq -c | head -n 20 > /tmp/mains.txt || exit 1`,
+	strings.Repeat(`echo "$USER ${PATH}" 'quoted text' \$escaped a\ b; `, 20),
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, line := range lines {
+		b.Run(fmt.Sprintf("%dB", len(line)), func(b *testing.B) {
+			b.SetBytes(int64(len(line)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := parser.Parse(line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newShell starts a shell with the default config, changed by configure,
+// in a home directory of its own.
+func newShell(b *testing.B, configure func(*config.Config)) *shell.Shell {
+	b.Helper()
+	b.Setenv("HOME", b.TempDir())
+	cfg, err := config.Default()
+	if err != nil {
+		b.Fatal(err)
+	}
+	configure(cfg)
+	sh, err := shell.New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return sh
+}
+
+func BenchmarkExpand(b *testing.B) {
+	sh := newShell(b, func(*config.Config) {})
+	dir := b.TempDir()
+	for i := 0; i < 100; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.go", i)), nil, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	inputs := map[string]string{
+		"literal": "echo one two three four five",
+		"params":  `echo $HOME "$PATH" ${USER}x "$@" $?`,
+		"split":   "echo $PATH $PATH $PATH",
+		"glob":    "echo " + dir + "/*.go " + dir + "/file1?.go",
+	}
+	for name, input := range inputs {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := sh.Expand(input); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPrompt(b *testing.B) {
+	configs := map[string]func(*config.Config){
+		"default": func(*config.Config) {},
+		"format": func(cfg *config.Config) {
+			cfg.Prompt = "{user}@{host} {dir} {status} > "
+		},
+		"powerline": func(cfg *config.Config) {
+			cfg.Theme = "powerline"
+		},
+	}
+	for name, configure := range configs {
+		b.Run(name, func(b *testing.B) {
+			sh := newShell(b, configure)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sh.Prompt()
+			}
+		})
+	}
+}
+
+// writeHistory writes a history file of n entries and returns its path.
+func writeHistory(b *testing.B, n int) string {
+	b.Helper()
+	file := filepath.Join(b.TempDir(), "history")
+	h, err := history.NewFile(file, history.Options{Size: n, Sync: history.SyncExit})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		h.Add(lines[i%len(lines)] + fmt.Sprint(" #", i))
+		h.Finish(i%7, 0)
+	}
+	if err := h.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return file
+}
+
+func BenchmarkHistoryAdd(b *testing.B) {
+	for _, sync := range []string{history.SyncWrite, history.SyncExit} {
+		b.Run(sync, func(b *testing.B) {
+			h, err := history.NewFile(filepath.Join(b.TempDir(), "history"), history.Options{Sync: sync})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer h.Close()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.Add(fmt.Sprint("echo ", i))
+				h.Finish(0, 0)
+			}
+		})
+	}
+}
+
+func BenchmarkHistoryLoad(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		file := writeHistory(b, n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h, err := history.NewFile(file, history.Options{Size: n})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if got := len(h.GetAll()); got != n {
+					b.Fatalf("loaded %d entries, want %d", got, n)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHistoryQuery(b *testing.B) {
+	const n = 100000
+	h, err := history.NewFile(writeHistory(b, n), history.Options{Size: n})
+	if err != nil {
+		b.Fatal(err)
+	}
+	h.GetAll()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.Query(history.Query{Failed: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
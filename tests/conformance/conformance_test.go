@@ -0,0 +1,222 @@
+// Package conformance runs the POSIX sh snippets in testdata/corpus with
+// myshell and with /bin/sh, and compares what they print and the status
+// they exit with. The share of snippets myshell gets right is its
+// compatibility score, which
+//
+//	go test ./tests/conformance -v
+//
+// reports, along with how each snippet it gets wrong differs.
+//
+// The snippets known to pass are listed in testdata/passing, and the test
+// fails when one of them stops passing. When more pass, run
+// go test ./tests/conformance -update to add them to the list.
+//
+// A corpus file holds snippets, each under a line "#### title"; what
+// comes before the first is a comment. Each snippet runs as a script of
+// its own, in an empty directory that is also $HOME.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "write the snippets that pass now into testdata/passing")
+
+// sh is the shell myshell is compared with.
+const sh = "/bin/sh"
+
+// myshell is the binary under test, built once for all the tests.
+var myshell string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	dir, err := os.MkdirTemp("", "myshell-conformance")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	myshell = filepath.Join(dir, "myshell")
+	build := exec.Command("go", "build", "-o", myshell, "shell/cmd/myshell")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "building myshell: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	status := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(status)
+}
+
+func TestConformance(t *testing.T) {
+	if _, err := os.Stat(sh); err != nil {
+		t.Skipf("no %s to compare with", sh)
+	}
+	snippets, err := readCorpus(filepath.Join("testdata", "corpus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := readPassing(filepath.Join("testdata", "passing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var ran int
+	var passing []string
+	t.Run("snippets", func(t *testing.T) {
+		for _, sn := range snippets {
+			t.Run(sn.name, func(t *testing.T) {
+				t.Parallel()
+				want, got := run(t, sh, sn.script), run(t, myshell, sn.script)
+				pass := got == want
+				mu.Lock()
+				ran++
+				if pass {
+					passing = append(passing, sn.name)
+				}
+				mu.Unlock()
+				switch {
+				case pass:
+					if !known[sn.name] && !*update {
+						t.Logf("passes now; run the test with -update to keep it passing")
+					}
+				case known[sn.name]:
+					t.Errorf("no longer matches %s:\n%s", sh, diff(want, got))
+				default:
+					t.Logf("differs from %s:\n%s", sh, diff(want, got))
+				}
+			})
+		}
+	})
+
+	sort.Strings(passing)
+	if ran > 0 {
+		t.Logf("compatibility with %s: %d of %d snippets (%.0f%%)",
+			sh, len(passing), ran, 100*float64(len(passing))/float64(ran))
+	}
+	if *update && ran == len(snippets) {
+		data := strings.Join(passing, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join("testdata", "passing"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// snippet is a script from the corpus, named by its file and title.
+type snippet struct {
+	name   string
+	script string
+}
+
+func readCorpus(dir string) ([]snippet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sh"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no snippets in %s", dir)
+	}
+	var snippets []snippet
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		prefix := strings.TrimSuffix(filepath.Base(file), ".sh") + "/"
+		var current *snippet
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if title, ok := strings.CutPrefix(line, "#### "); ok {
+				snippets = append(snippets, snippet{name: prefix + strings.TrimSpace(title)})
+				current = &snippets[len(snippets)-1]
+				continue
+			}
+			if current != nil {
+				current.script += line
+			}
+		}
+	}
+	return snippets, nil
+}
+
+// readPassing reads the names of the snippets known to pass.
+func readPassing(file string) (map[string]bool, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, name := range strings.Split(string(data), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			known[name] = true
+		}
+	}
+	return known, nil
+}
+
+// result is what running a snippet printed and the status it exited with.
+type result struct {
+	stdout string
+	status int
+}
+
+// run runs script with shell, in an empty directory that is also $HOME.
+func run(t *testing.T, shell, script string) result {
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(file, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, shell, file)
+	cmd.Dir = dir
+	cmd.Env = []string{"HOME=" + dir, "PATH=" + os.Getenv("PATH"), "LANG=C", "LC_ALL=C"}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return result{stdout: stdout.String(), status: -1}
+	case errors.As(err, &exit):
+		return result{stdout: stdout.String(), status: exit.ExitCode()}
+	case err != nil:
+		t.Fatalf("running %s: %v", shell, err)
+	}
+	return result{stdout: stdout.String()}
+}
+
+// diff shows how got differs from want.
+func diff(want, got result) string {
+	var b strings.Builder
+	if want.stdout != got.stdout {
+		fmt.Fprintf(&b, "output:\n%s\nwant:\n%s\n", indent(got.stdout), indent(want.stdout))
+	}
+	if want.status != got.status {
+		fmt.Fprintf(&b, "exit status %d, want %d\n", got.status, want.status)
+	}
+	return b.String()
+}
+
+func indent(text string) string {
+	if text == "" {
+		return "\t(nothing)"
+	}
+	return "\t" + strings.ReplaceAll(strings.TrimSuffix(text, "\n"), "\n", "\n\t")
+}
@@ -0,0 +1,67 @@
+# Builtins and exit statuses.
+
+#### true, false and colon
+true; echo $?
+false; echo $?
+:; echo $?
+
+#### test
+[ 1 -lt 2 ] && echo less
+[ abc = abc ] && echo equal
+[ -n "x" ] && echo nonempty
+test -z "" && echo empty
+
+#### test on files
+touch file
+[ -f file ] && echo file
+[ -d . ] && echo dir
+[ -e nosuch ] || echo missing
+
+#### printf
+printf '%s-%d\n' a 1 b 2
+
+#### printf star width and precision
+printf '[%*d] [%-*s] [%.*s]\n' 5 42 4 ab 2 abcdef
+
+#### printf octal escapes
+printf '\101\102|\12'
+
+#### read
+echo 'first second rest of it' | { read a b c; echo "$a|$b|$c"; }
+
+#### read backslashes
+printf '%s\n' 'a\\b c\ d' > in
+read x y < in
+printf '%s|%s\n' "$x" "$y"
+read -r x y < in
+printf '%s|%s\n' "$x" "$y"
+
+#### read line continuation
+printf '%s\n' 'one \' 'two  three  ' > in
+read x y < in
+echo "$x|$y"
+
+#### unset
+x=1
+unset x
+echo "[$x]"
+
+#### exit status of a script
+echo before
+exit 3
+echo after
+
+#### set -e stops at the first failure
+set -e
+echo start
+false
+echo not reached
+
+#### eval
+cmd='echo evaluated'
+eval "$cmd"
+
+#### cd and pwd
+mkdir -p sub/dir
+cd sub/dir
+basename "$(pwd)"
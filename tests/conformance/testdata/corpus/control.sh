@@ -0,0 +1,61 @@
+# Lists, conditionals, loops and functions.
+
+#### and and or lists
+true && echo yes
+false && echo no
+false || echo fallback
+
+#### negation
+! false && echo negated
+
+#### semicolons and newlines
+echo one; echo two
+echo three
+
+#### if
+if true; then echo then; else echo else; fi
+if false; then echo then; elif true; then echo elif; fi
+
+#### for
+for i in 1 2 3; do echo $i; done
+
+#### while
+i=0
+while [ $i -lt 3 ]; do i=$((i + 1)); echo $i; done
+
+#### until
+i=0
+until [ $i -ge 2 ]; do i=$((i + 1)); done
+echo $i
+
+#### case
+for word in apple banana cherry; do
+  case $word in
+    a*) echo "$word starts with a" ;;
+    b*|c*) echo "$word starts with b or c" ;;
+  esac
+done
+
+#### functions
+greet() { echo "hello, $1"; }
+greet world
+
+#### function return status
+check() { return 3; }
+check
+echo $?
+
+#### subshell
+x=outer
+(x=inner; echo $x)
+echo $x
+
+#### brace group
+{ echo a; echo b; } | wc -l | tr -d ' '
+
+#### pipelines
+printf 'b\na\nc\n' | sort | head -n 2
+
+#### pipeline status is the last command's
+false | true
+echo $?
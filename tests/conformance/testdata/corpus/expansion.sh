@@ -0,0 +1,28 @@
+# Command substitution, arithmetic, tilde and pathname expansion.
+
+#### command substitution
+echo "today is $(echo Monday)"
+
+#### backquotes
+echo `echo old style`
+
+#### nested command substitution
+echo $(echo $(echo nested))
+
+#### arithmetic
+echo $((1 + 2 * 3)) $(( (1 + 2) * 3 )) $((7 / 2)) $((7 % 3))
+
+#### arithmetic with variables
+n=5
+echo $((n * 2)) $(($n + 1))
+
+#### tilde
+[ ~ = "$HOME" ] && echo same
+
+#### globbing
+mkdir globdir && cd globdir && touch b.txt a.txt c.log
+echo *.txt
+echo ?.log
+
+#### a pattern matching nothing is kept
+echo *.nomatch
@@ -0,0 +1,54 @@
+# Parameters and their expansion.
+
+#### assignment and reference
+x=hello
+echo $x ${x}world
+
+#### unset variables are empty
+echo "[$nosuchvar]"
+
+#### positional parameters
+set -- one two three
+echo $# $1 $3
+
+#### shift
+set -- a b c
+shift
+echo $# "$1"
+
+#### quoted at keeps arguments apart
+set -- 'a b' c
+for arg in "$@"; do echo "<$arg>"; done
+
+#### star joins the arguments
+set -- a b c
+echo "$*"
+
+#### status of the last command
+false
+echo $?
+
+#### default values
+unset x
+echo ${x:-default} ${x-unset}
+
+#### assign a default
+unset x
+: ${x:=set}
+echo $x
+
+#### length
+x=hello
+echo ${#x}
+
+#### remove a suffix and a prefix
+f=archive.tar.gz
+echo ${f%.gz} ${f%%.*} ${f#*.} ${f##*.}
+
+#### export to commands
+export GREETING=hi
+sh -c 'echo $GREETING'
+
+#### assignment before a command
+X=1 sh -c 'echo $X'
+echo "[$X]"
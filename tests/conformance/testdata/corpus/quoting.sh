@@ -0,0 +1,28 @@
+# Quoting and word splitting.
+
+#### single quotes keep everything
+printf '%s\n' 'a  $HOME  "b"  \n'
+
+#### double quotes keep blanks
+x='1  2'
+echo "[$x]"
+
+#### unquoted values are split
+x='1  2   3'
+echo [$x]
+
+#### backslash escapes a blank
+echo a\ \ b
+
+#### backslash in double quotes
+echo "a\$b \"c\" \\ \x"
+
+#### quotes join into one word
+echo 'a'"b"c'd e'
+
+#### empty quotes make an empty argument
+set -- '' ""
+echo $#
+
+#### dollar at the end is literal
+echo a$ "b$"
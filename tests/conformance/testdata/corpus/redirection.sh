@@ -0,0 +1,38 @@
+# Redirections and here-documents.
+
+#### output to a file
+echo saved > out.txt
+cat out.txt
+
+#### append
+echo one > out.txt
+echo two >> out.txt
+cat out.txt
+
+#### input from a file
+echo content > in.txt
+tr a-z A-Z < in.txt
+
+#### standard error to standard output
+sh -c 'echo oops >&2' 2>&1
+
+#### discard errors
+ls /nosuchdir 2>/dev/null
+echo $?
+
+#### here-document
+cat <<EOF
+line one
+line two
+EOF
+
+#### here-document with expansion
+name=world
+cat <<EOF
+hello $name
+EOF
+
+#### quoted here-document delimiter
+cat <<'EOF'
+kept $name
+EOF
@@ -0,0 +1,155 @@
+// Package fuzz feeds the shell's parsers arbitrary text, as typed at the
+// keyboard, looking for input that makes them panic, hang or break their
+// own rules. Run a target for a while with
+//
+//	go test -fuzz FuzzParse -fuzztime 1m ./tests/fuzz
+//
+// Inputs that fail are saved under testdata/fuzz and run again by a plain
+// go test from then on, so check them in along with the fix.
+package fuzz
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"shell/internal/config"
+	"shell/internal/shell"
+	"shell/pkg/parser"
+)
+
+// seeds are command lines to start from, valid and not.
+var seeds = []string{
+	"",
+	"ls -l",
+	"FOO=1 make -j4 2>build.log && ./run | tee out; echo done &",
+	`echo "$HOME" '$HOME' \$HOME ${PATH}x "$@" $? $$ $#`,
+	"cat <in >>out 2>&1 3<>rw 4>&- >|clobber",
+	"! time -p false || true",
+	"echo 'unterminated",
+	`echo "unterminated`,
+	"ls |",
+	"&& ls",
+	"echo ${",
+	"echo a\\\nb",
+	"echo é ✓ \x00 \xff",
+	"echo */*.go [a-z]* ?",
+	"echo !! !$ !-2 !ec '!!' \\!!",
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		list, err := parser.Parse(input)
+		if err != nil {
+			var syntax *parser.SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("Parse(%q) returned %T, want *parser.SyntaxError", input, err)
+			}
+			checkPos(t, input, syntax.Pos)
+			_ = syntax.Error()
+			_ = syntax.Diagnostic()
+			return
+		}
+		for _, stmt := range list.Stmts {
+			checkPos(t, input, stmt.Position)
+			for _, pipeline := range stmt.AndOr.Pipelines {
+				for _, cmd := range pipeline.Commands {
+					checkPos(t, input, cmd.Position)
+					for _, word := range cmd.Words {
+						checkPos(t, input, word.Position)
+					}
+				}
+			}
+		}
+	})
+}
+
+// checkPos fails unless pos is a position in input.
+func checkPos(t *testing.T, input string, pos parser.Pos) {
+	t.Helper()
+	if pos.Offset < 0 || pos.Offset > len(input) || pos.Line < 1 || pos.Column < 1 {
+		t.Fatalf("position %+v out of range in %q", pos, input)
+	}
+	before := input[:pos.Offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	if pos.Line != line || pos.Column != column {
+		t.Fatalf("position %+v is line %d column %d in %q", pos, line, column, input)
+	}
+}
+
+// newShell starts a shell with the default config in a home and working
+// directory of its own, where globs find little.
+func newShell(f *testing.F) *shell.Shell {
+	f.Helper()
+	home := f.TempDir()
+	f.Setenv("HOME", home)
+	cfg, err := config.Default()
+	if err != nil {
+		f.Fatal(err)
+	}
+	cfg.Glob.MaxEntries = 1000
+	sh, err := shell.New(cfg)
+	if err != nil {
+		f.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		f.Fatal(err)
+	}
+	if err := sh.Execute("cd " + home); err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() { os.Chdir(wd) })
+	sh.SetArgs("myshell", []string{"one", "two words", ""})
+	return sh
+}
+
+func FuzzExpand(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	sh := newShell(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		sh.Expand(input)
+	})
+}
+
+func FuzzArith(f *testing.F) {
+	for _, seed := range []string{"", "1+2*3", "-(4 - 5) % 3", "x * y", "9223372036854775807 + 1", "1/0", "((1)", "n"} {
+		f.Add(seed)
+	}
+	sh := newShell(f)
+	if err := sh.Execute("x=6 y=x+1 n=n"); err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		sh.Arith(expr)
+	})
+}
+
+func FuzzExpandHistory(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	sh := newShell(f)
+	file := filepath.Join(f.TempDir(), "history")
+	if err := os.WriteFile(file, []byte("echo one two\nls\n \t\ngit commit -m 'x y'\n"), 0o644); err != nil {
+		f.Fatal(err)
+	}
+	if err := sh.Execute("history -r " + file); err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		expanded, changed, err := sh.ExpandHistory(line)
+		if err == nil && !changed && expanded != line {
+			t.Fatalf("ExpandHistory(%q) = %q but reports no change", line, expanded)
+		}
+	})
+}
@@ -0,0 +1,380 @@
+//go:build linux
+
+package tests
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// The REPL tests run myshell at a pseudo-terminal, type the input of each
+// file in testdata/repl at it and compare what the terminal then shows
+// with the output the file expects. A file is made of sections:
+//
+//	# What the test is about.
+//	-- config --
+//	prompt: "{status} $ "
+//	-- input --
+//	echo hello
+//	exit
+//	-- output --
+//	0 $ echo hello
+//	hello
+//	0 $ exit
+//
+// The config section is optional; without it the prompt is "$ ". Each
+// line of input is typed and followed by Enter, and the next is typed
+// once the prompt is back, or once nothing more has been written for a
+// moment while a command runs. Keys are written in braces, as {ctrl-c},
+// {tab}, {up} or {esc}, and a line ending in a key is not followed by
+// Enter. The session should end with exit.
+//
+// In the output, the home directory, where the shell starts, is shown as
+// $HOME, and the process ID of a job started in the background as PID.
+// Run go test ./tests -update to write the output the shell gives now
+// into the files.
+
+var update = flag.Bool("update", false, "write the output the shell gives into the golden files")
+
+// myshell is the binary under test, built once for all the tests.
+var myshell string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	dir, err := os.MkdirTemp("", "myshell-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	myshell = filepath.Join(dir, "myshell")
+	build := exec.Command("go", "build", "-o", myshell, "shell/cmd/myshell")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "building myshell: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	status := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(status)
+}
+
+func TestREPL(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "repl", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no tests in testdata/repl")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g, err := readGolden(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := runSession(t, g.config, g.input)
+			if *update {
+				g.output = got
+				if err := os.WriteFile(file, g.bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if got != g.output {
+				t.Errorf("%s: the terminal shows\n%s\nwant\n%s", file, got, g.output)
+			}
+		})
+	}
+}
+
+// golden is a test file: what it says about itself, and its sections.
+type golden struct {
+	comment               string
+	config, input, output string
+}
+
+func readGolden(file string) (*golden, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	g := &golden{}
+	var section *string = &g.comment
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "-- "); ok && strings.HasSuffix(name, " --") {
+			switch strings.TrimSuffix(name, " --") {
+			case "config":
+				section = &g.config
+			case "input":
+				section = &g.input
+			case "output":
+				section = &g.output
+			default:
+				return nil, fmt.Errorf("%s: unknown section %s", file, strings.TrimSpace(line))
+			}
+			continue
+		}
+		*section += line
+	}
+	if g.input == "" {
+		return nil, fmt.Errorf("%s: no input", file)
+	}
+	return g, nil
+}
+
+func (g *golden) bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString(g.comment)
+	if g.config != "" {
+		b.WriteString("-- config --\n" + g.config)
+	}
+	b.WriteString("-- input --\n" + g.input)
+	b.WriteString("-- output --\n" + g.output)
+	return b.Bytes()
+}
+
+// Marks in the shell's output. The working directory is reported once
+// before each prompt, and the end of the prompt each time it is drawn.
+const (
+	markDir       = "\x1b]7;"
+	markPromptEnd = "\x1b]133;B\a"
+)
+
+// settle is how long a command may write nothing before the next line
+// is typed while it runs.
+const settle = 300 * time.Millisecond
+
+// session is the shell running at a pseudo-terminal.
+type session struct {
+	t      *testing.T
+	master *os.File
+	cmd    *exec.Cmd
+
+	mu sync.Mutex
+	// out is everything the shell has written, and last when it last
+	// wrote.
+	out  []byte
+	last time.Time
+	// exited is closed when the shell has exited and its output been
+	// read.
+	exited chan struct{}
+}
+
+// runSession runs the shell with config, types input at it and returns
+// what the terminal shows by the time it has exited.
+func runSession(t *testing.T, config, input string) string {
+	home := t.TempDir()
+	if config == "" {
+		config = "prompt: \"$ \"\n"
+	}
+	configFile := filepath.Join(home, "config.yaml")
+	if err := os.WriteFile(configFile, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	master, slave, err := openPty()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	defer master.Close()
+	unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: 24, Col: 80})
+
+	cmd := exec.Command(myshell, "--config", configFile)
+	cmd.Dir = home
+	cmd.Env = []string{"HOME=" + home, "PATH=" + os.Getenv("PATH"), "TERM=xterm", "LANG=C.UTF-8", "USER=tester", "TZ=UTC"}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		slave.Close()
+		t.Fatal(err)
+	}
+	slave.Close()
+	s := &session{t: t, master: master, cmd: cmd, last: time.Now(), exited: make(chan struct{})}
+	go s.read()
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	s.waitPrompt(0)
+	for _, line := range strings.Split(strings.TrimSuffix(input, "\n"), "\n") {
+		keys, enter := parseKeys(line)
+		if enter {
+			keys += "\r"
+		}
+		prompts := s.count(markDir)
+		if _, err := master.WriteString(keys); err != nil {
+			t.Fatalf("typing %q: %v", line, err)
+		}
+		s.waitPrompt(prompts)
+	}
+	select {
+	case <-s.exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the shell did not exit at the end of the input")
+	}
+	cmd.Wait()
+	return normalize(s.screen(), home)
+}
+
+// read collects the shell's output until it exits.
+func (s *session) read() {
+	defer close(s.exited)
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.master.Read(buf)
+		s.mu.Lock()
+		s.out = append(s.out, buf[:n]...)
+		s.last = time.Now()
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// count returns how many times mark appears in the output so far.
+func (s *session) count(mark string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Count(s.out, []byte(mark))
+}
+
+// waitPrompt waits until the prompt after the first prompts has been
+// drawn, the output has settled while a command runs, or the shell has
+// exited.
+func (s *session) waitPrompt(prompts int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case <-s.exited:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		s.mu.Lock()
+		out, idle := s.out, time.Since(s.last)
+		s.mu.Unlock()
+		if i := nthIndex(out, markDir, prompts); i >= 0 && bytes.Contains(out[i:], []byte(markPromptEnd)) && idle > 20*time.Millisecond {
+			return
+		}
+		if idle > settle {
+			return
+		}
+	}
+	s.t.Fatalf("the shell is stuck; the terminal shows\n%s", s.screen())
+}
+
+// screen returns what the terminal shows.
+func (s *session) screen() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scr := newScreen(80)
+	scr.Write(s.out)
+	return scr.String()
+}
+
+// nthIndex returns the index of the nth occurrence of sep in data,
+// counting from 0, or -1.
+func nthIndex(data []byte, sep string, n int) int {
+	offset := 0
+	for ; n >= 0; n-- {
+		i := bytes.Index(data[offset:], []byte(sep))
+		if i < 0 {
+			return -1
+		}
+		if n == 0 {
+			return offset + i
+		}
+		offset += i + len(sep)
+	}
+	return -1
+}
+
+// keyCodes are what the keys written in braces send.
+var keyCodes = map[string]string{
+	"tab":   "\t",
+	"esc":   "\x1b",
+	"bs":    "\x7f",
+	"up":    "\x1b[A",
+	"down":  "\x1b[B",
+	"right": "\x1b[C",
+	"left":  "\x1b[D",
+}
+
+var keyPattern = regexp.MustCompile(`\{([a-z-]+)\}`)
+
+// parseKeys turns a line of input into what typing it sends, and
+// reports whether Enter should follow: it does unless it ends in a key.
+func parseKeys(line string) (string, bool) {
+	var keys strings.Builder
+	enter, start := true, 0
+	for _, loc := range keyPattern.FindAllStringSubmatchIndex(line, -1) {
+		code, ok := keyCode(line[loc[2]:loc[3]])
+		if !ok {
+			continue
+		}
+		keys.WriteString(line[start:loc[0]])
+		keys.WriteString(code)
+		start = loc[1]
+		enter = loc[1] < len(line)
+	}
+	keys.WriteString(line[start:])
+	return keys.String(), enter
+}
+
+// keyCode returns what the key named sends.
+func keyCode(name string) (string, bool) {
+	if letter, ok := strings.CutPrefix(name, "ctrl-"); ok {
+		if len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+			return "", false
+		}
+		return string(rune(letter[0] - 'a' + 1)), true
+	}
+	code, ok := keyCodes[name]
+	return code, ok
+}
+
+var jobPID = regexp.MustCompile(`(?m)^(\[\d+\]) \d+$`)
+
+// normalize replaces what changes from run to run in the output.
+func normalize(out, home string) string {
+	out = strings.ReplaceAll(out, home, "$HOME")
+	return jobPID.ReplaceAllString(out, "$1 PID")
+}
+
+// openPty opens a new pseudo-terminal, returning its two ends.
+func openPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err == nil {
+		// 0 unlocks the other end, so that it can be opened.
+		err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0)
+	}
+	if err == nil {
+		slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
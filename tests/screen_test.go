@@ -0,0 +1,174 @@
+//go:build linux
+
+package tests
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// screen is as much of a terminal as the shell's output needs to come out
+// as it would be seen: text, the cursor movements and erasing the line
+// editor does, and nothing of colors, titles or other escape sequences.
+// Lines never scroll off, so that the screen holds the whole session.
+type screen struct {
+	width    int
+	lines    [][]rune
+	row, col int
+	// pending is an escape sequence not yet complete.
+	pending []byte
+}
+
+func newScreen(width int) *screen {
+	return &screen{width: width, lines: [][]rune{nil}}
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	data := append(s.pending, p...)
+	s.pending = nil
+	for len(data) > 0 {
+		if data[0] == '\x1b' {
+			n := escapeLen(data)
+			if n == 0 {
+				s.pending = append([]byte(nil), data...)
+				break
+			}
+			s.escape(data[:n])
+			data = data[n:]
+			continue
+		}
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && !utf8.FullRune(data) {
+			s.pending = append([]byte(nil), data...)
+			break
+		}
+		s.put(r)
+		data = data[size:]
+	}
+	return len(p), nil
+}
+
+// escapeLen returns the length of the escape sequence data starts with,
+// or 0 if it is not complete.
+func escapeLen(data []byte) int {
+	if len(data) < 2 {
+		return 0
+	}
+	switch data[1] {
+	case '[':
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return 0
+	case ']':
+		// An OSC sequence ends with BEL or ESC \.
+		for i := 2; i < len(data); i++ {
+			if data[i] == '\a' {
+				return i + 1
+			}
+			if data[i] == '\x1b' && i+1 < len(data) {
+				return i + 2
+			}
+		}
+		return 0
+	}
+	return 2
+}
+
+// escape carries out a CSI sequence that moves the cursor or erases.
+func (s *screen) escape(seq []byte) {
+	if seq[1] != '[' {
+		return
+	}
+	params, final := string(seq[2:len(seq)-1]), seq[len(seq)-1]
+	if strings.HasPrefix(params, "?") {
+		return
+	}
+	n, err := strconv.Atoi(params)
+	if err != nil {
+		n = 0
+	}
+	count := max(n, 1)
+	switch final {
+	case 'A':
+		s.row = max(s.row-count, 0)
+	case 'B':
+		s.row += count
+		s.grow()
+	case 'C':
+		s.col = min(s.col+count, s.width-1)
+	case 'D':
+		s.col = max(s.col-count, 0)
+	case 'G':
+		s.col = min(count-1, s.width-1)
+	case 'K':
+		line := s.lines[s.row]
+		switch n {
+		case 0:
+			s.lines[s.row] = line[:min(s.col, len(line))]
+		case 1:
+			for i := 0; i < min(s.col+1, len(line)); i++ {
+				line[i] = ' '
+			}
+		case 2:
+			s.lines[s.row] = nil
+		}
+	case 'J':
+		if n == 0 {
+			s.lines[s.row] = s.lines[s.row][:min(s.col, len(s.lines[s.row]))]
+			s.lines = s.lines[:s.row+1]
+		}
+	}
+}
+
+func (s *screen) put(r rune) {
+	switch r {
+	case '\r':
+		s.col = 0
+	case '\n':
+		s.row++
+		s.grow()
+	case '\b':
+		s.col = max(s.col-1, 0)
+	case '\t':
+		s.col = min((s.col/8+1)*8, s.width-1)
+	default:
+		if r < ' ' || r == 0x7f {
+			return
+		}
+		if s.col >= s.width {
+			s.row++
+			s.col = 0
+			s.grow()
+		}
+		line := s.lines[s.row]
+		for len(line) <= s.col {
+			line = append(line, ' ')
+		}
+		line[s.col] = r
+		s.lines[s.row] = line
+		s.col++
+	}
+}
+
+func (s *screen) grow() {
+	for len(s.lines) <= s.row {
+		s.lines = append(s.lines, nil)
+	}
+}
+
+// String returns the lines on the screen, without the blanks that end
+// them or the empty lines at the bottom.
+func (s *screen) String() string {
+	var lines []string
+	for _, line := range s.lines {
+		lines = append(lines, strings.TrimRight(string(line), " "))
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -1,13 +1,18 @@
 package tests
 
 import (
+	"testing"
+
 	"shell/internal/config"
 	"shell/internal/shell"
-	"testing"
 )
 
 func TestShellInitialization(t *testing.T) {
-	cfg := &config.Config{}
+	t.Setenv("HOME", t.TempDir())
+	cfg, err := config.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
 	sh, err := shell.New(cfg)
 	if err != nil {
 		t.Fatalf("Failed to initialize shell: %v", err)